@@ -0,0 +1,73 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// AppLinksConfig regroupe ce qui sert aux liens de partage : liens vers les stores, site web de repli
+// et identifiants des applications pour les liens universels (iOS) et App Links (Android)
+type AppLinksConfig struct {
+	AndroidPackage      string   // ANDROID_PACKAGE_NAME
+	AndroidFingerprints []string // ANDROID_CERT_FINGERPRINTS (empreintes SHA-256 séparées par des virgules)
+	AndroidStoreURL     string   // ANDROID_STORE_URL (par défaut la fiche Google Play du package)
+	IOSAppID            string   // IOS_APP_ID (TEAMID.bundle.id)
+	IOSAppStoreID       string   // IOS_APP_STORE_ID (identifiant numérique de l'App Store)
+	IOSStoreURL         string   // IOS_STORE_URL (par défaut la fiche App Store de IOS_APP_STORE_ID)
+	WebBaseURL          string   // WEB_BASE_URL (par défaut FRONTEND_URL)
+	AppScheme           string   // APP_URL_SCHEME (schéma des deep links de l'application)
+	APIPublicURL        string   // API_PUBLIC_URL (URL publique de l'API, base des liens de partage)
+}
+
+// AppLinks est la configuration chargée par InitAppLinks
+var AppLinks = &AppLinksConfig{}
+
+// InitAppLinks lit la configuration des liens de partage depuis l'environnement
+func InitAppLinks() {
+	AppLinks = &AppLinksConfig{
+		AndroidPackage:  envOrDefault("ANDROID_PACKAGE_NAME", "bj.kivendie.app"),
+		AndroidStoreURL: os.Getenv("ANDROID_STORE_URL"),
+		IOSAppID:        os.Getenv("IOS_APP_ID"),
+		IOSAppStoreID:   strings.TrimPrefix(os.Getenv("IOS_APP_STORE_ID"), "id"),
+		IOSStoreURL:     os.Getenv("IOS_STORE_URL"),
+		WebBaseURL:      strings.TrimRight(envOrDefault("WEB_BASE_URL", envOrDefault("FRONTEND_URL", "https://kivendi.com")), "/"),
+		AppScheme:       envOrDefault("APP_URL_SCHEME", "kivendi"),
+		APIPublicURL:    strings.TrimRight(os.Getenv("API_PUBLIC_URL"), "/"),
+	}
+	for _, fingerprint := range strings.Split(os.Getenv("ANDROID_CERT_FINGERPRINTS"), ",") {
+		if fingerprint = strings.ToUpper(strings.TrimSpace(fingerprint)); fingerprint != "" {
+			AppLinks.AndroidFingerprints = append(AppLinks.AndroidFingerprints, fingerprint)
+		}
+	}
+
+	if AppLinks.AndroidStoreURL == "" {
+		AppLinks.AndroidStoreURL = "https://play.google.com/store/apps/details?id=" + AppLinks.AndroidPackage
+	}
+	if AppLinks.IOSStoreURL == "" && AppLinks.IOSAppStoreID != "" {
+		AppLinks.IOSStoreURL = "https://apps.apple.com/app/id" + AppLinks.IOSAppStoreID
+	}
+
+	if AppLinks.APIPublicURL == "" {
+		port := envOrDefault("PORT", "8080")
+		AppLinks.APIPublicURL = "http://localhost:" + port
+		log.Printf("⚠️  API_PUBLIC_URL non défini : les liens de partage utiliseront %s", AppLinks.APIPublicURL)
+	}
+	if AppLinks.IOSStoreURL == "" {
+		log.Println("⚠️  IOS_APP_STORE_ID / IOS_STORE_URL non définis : le lien App Store ne sera pas proposé")
+	}
+	if AppLinks.IOSAppID == "" {
+		log.Println("⚠️  IOS_APP_ID non défini : /.well-known/apple-app-site-association ne sera pas servi")
+	}
+	if len(AppLinks.AndroidFingerprints) == 0 {
+		log.Println("⚠️  ANDROID_CERT_FINGERPRINTS non défini : /.well-known/assetlinks.json ne sera pas servi")
+	}
+}
+
+// envOrDefault renvoie la variable d'environnement key, ou fallback si elle est vide
+func envOrDefault(key, fallback string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -1280,4 +1280,635 @@ Notre plateforme a été créée avec une vision simple : rendre les transaction
 		log.Printf("Attention: Impossible de créer les triggers pour app_settings ou maintenance_mode : %s", err)
 	}
 
+	// ========================================
+	// RECHERCHE PLEIN TEXTE SUR LES ANNONCES
+	// ========================================
+	log.Println("Configuration de la recherche plein texte...")
+	_, err = DB.Exec(`CREATE EXTENSION IF NOT EXISTS unaccent;`)
+	if err != nil {
+		log.Fatalf("Impossible de créer l'extension unaccent : %s", err)
+	}
+
+	// Configuration française insensible aux accents (stemming + unaccent)
+	_, err = DB.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'french_unaccent') THEN
+				CREATE TEXT SEARCH CONFIGURATION french_unaccent (COPY = french);
+				ALTER TEXT SEARCH CONFIGURATION french_unaccent
+					ALTER MAPPING FOR hword, hword_part, word
+					WITH unaccent, french_stem;
+			END IF;
+		END $$;
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer la configuration de recherche french_unaccent : %s", err)
+	}
+
+	// Colonne search_vector générée : titre (A), description (B), valeurs de form_data (C)
+	_, err = DB.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name='ads' AND column_name='search_vector') THEN
+				ALTER TABLE ads ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+					setweight(to_tsvector('french_unaccent', coalesce(title, '')), 'A') ||
+					setweight(to_tsvector('french_unaccent', coalesce(description, '')), 'B') ||
+					setweight(jsonb_to_tsvector('french_unaccent', coalesce(form_data, '{}'::jsonb), '["string", "numeric"]'), 'C')
+				) STORED;
+			END IF;
+		END $$;
+	`)
+	if err != nil {
+		log.Fatalf("Impossible d'ajouter la colonne search_vector à la table ads : %s", err)
+	}
+
+	_, err = DB.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_ads_search_vector ON ads USING GIN(search_vector);
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer l'index de recherche plein texte : %s", err)
+	}
+	log.Println("✓ Recherche plein texte configurée avec succès")
+
+	// Index pour la recherche géographique (boîte englobante sur latitude/longitude)
+	_, err = DB.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_ads_lat_lng ON ads(latitude, longitude) WHERE latitude IS NOT NULL AND longitude IS NOT NULL;
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer l'index géographique des annonces : %s", err)
+	}
+
+	// ========================================
+	// TABLES DES RECHERCHES SAUVEGARDÉES
+	// ========================================
+	log.Println("Création de la table saved_searches...")
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS saved_searches (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL,
+			
+			-- Critères (mêmes paramètres que /ads/search)
+			query TEXT,
+			city VARCHAR(255),
+			category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL,
+			sub_category_id INTEGER REFERENCES sub_categories(id) ON DELETE SET NULL,
+			min_price DECIMAL(10, 2),
+			max_price DECIMAL(10, 2),
+			is_delivery_available BOOLEAN,
+			latitude DOUBLE PRECISION,
+			longitude DOUBLE PRECISION,
+			radius_km DOUBLE PRECISION,
+			
+			-- Alertes
+			delivery_mode VARCHAR(20) NOT NULL DEFAULT 'instant' CHECK (delivery_mode IN ('instant', 'daily')),
+			alerts_enabled BOOLEAN DEFAULT TRUE,
+			last_notified_at TIMESTAMP WITH TIME ZONE,
+			
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer la table saved_searches : %s", err)
+	}
+
+	// Annonces déjà trouvées pour chaque recherche (évite les alertes en double)
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS saved_search_matches (
+			saved_search_id INTEGER NOT NULL REFERENCES saved_searches(id) ON DELETE CASCADE,
+			ad_id INTEGER NOT NULL REFERENCES ads(id) ON DELETE CASCADE,
+			matched_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			notified_at TIMESTAMP WITH TIME ZONE,
+			PRIMARY KEY (saved_search_id, ad_id)
+		);
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer la table saved_search_matches : %s", err)
+	}
+
+	_, err = DB.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_saved_searches_user_id ON saved_searches(user_id);
+		CREATE INDEX IF NOT EXISTS idx_saved_searches_alerts ON saved_searches(alerts_enabled, delivery_mode);
+		CREATE INDEX IF NOT EXISTS idx_saved_search_matches_pending ON saved_search_matches(saved_search_id) WHERE notified_at IS NULL;
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer les index pour saved_searches : %s", err)
+	}
+
+	// Date de (re)validation des annonces : fenêtre des alertes de recherches sauvegardées.
+	// Tenue à jour par trigger à chaque passage de is_validated à TRUE (modération, validation
+	// automatique, revalidation après modification ou signalements).
+	_, err = DB.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name='ads' AND column_name='validated_at') THEN
+				ALTER TABLE ads ADD COLUMN validated_at TIMESTAMP WITH TIME ZONE;
+				UPDATE ads SET validated_at = created_at WHERE is_validated = TRUE;
+			END IF;
+		END $$;
+
+		CREATE OR REPLACE FUNCTION set_ads_validated_at()
+		RETURNS TRIGGER AS $$
+		BEGIN
+			IF NEW.is_validated AND (TG_OP = 'INSERT' OR NOT COALESCE(OLD.is_validated, FALSE)) THEN
+				NEW.validated_at = CURRENT_TIMESTAMP;
+			END IF;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trigger_set_ads_validated_at ON ads;
+		CREATE TRIGGER trigger_set_ads_validated_at
+			BEFORE INSERT OR UPDATE OF is_validated ON ads
+			FOR EACH ROW
+			EXECUTE FUNCTION set_ads_validated_at();
+
+		CREATE INDEX IF NOT EXISTS idx_ads_validated_at ON ads(validated_at DESC) WHERE is_validated = TRUE;
+	`)
+	if err != nil {
+		log.Fatalf("Impossible d'ajouter la colonne validated_at à la table ads : %s", err)
+	}
+	log.Println("✓ Tables saved_searches créées avec succès")
+
+	// ========================================
+	// Schémas d'attributs des sous-catégories (validation de ads.form_data)
+	// ========================================
+	log.Println("Création de la table sub_category_attributes...")
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS sub_category_attributes (
+			id SERIAL PRIMARY KEY,
+			sub_category_id INTEGER NOT NULL REFERENCES sub_categories(id) ON DELETE CASCADE,
+			key VARCHAR(50) NOT NULL,
+			label VARCHAR(100) NOT NULL,
+			field_type VARCHAR(20) NOT NULL CHECK (field_type IN ('text', 'number', 'integer', 'boolean', 'enum', 'multi_enum')),
+			is_required BOOLEAN DEFAULT FALSE,
+			enum_values TEXT[] DEFAULT '{}',
+			unit VARCHAR(20),
+			min_value NUMERIC,
+			max_value NUMERIC,
+			display_order INTEGER DEFAULT 0,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (sub_category_id, key)
+		);
+		CREATE INDEX IF NOT EXISTS idx_sub_category_attributes_sub_category ON sub_category_attributes(sub_category_id, display_order);
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer la table sub_category_attributes : %s", err)
+	}
+	log.Println("✓ Table sub_category_attributes créée avec succès")
+
+	// Index JSONB pour les filtres d'attributs (attr.*) : containment @> sur form_data
+	_, err = DB.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_ads_form_data_path ON ads USING GIN (form_data jsonb_path_ops);
+		CREATE INDEX IF NOT EXISTS idx_ads_sub_category_created ON ads(sub_category_id, created_at DESC);
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer les index sur ads.form_data : %s", err)
+	}
+	log.Println("✓ Index des attributs d'annonces créés avec succès")
+
+	// Valeurs numériques de form_data (filtres attr.*_min / attr.*_max), tenues à jour par trigger :
+	// l'index B-tree (key, value) sert les intervalles que l'index GIN ne peut pas servir
+	log.Println("Création de la table ad_numeric_attributes...")
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS ad_numeric_attributes (
+			ad_id INTEGER NOT NULL REFERENCES ads(id) ON DELETE CASCADE,
+			key VARCHAR(50) NOT NULL,
+			value NUMERIC NOT NULL,
+			PRIMARY KEY (ad_id, key)
+		);
+		CREATE INDEX IF NOT EXISTS idx_ad_numeric_attributes_key_value ON ad_numeric_attributes(key, value, ad_id);
+
+		-- Entrées numériques d'un form_data : nombres JSON, ou textes numériques des anciennes annonces
+		CREATE OR REPLACE FUNCTION form_data_numeric_entries(data JSONB)
+		RETURNS TABLE (key TEXT, value NUMERIC) AS $$
+			SELECT e.key,
+				CASE WHEN jsonb_typeof(e.value) = 'number' THEN (e.value #>> '{}')::numeric
+					ELSE TRIM(e.value #>> '{}')::numeric END
+			FROM jsonb_each(COALESCE(data, '{}'::jsonb)) e
+			WHERE length(e.key) <= 50 AND (
+				jsonb_typeof(e.value) = 'number'
+				OR (jsonb_typeof(e.value) = 'string' AND (e.value #>> '{}') ~ '^\s*-?[0-9]+(\.[0-9]+)?\s*$')
+			);
+		$$ LANGUAGE sql IMMUTABLE;
+
+		CREATE OR REPLACE FUNCTION sync_ad_numeric_attributes()
+		RETURNS TRIGGER AS $$
+		BEGIN
+			DELETE FROM ad_numeric_attributes WHERE ad_id = NEW.id;
+			INSERT INTO ad_numeric_attributes (ad_id, key, value)
+			SELECT NEW.id, n.key, n.value FROM form_data_numeric_entries(NEW.form_data) n;
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS trigger_sync_ad_numeric_attributes ON ads;
+		CREATE TRIGGER trigger_sync_ad_numeric_attributes
+			AFTER INSERT OR UPDATE OF form_data ON ads
+			FOR EACH ROW
+			EXECUTE FUNCTION sync_ad_numeric_attributes();
+
+		-- Reprise des annonces existantes (première création de la table)
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM ad_numeric_attributes) THEN
+				INSERT INTO ad_numeric_attributes (ad_id, key, value)
+				SELECT a.id, n.key, n.value
+				FROM ads a CROSS JOIN LATERAL form_data_numeric_entries(a.form_data) n;
+			END IF;
+		END $$;
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer la table ad_numeric_attributes : %s", err)
+	}
+	log.Println("✓ Table ad_numeric_attributes créée avec succès")
+
+	// ========================================
+	// Expiration des annonces (app_settings.max_ad_duration_days)
+	// ========================================
+	log.Println("Ajout des colonnes d'expiration des annonces...")
+	_, err = DB.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'ads' AND column_name = 'expires_at') THEN
+				ALTER TABLE ads ADD COLUMN expires_at TIMESTAMP WITH TIME ZONE;
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'ads' AND column_name = 'is_expired') THEN
+				ALTER TABLE ads ADD COLUMN is_expired BOOLEAN NOT NULL DEFAULT FALSE;
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'ads' AND column_name = 'expired_at') THEN
+				ALTER TABLE ads ADD COLUMN expired_at TIMESTAMP WITH TIME ZONE;
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'ads' AND column_name = 'expiry_reminder_sent_at') THEN
+				ALTER TABLE ads ADD COLUMN expiry_reminder_sent_at TIMESTAMP WITH TIME ZONE;
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'app_settings' AND column_name = 'ad_expiry_reminder_days') THEN
+				ALTER TABLE app_settings ADD COLUMN ad_expiry_reminder_days INTEGER DEFAULT 3;
+			END IF;
+		END $$;
+
+		CREATE INDEX IF NOT EXISTS idx_ads_expiry ON ads(expires_at) WHERE is_expired = FALSE AND is_sold = FALSE;
+	`)
+	if err != nil {
+		log.Fatalf("Impossible d'ajouter les colonnes d'expiration des annonces : %s", err)
+	}
+	log.Println("✓ Colonnes d'expiration des annonces ajoutées avec succès")
+
+	// ========================================
+	// Brouillons d'annonces et publication programmée
+	// ========================================
+	log.Println("Création de la table ad_drafts...")
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS ad_drafts (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			title VARCHAR(255),
+			description TEXT,
+			price DECIMAL(10, 2),
+			sub_category_id INTEGER REFERENCES sub_categories(id) ON DELETE SET NULL,
+			images TEXT[] DEFAULT '{}',
+			form_data JSONB,
+			city VARCHAR(255),
+			phone_number VARCHAR(255),
+			is_phone_visible BOOLEAN DEFAULT FALSE,
+			is_delivery_available BOOLEAN DEFAULT FALSE,
+			latitude DOUBLE PRECISION,
+			longitude DOUBLE PRECISION,
+			publish_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_ad_drafts_user ON ad_drafts(user_id, updated_at DESC);
+		CREATE INDEX IF NOT EXISTS idx_ad_drafts_publish_at ON ad_drafts(publish_at) WHERE publish_at IS NOT NULL;
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer la table ad_drafts : %s", err)
+	}
+	log.Println("✓ Table ad_drafts créée avec succès")
+
+	// ========================================
+	// Historique des modifications d'annonces (revue des modérateurs)
+	// ========================================
+	log.Println("Création de la table ad_revisions...")
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS ad_revisions (
+			id SERIAL PRIMARY KEY,
+			ad_id INTEGER NOT NULL REFERENCES ads(id) ON DELETE CASCADE,
+			revision_number INTEGER NOT NULL,
+			editor_type VARCHAR(10) NOT NULL CHECK (editor_type IN ('initial', 'user', 'admin')),
+			editor_id INTEGER,
+			title VARCHAR(255),
+			description TEXT,
+			price DECIMAL(10, 2),
+			images TEXT[] DEFAULT '{}',
+			form_data JSONB,
+			city VARCHAR(255),
+			phone_number VARCHAR(255),
+			is_phone_visible BOOLEAN DEFAULT FALSE,
+			is_validated_version BOOLEAN NOT NULL DEFAULT FALSE,
+			validated_at TIMESTAMP WITH TIME ZONE,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (ad_id, revision_number)
+		);
+		CREATE INDEX IF NOT EXISTS idx_ad_revisions_validated ON ad_revisions(ad_id, id) WHERE is_validated_version = TRUE;
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer la table ad_revisions : %s", err)
+	}
+	log.Println("✓ Table ad_revisions créée avec succès")
+
+	// ========================================
+	// Historique des prix et alertes de baisse de prix (favoris)
+	// ========================================
+	log.Println("Création de la table ad_price_history...")
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS ad_price_history (
+			id SERIAL PRIMARY KEY,
+			ad_id INTEGER NOT NULL REFERENCES ads(id) ON DELETE CASCADE,
+			price DECIMAL(10, 2) NOT NULL,
+			previous_price DECIMAL(10, 2),
+			drop_alert_pending BOOLEAN NOT NULL DEFAULT FALSE,
+			alert_sent_at TIMESTAMP WITH TIME ZONE,
+			changed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_ad_price_history_ad ON ad_price_history(ad_id, changed_at);
+		CREATE INDEX IF NOT EXISTS idx_ad_price_history_pending ON ad_price_history(ad_id) WHERE drop_alert_pending = TRUE;
+
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'app_settings' AND column_name = 'price_drop_alert_percent') THEN
+				ALTER TABLE app_settings ADD COLUMN price_drop_alert_percent INTEGER DEFAULT 5;
+			END IF;
+		END $$;
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer la table ad_price_history : %s", err)
+	}
+	log.Println("✓ Table ad_price_history créée avec succès")
+
+	// ========================================
+	// Vues d'annonces : événements dédoublonnés et agrégats quotidiens
+	// ========================================
+	log.Println("Création des tables ad_view_events et ad_view_daily...")
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS ad_view_events (
+			id BIGSERIAL PRIMARY KEY,
+			ad_id INTEGER NOT NULL REFERENCES ads(id) ON DELETE CASCADE,
+			viewer_key VARCHAR(64) NOT NULL,
+			viewed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			rolled_up BOOLEAN NOT NULL DEFAULT FALSE
+		);
+		CREATE INDEX IF NOT EXISTS idx_ad_view_events_dedup ON ad_view_events(ad_id, viewer_key, viewed_at);
+		CREATE INDEX IF NOT EXISTS idx_ad_view_events_pending ON ad_view_events(id) WHERE rolled_up = FALSE;
+
+		CREATE TABLE IF NOT EXISTS ad_view_daily (
+			ad_id INTEGER NOT NULL REFERENCES ads(id) ON DELETE CASCADE,
+			day DATE NOT NULL,
+			views INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (ad_id, day)
+		);
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer les tables de vues d'annonces : %s", err)
+	}
+	log.Println("✓ Tables ad_view_events et ad_view_daily créées avec succès")
+
+	// ========================================
+	// Affichages du numéro de téléphone (statistiques vendeur)
+	// ========================================
+	log.Println("Création de la table ad_phone_reveals...")
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS ad_phone_reveals (
+			id BIGSERIAL PRIMARY KEY,
+			ad_id INTEGER NOT NULL REFERENCES ads(id) ON DELETE CASCADE,
+			viewer_key VARCHAR(64) NOT NULL,
+			revealed_on DATE NOT NULL DEFAULT CURRENT_DATE,
+			revealed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (ad_id, viewer_key, revealed_on)
+		);
+		CREATE INDEX IF NOT EXISTS idx_ad_phone_reveals_ad_day ON ad_phone_reveals(ad_id, revealed_on);
+		CREATE INDEX IF NOT EXISTS idx_favorites_ad_created ON favorites(ad_id, created_at);
+		CREATE INDEX IF NOT EXISTS idx_conversations_ad_created ON conversations(ad_id, created_at);
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer la table ad_phone_reveals : %s", err)
+	}
+	log.Println("✓ Table ad_phone_reveals créée avec succès")
+
+	// ========================================
+	// Import d'annonces en masse (comptes professionnels)
+	// ========================================
+	log.Println("Création de la table ad_import_jobs...")
+	_, err = DB.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name='ads' AND column_name='sku') THEN
+				ALTER TABLE ads ADD COLUMN sku VARCHAR(100);
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name='ads' AND column_name='import_image_sources') THEN
+				ALTER TABLE ads ADD COLUMN import_image_sources TEXT[];
+			END IF;
+		END $$;
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_ads_user_sku ON ads(user_id, sku) WHERE sku IS NOT NULL;
+
+		CREATE TABLE IF NOT EXISTS ad_import_jobs (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'processing', 'completed', 'failed')),
+			file_name VARCHAR(255),
+			file_format VARCHAR(10) NOT NULL CHECK (file_format IN ('csv', 'json')),
+			rows JSONB NOT NULL,
+			archive BYTEA,
+			total_rows INTEGER NOT NULL DEFAULT 0,
+			processed_rows INTEGER NOT NULL DEFAULT 0,
+			created_count INTEGER NOT NULL DEFAULT 0,
+			updated_count INTEGER NOT NULL DEFAULT 0,
+			unchanged_count INTEGER NOT NULL DEFAULT 0,
+			failed_count INTEGER NOT NULL DEFAULT 0,
+			row_errors JSONB NOT NULL DEFAULT '[]',
+			error_message TEXT,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			started_at TIMESTAMP WITH TIME ZONE,
+			finished_at TIMESTAMP WITH TIME ZONE
+		);
+		CREATE INDEX IF NOT EXISTS idx_ad_import_jobs_user ON ad_import_jobs(user_id, created_at DESC);
+		CREATE INDEX IF NOT EXISTS idx_ad_import_jobs_pending ON ad_import_jobs(created_at) WHERE status IN ('pending', 'processing');
+
+		DO $$
+		BEGIN
+			-- Signe de vie du worker qui traite l'import (reprise des seuls imports abandonnés)
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name='ad_import_jobs' AND column_name='heartbeat_at') THEN
+				ALTER TABLE ad_import_jobs ADD COLUMN heartbeat_at TIMESTAMP WITH TIME ZONE;
+			END IF;
+		END $$;
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer la table ad_import_jobs : %s", err)
+	}
+	log.Println("✓ Table ad_import_jobs créée avec succès")
+
+	// ========================================
+	// Détection des doublons d'annonces (empreintes d'images et de titres)
+	// ========================================
+	log.Println("Création de la table ad_image_hashes...")
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS ad_image_hashes (
+			image_url TEXT PRIMARY KEY,
+			phash BIGINT NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_ad_image_hashes_phash ON ad_image_hashes(phash);
+
+		DO $$
+		BEGIN
+			-- Tranches de 8 bits de l'empreinte (tranche*256 + valeur) pour préfiltrer les empreintes proches
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'ad_image_hashes' AND column_name = 'bands') THEN
+				ALTER TABLE ad_image_hashes ADD COLUMN bands INTEGER[];
+			END IF;
+		END $$;
+		UPDATE ad_image_hashes
+		SET bands = ARRAY(SELECT i * 256 + ((phash >> (8 * i)) & 255)::INTEGER FROM generate_series(0, 7) AS i ORDER BY i)
+		WHERE bands IS NULL;
+		CREATE INDEX IF NOT EXISTS idx_ad_image_hashes_bands ON ad_image_hashes USING GIN (bands);
+
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'ads' AND column_name = 'title_fingerprint') THEN
+				ALTER TABLE ads ADD COLUMN title_fingerprint TEXT;
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'app_settings' AND column_name = 'block_duplicate_ads') THEN
+				ALTER TABLE app_settings ADD COLUMN block_duplicate_ads BOOLEAN DEFAULT FALSE;
+			END IF;
+		END $$;
+		CREATE INDEX IF NOT EXISTS idx_ads_title_fingerprint ON ads(title_fingerprint) WHERE title_fingerprint <> '';
+		CREATE INDEX IF NOT EXISTS idx_ads_images_gin ON ads USING GIN (images);
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer la table ad_image_hashes : %s", err)
+	}
+	log.Println("✓ Table ad_image_hashes créée avec succès")
+
+	// ========================================
+	// Nettoyage des fichiers orphelins du stockage
+	// ========================================
+	log.Println("Création de la table media_gc_runs...")
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS media_gc_runs (
+			id SERIAL PRIMARY KEY,
+			status VARCHAR(20) NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'completed', 'failed')),
+			dry_run BOOLEAN NOT NULL DEFAULT TRUE,
+			triggered_by INTEGER REFERENCES admins(id) ON DELETE SET NULL,
+			grace_period_hours INTEGER NOT NULL,
+			scanned_count INTEGER NOT NULL DEFAULT 0,
+			scanned_bytes BIGINT NOT NULL DEFAULT 0,
+			referenced_count INTEGER NOT NULL DEFAULT 0,
+			orphan_count INTEGER NOT NULL DEFAULT 0,
+			orphan_bytes BIGINT NOT NULL DEFAULT 0,
+			deleted_count INTEGER NOT NULL DEFAULT 0,
+			failed_count INTEGER NOT NULL DEFAULT 0,
+			orphans JSONB NOT NULL DEFAULT '[]',
+			error_message TEXT,
+			started_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			finished_at TIMESTAMP WITH TIME ZONE
+		);
+		CREATE INDEX IF NOT EXISTS idx_media_gc_runs_started ON media_gc_runs(started_at DESC);
+
+		-- Les avatars des admins sont lus par l'authentification admin : s'assurer que la colonne existe
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'admins' AND column_name = 'avatar_url') THEN
+				ALTER TABLE admins ADD COLUMN avatar_url VARCHAR(500);
+			END IF;
+		END $$;
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer la table media_gc_runs : %s", err)
+	}
+	log.Println("✓ Table media_gc_runs créée avec succès")
+
+	// ========================================
+	// Fil d'accueil personnalisé : annonces vues et recherches des utilisateurs connectés
+	// ========================================
+	log.Println("Création des tables user_ad_views et user_search_history...")
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS user_ad_views (
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			ad_id INTEGER NOT NULL REFERENCES ads(id) ON DELETE CASCADE,
+			view_count INTEGER NOT NULL DEFAULT 1,
+			first_viewed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			last_viewed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, ad_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_user_ad_views_recent ON user_ad_views(user_id, last_viewed_at DESC);
+
+		CREATE TABLE IF NOT EXISTS user_search_history (
+			id BIGSERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			query TEXT NOT NULL DEFAULT '',
+			category_id INTEGER REFERENCES categories(id) ON DELETE SET NULL,
+			sub_category_id INTEGER REFERENCES sub_categories(id) ON DELETE SET NULL,
+			city VARCHAR(255),
+			searched_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_user_search_history_recent ON user_search_history(user_id, searched_at DESC);
+		CREATE INDEX IF NOT EXISTS idx_ads_sub_category_created ON ads(sub_category_id, created_at DESC);
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer les tables du fil d'accueil : %s", err)
+	}
+	log.Println("✓ Tables user_ad_views et user_search_history créées avec succès")
+
+	// ========================================
+	// Paramètres de l'utilisateur (historique de consultation, préférences de l'application)
+	// ========================================
+	log.Println("Création de la table user_settings...")
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS user_settings (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+			settings JSONB NOT NULL DEFAULT '{}',
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		);
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer la table user_settings : %s", err)
+	}
+	log.Println("✓ Table user_settings créée avec succès")
+
+	// ========================================
+	// Signalements d'annonces (file de modération et masquage automatique)
+	// ========================================
+	log.Println("Création de la table ad_reports...")
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS ad_reports (
+			id SERIAL PRIMARY KEY,
+			ad_id INTEGER NOT NULL REFERENCES ads(id) ON DELETE CASCADE,
+			reporter_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			reason VARCHAR(30) NOT NULL CHECK (reason IN ('scam', 'prohibited_item', 'wrong_category', 'duplicate', 'offensive')),
+			comment TEXT,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'resolved', 'dismissed')),
+			admin_notes TEXT,
+			reviewed_by INTEGER REFERENCES admins(id) ON DELETE SET NULL,
+			created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+			UNIQUE(ad_id, reporter_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_ad_reports_status ON ad_reports(status, created_at DESC);
+		CREATE INDEX IF NOT EXISTS idx_ad_reports_ad_id ON ad_reports(ad_id);
+
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'ads' AND column_name = 'reports_hidden_at') THEN
+				ALTER TABLE ads ADD COLUMN reports_hidden_at TIMESTAMP WITH TIME ZONE;
+			END IF;
+			IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'app_settings' AND column_name = 'ad_report_hide_threshold') THEN
+				ALTER TABLE app_settings ADD COLUMN ad_report_hide_threshold INTEGER DEFAULT 3;
+			END IF;
+		END $$;
+	`)
+	if err != nil {
+		log.Fatalf("Impossible de créer la table ad_reports : %s", err)
+	}
+	log.Println("✓ Table ad_reports créée avec succès")
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -16,7 +17,7 @@ import (
 )
 
 // GetAllAdsForAdminHandler récupère toutes les annonces pour le panel admin avec pagination et filtres.
-// Les annonces en attente de validation sont affichées en premier.
+// Les annonces masquées par des signalements sont affichées en premier, puis celles en attente de validation.
 func GetAllAdsForAdminHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Début de la récupération des annonces pour le panel admin.")
 
@@ -52,7 +53,7 @@ func GetAllAdsForAdminHandler(w http.ResponseWriter, r *http.Request) {
 				a.id, a.title, a.description, a.price, a.images, a.form_data, 
 				a.city, a.phone_number, a.is_phone_visible, a.latitude, a.longitude,
 				a.is_validated, a.is_deactivated, a.is_rejected, a.is_delivery_available, 
-				a.is_sold, a.created_at, a.views_count,
+				a.is_sold, a.created_at, a.views_count, ` + editedSinceValidationSQL + `, a.reports_hidden_at,
 				u.id as user_id, u.first_name, u.last_name, u.shop_name, u.account_type, u.avatar_url,
 				sc.name as sub_category_name, c.name as category_name
 			FROM ads a
@@ -61,6 +62,7 @@ func GetAllAdsForAdminHandler(w http.ResponseWriter, r *http.Request) {
 			JOIN categories c ON sc.category_id = c.id
 			ORDER BY 
 				CASE 
+					WHEN a.reports_hidden_at IS NOT NULL AND a.is_rejected = false AND a.is_deactivated = false THEN 0
 					WHEN a.is_validated = false AND a.is_rejected = false AND a.is_deactivated = false THEN 1 
 					ELSE 2 
 				END, 
@@ -79,13 +81,14 @@ func GetAllAdsForAdminHandler(w http.ResponseWriter, r *http.Request) {
 			var images pq.StringArray
 			var formDataStr, shopName, avatarURL sql.NullString
 			var latitude, longitude sql.NullFloat64
+			var reportsHiddenAt sql.NullTime
 			var firstName, lastName, accountType string
 
 			if err := rows.Scan(
 				&ad.ID, &ad.Title, &ad.Description, &ad.Price, &images, &formDataStr,
 				&ad.City, &ad.PhoneNumber, &ad.IsPhoneVisible, &latitude, &longitude,
 				&ad.IsValidated, &ad.IsDeactivated, &ad.IsRejected, &ad.IsDeliveryAvailable,
-				&ad.IsSold, &ad.CreatedAt, &ad.ViewsCount,
+				&ad.IsSold, &ad.CreatedAt, &ad.ViewsCount, &ad.EditedSinceValidation, &reportsHiddenAt,
 				&ad.User.ID, &firstName, &lastName, &shopName, &accountType, &avatarURL,
 				&ad.SubCategoryName, &ad.CategoryName,
 			); err != nil {
@@ -94,6 +97,10 @@ func GetAllAdsForAdminHandler(w http.ResponseWriter, r *http.Request) {
 			}
 
 			ad.Images = []string(images)
+			ad.ImageVariants = services.AdImageVariants(ad.Images)
+			if reportsHiddenAt.Valid {
+				ad.ReportsHiddenAt = &reportsHiddenAt.Time
+			}
 			if formDataStr.Valid {
 				_ = json.Unmarshal([]byte(formDataStr.String), &ad.FormData)
 			}
@@ -260,6 +267,7 @@ func GetAdDetailsForAdminHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Hydratation des champs complexes de l'objet 'ad'
 	ad.Images = []string(images)
+	ad.ImageVariants = services.AdImageVariants(ad.Images)
 	if formDataStr.Valid {
 		if err := json.Unmarshal([]byte(formDataStr.String), &ad.FormData); err != nil {
 			log.Printf("AVERTISSEMENT: Erreur lors du unmarshal de form_data pour l'annonce %d: %v", adID, err)
@@ -268,6 +276,14 @@ func GetAdDetailsForAdminHandler(w http.ResponseWriter, r *http.Request) {
 	ad.Latitude = latitude
 	ad.Longitude = longitude
 
+	// Doublons probables (même vendeur ou autres comptes) pour la modération
+	duplicates, err := findAdDuplicates(r.Context(), adID)
+	if err != nil {
+		log.Printf("AVERTISSEMENT: Erreur lors de la recherche de doublons pour l'annonce %d: %v", adID, err)
+	} else {
+		ad.DuplicateCandidates = duplicates
+	}
+
 	// 1. Définir une structure de réponse qui correspond à ce que le frontend attend (avec des types string)
 	type UserResponse struct {
 		ID           int    `json:"id"`
@@ -357,8 +373,10 @@ func EditAdForAdminHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 3. Récupérer les images actuelles de l'annonce (sans vérifier le propriétaire)
+	var subCategoryID int
+	var currentPrice float64
 	var currentImagesArray pq.StringArray
-	err = config.DB.QueryRow("SELECT images FROM ads WHERE id = $1", adID).Scan(&currentImagesArray)
+	err = config.DB.QueryRow("SELECT sub_category_id, price, images FROM ads WHERE id = $1", adID).Scan(&subCategoryID, &currentPrice, &currentImagesArray)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Printf("Erreur admin: Annonce non trouvée: %d", adID)
@@ -373,11 +391,16 @@ func EditAdForAdminHandler(w http.ResponseWriter, r *http.Request) {
 	currentImages := []string(currentImagesArray)
 	log.Printf("Annonce %d. Images actuelles: %v", adID, currentImages)
 
-	// 4. Initialiser le service AWS
-	awsService, err := services.NewAWSService()
-	if err != nil {
-		log.Printf("Erreur admin: Initialisation du service AWS: %v", err)
-		http.Error(w, "Erreur de configuration du service de stockage", http.StatusInternalServerError)
+	// Valider les attributs envoyés contre le schéma de la sous-catégorie
+	formDataJSON, ok := validateAdUpdateFormData(w, subCategoryID, req.FormData)
+	if !ok {
+		return
+	}
+
+	// Conserver la version actuelle avant de l'écraser
+	if err := ensureAdBaselineRevision(r.Context(), adID); err != nil {
+		log.Printf("Erreur admin: Révision initiale de l'annonce %d: %v", adID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
 		return
 	}
 
@@ -385,7 +408,7 @@ func EditAdForAdminHandler(w http.ResponseWriter, r *http.Request) {
 	var newUploadedImages []string
 	if len(req.NewImages) > 0 {
 		log.Printf("Admin upload de %d nouvelles images (base64) pour l'annonce %d", len(req.NewImages), adID)
-		newUploadedImages, err = awsService.UploadAdImages(req.NewImages)
+		newUploadedImages, err = mediaService.UploadAdImages(req.NewImages)
 		if err != nil {
 			log.Printf("Erreur admin: Upload des nouvelles images: %v", err)
 			http.Error(w, "Erreur lors de l'upload des nouvelles images", http.StatusInternalServerError)
@@ -404,10 +427,13 @@ func EditAdForAdminHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Les images d'une version validée restent disponibles pour la comparaison
+	imagesToDeleteFromS3 = imagesNotInValidatedRevisions(r.Context(), adID, imagesToDeleteFromS3)
+
 	// 7. Supprimer les images de S3
 	if len(imagesToDeleteFromS3) > 0 {
 		log.Printf("Admin supprime %d images de S3 pour l'annonce %d", len(imagesToDeleteFromS3), adID)
-		err = awsService.DeleteImages(imagesToDeleteFromS3)
+		err = mediaService.DeleteImages(imagesToDeleteFromS3)
 		if err != nil {
 			log.Printf("Erreur admin: Suppression des images S3: %v", err)
 			// Ne pas bloquer la requête pour cette erreur
@@ -449,6 +475,8 @@ func EditAdForAdminHandler(w http.ResponseWriter, r *http.Request) {
             is_phone_visible = $5, 
             city = $6, 
             price = $7, 
+            form_data = COALESCE($9, form_data),
+            title_fingerprint = $10,
             updated_at = NOW()
         WHERE id = $8
     `
@@ -462,13 +490,15 @@ func EditAdForAdminHandler(w http.ResponseWriter, r *http.Request) {
 		req.City,
 		req.Price,
 		adID,
+		formDataJSON,
+		services.TitleFingerprint(req.Title),
 	)
 
 	if err != nil {
 		log.Printf("Erreur admin: Mise à jour de l'annonce %d: %v", adID, err)
 		// Rollback des images uploadées si la DB échoue
 		if len(newUploadedImages) > 0 {
-			awsService.DeleteImages(newUploadedImages)
+			mediaService.DeleteImages(newUploadedImages)
 		}
 		http.Error(w, "Échec de la mise à jour de l'annonce", http.StatusInternalServerError)
 		return
@@ -476,6 +506,18 @@ func EditAdForAdminHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Annonce %d mise à jour avec succès par l'admin.", adID)
 
+	// Historique des modifications (la révision reste validée si l'annonce l'est)
+	adminID, _ := r.Context().Value(adminIDContextKey).(int)
+	if err := recordAdRevision(r.Context(), adID, models.AdRevisionEditorAdmin, adminID); err != nil {
+		log.Printf("Erreur admin: Révision de l'annonce %d: %v", adID, err)
+	}
+
+	// Historique des prix et alertes de baisse (l'annonce reste visible si elle l'était)
+	if err := recordAdPriceChange(r.Context(), adID, currentPrice, req.Price); err != nil {
+		log.Printf("Erreur admin: Historique des prix de l'annonce %d: %v", adID, err)
+	}
+	go dispatchPriceDropAlerts(context.Background(), adID)
+
 	// 10. Renvoyer une réponse de succès
 	response := struct {
 		Message string   `json:"message"`
@@ -1006,6 +1048,206 @@ func DeleteSubCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// ============== SCHÉMAS D'ATTRIBUTS DES SOUS-CATÉGORIES ==============
+
+// CreateSubCategoryAttributeHandler ajoute un attribut au schéma d'une sous-catégorie
+func CreateSubCategoryAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	subCategoryID, err := strconv.Atoi(mux.Vars(r)["subCategoryID"])
+	if err != nil {
+		http.Error(w, "ID de sous-catégorie invalide", http.StatusBadRequest)
+		return
+	}
+
+	var req SubCategoryAttributeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Erreur admin: Décodage JSON pour création d'attribut: %v", err)
+		http.Error(w, "Données de requête invalides", http.StatusBadRequest)
+		return
+	}
+	if msg := validateAttributeDefinition(&req); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	// Vérifier que la sous-catégorie existe
+	var subCategoryExists bool
+	err = config.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM sub_categories WHERE id = $1)", subCategoryID).Scan(&subCategoryExists)
+	if err != nil {
+		log.Printf("Erreur admin: Vérification de l'existence de la sous-catégorie: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if !subCategoryExists {
+		http.Error(w, "Sous-catégorie non trouvée", http.StatusNotFound)
+		return
+	}
+
+	// Vérifier que la clé n'est pas déjà utilisée dans cette sous-catégorie
+	var exists bool
+	err = config.DB.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM sub_category_attributes WHERE sub_category_id = $1 AND key = $2)",
+		subCategoryID, req.Key,
+	).Scan(&exists)
+	if err != nil {
+		log.Printf("Erreur admin: Vérification de l'existence de l'attribut: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		http.Error(w, "Un attribut avec cette clé existe déjà dans cette sous-catégorie", http.StatusConflict)
+		return
+	}
+
+	row := config.DB.QueryRow(`
+		INSERT INTO sub_category_attributes
+			(sub_category_id, key, label, field_type, is_required, enum_values, unit, min_value, max_value, display_order)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING `+subCategoryAttributeColumns,
+		subCategoryID, req.Key, req.Label, req.FieldType, req.IsRequired, pq.Array(req.EnumValues),
+		req.Unit, req.MinValue, req.MaxValue, req.DisplayOrder,
+	)
+	attribute, err := scanSubCategoryAttribute(row)
+	if err != nil {
+		log.Printf("Erreur admin: Insertion de l'attribut: %v", err)
+		http.Error(w, "Erreur lors de la création de l'attribut", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Attribut créé avec succès: ID=%d, Key=%s, SubCategoryID=%d", attribute.ID, attribute.Key, subCategoryID)
+
+	response := struct {
+		Message   string                      `json:"message"`
+		Attribute models.SubCategoryAttribute `json:"attribute"`
+	}{
+		Message:   "Attribut créé avec succès",
+		Attribute: attribute,
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateSubCategoryAttributeHandler modifie un attribut du schéma d'une sous-catégorie.
+// Les annonces existantes ne sont pas revalidées : le nouveau schéma s'applique à leur prochaine modification.
+func UpdateSubCategoryAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	subCategoryID, err := strconv.Atoi(vars["subCategoryID"])
+	if err != nil {
+		http.Error(w, "ID de sous-catégorie invalide", http.StatusBadRequest)
+		return
+	}
+	attributeID, err := strconv.Atoi(vars["attributeID"])
+	if err != nil {
+		http.Error(w, "ID d'attribut invalide", http.StatusBadRequest)
+		return
+	}
+
+	var req SubCategoryAttributeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Erreur admin: Décodage JSON pour modification d'attribut: %v", err)
+		http.Error(w, "Données de requête invalides", http.StatusBadRequest)
+		return
+	}
+	if msg := validateAttributeDefinition(&req); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	// Vérifier si un autre attribut utilise déjà cette clé dans la sous-catégorie
+	var exists bool
+	err = config.DB.QueryRow(
+		"SELECT EXISTS(SELECT 1 FROM sub_category_attributes WHERE sub_category_id = $1 AND key = $2 AND id != $3)",
+		subCategoryID, req.Key, attributeID,
+	).Scan(&exists)
+	if err != nil {
+		log.Printf("Erreur admin: Vérification de l'existence de l'attribut: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if exists {
+		http.Error(w, "Un attribut avec cette clé existe déjà dans cette sous-catégorie", http.StatusConflict)
+		return
+	}
+
+	row := config.DB.QueryRow(`
+		UPDATE sub_category_attributes
+		SET key = $1, label = $2, field_type = $3, is_required = $4, enum_values = $5,
+			unit = $6, min_value = $7, max_value = $8, display_order = $9, updated_at = NOW()
+		WHERE id = $10 AND sub_category_id = $11
+		RETURNING `+subCategoryAttributeColumns,
+		req.Key, req.Label, req.FieldType, req.IsRequired, pq.Array(req.EnumValues),
+		req.Unit, req.MinValue, req.MaxValue, req.DisplayOrder, attributeID, subCategoryID,
+	)
+	attribute, err := scanSubCategoryAttribute(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Attribut non trouvé", http.StatusNotFound)
+			return
+		}
+		log.Printf("Erreur admin: Mise à jour de l'attribut %d: %v", attributeID, err)
+		http.Error(w, "Erreur lors de la mise à jour de l'attribut", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Attribut %d de la sous-catégorie %d mis à jour avec succès", attributeID, subCategoryID)
+
+	response := struct {
+		Message   string                      `json:"message"`
+		Attribute models.SubCategoryAttribute `json:"attribute"`
+	}{
+		Message:   "Attribut mis à jour avec succès",
+		Attribute: attribute,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeleteSubCategoryAttributeHandler retire un attribut du schéma d'une sous-catégorie.
+// Les valeurs déjà présentes dans form_data ne sont pas supprimées.
+func DeleteSubCategoryAttributeHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	subCategoryID, err := strconv.Atoi(vars["subCategoryID"])
+	if err != nil {
+		http.Error(w, "ID de sous-catégorie invalide", http.StatusBadRequest)
+		return
+	}
+	attributeID, err := strconv.Atoi(vars["attributeID"])
+	if err != nil {
+		http.Error(w, "ID d'attribut invalide", http.StatusBadRequest)
+		return
+	}
+
+	result, err := config.DB.Exec(
+		"DELETE FROM sub_category_attributes WHERE id = $1 AND sub_category_id = $2",
+		attributeID, subCategoryID,
+	)
+	if err != nil {
+		log.Printf("Erreur admin: Suppression de l'attribut %d: %v", attributeID, err)
+		http.Error(w, "Erreur lors de la suppression de l'attribut", http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		http.Error(w, "Attribut non trouvé", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("Attribut %d de la sous-catégorie %d supprimé avec succès", attributeID, subCategoryID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Attribut supprimé avec succès",
+	})
+}
+
 // ============== NOUVELLES FONCTIONS DE MODÉRATION (MISES À JOUR) ==============
 
 // getAdInfoForNotification récupère l'ID de l'utilisateur et le titre d'une annonce.
@@ -1038,7 +1280,7 @@ func ValidateAdHandler(w http.ResponseWriter, r *http.Request) {
 	// Assure que les autres statuts sont bien à FALSE
 	query := `
 		UPDATE ads 
-		SET is_validated = TRUE, is_rejected = FALSE, is_deactivated = FALSE, updated_at = NOW()
+		SET is_validated = TRUE, is_rejected = FALSE, is_deactivated = FALSE, reports_hidden_at = NULL, updated_at = NOW()
 		WHERE id = $1
 	`
 	result, err := config.DB.Exec(query, adID)
@@ -1054,16 +1296,16 @@ func ValidateAdHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Envoyer la notification (in-app)
-	notificationTitle := "Votre annonce a été approuvée !"
-	notificationMessage := fmt.Sprintf("Bonne nouvelle ! Votre annonce « %s » a été validée et est maintenant visible par tous.", adTitle)
-	go services.CreateNotification(userID, "ad_validated", notificationTitle, notificationMessage, map[string]interface{}{"adId": adID})
-
-	// Envoyer la notification (push)
-	if services.PushSvc != nil {
-		services.PushSvc.SendAdValidatedPush(r.Context(), userID, adTitle, adID)
+	// La version actuelle devient la référence pour les prochaines comparaisons
+	if err := markAdRevisionValidated(r.Context(), adID); err != nil {
+		log.Printf("Erreur lors du marquage de la révision validée de l'annonce %d: %v", adID, err)
 	}
 
+	services.NotifyAdValidated(r.Context(), userID, adID, adTitle)
+
+	// Alertes de baisse de prix en attente de la validation
+	go dispatchPriceDropAlerts(context.Background(), adID)
+
 	log.Printf("Annonce %d validée avec succès. Notification envoyée à l'utilisateur %d.", adID, userID)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -1100,7 +1342,7 @@ func RejectAdHandler(w http.ResponseWriter, r *http.Request) {
 	// Mise à jour du statut, SANS sauvegarder la raison dans la DB
 	query := `
 		UPDATE ads 
-		SET is_validated = FALSE, is_rejected = TRUE, is_deactivated = FALSE, updated_at = NOW()
+		SET is_validated = FALSE, is_rejected = TRUE, is_deactivated = FALSE, reports_hidden_at = NULL, updated_at = NOW()
 		WHERE id = $1
 	`
 	_, err = config.DB.Exec(query, adID)
@@ -1235,12 +1477,7 @@ func DeleteAdForAdminHandler(w http.ResponseWriter, r *http.Request) {
 	// Supprimer les images de S3
 	if len(images) > 0 {
 		go func() {
-			awsService, err := services.NewAWSService()
-			if err != nil {
-				log.Printf("CRITIQUE: Impossible d'initier le service AWS pour l'annonce %d. Erreur: %v", adID, err)
-				return
-			}
-			if err := awsService.DeleteImages([]string(images)); err != nil {
+			if err := mediaService.DeleteImages([]string(images)); err != nil {
 				log.Printf("ERREUR S3: La suppression des images de l'annonce %d a échoué: %v", adID, err)
 			} else {
 				log.Printf("Images de l'annonce %d supprimées de S3.", adID)
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"kivendi-backend/models"
+)
+
+// attributeFilterPrefix préfixe les paramètres de filtre sur form_data :
+// attr.marque=Toyota, attr.marque=Toyota,Honda (plusieurs valeurs), attr.annee_min=2015, attr.kilometrage_max=100000
+const attributeFilterPrefix = "attr."
+
+// maxAttributeFilters limite le nombre de filtres d'attributs par requête
+const maxAttributeFilters = 10
+
+var errInvalidAttributeFilter = errors.New("filtre d'attribut invalide")
+
+// AttributeFilter est un filtre sur un attribut de form_data : égalité (une des valeurs) et/ou intervalle
+type AttributeFilter struct {
+	Key    string   `json:"key"`
+	Values []string `json:"values,omitempty"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+
+	attr *models.SubCategoryAttribute // Définition du schéma, si la sous-catégorie est connue
+}
+
+// parseAttributeFilters lit les paramètres attr.* de la requête. Lorsque la sous-catégorie est connue,
+// son schéma d'attributs sert à typer les valeurs (nombre, booléen, valeur canonique d'une liste).
+// Les erreurs de saisie enveloppent errInvalidAttributeFilter ; les autres viennent de la base.
+func parseAttributeFilters(r *http.Request, subCategoryID *int) ([]AttributeFilter, error) {
+	var names []string
+	for name := range r.URL.Query() {
+		if strings.HasPrefix(name, attributeFilterPrefix) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	sort.Strings(names)
+
+	schema := make(map[string]models.SubCategoryAttribute)
+	if subCategoryID != nil {
+		attributes, err := loadSubCategoryAttributes(*subCategoryID)
+		if err != nil {
+			return nil, err
+		}
+		for _, attr := range attributes {
+			schema[attr.Key] = attr
+		}
+	}
+
+	filters := make(map[string]*AttributeFilter)
+	var order []string
+	getFilter := func(key string) *AttributeFilter {
+		if f, ok := filters[key]; ok {
+			return f
+		}
+		f := &AttributeFilter{Key: key}
+		if attr, ok := schema[key]; ok {
+			f.attr = &attr
+		}
+		filters[key] = f
+		order = append(order, key)
+		return f
+	}
+
+	for _, name := range names {
+		key := strings.TrimPrefix(name, attributeFilterPrefix)
+		rawValues := r.URL.Query()[name]
+
+		// Suffixe _min / _max = intervalle, sauf si la clé complète existe dans le schéma
+		bound := ""
+		if _, known := schema[key]; !known {
+			switch {
+			case strings.HasSuffix(key, "_min"):
+				bound, key = "min", strings.TrimSuffix(key, "_min")
+			case strings.HasSuffix(key, "_max"):
+				bound, key = "max", strings.TrimSuffix(key, "_max")
+			}
+		}
+		if !attributeKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("%w : %s", errInvalidAttributeFilter, name)
+		}
+
+		f := getFilter(key)
+		if bound != "" {
+			if f.attr != nil && f.attr.FieldType != models.AttributeTypeNumber && f.attr.FieldType != models.AttributeTypeInteger {
+				return nil, fmt.Errorf("%w : l'attribut %s n'accepte pas de filtre min/max", errInvalidAttributeFilter, key)
+			}
+			raw := strings.TrimSpace(rawValues[len(rawValues)-1])
+			if raw == "" {
+				continue
+			}
+			n, err := strconv.ParseFloat(strings.ReplaceAll(raw, " ", ""), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w : la borne %s doit être un nombre", errInvalidAttributeFilter, name)
+			}
+			if bound == "min" {
+				f.Min = &n
+			} else {
+				f.Max = &n
+			}
+			continue
+		}
+
+		// Plusieurs valeurs : paramètre répété ou valeurs séparées par des virgules
+		for _, raw := range rawValues {
+			for _, v := range strings.Split(raw, ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					f.Values = append(f.Values, v)
+				}
+			}
+		}
+	}
+
+	if len(order) > maxAttributeFilters {
+		return nil, fmt.Errorf("%w : %d filtres d'attributs maximum", errInvalidAttributeFilter, maxAttributeFilters)
+	}
+
+	result := make([]AttributeFilter, 0, len(order))
+	for _, key := range order {
+		f := filters[key]
+		if len(f.Values) == 0 && f.Min == nil && f.Max == nil {
+			continue
+		}
+		result = append(result, *f)
+	}
+	return result, nil
+}
+
+// containment renvoie le document JSON {"clé": valeur} utilisé avec l'opérateur @>,
+// servi par l'index GIN jsonb_path_ops sur ads.form_data (fonctionne aussi pour les listes multi_enum).
+func (f AttributeFilter) containment(value interface{}) string {
+	data, _ := json.Marshal(map[string]interface{}{f.Key: value})
+	return string(data)
+}
+
+// clause construit la condition SQL du filtre à partir du paramètre $argIndex.
+// La clé a été validée par attributeKeyPattern et peut donc être insérée telle quelle.
+func (f AttributeFilter) clause(argIndex int) (string, []interface{}) {
+	var parts []string
+	var params []interface{}
+
+	if len(f.Values) > 0 {
+		var alternatives []string
+		addContainment := func(doc string) {
+			alternatives = append(alternatives, fmt.Sprintf("a.form_data @> $%d::jsonb", argIndex))
+			params = append(params, doc)
+			argIndex++
+		}
+
+		for _, v := range f.Values {
+			switch {
+			case f.attr != nil && f.attr.FieldType == models.AttributeTypeText:
+				// Texte libre : comparaison insensible à la casse
+				alternatives = append(alternatives, fmt.Sprintf("LOWER(a.form_data->>'%s') = LOWER($%d)", f.Key, argIndex))
+				params = append(params, v)
+				argIndex++
+			case f.attr != nil && (f.attr.FieldType == models.AttributeTypeEnum || f.attr.FieldType == models.AttributeTypeMultiEnum):
+				if canonical, found := matchEnumValue(f.attr.EnumValues, v); found {
+					v = canonical
+				}
+				if f.attr.FieldType == models.AttributeTypeMultiEnum {
+					addContainment(f.containment([]string{v}))
+				} else {
+					addContainment(f.containment(v))
+				}
+			case f.attr != nil && (f.attr.FieldType == models.AttributeTypeNumber || f.attr.FieldType == models.AttributeTypeInteger):
+				if n, err := strconv.ParseFloat(v, 64); err == nil {
+					addContainment(f.containment(n))
+				} else {
+					alternatives = append(alternatives, "FALSE")
+				}
+			case f.attr != nil && f.attr.FieldType == models.AttributeTypeBoolean:
+				if b, err := strconv.ParseBool(v); err == nil {
+					addContainment(f.containment(b))
+				} else {
+					alternatives = append(alternatives, "FALSE")
+				}
+			default:
+				// Sans schéma : la valeur peut avoir été enregistrée en texte, en nombre ou en booléen
+				addContainment(f.containment(v))
+				if n, err := strconv.ParseFloat(v, 64); err == nil {
+					addContainment(f.containment(n))
+				} else if b, err := strconv.ParseBool(v); err == nil {
+					addContainment(f.containment(b))
+				}
+			}
+		}
+		parts = append(parts, "("+strings.Join(alternatives, " OR ")+")")
+	}
+
+	if f.Min != nil || f.Max != nil {
+		// Intervalle servi par l'index (key, value) de ad_numeric_attributes, alimentée par trigger
+		// avec les valeurs numériques de form_data (les valeurs non numériques n'y figurent pas)
+		bounds := []string{fmt.Sprintf("n.key = '%s'", f.Key)}
+		if f.Min != nil {
+			bounds = append(bounds, fmt.Sprintf("n.value >= $%d", argIndex))
+			params = append(params, *f.Min)
+			argIndex++
+		}
+		if f.Max != nil {
+			bounds = append(bounds, fmt.Sprintf("n.value <= $%d", argIndex))
+			params = append(params, *f.Max)
+			argIndex++
+		}
+		parts = append(parts, "a.id IN (SELECT n.ad_id FROM ad_numeric_attributes n WHERE "+strings.Join(bounds, " AND ")+")")
+	}
+
+	return strings.Join(parts, " AND "), params
+}
@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"kivendi-backend/config"
+	"kivendi-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// attributeKeyPattern restreint les clés d'attributs (clés JSON de form_data) à des identifiants simples
+var attributeKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+const subCategoryAttributeColumns = `
+	id, sub_category_id, key, label, field_type, is_required, enum_values,
+	unit, min_value, max_value, display_order, created_at, updated_at`
+
+// SubCategoryAttributeRequest est le corps des requêtes admin de création/modification d'un attribut
+type SubCategoryAttributeRequest struct {
+	Key          string   `json:"key"`
+	Label        string   `json:"label"`
+	FieldType    string   `json:"field_type"`
+	IsRequired   bool     `json:"is_required"`
+	EnumValues   []string `json:"enum_values"`
+	Unit         *string  `json:"unit"`
+	MinValue     *float64 `json:"min_value"`
+	MaxValue     *float64 `json:"max_value"`
+	DisplayOrder int      `json:"display_order"`
+}
+
+// scanSubCategoryAttribute lit une ligne de sub_category_attributes (colonnes subCategoryAttributeColumns)
+func scanSubCategoryAttribute(scanner interface{ Scan(...interface{}) error }) (models.SubCategoryAttribute, error) {
+	var attr models.SubCategoryAttribute
+	var enumValues pq.StringArray
+	var unit sql.NullString
+	var minValue, maxValue sql.NullFloat64
+
+	err := scanner.Scan(
+		&attr.ID, &attr.SubCategoryID, &attr.Key, &attr.Label, &attr.FieldType, &attr.IsRequired, &enumValues,
+		&unit, &minValue, &maxValue, &attr.DisplayOrder, &attr.CreatedAt, &attr.UpdatedAt,
+	)
+	if err != nil {
+		return attr, err
+	}
+
+	attr.EnumValues = []string(enumValues)
+	if attr.EnumValues == nil {
+		attr.EnumValues = []string{}
+	}
+	if unit.Valid {
+		attr.Unit = &unit.String
+	}
+	if minValue.Valid {
+		attr.MinValue = &minValue.Float64
+	}
+	if maxValue.Valid {
+		attr.MaxValue = &maxValue.Float64
+	}
+	return attr, nil
+}
+
+// loadSubCategoryAttributes renvoie le schéma d'attributs d'une sous-catégorie, dans l'ordre d'affichage
+func loadSubCategoryAttributes(subCategoryID int) ([]models.SubCategoryAttribute, error) {
+	rows, err := config.DB.Query(`
+		SELECT `+subCategoryAttributeColumns+`
+		FROM sub_category_attributes
+		WHERE sub_category_id = $1
+		ORDER BY display_order ASC, id ASC
+	`, subCategoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attributes := []models.SubCategoryAttribute{}
+	for rows.Next() {
+		attr, err := scanSubCategoryAttribute(rows)
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, attr)
+	}
+	return attributes, rows.Err()
+}
+
+// validateAttributeDefinition vérifie la cohérence d'une définition d'attribut envoyée par un admin.
+// Renvoie un message d'erreur vide si la définition est valide.
+func validateAttributeDefinition(req *SubCategoryAttributeRequest) string {
+	req.Key = strings.TrimSpace(req.Key)
+	req.Label = strings.TrimSpace(req.Label)
+
+	if !attributeKeyPattern.MatchString(req.Key) {
+		return "La clé de l'attribut est invalide (minuscules, chiffres et '_' uniquement, 50 caractères max)"
+	}
+	if req.Label == "" {
+		return "Le libellé de l'attribut est requis"
+	}
+
+	switch req.FieldType {
+	case models.AttributeTypeText, models.AttributeTypeNumber, models.AttributeTypeInteger, models.AttributeTypeBoolean:
+		req.EnumValues = []string{}
+	case models.AttributeTypeEnum, models.AttributeTypeMultiEnum:
+		values := []string{}
+		seen := make(map[string]bool)
+		for _, v := range req.EnumValues {
+			v = strings.TrimSpace(v)
+			if v == "" || seen[strings.ToLower(v)] {
+				continue
+			}
+			seen[strings.ToLower(v)] = true
+			values = append(values, v)
+		}
+		if len(values) == 0 {
+			return "Au moins une valeur possible est requise pour un attribut de type liste"
+		}
+		req.EnumValues = values
+	default:
+		return "Type de champ invalide (text, number, integer, boolean, enum ou multi_enum)"
+	}
+
+	if req.FieldType == models.AttributeTypeBoolean && (req.MinValue != nil || req.MaxValue != nil) {
+		return "Les bornes min/max ne s'appliquent pas à un attribut booléen"
+	}
+	if req.MinValue != nil && req.MaxValue != nil && *req.MinValue > *req.MaxValue {
+		return "La valeur minimale doit être inférieure ou égale à la valeur maximale"
+	}
+	if req.Unit != nil {
+		unit := strings.TrimSpace(*req.Unit)
+		if unit == "" {
+			req.Unit = nil
+		} else {
+			req.Unit = &unit
+		}
+	}
+	return ""
+}
+
+// validateAdFormData valide form_data contre le schéma de la sous-catégorie et normalise les valeurs
+// (nombres envoyés en texte, casse des valeurs de liste, champs vides et clés hors schéma retirés).
+// Les clés hors schéma sont ignorées : une annonce antérieure au schéma, ou à la suppression d'un
+// attribut, doit rester modifiable. Les champs obligatoires absents ne sont refusés qu'à la création
+// (requireAll) ; en modification, seul un champ obligatoire envoyé vide est refusé.
+// Renvoie les erreurs par clé d'attribut ; une sous-catégorie sans schéma accepte tout form_data.
+func validateAdFormData(subCategoryID int, formData map[string]interface{}, requireAll bool) (map[string]string, error) {
+	attributes, err := loadSubCategoryAttributes(subCategoryID)
+	if err != nil {
+		return nil, err
+	}
+	if len(attributes) == 0 {
+		return nil, nil
+	}
+
+	fieldErrors := make(map[string]string)
+	known := make(map[string]bool, len(attributes))
+
+	for _, attr := range attributes {
+		known[attr.Key] = true
+
+		raw, present := formData[attr.Key]
+		if !present || isEmptyAttributeValue(raw) {
+			if attr.IsRequired && (present || requireAll) {
+				fieldErrors[attr.Key] = fmt.Sprintf("Le champ « %s » est obligatoire", attr.Label)
+			}
+			delete(formData, attr.Key)
+			continue
+		}
+
+		value, msg := normalizeAttributeValue(attr, raw)
+		if msg != "" {
+			fieldErrors[attr.Key] = msg
+			continue
+		}
+		formData[attr.Key] = value
+	}
+
+	for key := range formData {
+		if !known[key] {
+			delete(formData, key)
+		}
+	}
+
+	if len(fieldErrors) == 0 {
+		return nil, nil
+	}
+	return fieldErrors, nil
+}
+
+// isEmptyAttributeValue indique si une valeur de form_data doit être considérée comme non renseignée
+func isEmptyAttributeValue(v interface{}) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(val) == ""
+	case []interface{}:
+		return len(val) == 0
+	}
+	return false
+}
+
+// normalizeAttributeValue convertit et vérifie une valeur selon le type de l'attribut
+func normalizeAttributeValue(attr models.SubCategoryAttribute, raw interface{}) (interface{}, string) {
+	switch attr.FieldType {
+	case models.AttributeTypeText:
+		s, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Sprintf("Le champ « %s » doit être un texte", attr.Label)
+		}
+		s = strings.TrimSpace(s)
+		length := float64(utf8.RuneCountInString(s))
+		if attr.MinValue != nil && length < *attr.MinValue {
+			return nil, fmt.Sprintf("Le champ « %s » doit contenir au moins %.0f caractères", attr.Label, *attr.MinValue)
+		}
+		if attr.MaxValue != nil && length > *attr.MaxValue {
+			return nil, fmt.Sprintf("Le champ « %s » doit contenir au plus %.0f caractères", attr.Label, *attr.MaxValue)
+		}
+		return s, ""
+
+	case models.AttributeTypeNumber, models.AttributeTypeInteger:
+		var n float64
+		switch val := raw.(type) {
+		case float64:
+			n = val
+		case string:
+			// Les formulaires envoient souvent "12 500" ou "12,5"
+			cleaned := strings.ReplaceAll(strings.ReplaceAll(strings.TrimSpace(val), " ", ""), ",", ".")
+			parsed, err := strconv.ParseFloat(cleaned, 64)
+			if err != nil {
+				return nil, fmt.Sprintf("Le champ « %s » doit être un nombre", attr.Label)
+			}
+			n = parsed
+		default:
+			return nil, fmt.Sprintf("Le champ « %s » doit être un nombre", attr.Label)
+		}
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, fmt.Sprintf("Le champ « %s » doit être un nombre", attr.Label)
+		}
+		if attr.FieldType == models.AttributeTypeInteger && n != math.Trunc(n) {
+			return nil, fmt.Sprintf("Le champ « %s » doit être un nombre entier", attr.Label)
+		}
+		if attr.MinValue != nil && n < *attr.MinValue {
+			return nil, fmt.Sprintf("Le champ « %s » doit être supérieur ou égal à %s", attr.Label, formatAttributeBound(*attr.MinValue, attr.Unit))
+		}
+		if attr.MaxValue != nil && n > *attr.MaxValue {
+			return nil, fmt.Sprintf("Le champ « %s » doit être inférieur ou égal à %s", attr.Label, formatAttributeBound(*attr.MaxValue, attr.Unit))
+		}
+		return n, ""
+
+	case models.AttributeTypeBoolean:
+		switch val := raw.(type) {
+		case bool:
+			return val, ""
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(val)); err == nil {
+				return b, ""
+			}
+		}
+		return nil, fmt.Sprintf("Le champ « %s » doit être oui ou non", attr.Label)
+
+	case models.AttributeTypeEnum:
+		s, ok := raw.(string)
+		if !ok {
+			return nil, fmt.Sprintf("Le champ « %s » doit être une valeur de la liste", attr.Label)
+		}
+		if v, found := matchEnumValue(attr.EnumValues, s); found {
+			return v, ""
+		}
+		return nil, fmt.Sprintf("La valeur « %s » n'est pas autorisée pour le champ « %s »", s, attr.Label)
+
+	case models.AttributeTypeMultiEnum:
+		items, ok := raw.([]interface{})
+		if !ok {
+			return nil, fmt.Sprintf("Le champ « %s » doit être une liste de valeurs", attr.Label)
+		}
+		values := []string{}
+		seen := make(map[string]bool)
+		for _, item := range items {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Sprintf("Le champ « %s » doit être une liste de valeurs", attr.Label)
+			}
+			v, found := matchEnumValue(attr.EnumValues, s)
+			if !found {
+				return nil, fmt.Sprintf("La valeur « %s » n'est pas autorisée pour le champ « %s »", s, attr.Label)
+			}
+			if !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		}
+		// Pour une liste à choix multiples, min/max portent sur le nombre de choix
+		count := float64(len(values))
+		if attr.MinValue != nil && count < *attr.MinValue {
+			return nil, fmt.Sprintf("Le champ « %s » demande au moins %.0f choix", attr.Label, *attr.MinValue)
+		}
+		if attr.MaxValue != nil && count > *attr.MaxValue {
+			return nil, fmt.Sprintf("Le champ « %s » accepte au plus %.0f choix", attr.Label, *attr.MaxValue)
+		}
+		return values, ""
+	}
+
+	return nil, fmt.Sprintf("Le champ « %s » a un type inconnu", attr.Label)
+}
+
+// matchEnumValue renvoie la valeur canonique de la liste correspondant à s (sans tenir compte de la casse)
+func matchEnumValue(enumValues []string, s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	for _, v := range enumValues {
+		if strings.EqualFold(v, s) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// formatAttributeBound affiche une borne numérique avec son unité éventuelle
+func formatAttributeBound(v float64, unit *string) string {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	if unit != nil {
+		s += " " + *unit
+	}
+	return s
+}
+
+// writeFormDataErrors renvoie une erreur 400 détaillant les attributs invalides de form_data
+func writeFormDataErrors(w http.ResponseWriter, fieldErrors map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  "Les données du formulaire sont invalides",
+		"fields": fieldErrors,
+	})
+}
+
+// GetSubCategoryAttributesHandler renvoie (route publique) le schéma d'attributs d'une sous-catégorie
+// pour que l'application construise ses formulaires de dépôt et de modification d'annonce.
+func GetSubCategoryAttributesHandler(w http.ResponseWriter, r *http.Request) {
+	subCategoryID, err := strconv.Atoi(mux.Vars(r)["subCategoryID"])
+	if err != nil {
+		http.Error(w, "ID de sous-catégorie invalide", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	err = config.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM sub_categories WHERE id = $1)", subCategoryID).Scan(&exists)
+	if err != nil {
+		log.Printf("Erreur lors de la vérification de la sous-catégorie %d: %v", subCategoryID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Sous-catégorie non trouvée", http.StatusNotFound)
+		return
+	}
+
+	attributes, err := loadSubCategoryAttributes(subCategoryID)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération des attributs de la sous-catégorie %d: %v", subCategoryID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sub_category_id": subCategoryID,
+		"attributes":      attributes,
+	})
+}
+
+// validateAdUpdateFormData valide le form_data d'une requête de modification d'annonce
+// (les champs obligatoires absents sont tolérés, voir validateAdFormData).
+// Renvoie le JSON à enregistrer (nil si form_data n'est pas modifié) ; en cas d'échec la réponse
+// d'erreur est déjà écrite et ok vaut false.
+func validateAdUpdateFormData(w http.ResponseWriter, subCategoryID int, formData map[string]interface{}) (formDataJSON *string, ok bool) {
+	if formData == nil {
+		return nil, true
+	}
+
+	fieldErrors, err := validateAdFormData(subCategoryID, formData, false)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération du schéma d'attributs de la sous-catégorie %d: %v", subCategoryID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return nil, false
+	}
+	if fieldErrors != nil {
+		log.Printf("Erreur: form_data ne respecte pas le schéma de la sous-catégorie %d: %v", subCategoryID, fieldErrors)
+		writeFormDataErrors(w, fieldErrors)
+		return nil, false
+	}
+
+	data, _ := json.Marshal(formData)
+	formDataStr := string(data)
+	return &formDataStr, true
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PagePagination est le bloc de pagination classique (page/limit + COUNT total)
+type PagePagination struct {
+	CurrentPage int `json:"current_page"`
+	TotalPages  int `json:"total_pages"`
+	TotalAds    int `json:"total_ads"`
+	Limit       int `json:"limit"`
+}
+
+// CursorPagination est le bloc de pagination par curseur (keyset), sans COUNT total
+type CursorPagination struct {
+	Limit      int     `json:"limit"`
+	NextCursor *string `json:"next_cursor"`
+	HasMore    bool    `json:"has_more"`
+}
+
+// keysetKind est le type des valeurs d'une colonne de tri, vérifié au décodage d'un curseur
+type keysetKind int
+
+const (
+	keysetNumber keysetKind = iota // Nombre (prix, score, distance), en JSON ou en texte
+	keysetTime                     // Horodatage RFC 3339
+	keysetID                       // Identifiant entier
+)
+
+// keysetColumn décrit une colonne de tri utilisée pour la pagination par curseur.
+// La dernière colonne doit toujours être unique (a.id) pour garantir un ordre total.
+type keysetColumn struct {
+	Expr string
+	Desc bool
+	Kind keysetKind
+}
+
+// adCursor est le contenu (opaque pour les clients) d'un curseur : le tri utilisé
+// et les valeurs des colonnes de tri de la dernière annonce renvoyée.
+type adCursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+var errInvalidCursor = errors.New("curseur invalide")
+
+// parseCursorParam indique si le mode curseur est demandé (paramètre "cursor" présent,
+// vide pour la première page) et décode le curseur éventuel.
+func parseCursorParam(r *http.Request, sortBy string, columns []keysetColumn) (enabled bool, cursor *adCursor, err error) {
+	if !r.URL.Query().Has("cursor") {
+		return false, nil, nil
+	}
+	raw := r.URL.Query().Get("cursor")
+	if raw == "" {
+		return true, nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return true, nil, errInvalidCursor
+	}
+	var c adCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return true, nil, errInvalidCursor
+	}
+	// Un curseur n'est valable que pour le tri qui l'a produit
+	if c.Sort != sortBy || len(c.Values) != len(columns) {
+		return true, nil, errInvalidCursor
+	}
+	// Chaque valeur doit avoir le type de sa colonne : elle est ensuite comparée telle quelle en SQL
+	for i, col := range columns {
+		v, ok := cursorValue(col.Kind, c.Values[i])
+		if !ok {
+			return true, nil, errInvalidCursor
+		}
+		c.Values[i] = v
+	}
+	return true, &c, nil
+}
+
+// cursorValue vérifie une valeur décodée d'un curseur et la convertit pour la requête
+func cursorValue(kind keysetKind, raw interface{}) (interface{}, bool) {
+	switch kind {
+	case keysetTime:
+		s, ok := raw.(string)
+		if !ok {
+			return nil, false
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, false
+		}
+		return t, true
+	case keysetID:
+		n, ok := raw.(float64)
+		if !ok || n != math.Trunc(n) || n < 0 || n > math.MaxInt32 {
+			return nil, false
+		}
+		return int64(n), true
+	default:
+		switch v := raw.(type) {
+		case float64:
+			return v, true
+		case string:
+			// Texte produit par PostgreSQL (ex. "Infinity" pour les annonces sans coordonnées) : transmis tel quel
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil || math.IsNaN(n) {
+				return nil, false
+			}
+			return v, true
+		}
+		return nil, false
+	}
+}
+
+// encodeAdCursor produit le curseur opaque à partir des valeurs de tri de la dernière annonce
+func encodeAdCursor(sortBy string, values ...interface{}) string {
+	data, _ := json.Marshal(adCursor{Sort: sortBy, Values: values})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// keysetCondition construit la condition "après le curseur" pour des colonnes de sens mixtes :
+// (c1 > v1) OR (c1 = v1 AND c2 > v2) OR ... en commençant aux paramètres $argIndex.
+func keysetCondition(columns []keysetColumn, cursor *adCursor, argIndex int) (string, []interface{}) {
+	var params []interface{}
+	var placeholders []string
+	for i := range columns {
+		placeholders = append(placeholders, fmt.Sprintf("$%d", argIndex+i))
+		params = append(params, cursor.Values[i])
+	}
+
+	var disjuncts []string
+	for i, col := range columns {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, fmt.Sprintf("%s = %s", columns[j].Expr, placeholders[j]))
+		}
+		op := ">"
+		if col.Desc {
+			op = "<"
+		}
+		parts = append(parts, fmt.Sprintf("%s %s %s", col.Expr, op, placeholders[i]))
+		disjuncts = append(disjuncts, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(disjuncts, " OR ") + ")", params
+}
+
+// keysetOrderBy construit la clause ORDER BY correspondant aux colonnes de tri
+func keysetOrderBy(columns []keysetColumn) string {
+	var parts []string
+	for _, col := range columns {
+		if col.Desc {
+			parts = append(parts, col.Expr+" DESC")
+		} else {
+			parts = append(parts, col.Expr+" ASC")
+		}
+	}
+	return "ORDER BY " + strings.Join(parts, ", ")
+}
+
+// adKeysetColumns renvoie les colonnes de tri "keyset" des flux publics pour un tri donné.
+// rankExpr et distanceExpr ne sont utilisés que pour les tris relevance et distance.
+func adKeysetColumns(sortBy, rankExpr, distanceExpr string) []keysetColumn {
+	switch sortBy {
+	case "oldest":
+		return []keysetColumn{{"a.created_at", false, keysetTime}, {"a.id", false, keysetID}}
+	case "price_asc":
+		return []keysetColumn{{"a.price", false, keysetNumber}, {"a.id", true, keysetID}}
+	case "price_desc":
+		return []keysetColumn{{"a.price", true, keysetNumber}, {"a.id", true, keysetID}}
+	case "relevance":
+		if rankExpr != "" {
+			return []keysetColumn{{rankExpr, true, keysetNumber}, {"a.id", true, keysetID}}
+		}
+	case "distance":
+		if distanceExpr != "" {
+			// Les annonces sans coordonnées passent en dernier
+			return []keysetColumn{{"COALESCE(" + distanceExpr + ", 'Infinity'::float8)", false, keysetNumber}, {"a.id", true, keysetID}}
+		}
+	}
+	return []keysetColumn{{"a.created_at", true, keysetTime}, {"a.id", true, keysetID}}
+}
+
+// keysetSelectColumn renvoie la colonne SELECT (text[]) contenant les valeurs de tri
+// hors a.id, relues pour construire le curseur suivant. Les horodatages sont écrits en RFC 3339 (UTC).
+func keysetSelectColumn(columns []keysetColumn) string {
+	var parts []string
+	for _, col := range columns[:len(columns)-1] {
+		if col.Kind == keysetTime {
+			parts = append(parts, "to_char(("+col.Expr+") AT TIME ZONE 'UTC', 'YYYY-MM-DD\"T\"HH24:MI:SS.US\"Z\"')")
+			continue
+		}
+		parts = append(parts, "("+col.Expr+")::text")
+	}
+	return "ARRAY[" + strings.Join(parts, ", ") + "]"
+}
+
+// nextAdCursor construit le curseur suivant à partir des valeurs de tri de la dernière annonce
+func nextAdCursor(sortBy string, keyValues []string, lastID int) *string {
+	values := make([]interface{}, 0, len(keyValues)+1)
+	for _, v := range keyValues {
+		values = append(values, v)
+	}
+	values = append(values, lastID)
+	cursor := encodeAdCursor(sortBy, values...)
+	return &cursor
+}
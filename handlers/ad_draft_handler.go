@@ -0,0 +1,780 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"kivendi-backend/config"
+	"kivendi-backend/models"
+	"kivendi-backend/services"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// maxAdDraftsPerUser limite le nombre de brouillons d'annonces par utilisateur
+const maxAdDraftsPerUser = 20
+
+// maxAdDraftScheduleDays limite le délai d'une publication programmée
+const maxAdDraftScheduleDays = 30
+
+// AdDraftRequest représente les champs d'un brouillon, tous facultatifs.
+// Images n'est accepté qu'en modification : liste ordonnée des images déjà envoyées à conserver.
+type AdDraftRequest struct {
+	Title               *string                `json:"title"`
+	Description         *string                `json:"description"`
+	Price               *float64               `json:"price"`
+	SubCategoryID       *int                   `json:"sub_category_id"`
+	FormData            map[string]interface{} `json:"form_data"`
+	City                *string                `json:"city"`
+	PhoneNumber         *string                `json:"phone_number"`
+	IsPhoneVisible      *bool                  `json:"is_phone_visible"`
+	IsDeliveryAvailable *bool                  `json:"is_delivery_available"`
+	Latitude            *float64               `json:"latitude"`
+	Longitude           *float64               `json:"longitude"`
+	Images              *[]string              `json:"images"`
+}
+
+// AdDraftPublishRequest représente le corps (facultatif) de la publication d'un brouillon
+type AdDraftPublishRequest struct {
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+const adDraftColumns = `
+	d.id, d.user_id, COALESCE(d.title, ''), COALESCE(d.description, ''), d.price, d.sub_category_id,
+	COALESCE(d.images, '{}'), d.form_data, COALESCE(d.city, ''), COALESCE(d.phone_number, ''),
+	COALESCE(d.is_phone_visible, FALSE), COALESCE(d.is_delivery_available, FALSE),
+	d.latitude, d.longitude, d.publish_at, d.created_at, d.updated_at`
+
+// scanAdDraft lit une ligne produite par adDraftColumns
+func scanAdDraft(scanner interface{ Scan(...interface{}) error }) (models.AdDraft, error) {
+	var d models.AdDraft
+	var price, lat, lng sql.NullFloat64
+	var subCategoryID sql.NullInt64
+	var formData []byte
+	var publishAt sql.NullTime
+
+	err := scanner.Scan(
+		&d.ID, &d.UserID, &d.Title, &d.Description, &price, &subCategoryID,
+		pq.Array(&d.Images), &formData, &d.City, &d.PhoneNumber,
+		&d.IsPhoneVisible, &d.IsDeliveryAvailable,
+		&lat, &lng, &publishAt, &d.CreatedAt, &d.UpdatedAt,
+	)
+	if err != nil {
+		return d, err
+	}
+
+	if price.Valid {
+		d.Price = &price.Float64
+	}
+	if subCategoryID.Valid {
+		v := int(subCategoryID.Int64)
+		d.SubCategoryID = &v
+	}
+	if lat.Valid {
+		d.Latitude = &lat.Float64
+	}
+	if lng.Valid {
+		d.Longitude = &lng.Float64
+	}
+	if len(formData) > 0 {
+		if err := json.Unmarshal(formData, &d.FormData); err != nil {
+			log.Printf("Erreur lors du décodage du form_data du brouillon %d: %v", d.ID, err)
+		}
+	}
+	if d.Images == nil {
+		d.Images = []string{}
+	}
+
+	d.Status = models.AdDraftStatusDraft
+	if publishAt.Valid {
+		d.PublishAt = &publishAt.Time
+		d.Status = models.AdDraftStatusScheduled
+	}
+	d.MissingFields = d.ComputeMissingFields()
+	return d, nil
+}
+
+// loadUserAdDraft renvoie le brouillon draftID de l'utilisateur (sql.ErrNoRows s'il n'existe pas)
+func loadUserAdDraft(ctx context.Context, draftID, userID int) (models.AdDraft, error) {
+	return scanAdDraft(config.DB.QueryRowContext(ctx,
+		"SELECT "+adDraftColumns+" FROM ad_drafts d WHERE d.id = $1 AND d.user_id = $2", draftID, userID))
+}
+
+// validateAdDraftRequest vérifie les champs renseignés d'un brouillon et renvoie un message d'erreur, vide si tout est correct
+func validateAdDraftRequest(ctx context.Context, req *AdDraftRequest) (string, error) {
+	if req.Title != nil {
+		*req.Title = strings.TrimSpace(*req.Title)
+		if len(*req.Title) > 255 {
+			return "Le titre ne doit pas dépasser 255 caractères", nil
+		}
+	}
+	if req.Description != nil {
+		*req.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Price != nil && *req.Price < 0 {
+		return "Le prix ne peut pas être négatif", nil
+	}
+	if req.Latitude != nil && (*req.Latitude < -90 || *req.Latitude > 90) {
+		return "La latitude doit être comprise entre -90 et 90", nil
+	}
+	if req.Longitude != nil && (*req.Longitude < -180 || *req.Longitude > 180) {
+		return "La longitude doit être comprise entre -180 et 180", nil
+	}
+	if req.SubCategoryID != nil {
+		var exists bool
+		err := config.DB.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM sub_categories WHERE id = $1)", *req.SubCategoryID).Scan(&exists)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return "Sous-catégorie introuvable", nil
+		}
+	}
+	return "", nil
+}
+
+// parseAdDraftID lit l'identifiant de brouillon de l'URL
+func parseAdDraftID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	draftID, err := strconv.Atoi(mux.Vars(r)["draftID"])
+	if err != nil {
+		http.Error(w, "ID de brouillon invalide", http.StatusBadRequest)
+		return 0, false
+	}
+	return draftID, true
+}
+
+// writeAdDraft renvoie le brouillon en JSON avec le code HTTP donné
+func writeAdDraft(w http.ResponseWriter, status int, draft models.AdDraft) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(draft)
+}
+
+// GetUserAdDraftsHandler renvoie les brouillons (et publications programmées) de l'utilisateur connecté
+func GetUserAdDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := config.DB.QueryContext(r.Context(),
+		"SELECT "+adDraftColumns+" FROM ad_drafts d WHERE d.user_id = $1 ORDER BY d.updated_at DESC", userID)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération des brouillons de l'utilisateur %d: %v", userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	drafts := []models.AdDraft{}
+	for rows.Next() {
+		draft, err := scanAdDraft(rows)
+		if err != nil {
+			log.Printf("Erreur lors du scan d'un brouillon: %v", err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+			return
+		}
+		drafts = append(drafts, draft)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Erreur après l'itération des brouillons: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(drafts)
+}
+
+// GetUserAdDraftHandler renvoie un brouillon de l'utilisateur connecté
+func GetUserAdDraftHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+	draftID, ok := parseAdDraftID(w, r)
+	if !ok {
+		return
+	}
+
+	draft, err := loadUserAdDraft(r.Context(), draftID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Brouillon non trouvé", http.StatusNotFound)
+			return
+		}
+		log.Printf("Erreur lors de la récupération du brouillon %d: %v", draftID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	writeAdDraft(w, http.StatusOK, draft)
+}
+
+// CreateAdDraftHandler crée un brouillon d'annonce : aucun champ n'est obligatoire,
+// les images sont ajoutées ensuite via UploadAdDraftImagesHandler.
+func CreateAdDraftHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+
+	var req AdDraftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Corps de la requête invalide", http.StatusBadRequest)
+		return
+	}
+	if req.Images != nil {
+		http.Error(w, "Les images s'ajoutent après la création du brouillon", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := validateAdDraftRequest(r.Context(), &req)
+	if err != nil {
+		log.Printf("Erreur lors de la validation du brouillon: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	var count int
+	if err := config.DB.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM ad_drafts WHERE user_id = $1", userID).Scan(&count); err != nil {
+		log.Printf("Erreur lors du comptage des brouillons de l'utilisateur %d: %v", userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxAdDraftsPerUser {
+		http.Error(w, fmt.Sprintf("Vous ne pouvez pas avoir plus de %d brouillons", maxAdDraftsPerUser), http.StatusBadRequest)
+		return
+	}
+
+	var formDataJSON *string
+	if req.FormData != nil {
+		data, _ := json.Marshal(req.FormData)
+		s := string(data)
+		formDataJSON = &s
+	}
+
+	draft, err := scanAdDraft(config.DB.QueryRowContext(r.Context(), `
+		WITH d AS (
+			INSERT INTO ad_drafts (user_id, title, description, price, sub_category_id, form_data, city, phone_number, is_phone_visible, is_delivery_available, latitude, longitude)
+			VALUES ($1, $2, $3, $4, $5, $6::jsonb, $7, $8, COALESCE($9, FALSE), COALESCE($10, FALSE), $11, $12)
+			RETURNING *
+		)
+		SELECT `+adDraftColumns+` FROM d`,
+		userID, req.Title, req.Description, req.Price, req.SubCategoryID, formDataJSON,
+		req.City, req.PhoneNumber, req.IsPhoneVisible, req.IsDeliveryAvailable, req.Latitude, req.Longitude,
+	))
+	if err != nil {
+		log.Printf("Erreur lors de la création du brouillon: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	writeAdDraft(w, http.StatusCreated, draft)
+}
+
+// UpdateAdDraftHandler met à jour les champs renseignés d'un brouillon.
+// Le champ images permet de retirer ou réordonner les images déjà envoyées.
+func UpdateAdDraftHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+	draftID, ok := parseAdDraftID(w, r)
+	if !ok {
+		return
+	}
+
+	var req AdDraftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corps de la requête invalide", http.StatusBadRequest)
+		return
+	}
+
+	draft, err := loadUserAdDraft(r.Context(), draftID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Brouillon non trouvé", http.StatusNotFound)
+			return
+		}
+		log.Printf("Erreur lors de la récupération du brouillon %d: %v", draftID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if draft.PublishAt != nil {
+		http.Error(w, "Annulez la publication programmée avant de modifier ce brouillon", http.StatusConflict)
+		return
+	}
+
+	msg, err := validateAdDraftRequest(r.Context(), &req)
+	if err != nil {
+		log.Printf("Erreur lors de la validation du brouillon %d: %v", draftID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	var setClauses []string
+	var args []interface{}
+	argIndex := 1
+	set := func(column string, value interface{}) {
+		setClauses = append(setClauses, fmt.Sprintf("%s = $%d", column, argIndex))
+		args = append(args, value)
+		argIndex++
+	}
+
+	if req.Title != nil {
+		set("title", *req.Title)
+	}
+	if req.Description != nil {
+		set("description", *req.Description)
+	}
+	if req.Price != nil {
+		set("price", *req.Price)
+	}
+	if req.SubCategoryID != nil {
+		set("sub_category_id", *req.SubCategoryID)
+	}
+	if req.FormData != nil {
+		data, _ := json.Marshal(req.FormData)
+		set("form_data", string(data))
+	}
+	if req.City != nil {
+		set("city", strings.TrimSpace(*req.City))
+	}
+	if req.PhoneNumber != nil {
+		set("phone_number", strings.TrimSpace(*req.PhoneNumber))
+	}
+	if req.IsPhoneVisible != nil {
+		set("is_phone_visible", *req.IsPhoneVisible)
+	}
+	if req.IsDeliveryAvailable != nil {
+		set("is_delivery_available", *req.IsDeliveryAvailable)
+	}
+	if req.Latitude != nil {
+		set("latitude", *req.Latitude)
+	}
+	if req.Longitude != nil {
+		set("longitude", *req.Longitude)
+	}
+
+	// Images : seules les images déjà envoyées pour ce brouillon peuvent être conservées
+	var removedImages []string
+	if req.Images != nil {
+		current := make(map[string]bool, len(draft.Images))
+		for _, url := range draft.Images {
+			current[url] = true
+		}
+		kept := make(map[string]bool, len(*req.Images))
+		for _, url := range *req.Images {
+			if !current[url] {
+				http.Error(w, "Une des images ne fait pas partie de ce brouillon", http.StatusBadRequest)
+				return
+			}
+			kept[url] = true
+		}
+		for _, url := range draft.Images {
+			if !kept[url] {
+				removedImages = append(removedImages, url)
+			}
+		}
+		set("images", pq.Array(*req.Images))
+	}
+
+	if len(setClauses) == 0 {
+		http.Error(w, "Aucun champ à mettre à jour", http.StatusBadRequest)
+		return
+	}
+	set("updated_at", time.Now())
+
+	query := fmt.Sprintf("UPDATE ad_drafts SET %s WHERE id = $%d AND user_id = $%d AND publish_at IS NULL",
+		strings.Join(setClauses, ", "), argIndex, argIndex+1)
+	args = append(args, draftID, userID)
+
+	result, err := config.DB.ExecContext(r.Context(), query, args...)
+	if err != nil {
+		log.Printf("Erreur lors de la mise à jour du brouillon %d: %v", draftID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		http.Error(w, "Brouillon non trouvé", http.StatusNotFound)
+		return
+	}
+
+	// Supprimer du stockage les images retirées du brouillon
+	if len(removedImages) > 0 {
+		if err := mediaService.DeleteImages(removedImages); err != nil {
+			log.Printf("Erreur lors de la suppression des images retirées du brouillon %d: %v", draftID, err)
+		}
+	}
+
+	draft, err = loadUserAdDraft(r.Context(), draftID, userID)
+	if err != nil {
+		log.Printf("Erreur lors de la relecture du brouillon %d: %v", draftID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	writeAdDraft(w, http.StatusOK, draft)
+}
+
+// UploadAdDraftImagesHandler ajoute des images (multipart, champ "images") à la suite de celles du brouillon,
+// dans la limite de app_settings.max_images_per_ad.
+func UploadAdDraftImagesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+	draftID, ok := parseAdDraftID(w, r)
+	if !ok {
+		return
+	}
+
+	// Limiter la taille de la requête pour éviter les attaques DoS
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<20) // 10 MB
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		log.Printf("Erreur lors de l'analyse du formulaire multipart : %v", err)
+		http.Error(w, "La requête est trop grande", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	files := r.MultipartForm.File["images"]
+	if len(files) == 0 {
+		http.Error(w, "Au moins une image est requise", http.StatusBadRequest)
+		return
+	}
+
+	draft, err := loadUserAdDraft(r.Context(), draftID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Brouillon non trouvé", http.StatusNotFound)
+			return
+		}
+		log.Printf("Erreur lors de la récupération du brouillon %d: %v", draftID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if draft.PublishAt != nil {
+		http.Error(w, "Annulez la publication programmée avant de modifier ce brouillon", http.StatusConflict)
+		return
+	}
+
+	adSettings := services.GetAdSettings()
+	if adSettings.MaxImagesPerAd > 0 && len(draft.Images)+len(files) > adSettings.MaxImagesPerAd {
+		http.Error(w, fmt.Sprintf("Vous ne pouvez pas ajouter plus de %d images", adSettings.MaxImagesPerAd), http.StatusBadRequest)
+		return
+	}
+
+	uploadedImageURLs, err := mediaService.UploadAdMultipartImages(files)
+	if err != nil {
+		log.Printf("Erreur lors de l'upload des images du brouillon %d: %v", draftID, err)
+		http.Error(w, "Erreur lors de l'upload des images", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := config.DB.ExecContext(r.Context(), `
+		UPDATE ad_drafts SET images = COALESCE(images, '{}') || $1, updated_at = NOW()
+		WHERE id = $2 AND user_id = $3 AND publish_at IS NULL
+	`, pq.Array(uploadedImageURLs), draftID, userID)
+	if err == nil {
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			err = sql.ErrNoRows
+		}
+	}
+	if err != nil {
+		log.Printf("Erreur lors de l'ajout des images au brouillon %d: %v", draftID, err)
+		if deleteErr := mediaService.DeleteImages(uploadedImageURLs); deleteErr != nil {
+			log.Printf("Erreur lors de la suppression des images: %v", deleteErr)
+		}
+		if err == sql.ErrNoRows {
+			http.Error(w, "Brouillon non trouvé", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	draft, err = loadUserAdDraft(r.Context(), draftID, userID)
+	if err != nil {
+		log.Printf("Erreur lors de la relecture du brouillon %d: %v", draftID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	writeAdDraft(w, http.StatusOK, draft)
+}
+
+// DeleteAdDraftHandler supprime un brouillon et ses images
+func DeleteAdDraftHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+	draftID, ok := parseAdDraftID(w, r)
+	if !ok {
+		return
+	}
+
+	var images []string
+	err := config.DB.QueryRowContext(r.Context(),
+		"DELETE FROM ad_drafts WHERE id = $1 AND user_id = $2 RETURNING COALESCE(images, '{}')", draftID, userID,
+	).Scan(pq.Array(&images))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Brouillon non trouvé", http.StatusNotFound)
+			return
+		}
+		log.Printf("Erreur lors de la suppression du brouillon %d: %v", draftID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	if len(images) > 0 {
+		if err := mediaService.DeleteImages(images); err != nil {
+			log.Printf("Erreur lors de la suppression des images du brouillon %d: %v", draftID, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PublishAdDraftHandler publie un brouillon complet : immédiatement (modération ou validation automatique)
+// ou, si publish_at est dans le futur, à la date programmée par le job de publication.
+func PublishAdDraftHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+	draftID, ok := parseAdDraftID(w, r)
+	if !ok {
+		return
+	}
+
+	var req AdDraftPublishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Corps de la requête invalide", http.StatusBadRequest)
+		return
+	}
+	if req.PublishAt != nil && req.PublishAt.After(time.Now().AddDate(0, 0, maxAdDraftScheduleDays)) {
+		http.Error(w, fmt.Sprintf("La publication ne peut pas être programmée à plus de %d jours", maxAdDraftScheduleDays), http.StatusBadRequest)
+		return
+	}
+
+	draft, err := loadUserAdDraft(r.Context(), draftID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Brouillon non trouvé", http.StatusNotFound)
+			return
+		}
+		log.Printf("Erreur lors de la récupération du brouillon %d: %v", draftID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	// Mêmes exigences que CreateAdHandler
+	if len(draft.MissingFields) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":          "Les champs obligatoires sont manquants.",
+			"missing_fields": draft.MissingFields,
+		})
+		return
+	}
+
+	adSettings := services.GetAdSettings()
+	if adSettings.MaxImagesPerAd > 0 && len(draft.Images) > adSettings.MaxImagesPerAd {
+		http.Error(w, fmt.Sprintf("Vous ne pouvez pas ajouter plus de %d images", adSettings.MaxImagesPerAd), http.StatusBadRequest)
+		return
+	}
+
+	// Valider les attributs contre le schéma de la sous-catégorie et enregistrer les valeurs normalisées
+	formData := draft.FormData
+	if formData == nil {
+		formData = map[string]interface{}{}
+	}
+	fieldErrors, err := validateAdFormData(*draft.SubCategoryID, formData, true)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération du schéma d'attributs de la sous-catégorie %d: %v", *draft.SubCategoryID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if fieldErrors != nil {
+		log.Printf("Erreur: form_data du brouillon %d ne respecte pas le schéma de la sous-catégorie %d: %v", draftID, *draft.SubCategoryID, fieldErrors)
+		writeFormDataErrors(w, fieldErrors)
+		return
+	}
+	formDataJSON, _ := json.Marshal(formData)
+
+	// Republication à l'identique d'une annonce du vendeur (si app_settings.block_duplicate_ads)
+	if !checkExactRepost(w, r.Context(), userID, draft.Title, draft.Images, 0) {
+		return
+	}
+
+	scheduled := req.PublishAt != nil && req.PublishAt.After(time.Now())
+	var publishAt *time.Time
+	if scheduled {
+		publishAt = req.PublishAt
+	}
+	_, err = config.DB.ExecContext(r.Context(),
+		"UPDATE ad_drafts SET form_data = $1, publish_at = $2, updated_at = NOW() WHERE id = $3 AND user_id = $4",
+		string(formDataJSON), publishAt, draftID, userID)
+	if err != nil {
+		log.Printf("Erreur lors de la préparation de la publication du brouillon %d: %v", draftID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	// Publication programmée : le job de publication s'en chargera à publish_at
+	if scheduled {
+		draft, err = loadUserAdDraft(r.Context(), draftID, userID)
+		if err != nil {
+			log.Printf("Erreur lors de la relecture du brouillon %d: %v", draftID, err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Publication du brouillon %d programmée le %s", draftID, publishAt.Format(time.RFC3339))
+		writeAdDraft(w, http.StatusOK, draft)
+		return
+	}
+
+	published, err := services.PublishAdDraft(r.Context(), draftID, false)
+	if err != nil {
+		if errors.Is(err, services.ErrDraftNotPublishable) {
+			http.Error(w, "Brouillon non trouvé ou incomplet", http.StatusConflict)
+			return
+		}
+		log.Printf("Erreur lors de la publication du brouillon %d: %v", draftID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Brouillon %d publié. ID de l'annonce: %d", draftID, published.AdID)
+
+	// Validation automatique : mêmes notifications que la validation par un modérateur
+	if published.IsValidated {
+		services.NotifyAdValidated(r.Context(), userID, published.AdID, published.Title)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":           published.AdID,
+		"message":      "Annonce créée avec succès",
+		"images":       draft.Images,
+		"is_validated": published.IsValidated,
+	})
+}
+
+// ValidateScheduledAdDraft revérifie un brouillon programmé au moment de sa publication, avec les mêmes règles
+// que PublishAdDraftHandler et les paramètres en vigueur (nombre d'images, attributs de la sous-catégorie,
+// republication à l'identique). Renvoie le motif du refus, vide si le brouillon peut être publié ;
+// services.ErrDraftNotPublishable si le brouillon n'existe plus.
+func ValidateScheduledAdDraft(ctx context.Context, draftID int) (string, error) {
+	draft, err := scanAdDraft(config.DB.QueryRowContext(ctx,
+		"SELECT "+adDraftColumns+" FROM ad_drafts d WHERE d.id = $1", draftID))
+	if err == sql.ErrNoRows {
+		return "", services.ErrDraftNotPublishable
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if len(draft.MissingFields) > 0 {
+		return "il est incomplet", nil
+	}
+
+	adSettings := services.GetAdSettings()
+	if adSettings.MaxImagesPerAd > 0 && len(draft.Images) > adSettings.MaxImagesPerAd {
+		return fmt.Sprintf("il dépasse la limite de %d images par annonce", adSettings.MaxImagesPerAd), nil
+	}
+
+	formData := draft.FormData
+	if formData == nil {
+		formData = map[string]interface{}{}
+	}
+	// Le brouillon a été validé à la programmation : un attribut devenu obligatoire ou supprimé
+	// depuis ne l'empêche pas de paraître, seules les valeurs envoyées doivent rester valides
+	fieldErrors, err := validateAdFormData(*draft.SubCategoryID, formData, false)
+	if err != nil {
+		return "", err
+	}
+	if fieldErrors != nil {
+		return "ses caractéristiques ne correspondent plus au formulaire de la catégorie", nil
+	}
+	formDataJSON, _ := json.Marshal(formData)
+	if _, err := config.DB.ExecContext(ctx, "UPDATE ad_drafts SET form_data = $1 WHERE id = $2 AND publish_at IS NOT NULL", string(formDataJSON), draftID); err != nil {
+		return "", err
+	}
+
+	if adSettings.BlockDuplicateAds {
+		_, found, err := findExactRepost(ctx, draft.UserID, draft.Title, draft.Images, 0)
+		if err != nil {
+			return "", err
+		}
+		if found {
+			return "il est identique à une annonce que vous avez déjà publiée", nil
+		}
+	}
+	return "", nil
+}
+
+// CancelAdDraftScheduleHandler annule la publication programmée d'un brouillon, qui redevient modifiable
+func CancelAdDraftScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+	draftID, ok := parseAdDraftID(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := config.DB.ExecContext(r.Context(),
+		"UPDATE ad_drafts SET publish_at = NULL, updated_at = NOW() WHERE id = $1 AND user_id = $2 AND publish_at IS NOT NULL",
+		draftID, userID)
+	if err != nil {
+		log.Printf("Erreur lors de l'annulation de la publication du brouillon %d: %v", draftID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		http.Error(w, "Aucune publication programmée pour ce brouillon", http.StatusNotFound)
+		return
+	}
+
+	draft, err := loadUserAdDraft(r.Context(), draftID, userID)
+	if err != nil {
+		log.Printf("Erreur lors de la relecture du brouillon %d: %v", draftID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	writeAdDraft(w, http.StatusOK, draft)
+}
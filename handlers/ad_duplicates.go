@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"kivendi-backend/config"
+	"kivendi-backend/models"
+	"kivendi-backend/services"
+
+	"github.com/lib/pq"
+)
+
+// maxAdDuplicateCandidates limite le nombre de doublons probables renvoyés pour une annonce
+const maxAdDuplicateCandidates = 20
+
+// imageHashDistanceSQL calcule la distance de Hamming entre deux empreintes BIGINT
+const imageHashDistanceSQL = `length(replace(((%s # %s)::bit(64))::text, '0', ''))`
+
+// findAdDuplicates renvoie les annonces ressemblant à adID : même titre normalisé ou images
+// visuellement identiques, chez le même vendeur comme sur d'autres comptes.
+func findAdDuplicates(ctx context.Context, adID int) ([]models.AdDuplicateCandidate, error) {
+	var title string
+	err := config.DB.QueryRowContext(ctx, "SELECT title FROM ads WHERE id = $1", adID).Scan(&title)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make(map[int]*models.AdDuplicateCandidate)
+	candidate := func(id int) *models.AdDuplicateCandidate {
+		if c, ok := candidates[id]; ok {
+			return c
+		}
+		c := &models.AdDuplicateCandidate{AdID: id, Reasons: []string{}}
+		candidates[id] = c
+		return c
+	}
+
+	// Même titre normalisé
+	if fingerprint := services.TitleFingerprint(title); fingerprint != "" {
+		rows, err := config.DB.QueryContext(ctx, `
+			SELECT id FROM ads WHERE title_fingerprint = $1 AND id <> $2
+			ORDER BY created_at DESC
+			LIMIT $3
+		`, fingerprint, adID, maxAdDuplicateCandidates)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			c := candidate(id)
+			c.Reasons = append(c.Reasons, models.AdDuplicateReasonTitle)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Images visuellement identiques (empreintes perceptuelles proches)
+	distanceSQL := fmt.Sprintf(imageHashDistanceSQL, "mine.phash", "other.phash")
+	rows, err := config.DB.QueryContext(ctx, `
+		WITH mine AS (
+			SELECT img, h.phash, h.bands
+			FROM ads a
+			CROSS JOIN LATERAL unnest(a.images) AS img
+			JOIN ad_image_hashes h ON h.image_url = img
+			WHERE a.id = $1
+		), similar AS (
+			SELECT mine.img, other.image_url, `+distanceSQL+` AS distance
+			FROM mine
+			JOIN ad_image_hashes other ON other.bands && mine.bands AND other.image_url <> mine.img
+			WHERE `+distanceSQL+` <= $2
+		)
+		SELECT o.id, similar.img, similar.image_url, similar.distance
+		FROM similar
+		JOIN ads o ON o.images @> ARRAY[similar.image_url] AND o.id <> $1
+		ORDER BY similar.distance, o.created_at DESC
+		LIMIT 100
+	`, adID, services.ImageHashDuplicateDistance)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		var match models.AdImageMatch
+		if err := rows.Scan(&id, &match.Image, &match.MatchedImage, &match.Distance); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c := candidate(id)
+		if len(c.MatchingImages) == 0 {
+			c.Reasons = append(c.Reasons, models.AdDuplicateReasonImage)
+		}
+		c.MatchingImages = append(c.MatchingImages, match)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(candidates) == 0 {
+		return []models.AdDuplicateCandidate{}, nil
+	}
+
+	// Informations sur les annonces candidates et leurs vendeurs
+	ids := make([]int64, 0, len(candidates))
+	for id := range candidates {
+		ids = append(ids, int64(id))
+	}
+	rows, err = config.DB.QueryContext(ctx, `
+		SELECT o.id, o.title, o.user_id,
+			CASE WHEN u.account_type = 'Professionnel' AND u.shop_name IS NOT NULL THEN u.shop_name
+				ELSE u.first_name || ' ' || u.last_name END,
+			o.user_id = (SELECT user_id FROM ads WHERE id = $2),
+			COALESCE(o.is_validated, FALSE), COALESCE(o.is_sold, FALSE), o.created_at
+		FROM ads o
+		JOIN users u ON u.id = o.user_id
+		WHERE o.id = ANY($1)
+	`, pq.Array(ids), adID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []models.AdDuplicateCandidate{}
+	for rows.Next() {
+		var id int
+		var info models.AdDuplicateCandidate
+		if err := rows.Scan(&id, &info.Title, &info.UserID, &info.SellerName, &info.SameSeller,
+			&info.IsValidated, &info.IsSold, &info.CreatedAt); err != nil {
+			return nil, err
+		}
+		c := candidates[id]
+		info.AdID = id
+		info.Reasons = c.Reasons
+		info.MatchingImages = c.MatchingImages
+		result = append(result, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Le même vendeur d'abord, puis les annonces cumulant titre et images, puis les plus récentes
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].SameSeller != result[j].SameSeller {
+			return result[i].SameSeller
+		}
+		if len(result[i].Reasons) != len(result[j].Reasons) {
+			return len(result[i].Reasons) > len(result[j].Reasons)
+		}
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	if len(result) > maxAdDuplicateCandidates {
+		result = result[:maxAdDuplicateCandidates]
+	}
+	return result, nil
+}
+
+// findExactRepost cherche une annonce non vendue du même vendeur republiée à l'identique :
+// même titre normalisé et au moins une image d'empreinte perceptuelle identique.
+// excludeAdID exclut l'annonce elle-même (0 lors d'une création).
+func findExactRepost(ctx context.Context, userID int, title string, images []string, excludeAdID int) (int, bool, error) {
+	fingerprint := services.TitleFingerprint(title)
+	if fingerprint == "" || len(images) == 0 {
+		return 0, false, nil
+	}
+
+	var adID int
+	err := config.DB.QueryRowContext(ctx, `
+		SELECT a.id
+		FROM ads a
+		WHERE a.user_id = $1 AND a.title_fingerprint = $2 AND a.id <> $3
+		AND COALESCE(a.is_sold, FALSE) = FALSE
+		AND EXISTS (
+			SELECT 1
+			FROM unnest(a.images) AS img
+			JOIN ad_image_hashes h ON h.image_url = img
+			JOIN ad_image_hashes n ON n.image_url = ANY($4) AND n.phash = h.phash
+		)
+		ORDER BY a.created_at DESC
+		LIMIT 1
+	`, userID, fingerprint, excludeAdID, pq.Array(images)).Scan(&adID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return adID, true, nil
+}
+
+// editMayCreateRepost indique si une modification peut rendre l'annonce identique à une autre annonce du
+// vendeur : titre différent (à l'empreinte près) ou nouvelle image. Retirer ou réordonner des images ne le
+// peut pas, et une annonce déjà en double reste ainsi modifiable (prix, description...).
+func editMayCreateRepost(oldTitle, newTitle string, oldImages, newImages []string) bool {
+	if services.TitleFingerprint(oldTitle) != services.TitleFingerprint(newTitle) {
+		return true
+	}
+	current := make(map[string]bool, len(oldImages))
+	for _, img := range oldImages {
+		current[img] = true
+	}
+	for _, img := range newImages {
+		if !current[img] {
+			return true
+		}
+	}
+	return false
+}
+
+// checkExactRepost refuse (409) la republication à l'identique d'une annonce du vendeur lorsque
+// app_settings.block_duplicate_ads est activé. excludeAdID est l'annonce modifiée (0 à la création).
+// Renvoie false si une réponse d'erreur a été écrite.
+func checkExactRepost(w http.ResponseWriter, ctx context.Context, userID int, title string, images []string, excludeAdID int) bool {
+	if !services.GetAdSettings().BlockDuplicateAds {
+		return true
+	}
+
+	existingAdID, found, err := findExactRepost(ctx, userID, title, images, excludeAdID)
+	if err != nil {
+		log.Printf("Erreur lors de la recherche de doublons pour l'utilisateur %d: %v", userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return false
+	}
+	if !found {
+		return true
+	}
+
+	log.Printf("Republication refusée: l'utilisateur %d a déjà publié l'annonce %d à l'identique", userID, existingAdID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":          "Vous avez déjà publié cette annonce. Modifiez ou renouvelez l'annonce existante plutôt que de la republier.",
+		"existing_ad_id": existingAdID,
+	})
+	return false
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kivendi-backend/config"
+	"kivendi-backend/services"
+
+	"github.com/gorilla/mux"
+)
+
+// RenewAdHandler permet au vendeur de renouveler une annonce expirée (ou sur le point d'expirer)
+// pour une nouvelle durée de publication.
+func RenewAdHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		log.Println("Erreur: ID utilisateur non trouvé dans le contexte.")
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+
+	adID, err := strconv.Atoi(mux.Vars(r)["adID"])
+	if err != nil {
+		http.Error(w, "ID d'annonce invalide", http.StatusBadRequest)
+		return
+	}
+
+	// Vérifier que l'utilisateur est propriétaire de l'annonce
+	var adOwnerID int
+	var isSold bool
+	err = config.DB.QueryRow(`SELECT user_id, is_sold FROM ads WHERE id = $1`, adID).Scan(&adOwnerID, &isSold)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Annonce non trouvée", http.StatusNotFound)
+		} else {
+			log.Printf("Erreur lors de la vérification de l'annonce: %v", err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		}
+		return
+	}
+	if adOwnerID != userID {
+		http.Error(w, "Vous n'êtes pas autorisé à modifier cette annonce", http.StatusForbidden)
+		return
+	}
+	if isSold {
+		http.Error(w, "Une annonce vendue ne peut pas être renouvelée", http.StatusConflict)
+		return
+	}
+
+	// Nouvelle durée de publication à partir de maintenant ; le rappel pourra être renvoyé
+	var expiresAt sql.NullTime
+	err = config.DB.QueryRow(`
+		UPDATE ads
+		SET expires_at = `+services.AdExpiresAtSQL+`,
+			is_expired = FALSE,
+			expired_at = NULL,
+			expiry_reminder_sent_at = NULL,
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING expires_at
+	`, adID).Scan(&expiresAt)
+	if err != nil {
+		log.Printf("Erreur lors du renouvellement de l'annonce %d: %v", adID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Message   string     `json:"message"`
+		AdID      int        `json:"ad_id"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}{
+		Message: "Annonce renouvelée avec succès",
+		AdID:    adID,
+	}
+	if expiresAt.Valid {
+		response.ExpiresAt = &expiresAt.Time
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Erreur lors de l'encodage de la réponse JSON: %v", err)
+	}
+
+	log.Printf("Annonce %d renouvelée par l'utilisateur %d", adID, userID)
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"kivendi-backend/config"
+)
+
+// maxCityFacets limite le nombre de villes renvoyées dans les facettes
+const maxCityFacets = 20
+
+// Facettes disponibles pour la recherche (paramètre facets=category,city,price,delivery)
+var searchFacetNames = []string{"category", "city", "price", "delivery"}
+
+// priceBucket décrit une tranche de prix (en FCFA) des facettes de recherche
+type priceBucket struct {
+	Key string
+	Min *float64
+	Max *float64 // Borne exclusive
+}
+
+func floatPtr(v float64) *float64 { return &v }
+
+// searchPriceBuckets sont les tranches de prix proposées dans les filtres de l'application
+var searchPriceBuckets = []priceBucket{
+	{Key: "0-10000", Max: floatPtr(10000)},
+	{Key: "10000-50000", Min: floatPtr(10000), Max: floatPtr(50000)},
+	{Key: "50000-100000", Min: floatPtr(50000), Max: floatPtr(100000)},
+	{Key: "100000-500000", Min: floatPtr(100000), Max: floatPtr(500000)},
+	{Key: "500000-1000000", Min: floatPtr(500000), Max: floatPtr(1000000)},
+	{Key: "1000000-5000000", Min: floatPtr(1000000), Max: floatPtr(5000000)},
+	{Key: "5000000+", Min: floatPtr(5000000)},
+}
+
+// FacetCount est le nombre d'annonces pour une valeur de filtre
+type FacetCount struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// SubCategoryFacet est le nombre d'annonces d'une sous-catégorie
+type SubCategoryFacet struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// CategoryFacet est le nombre d'annonces d'une catégorie, détaillé par sous-catégorie
+type CategoryFacet struct {
+	ID            int                `json:"id"`
+	Name          string             `json:"name"`
+	Count         int                `json:"count"`
+	SubCategories []SubCategoryFacet `json:"sub_categories"`
+}
+
+// PriceFacet est le nombre d'annonces d'une tranche de prix
+type PriceFacet struct {
+	Key      string   `json:"key"`
+	MinPrice *float64 `json:"min_price,omitempty"`
+	MaxPrice *float64 `json:"max_price,omitempty"`
+	Count    int      `json:"count"`
+}
+
+// DeliveryFacet est le nombre d'annonces avec ou sans livraison
+type DeliveryFacet struct {
+	IsDeliveryAvailable bool `json:"is_delivery_available"`
+	Count               int  `json:"count"`
+}
+
+// SearchFacets regroupe les facettes calculées pour une recherche
+type SearchFacets struct {
+	Categories  []CategoryFacet `json:"categories,omitempty"`
+	Cities      []FacetCount    `json:"cities,omitempty"`
+	PriceRanges []PriceFacet    `json:"price_ranges,omitempty"`
+	Delivery    []DeliveryFacet `json:"delivery,omitempty"`
+}
+
+// parseFacetsParam lit le paramètre facets : vide = toutes les facettes,
+// "none"/"false"/"0" = aucune, sinon une liste séparée par des virgules.
+func parseFacetsParam(r *http.Request) map[string]bool {
+	wanted := make(map[string]bool)
+	raw := strings.TrimSpace(strings.ToLower(r.URL.Query().Get("facets")))
+	switch raw {
+	case "":
+		for _, name := range searchFacetNames {
+			wanted[name] = true
+		}
+	case "none", "false", "0":
+	default:
+		for _, name := range strings.Split(raw, ",") {
+			wanted[strings.TrimSpace(name)] = true
+		}
+	}
+	return wanted
+}
+
+// facetWhere renvoie la clause WHERE d'une facette : le filtre de sa propre dimension est
+// neutralisé ("OR TRUE") afin que l'application puisse proposer les autres choix, tandis que
+// tous les autres filtres actifs s'appliquent. Les paramètres restent ainsi tous référencés.
+func facetWhere(clauses, dims []string, facet string) string {
+	parts := make([]string, 0, len(clauses))
+	for i, clause := range clauses {
+		if dims[i] == facet {
+			parts = append(parts, "(("+clause+") OR TRUE)")
+		} else {
+			parts = append(parts, clause)
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " AND " + strings.Join(parts, " AND ")
+}
+
+// computeSearchFacets calcule en une requête les facettes demandées pour une recherche.
+// baseFrom contient le FROM et les conditions de visibilité des annonces publiques.
+func computeSearchFacets(baseFrom string, clauses, dims []string, args []interface{}, wanted map[string]bool) (*SearchFacets, error) {
+	var subQueries []string
+
+	if wanted["category"] {
+		subQueries = append(subQueries, `
+		SELECT 'category', sc.id::text, sc.name, c.id::text, c.name, COUNT(*)
+		`+baseFrom+facetWhere(clauses, dims, "category")+`
+		GROUP BY c.id, c.name, sc.id, sc.name`)
+	}
+	if wanted["city"] {
+		// Même normalisation que le filtre city (casse, espaces, tirets) ; libellé = graphie la plus fréquente
+		subQueries = append(subQueries, `
+		SELECT 'city', REPLACE(REPLACE(LOWER(a.city), '-', ''), ' ', ''), mode() WITHIN GROUP (ORDER BY TRIM(a.city)), NULL, NULL, COUNT(*)
+		`+baseFrom+facetWhere(clauses, dims, "city")+` AND a.city IS NOT NULL AND TRIM(a.city) != ''
+		GROUP BY REPLACE(REPLACE(LOWER(a.city), '-', ''), ' ', '')`)
+	}
+	if wanted["price"] {
+		var cases []string
+		for _, b := range searchPriceBuckets {
+			var conds []string
+			if b.Min != nil {
+				conds = append(conds, fmt.Sprintf("a.price >= %.0f", *b.Min))
+			}
+			if b.Max != nil {
+				conds = append(conds, fmt.Sprintf("a.price < %.0f", *b.Max))
+			}
+			cases = append(cases, fmt.Sprintf("WHEN %s THEN '%s'", strings.Join(conds, " AND "), b.Key))
+		}
+		subQueries = append(subQueries, `
+		SELECT 'price', bucket, NULL, NULL, NULL, COUNT(*)
+		FROM (
+			SELECT CASE `+strings.Join(cases, " ")+` END AS bucket
+			`+baseFrom+facetWhere(clauses, dims, "price")+`
+		) AS prices
+		GROUP BY bucket`)
+	}
+	if wanted["delivery"] {
+		subQueries = append(subQueries, `
+		SELECT 'delivery', COALESCE(a.is_delivery_available, FALSE)::text, NULL, NULL, NULL, COUNT(*)
+		`+baseFrom+facetWhere(clauses, dims, "delivery")+`
+		GROUP BY COALESCE(a.is_delivery_available, FALSE)`)
+	}
+
+	if len(subQueries) == 0 {
+		return nil, nil
+	}
+
+	rows, err := config.DB.Query(strings.Join(subQueries, "\n\t\tUNION ALL"), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := &SearchFacets{}
+	categoryIndex := make(map[string]int)
+	priceCounts := make(map[string]int)
+	deliveryCounts := make(map[bool]int)
+
+	for rows.Next() {
+		var facet string
+		var value, label, parentValue, parentLabel *string
+		var count int
+		if err := rows.Scan(&facet, &value, &label, &parentValue, &parentLabel, &count); err != nil {
+			return nil, err
+		}
+		if value == nil {
+			continue
+		}
+
+		switch facet {
+		case "category":
+			idx, ok := categoryIndex[*parentValue]
+			if !ok {
+				categoryID, _ := strconv.Atoi(*parentValue)
+				facets.Categories = append(facets.Categories, CategoryFacet{ID: categoryID, Name: *parentLabel})
+				idx = len(facets.Categories) - 1
+				categoryIndex[*parentValue] = idx
+			}
+			subCategoryID, _ := strconv.Atoi(*value)
+			facets.Categories[idx].Count += count
+			facets.Categories[idx].SubCategories = append(facets.Categories[idx].SubCategories,
+				SubCategoryFacet{ID: subCategoryID, Name: *label, Count: count})
+		case "city":
+			facets.Cities = append(facets.Cities, FacetCount{Value: *value, Label: *label, Count: count})
+		case "price":
+			priceCounts[*value] = count
+		case "delivery":
+			deliveryCounts[*value == "true"] = count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Tri par nombre d'annonces décroissant
+	sort.Slice(facets.Categories, func(i, j int) bool { return facets.Categories[i].Count > facets.Categories[j].Count })
+	for _, category := range facets.Categories {
+		subs := category.SubCategories
+		sort.Slice(subs, func(i, j int) bool { return subs[i].Count > subs[j].Count })
+	}
+	sort.Slice(facets.Cities, func(i, j int) bool { return facets.Cities[i].Count > facets.Cities[j].Count })
+	if len(facets.Cities) > maxCityFacets {
+		facets.Cities = facets.Cities[:maxCityFacets]
+	}
+
+	// Les tranches de prix et la livraison sont toujours renvoyées dans le même ordre, même à 0
+	if wanted["price"] {
+		for _, b := range searchPriceBuckets {
+			facets.PriceRanges = append(facets.PriceRanges, PriceFacet{Key: b.Key, MinPrice: b.Min, MaxPrice: b.Max, Count: priceCounts[b.Key]})
+		}
+	}
+	if wanted["delivery"] {
+		facets.Delivery = []DeliveryFacet{
+			{IsDeliveryAvailable: true, Count: deliveryCounts[true]},
+			{IsDeliveryAvailable: false, Count: deliveryCounts[false]},
+		}
+	}
+
+	return facets, nil
+}
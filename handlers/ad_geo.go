@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// earthRadiusKm est le rayon moyen de la Terre utilisé par la formule de haversine
+const earthRadiusKm = 6371.0
+
+// kmPerDegreeLat correspond à la distance approximative d'un degré de latitude
+const kmPerDegreeLat = 111.045
+
+// geoFilter regroupe les paramètres de recherche "autour de moi" (lat, lng, radius_km)
+type geoFilter struct {
+	Lat      float64
+	Lng      float64
+	RadiusKm *float64
+}
+
+// parseGeoFilter lit les paramètres lat, lng et radius_km de la requête.
+// Renvoie nil si aucune position valide n'est fournie (le filtre est alors ignoré).
+func parseGeoFilter(r *http.Request) *geoFilter {
+	latStr := r.URL.Query().Get("lat")
+	lngStr := r.URL.Query().Get("lng")
+	if latStr == "" || lngStr == "" {
+		return nil
+	}
+
+	lat, err := strconv.ParseFloat(latStr, 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return nil
+	}
+	lng, err := strconv.ParseFloat(lngStr, 64)
+	if err != nil || lng < -180 || lng > 180 {
+		return nil
+	}
+
+	geo := &geoFilter{Lat: lat, Lng: lng}
+	if radiusStr := r.URL.Query().Get("radius_km"); radiusStr != "" {
+		if radius, err := strconv.ParseFloat(radiusStr, 64); err == nil && radius > 0 {
+			geo.RadiusKm = &radius
+		}
+	}
+	return geo
+}
+
+// distanceSQL renvoie l'expression SQL (haversine) de la distance en kilomètres
+// entre l'annonce et la position passée aux paramètres $latIdx et $lngIdx.
+func distanceSQL(latIdx, lngIdx int) string {
+	return fmt.Sprintf(`(%g * acos(LEAST(1.0, GREATEST(-1.0,
+		cos(radians($%d)) * cos(radians(a.latitude)) * cos(radians(a.longitude) - radians($%d)) +
+		sin(radians($%d)) * sin(radians(a.latitude))))))`, earthRadiusKm, latIdx, lngIdx, latIdx)
+}
+
+// radiusClause construit la clause WHERE du filtre de rayon à partir de l'index argIndex.
+// Une boîte englobante (indexable) précède le calcul exact de la distance.
+func (g *geoFilter) radiusClause(argIndex int) (string, []interface{}) {
+	radius := *g.RadiusKm
+	latDelta := radius / kmPerDegreeLat
+	lngDelta := 180.0
+	if cosLat := math.Cos(g.Lat * math.Pi / 180); cosLat > 0.01 {
+		lngDelta = math.Min(radius/(kmPerDegreeLat*cosLat), 180.0)
+	}
+
+	clause := fmt.Sprintf(`a.latitude BETWEEN $%d AND $%d AND a.longitude BETWEEN $%d AND $%d AND %s <= $%d`,
+		argIndex, argIndex+1, argIndex+2, argIndex+3,
+		distanceSQL(argIndex+4, argIndex+5), argIndex+6)
+
+	params := []interface{}{
+		g.Lat - latDelta, g.Lat + latDelta,
+		g.Lng - lngDelta, g.Lng + lngDelta,
+		g.Lat, g.Lng, radius,
+	}
+	return clause, params
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"log"
 	"net/http"
 	"strconv"
@@ -94,7 +96,7 @@ func GetCategoriesWithSubCategories(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// CreateAdHandler gère la création d'une nouvelle annonce, y compris l'upload des images sur AWS S3.
+// CreateAdHandler gère la création d'une nouvelle annonce, y compris l'upload des images dans le stockage de fichiers.
 func CreateAdHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Début du traitement de la requête de création d'annonce.")
 
@@ -203,6 +205,24 @@ func CreateAdHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Println("Analyse du JSON du formulaire réussie.")
 
+	// Valider les attributs contre le schéma de la sous-catégorie
+	fieldErrors, err := validateAdFormData(subCategoryID, formData, true)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération du schéma d'attributs de la sous-catégorie %d: %v", subCategoryID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if fieldErrors != nil {
+		log.Printf("Erreur: form_data ne respecte pas le schéma de la sous-catégorie %d: %v", subCategoryID, fieldErrors)
+		writeFormDataErrors(w, fieldErrors)
+		return
+	}
+	normalizedFormData, _ := json.Marshal(formData)
+	formDataStr = string(normalizedFormData)
+
+	// Paramètres de modération (cache de app_settings)
+	adSettings := services.GetAdSettings()
+
 	// Récupérer les fichiers d'images
 	files := r.MultipartForm.File["images"]
 	if len(files) == 0 {
@@ -210,31 +230,36 @@ func CreateAdHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Au moins une image est requise", http.StatusBadRequest)
 		return
 	}
-	log.Printf("Début de l'upload de %d images vers S3 via le service AWS.", len(files))
-
-	// Initialiser le service AWS
-	awsService, err := services.NewAWSService()
-	if err != nil {
-		log.Printf("Erreur lors de l'initialisation du service AWS: %v", err)
-		http.Error(w, "Erreur de configuration du service de stockage", http.StatusInternalServerError)
+	if adSettings.MaxImagesPerAd > 0 && len(files) > adSettings.MaxImagesPerAd {
+		log.Printf("Erreur: %d images fournies, maximum autorisé: %d", len(files), adSettings.MaxImagesPerAd)
+		http.Error(w, fmt.Sprintf("Vous ne pouvez pas ajouter plus de %d images", adSettings.MaxImagesPerAd), http.StatusBadRequest)
 		return
 	}
+	log.Printf("Début de l'upload de %d images vers le stockage.", len(files))
 
-	// Uploader les images via le service AWS
-	uploadedImageURLs, err := awsService.UploadAdMultipartImages(files)
+	// Uploader les images via le service de fichiers
+	uploadedImageURLs, err := mediaService.UploadAdMultipartImages(files)
 	if err != nil {
 		log.Printf("Erreur lors de l'upload des images: %v", err)
 		http.Error(w, "Erreur lors de l'upload des images", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Toutes les images ont été uploadées avec succès sur S3. Total: %d images", len(uploadedImageURLs))
+	log.Printf("Toutes les images ont été uploadées avec succès dans le stockage. Total: %d images", len(uploadedImageURLs))
+
+	// Republication à l'identique d'une annonce du vendeur (si app_settings.block_duplicate_ads)
+	if !checkExactRepost(w, r.Context(), userID, title, uploadedImageURLs, 0) {
+		if deleteErr := mediaService.DeleteImages(uploadedImageURLs); deleteErr != nil {
+			log.Printf("Erreur lors de la suppression des images: %v", deleteErr)
+		}
+		return
+	}
 
 	// Insérer l'annonce dans la base de données
 	log.Println("Préparation de la requête SQL pour insérer l'annonce dans la base de données.")
 	stmt, err := config.DB.PrepareContext(context.Background(), `
-        INSERT INTO ads (title, description, price, sub_category_id, images, form_data, is_validated, is_deactivated, is_rejected, latitude, longitude, city, phone_number, is_phone_visible, is_delivery_available, user_id)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+        INSERT INTO ads (title, description, price, sub_category_id, images, form_data, is_validated, is_deactivated, is_rejected, latitude, longitude, city, phone_number, is_phone_visible, is_delivery_available, user_id, title_fingerprint, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, `+services.AdExpiresAtSQL+`)
         RETURNING id
     `)
 	if err != nil {
@@ -255,9 +280,9 @@ func CreateAdHandler(w http.ResponseWriter, r *http.Request) {
 		subCategoryID,
 		pq.Array(uploadedImageURLs),
 		formDataStr,
-		false, // is_validated
-		false, // is_deactivated
-		false, // is_rejected
+		adSettings.AutoValidateAds, // is_validated (validation automatique si activée)
+		false,                      // is_deactivated
+		false,                      // is_rejected
 		latitude,
 		longitude,
 		city,
@@ -265,13 +290,14 @@ func CreateAdHandler(w http.ResponseWriter, r *http.Request) {
 		isPhoneVisible,
 		isDeliveryAvailable,
 		userID,
+		services.TitleFingerprint(title),
 	).Scan(&newAdID)
 	if err != nil {
 		log.Printf("Erreur lors de l'insertion de l'annonce dans la base de données : %v", err)
 
 		// En cas d'erreur, essayer de supprimer les images uploadées
 		log.Println("Tentative de suppression des images uploadées suite à l'échec de l'insertion...")
-		if deleteErr := awsService.DeleteImages(uploadedImageURLs); deleteErr != nil {
+		if deleteErr := mediaService.DeleteImages(uploadedImageURLs); deleteErr != nil {
 			log.Printf("Erreur lors de la suppression des images: %v", deleteErr)
 		}
 
@@ -281,13 +307,19 @@ func CreateAdHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Annonce créée avec succès. ID: %d", newAdID)
 
+	// Validation automatique : mêmes notifications que la validation par un modérateur
+	if adSettings.AutoValidateAds {
+		services.NotifyAdValidated(r.Context(), userID, newAdID, title)
+	}
+
 	// Réponse de succès
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"id":      newAdID,
-		"message": "Annonce créée avec succès",
-		"images":  uploadedImageURLs,
+		"id":           newAdID,
+		"message":      "Annonce créée avec succès",
+		"images":       uploadedImageURLs,
+		"is_validated": adSettings.AutoValidateAds,
 	})
 }
 
@@ -311,19 +343,39 @@ func GetValidatedAdsHandler(w http.ResponseWriter, r *http.Request) {
 	// 2. Calculer le décalage (offset)
 	offset := (page - 1) * limit
 
+	// Pagination par curseur (keyset) : activée par le paramètre "cursor" (vide pour la première page)
+	keysetColumns := adKeysetColumns("newest", "", "")
+	cursorMode, cursor, err := parseCursorParam(r, "newest", keysetColumns)
+	if err != nil {
+		http.Error(w, "Curseur invalide", http.StatusBadRequest)
+		return
+	}
+
 	// 3. Modifier la requête SQL pour inclure LIMIT, OFFSET et a.is_delivery_available
-	rows, err := config.DB.Query(`
+	query := `
         SELECT 
             a.id, a.title, a.description, a.price, a.images, a.form_data, 
             a.city, a.phone_number, a.is_phone_visible, a.latitude, a.longitude,
             u.first_name, u.last_name, u.shop_name, u.account_type, u.avatar_url,
-            a.is_delivery_available  -- NOUVEAU: Ajoutez cette colonne
+            a.is_delivery_available, a.created_at
         FROM ads a
         JOIN users u ON a.user_id = u.id
-        WHERE a.is_validated = true
-        ORDER BY a.created_at DESC
-        LIMIT $1 OFFSET $2`,
-		limit, offset)
+        WHERE a.is_validated = true AND a.is_expired = FALSE`
+	var args []interface{}
+	if cursorMode {
+		if cursor != nil {
+			clause, params := keysetCondition(keysetColumns, cursor, 1)
+			query += " AND " + clause
+			args = append(args, params...)
+		}
+		query += " " + keysetOrderBy(keysetColumns) + fmt.Sprintf(" LIMIT $%d", len(args)+1)
+		args = append(args, limit+1)
+	} else {
+		query += " ORDER BY a.created_at DESC LIMIT $1 OFFSET $2"
+		args = append(args, limit, offset)
+	}
+
+	rows, err := config.DB.Query(query, args...)
 	if err != nil {
 		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
 		return
@@ -358,6 +410,7 @@ func GetValidatedAdsHandler(w http.ResponseWriter, r *http.Request) {
 			&accountType,
 			&avatarURL,
 			&isDeliveryAvailable, // NOUVEAU: Scannez la valeur
+			&ad.CreatedAt,
 		)
 		if err != nil {
 			http.Error(w, "Erreur interne du serveur lors du scan", http.StatusInternalServerError)
@@ -365,6 +418,7 @@ func GetValidatedAdsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		ad.Images = []string(images)
+		ad.ImageVariants = services.AdImageVariants(ad.Images)
 
 		if formDataStr.Valid {
 			err = json.Unmarshal([]byte(formDataStr.String), &ad.FormData)
@@ -399,6 +453,26 @@ func GetValidatedAdsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+
+	// En mode curseur, la liste est enveloppée avec son bloc de pagination
+	if cursorMode {
+		pagination := CursorPagination{Limit: limit}
+		if len(ads) > limit {
+			ads = ads[:limit]
+			last := ads[limit-1]
+			pagination.HasMore = true
+			pagination.NextCursor = nextAdCursor("newest", []string{last.CreatedAt.Format(time.RFC3339Nano)}, last.ID)
+		}
+		response := struct {
+			Ads        []models.Ad      `json:"ads"`
+			Pagination CursorPagination `json:"pagination"`
+		}{Ads: ads, Pagination: pagination}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		}
+		return
+	}
+
 	if err := json.NewEncoder(w).Encode(ads); err != nil {
 		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
 		return
@@ -430,7 +504,7 @@ func GetAdDetailsHandler(w http.ResponseWriter, r *http.Request) {
         SELECT
             a.id, a.title, a.description, a.price, a.images,
             a.form_data, a.city, a.phone_number, a.is_phone_visible, a.is_delivery_available,
-            a.latitude, a.longitude, a.created_at,
+            a.latitude, a.longitude, a.created_at, a.expires_at, a.is_expired,
             u.id, u.first_name, u.last_name, u.shop_name, u.account_type, u.avatar_url,
             sc.name as sub_category_name, c.name as category_name
         FROM ads a
@@ -441,10 +515,11 @@ func GetAdDetailsHandler(w http.ResponseWriter, r *http.Request) {
     `
 	row := config.DB.QueryRow(query, adID)
 
+	var expiresAt sql.NullTime
 	err = row.Scan(
 		&ad.ID, &ad.Title, &ad.Description, &ad.Price, &images,
 		&formDataStr, &ad.City, &ad.PhoneNumber, &ad.IsPhoneVisible, &isDeliveryAvailable,
-		&latitude, &longitude, &ad.CreatedAt,
+		&latitude, &longitude, &ad.CreatedAt, &expiresAt, &ad.IsExpired,
 		&userID, &firstName, &lastName, &shopName, &accountType, &avatarURL,
 		&subCategoryName, &categoryName,
 	)
@@ -461,10 +536,14 @@ func GetAdDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ad.Images = []string(images)
+	ad.ImageVariants = services.AdImageVariants(ad.Images)
 	ad.IsDeliveryAvailable = isDeliveryAvailable
 	if formDataStr.Valid {
 		_ = json.Unmarshal([]byte(formDataStr.String), &ad.FormData)
 	}
+	if expiresAt.Valid {
+		ad.ExpiresAt = &expiresAt.Time
+	}
 
 	if latitude.Valid {
 		ad.Latitude = latitude
@@ -490,11 +569,27 @@ func GetAdDetailsHandler(w http.ResponseWriter, r *http.Request) {
 		ad.User.DisplayName = fmt.Sprintf("%s %s", firstName, lastName)
 	}
 
+	// Historique des prix (vide tant que le prix n'a jamais changé)
+	priceHistory, err := loadAdPriceHistory(r.Context(), adID)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération de l'historique des prix de l'annonce %d: %v", adID, err)
+	} else if len(priceHistory) > 1 {
+		ad.PriceHistory = priceHistory
+	}
+
+	// Historique de consultation de l'utilisateur connecté (hors vendeur). La vue n'est pas comptée ici :
+	// le comptage dédoublonné (et view_count de l'historique) passe par RecordAdViewHandler.
+	if viewerID, ok := optionalUserID(r); ok && viewerID != userID {
+		go recordUserAdView(viewerID, adID, false)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(ad)
 }
 
 // GetSimilarAdsHandler gère la récupération des annonces similaires.
+// Les annonces de la même sous-catégorie sont classées par score (prix, localisation, attributs, titre),
+// en diversifiant les vendeurs ; les annonces vendues, désactivées ou du même vendeur sont exclues.
 func GetSimilarAdsHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Début du traitement de la requête pour les annonces similaires.")
 
@@ -506,35 +601,53 @@ func GetSimilarAdsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var subCategoryID int
-	// Étape 1 : Récupérer le sub_category_id de l'annonce d'origine
-	err = config.DB.QueryRow("SELECT sub_category_id FROM ads WHERE id = $1 AND is_validated = TRUE", adID).Scan(&subCategoryID)
+	// Étape 1 : Récupérer l'annonce d'origine
+	var subCategoryID, sourceUserID int
+	var sourceTitle string
+	var sourcePrice float64
+	var sourceCity sql.NullString
+	var sourceLat, sourceLng sql.NullFloat64
+	var sourceFormData []byte
+	err = config.DB.QueryRow(`
+		SELECT sub_category_id, user_id, title, price, city, latitude, longitude, form_data
+		FROM ads WHERE id = $1 AND is_validated = TRUE
+	`, adID).Scan(&subCategoryID, &sourceUserID, &sourceTitle, &sourcePrice, &sourceCity, &sourceLat, &sourceLng, &sourceFormData)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// L'annonce n'existe pas ou n'est pas validée
 			http.Error(w, "Annonce non trouvée ou non validée", http.StatusNotFound)
 		} else {
-			log.Printf("Erreur lors de la récupération du sub_category_id: %v", err)
+			log.Printf("Erreur lors de la récupération de l'annonce d'origine: %v", err)
 			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
 		}
 		return
 	}
+	source := newSimilarAdProfile(sourceUserID, sourceTitle, sourcePrice, sourceCity.String,
+		nullFloatPtr(sourceLat), nullFloatPtr(sourceLng), decodeFormData(sourceFormData))
 
-	var ads []models.Ad
-	// Étape 2 : Récupérer les annonces similaires validées
+	// Étape 2 : Récupérer les candidates validées et visibles de la sous-catégorie
 	query := `
 		SELECT
 			a.id, a.title, a.description, a.price, a.images, a.city, a.created_at,
+			a.user_id, a.latitude, a.longitude, a.form_data,
 			u.first_name, u.last_name, u.shop_name, u.account_type,
-			sc.name AS sub_category_name, c.name AS category_name
+			sc.name AS sub_category_name, c.name AS category_name,
+			EXISTS (
+				SELECT 1 FROM ad_boosts ab
+				WHERE ab.ad_id = a.id AND ab.is_active = TRUE AND ab.payment_status = 'completed'
+				AND ab.end_date > CURRENT_TIMESTAMP
+			) AS is_boosted
 		FROM ads a
 		JOIN users u ON a.user_id = u.id
 		JOIN sub_categories sc ON a.sub_category_id = sc.id
 		JOIN categories c ON sc.category_id = c.id
-		WHERE a.sub_category_id = $1 AND a.id != $2 AND a.is_validated = TRUE
-		LIMIT 5
+		WHERE a.sub_category_id = $1 AND a.id != $2 AND a.user_id != $3
+		AND a.is_validated = TRUE AND a.is_expired = FALSE
+		AND COALESCE(a.is_deactivated, FALSE) = FALSE AND COALESCE(a.is_sold, FALSE) = FALSE
+		ORDER BY a.created_at DESC
+		LIMIT $4
 	`
-	rows, err := config.DB.Query(query, subCategoryID, adID)
+	rows, err := config.DB.Query(query, subCategoryID, adID, sourceUserID, similarAdsCandidatePool)
 	if err != nil {
 		log.Printf("Erreur lors de la récupération des annonces similaires: %v", err)
 		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
@@ -542,17 +655,22 @@ func GetSimilarAdsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
+	var candidates []similarAdCandidate
 	for rows.Next() {
 		var ad models.Ad
 		var images pq.StringArray
-		var shopName sql.NullString
+		var city, shopName sql.NullString
 		var firstName, lastName, accountType string
 		var subCategoryName, categoryName string
+		var userID int
+		var formData []byte
+		var isBoosted bool
 
 		err := rows.Scan(
-			&ad.ID, &ad.Title, &ad.Description, &ad.Price, &images, &ad.City, &ad.CreatedAt,
+			&ad.ID, &ad.Title, &ad.Description, &ad.Price, &images, &city, &ad.CreatedAt,
+			&userID, &ad.Latitude, &ad.Longitude, &formData,
 			&firstName, &lastName, &shopName, &accountType,
-			&subCategoryName, &categoryName,
+			&subCategoryName, &categoryName, &isBoosted,
 		)
 		if err != nil {
 			log.Printf("Erreur lors de la lecture d'une ligne d'annonce similaire: %v", err)
@@ -560,7 +678,11 @@ func GetSimilarAdsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Remplissage de la structure de l'annonce
+		ad.City = city.String
 		ad.Images = []string(images)
+		ad.ImageVariants = services.AdImageVariants(ad.Images)
+		ad.IsBoosted = isBoosted
+		ad.User.ID = userID
 		ad.User.FirstName = firstName
 		ad.User.LastName = lastName
 		ad.User.ShopName = shopName
@@ -573,7 +695,12 @@ func GetSimilarAdsHandler(w http.ResponseWriter, r *http.Request) {
 		ad.SubCategoryName = subCategoryName
 		ad.CategoryName = categoryName
 
-		ads = append(ads, ad)
+		candidates = append(candidates, similarAdCandidate{
+			ad: ad,
+			profile: newSimilarAdProfile(userID, ad.Title, ad.Price, ad.City,
+				nullFloatPtr(ad.Latitude), nullFloatPtr(ad.Longitude), decodeFormData(formData)),
+			isBoosted: isBoosted,
+		})
 	}
 
 	if err = rows.Err(); err != nil {
@@ -582,6 +709,8 @@ func GetSimilarAdsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ads := rankSimilarAds(source, candidates, similarAdsLimit)
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(ads)
 }
@@ -655,7 +784,7 @@ func GetSellerProfileHandler(w http.ResponseWriter, r *http.Request) {
 		FROM ads a
 		JOIN sub_categories sc ON a.sub_category_id = sc.id
 		JOIN categories c ON sc.category_id = c.id
-		WHERE a.user_id = $1 AND a.is_validated = true
+		WHERE a.user_id = $1 AND a.is_validated = true AND a.is_expired = FALSE
 		ORDER BY a.created_at DESC
 		LIMIT $2 OFFSET $3
 	`
@@ -699,6 +828,7 @@ func GetSellerProfileHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		ad.Images = []string(images)
+		ad.ImageVariants = services.AdImageVariants(ad.Images)
 		ad.IsDeliveryAvailable = isDeliveryAvailable
 
 		if formDataStr.Valid {
@@ -732,7 +862,7 @@ func GetSellerProfileHandler(w http.ResponseWriter, r *http.Request) {
 
 	// 5. Compter le nombre total d'annonces pour la pagination
 	var totalAds int
-	countQuery := `SELECT COUNT(*) FROM ads WHERE user_id = $1 AND is_validated = true`
+	countQuery := `SELECT COUNT(*) FROM ads WHERE user_id = $1 AND is_validated = true AND is_expired = FALSE`
 	err = config.DB.QueryRow(countQuery, userID).Scan(&totalAds)
 	if err != nil {
 		log.Printf("Erreur lors du comptage des annonces: %v", err)
@@ -852,9 +982,9 @@ func GetAllAdsHandler(w http.ResponseWriter, r *http.Request) {
         JOIN users u ON a.user_id = u.id
         JOIN sub_categories sc ON a.sub_category_id = sc.id
         JOIN categories c ON sc.category_id = c.id
-        WHERE a.is_validated = TRUE AND a.is_deactivated = FALSE AND a.is_rejected = FALSE`
+        WHERE a.is_validated = TRUE AND a.is_deactivated = FALSE AND a.is_rejected = FALSE AND a.is_expired = FALSE`
 
-	baseCountQuery := `SELECT COUNT(*) FROM ads a WHERE a.is_validated = TRUE AND a.is_deactivated = FALSE AND a.is_rejected = FALSE`
+	baseCountQuery := `SELECT COUNT(*) FROM ads a WHERE a.is_validated = TRUE AND a.is_deactivated = FALSE AND a.is_rejected = FALSE AND a.is_expired = FALSE`
 
 	var whereClauses []string
 	var args []interface{}
@@ -947,6 +1077,7 @@ func GetAllAdsHandler(w http.ResponseWriter, r *http.Request) {
 
 		// Assign scanned values to the Ad and User structs
 		ad.Images = []string(images)
+		ad.ImageVariants = services.AdImageVariants(ad.Images)
 		if formDataStr.Valid {
 			json.Unmarshal([]byte(formDataStr.String), &ad.FormData)
 		}
@@ -1105,6 +1236,7 @@ func GetAdsByCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	minPriceStr := r.URL.Query().Get("min_price")
 	maxPriceStr := r.URL.Query().Get("max_price")
 	sortBy := r.URL.Query().Get("sort_by")
+	geo := parseGeoFilter(r) // Recherche "autour de moi" : lat, lng, radius_km
 
 	// Valeurs par défaut
 	page, err := strconv.Atoi(pageStr)
@@ -1138,8 +1270,20 @@ func GetAdsByCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Sort par défaut
-	if sortBy == "" {
+	// Filtres d'attributs, typés par le schéma de la sous-catégorie lorsqu'elle est connue
+	attributeFilters, err := parseAttributeFilters(r, subCategoryID)
+	if err != nil {
+		if errors.Is(err, errInvalidAttributeFilter) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			log.Printf("Erreur lors de la récupération du schéma d'attributs: %v", err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Sort par défaut (le tri par distance nécessite une position)
+	if sortBy == "" || (sortBy == "distance" && geo == nil) {
 		sortBy = "newest"
 	}
 
@@ -1147,24 +1291,11 @@ func GetAdsByCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	offset := (page - 1) * limit
 
 	// 4. Construire la requête SQL dynamique
-	baseQuery := `
-        SELECT
-            a.id, a.title, a.description, a.price, a.images, a.form_data,
-            a.city, a.phone_number, a.is_phone_visible, a.is_delivery_available,
-            a.latitude, a.longitude, a.created_at,
-            u.id, u.first_name, u.last_name, u.shop_name, u.account_type, u.avatar_url,
-            sc.name AS sub_category_name, c.name AS category_name
-        FROM ads a
-        JOIN users u ON a.user_id = u.id
-        JOIN sub_categories sc ON a.sub_category_id = sc.id
-        JOIN categories c ON sc.category_id = c.id
-        WHERE a.is_validated = TRUE AND a.is_deactivated = FALSE AND a.is_rejected = FALSE`
-
 	baseCountQuery := `
         SELECT COUNT(*) 
         FROM ads a 
         JOIN sub_categories sc ON a.sub_category_id = sc.id
-        WHERE a.is_validated = TRUE AND a.is_deactivated = FALSE AND a.is_rejected = FALSE`
+        WHERE a.is_validated = TRUE AND a.is_deactivated = FALSE AND a.is_rejected = FALSE AND a.is_expired = FALSE`
 
 	var whereClauses []string
 	var args []interface{}
@@ -1207,12 +1338,67 @@ func GetAdsByCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		argIndex++
 	}
 
+	// Filtre de rayon autour de la position de l'utilisateur
+	if geo != nil && geo.RadiusKm != nil {
+		clause, params := geo.radiusClause(argIndex)
+		whereClauses = append(whereClauses, clause)
+		args = append(args, params...)
+		countArgs = append(countArgs, params...)
+		argIndex += len(params)
+	}
+
+	// Filtres sur les attributs de form_data (attr.marque=Toyota, attr.annee_min=2015, ...)
+	for _, filter := range attributeFilters {
+		clause, params := filter.clause(argIndex)
+		whereClauses = append(whereClauses, clause)
+		args = append(args, params...)
+		countArgs = append(countArgs, params...)
+		argIndex += len(params)
+	}
+
 	// Construire la clause WHERE
 	whereClause := ""
 	if len(whereClauses) > 0 {
 		whereClause = " AND " + strings.Join(whereClauses, " AND ")
 	}
 
+	// Distance calculée uniquement pour la requête principale (paramètres absents du comptage)
+	distanceColumn := "NULL::float8"
+	distanceExpr := ""
+	if geo != nil {
+		distanceExpr = distanceSQL(argIndex, argIndex+1)
+		distanceColumn = "ROUND(" + distanceExpr + "::numeric, 2)::float8"
+		args = append(args, geo.Lat, geo.Lng)
+		argIndex += 2
+	}
+
+	// Pagination par curseur (keyset) : activée par le paramètre "cursor" (vide pour la première page)
+	keysetColumns := adKeysetColumns(sortBy, "", distanceExpr)
+	cursorMode, cursor, err := parseCursorParam(r, sortBy, keysetColumns)
+	if err != nil {
+		http.Error(w, "Curseur invalide", http.StatusBadRequest)
+		return
+	}
+	cursorColumn := "NULL::text[]"
+	if cursorMode {
+		cursorColumn = keysetSelectColumn(keysetColumns)
+	}
+
+	baseQuery := `
+        SELECT
+            a.id, a.title, a.description, a.price, a.images, a.form_data,
+            a.city, a.phone_number, a.is_phone_visible, a.is_delivery_available,
+            a.latitude, a.longitude, a.created_at,
+            u.id, u.first_name, u.last_name, u.shop_name, u.account_type, u.avatar_url,
+            sc.name AS sub_category_name, c.name AS category_name,
+            ` + distanceColumn + ` AS distance_km,
+            ` + cursorColumn + ` AS cursor_key
+        FROM ads a
+        JOIN users u ON a.user_id = u.id
+        JOIN sub_categories sc ON a.sub_category_id = sc.id
+        JOIN categories c ON sc.category_id = c.id
+        WHERE a.is_validated = TRUE AND a.is_deactivated = FALSE AND a.is_rejected = FALSE AND a.is_expired = FALSE`
+
 	// Ajouter la clause ORDER BY
 	var orderBy string
 	switch sortBy {
@@ -1222,6 +1408,8 @@ func GetAdsByCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		orderBy = "ORDER BY a.price ASC, a.created_at DESC"
 	case "price_desc":
 		orderBy = "ORDER BY a.price DESC, a.created_at DESC"
+	case "distance":
+		orderBy = "ORDER BY distance_km ASC NULLS LAST, a.created_at DESC"
 	case "newest":
 		fallthrough
 	default:
@@ -1229,12 +1417,26 @@ func GetAdsByCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Requêtes complètes
-	query := baseQuery + whereClause + " " + orderBy + fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	var query string
+	if cursorMode {
+		// Mode curseur : on reprend après la dernière annonce vue et on lit une annonce de plus
+		// pour savoir s'il reste des résultats (pas de COUNT, pas de doublons ni de trous)
+		keysetClause := ""
+		if cursor != nil {
+			clause, params := keysetCondition(keysetColumns, cursor, argIndex)
+			keysetClause = " AND " + clause
+			args = append(args, params...)
+			argIndex += len(params)
+		}
+		query = baseQuery + whereClause + keysetClause + " " + keysetOrderBy(keysetColumns) + fmt.Sprintf(" LIMIT $%d", argIndex)
+		args = append(args, limit+1)
+	} else {
+		query = baseQuery + whereClause + " " + orderBy + fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+		// Ajouter LIMIT et OFFSET aux arguments
+		args = append(args, limit, offset)
+	}
 	countQuery := baseCountQuery + whereClause
 
-	// Ajouter LIMIT et OFFSET aux arguments
-	args = append(args, limit, offset)
-
 	log.Printf("Exécution de la requête: %s", query)
 	log.Printf("Avec les arguments: %v", args)
 
@@ -1248,6 +1450,7 @@ func GetAdsByCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	var ads []models.Ad
+	var cursorKeys [][]string
 
 	for rows.Next() {
 		var ad models.Ad
@@ -1256,6 +1459,8 @@ func GetAdsByCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		var latitude, longitude sql.NullFloat64
 		var firstName, lastName, accountType string
 		var subCategoryName, categoryName string
+		var distanceKm sql.NullFloat64
+		var cursorKey pq.StringArray
 
 		err := rows.Scan(
 			&ad.ID, &ad.Title, &ad.Description, &ad.Price, &images, &formDataStr,
@@ -1263,6 +1468,7 @@ func GetAdsByCategoryHandler(w http.ResponseWriter, r *http.Request) {
 			&latitude, &longitude, &ad.CreatedAt,
 			&ad.User.ID, &firstName, &lastName, &shopName, &accountType, &avatarURL,
 			&subCategoryName, &categoryName,
+			&distanceKm, &cursorKey,
 		)
 		if err != nil {
 			log.Printf("Erreur lors du scan de l'annonce: %v", err)
@@ -1271,6 +1477,7 @@ func GetAdsByCategoryHandler(w http.ResponseWriter, r *http.Request) {
 
 		// Assigner les valeurs scannées
 		ad.Images = []string(images)
+		ad.ImageVariants = services.AdImageVariants(ad.Images)
 		if formDataStr.Valid {
 			json.Unmarshal([]byte(formDataStr.String), &ad.FormData)
 		}
@@ -1280,6 +1487,9 @@ func GetAdsByCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		if longitude.Valid {
 			ad.Longitude = longitude
 		}
+		if distanceKm.Valid {
+			ad.DistanceKm = &distanceKm.Float64
+		}
 
 		ad.SubCategoryName = subCategoryName
 		ad.CategoryName = categoryName
@@ -1297,6 +1507,7 @@ func GetAdsByCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		ads = append(ads, ad)
+		cursorKeys = append(cursorKeys, []string(cursorKey))
 	}
 
 	if err = rows.Err(); err != nil {
@@ -1305,13 +1516,30 @@ func GetAdsByCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 6. Compter le nombre total d'annonces pour la pagination
-	var totalAds int
-	err = config.DB.QueryRow(countQuery, countArgs...).Scan(&totalAds)
-	if err != nil {
-		log.Printf("Erreur lors du comptage des annonces: %v", err)
-		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
-		return
+	// 6. Compter le nombre total d'annonces pour la pagination (mode page uniquement)
+	var pagination interface{}
+	if cursorMode {
+		cursorPagination := CursorPagination{Limit: limit}
+		if len(ads) > limit {
+			ads = ads[:limit]
+			cursorPagination.HasMore = true
+			cursorPagination.NextCursor = nextAdCursor(sortBy, cursorKeys[limit-1], ads[limit-1].ID)
+		}
+		pagination = cursorPagination
+	} else {
+		var totalAds int
+		err = config.DB.QueryRow(countQuery, countArgs...).Scan(&totalAds)
+		if err != nil {
+			log.Printf("Erreur lors du comptage des annonces: %v", err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+			return
+		}
+		pagination = PagePagination{
+			CurrentPage: page,
+			TotalPages:  (totalAds + limit - 1) / limit,
+			TotalAds:    totalAds,
+			Limit:       limit,
+		}
 	}
 
 	// 7. Récupérer les informations de la catégorie pour la réponse
@@ -1337,36 +1565,37 @@ func GetAdsByCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	response := struct {
 		Ads        []models.Ad `json:"ads"`
 		Category   interface{} `json:"category"`
-		Pagination struct {
-			CurrentPage int `json:"current_page"`
-			TotalPages  int `json:"total_pages"`
-			TotalAds    int `json:"total_ads"`
-			Limit       int `json:"limit"`
-		} `json:"pagination"`
-		Filters struct {
-			CategoryID    int      `json:"category_id"`
-			SubCategoryID *int     `json:"sub_category_id,omitempty"`
-			City          string   `json:"city,omitempty"`
-			MinPrice      *float64 `json:"min_price,omitempty"`
-			MaxPrice      *float64 `json:"max_price,omitempty"`
-			SortBy        string   `json:"sort_by"`
+		Pagination interface{} `json:"pagination"`
+		Filters    struct {
+			CategoryID    int               `json:"category_id"`
+			SubCategoryID *int              `json:"sub_category_id,omitempty"`
+			City          string            `json:"city,omitempty"`
+			MinPrice      *float64          `json:"min_price,omitempty"`
+			MaxPrice      *float64          `json:"max_price,omitempty"`
+			Lat           *float64          `json:"lat,omitempty"`
+			Lng           *float64          `json:"lng,omitempty"`
+			RadiusKm      *float64          `json:"radius_km,omitempty"`
+			Attributes    []AttributeFilter `json:"attributes,omitempty"`
+			SortBy        string            `json:"sort_by"`
 		} `json:"filters"`
 	}{
-		Ads:      ads,
-		Category: categoryInfo,
+		Ads:        ads,
+		Category:   categoryInfo,
+		Pagination: pagination,
 	}
 
-	response.Pagination.CurrentPage = page
-	response.Pagination.TotalAds = totalAds
-	response.Pagination.Limit = limit
-	response.Pagination.TotalPages = (totalAds + limit - 1) / limit
-
 	// Ajouter les informations de filtre à la réponse
 	response.Filters.CategoryID = categoryID
 	response.Filters.SubCategoryID = subCategoryID
 	response.Filters.City = city
 	response.Filters.MinPrice = minPrice
 	response.Filters.MaxPrice = maxPrice
+	if geo != nil {
+		response.Filters.Lat = &geo.Lat
+		response.Filters.Lng = &geo.Lng
+		response.Filters.RadiusKm = geo.RadiusKm
+	}
+	response.Filters.Attributes = attributeFilters
 	response.Filters.SortBy = sortBy
 
 	w.Header().Set("Content-Type", "application/json")
@@ -1419,7 +1648,8 @@ func GetUserAdsHandler(w http.ResponseWriter, r *http.Request) {
 			sc.name as sub_category_name, c.name as category_name,
 			COALESCE(f.favorites_count, 0) as favorites_count,
 			a.is_boosted,
-			ab.end_date as boost_expires_at
+			ab.end_date as boost_expires_at,
+			a.expires_at, a.is_expired
 		FROM ads a
 		JOIN sub_categories sc ON a.sub_category_id = sc.id
 		JOIN categories c ON sc.category_id = c.id
@@ -1459,7 +1689,7 @@ func GetUserAdsHandler(w http.ResponseWriter, r *http.Request) {
 		var viewsCount int
 		var favoritesCount int
 		var isBoosted bool
-		var boostExpiresAt sql.NullTime
+		var boostExpiresAt, expiresAt sql.NullTime
 
 		err := rows.Scan(
 			&ad.ID, &ad.Title, &ad.Description, &ad.Price, &images, &formDataStr,
@@ -1471,6 +1701,7 @@ func GetUserAdsHandler(w http.ResponseWriter, r *http.Request) {
 			&favoritesCount,
 			&isBoosted,
 			&boostExpiresAt,
+			&expiresAt, &ad.IsExpired,
 		)
 
 		if err != nil {
@@ -1479,6 +1710,7 @@ func GetUserAdsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		ad.Images = []string(images)
+		ad.ImageVariants = services.AdImageVariants(ad.Images)
 		if formDataStr.Valid {
 			_ = json.Unmarshal([]byte(formDataStr.String), &ad.FormData)
 		}
@@ -1496,6 +1728,10 @@ func GetUserAdsHandler(w http.ResponseWriter, r *http.Request) {
 		if boostExpiresAt.Valid {
 			ad.BoostExpiresAt = &boostExpiresAt.Time
 		}
+		if expiresAt.Valid {
+			ad.ExpiresAt = &expiresAt.Time
+		}
+		ad.Status = ad.ComputeStatus()
 
 		// ✅ Log pour vérifier les données de boost par annonce
 		log.Printf("📦 Annonce ID=%d, IsBoosted=%v, BoostExpiresAt=%v", ad.ID, ad.IsBoosted, ad.BoostExpiresAt)
@@ -1848,6 +2084,7 @@ func GetSoldAdsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		soldAd.Images = []string(images)
+		soldAd.ImageVariants = services.AdImageVariants(soldAd.Images)
 		soldAds = append(soldAds, soldAd)
 	}
 
@@ -1934,47 +2171,18 @@ func DeleteAdHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent) // 204 No Content pour une suppression réussie
 }
 
-// IncrementAdViewsHandler incrémente le nombre de vues pour une annonce spécifique.
-func IncrementAdViewsHandler(w http.ResponseWriter, r *http.Request) {
-	// Récupérer les variables de l'URL
-	vars := mux.Vars(r)
-	adIDStr := vars["adID"]
-
-	adID, err := strconv.Atoi(adIDStr)
-	if err != nil {
-		http.Error(w, "ID d'annonce invalide", http.StatusBadRequest)
-		return
-	}
-
-	// Préparer la requête SQL pour incrémenter le compteur de vues
-	query := `
-        UPDATE ads 
-        SET views_count = views_count + 1 
-        WHERE id = $1
-    `
-	_, err = config.DB.Exec(query, adID)
-	if err != nil {
-		log.Printf("Erreur lors de l'incrémentation des vues pour l'annonce %d: %v", adID, err)
-		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Vues incrémentées avec succès"})
-}
-
 // Structure pour la requête de mise à jour de l'annonce
 type AdUpdateRequest struct {
-	Title          string   `json:"title"`
-	Description    string   `json:"description"`
-	PhoneNumber    string   `json:"phoneNumber"`
-	IsPhoneVisible bool     `json:"isPhoneVisible"`
-	City           string   `json:"city"`
-	Images         []string `json:"images"`    // URLs des images existantes
-	NewImages      []string `json:"newImages"` // Images base64 à uploader
-	Price          float64  `json:"price"`
-	RemovedImages  []string `json:"removedImages"` // URLs des images à supprimer
+	Title          string                 `json:"title"`
+	Description    string                 `json:"description"`
+	PhoneNumber    string                 `json:"phoneNumber"`
+	IsPhoneVisible bool                   `json:"isPhoneVisible"`
+	City           string                 `json:"city"`
+	Images         []string               `json:"images"`    // URLs des images existantes
+	NewImages      []string               `json:"newImages"` // Images base64 à uploader
+	Price          float64                `json:"price"`
+	RemovedImages  []string               `json:"removedImages"` // URLs des images à supprimer
+	FormData       map[string]interface{} `json:"formData"`      // Attributs (optionnel, inchangés si absent)
 }
 
 // EditAdHandler gère la modification d'une annonce par son ID avec gestion complète des images.
@@ -2023,9 +2231,11 @@ func EditAdHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Request data: %+v", req)
 
 	// Récupérer les images actuelles de l'annonce et vérifier le propriétaire
-	var ownerID int
+	var ownerID, subCategoryID int
+	var currentTitle string
+	var currentPrice float64
 	var currentImagesArray pq.StringArray
-	err = config.DB.QueryRow("SELECT user_id, images FROM ads WHERE id = $1", adID).Scan(&ownerID, &currentImagesArray)
+	err = config.DB.QueryRow("SELECT user_id, sub_category_id, title, price, images FROM ads WHERE id = $1", adID).Scan(&ownerID, &subCategoryID, &currentTitle, &currentPrice, &currentImagesArray)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Printf("Annonce non trouvée: %d", adID)
@@ -2047,53 +2257,51 @@ func EditAdHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Initialiser le service AWS
-	awsService, err := services.NewAWSService()
-	if err != nil {
-		log.Printf("Erreur lors de l'initialisation du service AWS: %v", err)
-		http.Error(w, "Erreur de configuration du service de stockage", http.StatusInternalServerError)
+	// Valider les attributs envoyés contre le schéma de la sous-catégorie
+	formDataJSON, ok := validateAdUpdateFormData(w, subCategoryID, req.FormData)
+	if !ok {
 		return
 	}
 
-	// Traitement des nouvelles images à uploader (base64)
-	var newUploadedImages []string
-	if len(req.NewImages) > 0 {
-		log.Printf("Upload de %d nouvelles images (base64)", len(req.NewImages))
-		newUploadedImages, err = awsService.UploadAdImages(req.NewImages)
-		if err != nil {
-			log.Printf("Erreur lors de l'upload des nouvelles images: %v", err)
-			http.Error(w, "Erreur lors de l'upload des nouvelles images", http.StatusInternalServerError)
-			return
-		}
-		log.Printf("Nouvelles images uploadées: %v", newUploadedImages)
+	// Conserver la version actuelle (vue par les modérateurs) avant de l'écraser
+	if err := ensureAdBaselineRevision(r.Context(), adID); err != nil {
+		log.Printf("Erreur lors de l'enregistrement de la révision initiale de l'annonce %d: %v", adID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
 	}
 
-	// Identifier les images à supprimer réellement de S3
-	var imagesToDeleteFromS3 []string
-	for _, removedImg := range req.RemovedImages {
-		// Vérifier que l'image fait partie des images actuelles
-		isCurrentImage := false
-		for _, currentImg := range currentImages {
-			if currentImg == removedImg {
-				isCurrentImage = true
+	// Vérifier le nombre maximal d'images avant tout upload
+	adSettings := services.GetAdSettings()
+	keptImages := 0
+	for _, img := range req.Images {
+		removed := false
+		for _, removedImg := range req.RemovedImages {
+			if img == removedImg {
+				removed = true
 				break
 			}
 		}
-		if isCurrentImage {
-			imagesToDeleteFromS3 = append(imagesToDeleteFromS3, removedImg)
+		if !removed {
+			keptImages++
 		}
 	}
+	if adSettings.MaxImagesPerAd > 0 && keptImages+len(req.NewImages) > adSettings.MaxImagesPerAd {
+		log.Printf("Erreur: %d images après modification, maximum autorisé: %d", keptImages+len(req.NewImages), adSettings.MaxImagesPerAd)
+		http.Error(w, fmt.Sprintf("Vous ne pouvez pas ajouter plus de %d images", adSettings.MaxImagesPerAd), http.StatusBadRequest)
+		return
+	}
 
-	// Supprimer les images de S3
-	if len(imagesToDeleteFromS3) > 0 {
-		log.Printf("Suppression de %d images de S3", len(imagesToDeleteFromS3))
-		err = awsService.DeleteImages(imagesToDeleteFromS3)
+	// Traitement des nouvelles images à uploader (base64)
+	var newUploadedImages []string
+	if len(req.NewImages) > 0 {
+		log.Printf("Upload de %d nouvelles images (base64)", len(req.NewImages))
+		newUploadedImages, err = mediaService.UploadAdImages(req.NewImages)
 		if err != nil {
-			log.Printf("Erreur lors de la suppression des images S3: %v", err)
-			// Ne pas faire échouer la requête pour cette erreur, juste logger
-		} else {
-			log.Printf("Images supprimées avec succès de S3")
+			log.Printf("Erreur lors de l'upload des nouvelles images: %v", err)
+			http.Error(w, "Erreur lors de l'upload des nouvelles images", http.StatusInternalServerError)
+			return
 		}
+		log.Printf("Nouvelles images uploadées: %v", newUploadedImages)
 	}
 
 	// Construire la liste finale des images
@@ -2126,6 +2334,48 @@ func EditAdHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Une modification ne doit pas transformer l'annonce en copie d'une autre annonce du vendeur
+	if editMayCreateRepost(currentTitle, req.Title, currentImages, finalImages) &&
+		!checkExactRepost(w, r.Context(), userID, req.Title, finalImages, adID) {
+		if len(newUploadedImages) > 0 {
+			if deleteErr := mediaService.DeleteImages(newUploadedImages); deleteErr != nil {
+				log.Printf("Erreur lors de la suppression des nouvelles images: %v", deleteErr)
+			}
+		}
+		return
+	}
+
+	// Identifier les images à supprimer réellement de S3
+	var imagesToDeleteFromS3 []string
+	for _, removedImg := range req.RemovedImages {
+		// Vérifier que l'image fait partie des images actuelles
+		isCurrentImage := false
+		for _, currentImg := range currentImages {
+			if currentImg == removedImg {
+				isCurrentImage = true
+				break
+			}
+		}
+		if isCurrentImage {
+			imagesToDeleteFromS3 = append(imagesToDeleteFromS3, removedImg)
+		}
+	}
+
+	// Les images d'une version validée restent disponibles pour la comparaison par les modérateurs
+	imagesToDeleteFromS3 = imagesNotInValidatedRevisions(r.Context(), adID, imagesToDeleteFromS3)
+
+	// Supprimer les images de S3
+	if len(imagesToDeleteFromS3) > 0 {
+		log.Printf("Suppression de %d images de S3", len(imagesToDeleteFromS3))
+		err = mediaService.DeleteImages(imagesToDeleteFromS3)
+		if err != nil {
+			log.Printf("Erreur lors de la suppression des images S3: %v", err)
+			// Ne pas faire échouer la requête pour cette erreur, juste logger
+		} else {
+			log.Printf("Images supprimées avec succès de S3")
+		}
+	}
+
 	// Mise à jour de l'annonce dans la base de données
 	updateQuery := `
         UPDATE ads 
@@ -2136,14 +2386,19 @@ func EditAdHandler(w http.ResponseWriter, r *http.Request) {
             is_phone_visible = $5, 
             city = $6, 
             price = $7, 
+            form_data = COALESCE($9, form_data),
+            title_fingerprint = $11,
             updated_at = NOW(),
-            is_validated = FALSE, 
+            is_validated = ($10 AND reports_hidden_at IS NULL), 
             is_deactivated = FALSE, 
             is_rejected = FALSE
         WHERE id = $8
+        RETURNING is_validated
     `
 
-	_, err = config.DB.Exec(updateQuery,
+	// Une annonce masquée par des signalements reste en modération, même avec la validation automatique
+	var isValidated bool
+	err = config.DB.QueryRow(updateQuery,
 		req.Title,
 		req.Description,
 		pq.Array(finalImages),
@@ -2152,7 +2407,10 @@ func EditAdHandler(w http.ResponseWriter, r *http.Request) {
 		req.City,
 		req.Price,
 		adID,
-	)
+		formDataJSON,
+		adSettings.AutoValidateAds, // Repasse en modération sauf validation automatique
+		services.TitleFingerprint(req.Title),
+	).Scan(&isValidated)
 
 	if err != nil {
 		log.Printf("Erreur lors de la mise à jour de l'annonce: %v", err)
@@ -2160,7 +2418,7 @@ func EditAdHandler(w http.ResponseWriter, r *http.Request) {
 		// En cas d'erreur, essayer de supprimer les nouvelles images uploadées
 		if len(newUploadedImages) > 0 {
 			log.Println("Tentative de suppression des nouvelles images suite à l'échec de la mise à jour...")
-			if deleteErr := awsService.DeleteImages(newUploadedImages); deleteErr != nil {
+			if deleteErr := mediaService.DeleteImages(newUploadedImages); deleteErr != nil {
 				log.Printf("Erreur lors de la suppression des nouvelles images: %v", deleteErr)
 			}
 		}
@@ -2171,6 +2429,22 @@ func EditAdHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Annonce %d mise à jour avec succès par l'utilisateur %d", adID, userID)
 
+	// Historique des modifications pour la revue des modérateurs
+	if err := recordAdRevision(r.Context(), adID, models.AdRevisionEditorUser, userID); err != nil {
+		log.Printf("Erreur lors de l'enregistrement de la révision de l'annonce %d: %v", adID, err)
+	}
+
+	// Historique des prix ; les alertes de baisse partent dès que l'annonce est visible
+	if err := recordAdPriceChange(r.Context(), adID, currentPrice, req.Price); err != nil {
+		log.Printf("Erreur lors de l'enregistrement du prix de l'annonce %d: %v", adID, err)
+	}
+
+	// Validation automatique : mêmes notifications que la validation par un modérateur
+	if isValidated {
+		services.NotifyAdValidated(r.Context(), userID, adID, req.Title)
+		go dispatchPriceDropAlerts(context.Background(), adID)
+	}
+
 	// Renvoyer une réponse de succès avec les nouvelles images
 	response := struct {
 		Message       string   `json:"message"`
@@ -2178,18 +2452,34 @@ func EditAdHandler(w http.ResponseWriter, r *http.Request) {
 		ImagesCount   int      `json:"images_count"`
 		AddedImages   int      `json:"added_images"`
 		RemovedImages int      `json:"removed_images"`
+		IsValidated   bool     `json:"is_validated"`
 	}{
 		Message:       "Annonce mise à jour avec succès",
 		Images:        finalImages,
 		ImagesCount:   len(finalImages),
 		AddedImages:   len(newUploadedImages),
 		RemovedImages: len(imagesToDeleteFromS3),
+		IsValidated:   isValidated,
 	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
+// Marqueurs des termes trouvés dans les extraits de ts_headline (caractères Unicode à usage privé,
+// absents du texte une fois filtré), convertis en <mark></mark> par renderHighlight
+const (
+	highlightStartSel = "\uE000"
+	highlightStopSel  = "\uE001"
+)
+
+// renderHighlight échappe le texte d'un extrait (contenu libre de l'annonce) puis y place les balises <mark>
+func renderHighlight(headline string) string {
+	escaped := html.EscapeString(headline)
+	escaped = strings.ReplaceAll(escaped, highlightStartSel, "<mark>")
+	return strings.ReplaceAll(escaped, highlightStopSel, "</mark>")
+}
+
 // SearchAdsHandler gère la recherche d'annonces avec filtres et pagination
 func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Début du traitement de la requête de recherche d'annonces.")
@@ -2207,6 +2497,8 @@ func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 	maxPriceStr := r.URL.Query().Get("max_price")
 	sortBy := r.URL.Query().Get("sort_by") // "newest", "oldest", "price_asc", "price_desc", "relevance"
 	isDeliveryAvailableStr := r.URL.Query().Get("is_delivery_available")
+	geo := parseGeoFilter(r)            // Recherche "autour de moi" : lat, lng, radius_km
+	wantedFacets := parseFacetsParam(r) // facets=none pour ne pas calculer les facettes
 
 	// Valeurs par défaut pour la pagination
 	page, err := strconv.Atoi(pageStr)
@@ -2251,7 +2543,29 @@ func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Recherches récentes des utilisateurs connectés (fil personnalisé), une fois par recherche
+	if userID, ok := optionalUserID(r); ok && page == 1 {
+		if strings.TrimSpace(searchQuery) != "" || categoryID != nil || subCategoryID != nil || strings.TrimSpace(city) != "" {
+			go recordUserSearch(userID, searchQuery, categoryID, subCategoryID, city)
+		}
+	}
+
+	// Filtres d'attributs, typés par le schéma de la sous-catégorie lorsqu'elle est connue
+	attributeFilters, err := parseAttributeFilters(r, subCategoryID)
+	if err != nil {
+		if errors.Is(err, errInvalidAttributeFilter) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			log.Printf("Erreur lors de la récupération du schéma d'attributs: %v", err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		}
+		return
+	}
+
 	// Sort par défaut
+	if sortBy == "distance" && geo == nil {
+		sortBy = "" // Le tri par distance nécessite une position
+	}
 	if sortBy == "" {
 		if searchQuery != "" {
 			sortBy = "relevance" // Par pertinence si recherche textuelle
@@ -2264,21 +2578,18 @@ func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 	offset := (page - 1) * limit
 
 	// 3. Construire la requête SQL dynamique
-	baseQuery := `
-		SELECT
-			a.id, a.title, a.description, a.price, a.images, a.form_data,
-			a.city, a.phone_number, a.is_phone_visible, a.is_delivery_available,
-			a.latitude, a.longitude, a.created_at,
-			u.id, u.first_name, u.last_name, u.shop_name, u.account_type, u.avatar_url,
-			sc.name AS sub_category_name, c.name AS category_name
-		FROM ads a
-		JOIN users u ON a.user_id = u.id
-		JOIN sub_categories sc ON a.sub_category_id = sc.id
-		JOIN categories c ON sc.category_id = c.id
-		WHERE a.is_validated = TRUE 
-		AND a.is_deactivated = FALSE 
-		AND a.is_rejected = FALSE
-		AND a.is_sold = FALSE`
+	// La requête plein texte est toujours le premier argument ($1) lorsqu'elle est présente,
+	// ce qui permet de la réutiliser pour le filtre, le score et les extraits surlignés.
+	highlightColumns := "NULL::text, NULL::text"
+	if searchQuery != "" {
+		// Marqueurs neutres (retirés du texte de l'annonce), remplacés par <mark> après échappement HTML
+		highlightColumns = `ts_headline('french_unaccent', translate(a.title, '` + highlightStartSel + highlightStopSel + `', ''),
+				websearch_to_tsquery('french_unaccent', $1),
+				'StartSel="` + highlightStartSel + `", StopSel="` + highlightStopSel + `", HighlightAll=true'),
+			ts_headline('french_unaccent', translate(a.description, '` + highlightStartSel + highlightStopSel + `', ''),
+				websearch_to_tsquery('french_unaccent', $1),
+				'StartSel="` + highlightStartSel + `", StopSel="` + highlightStopSel + `", MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=" … "')`
+	}
 
 	baseCountQuery := `
 		SELECT COUNT(*) 
@@ -2287,31 +2598,36 @@ func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 		WHERE a.is_validated = TRUE 
 		AND a.is_deactivated = FALSE 
 		AND a.is_rejected = FALSE
-		AND a.is_sold = FALSE`
+		AND a.is_sold = FALSE
+		AND a.is_expired = FALSE`
 
 	var whereClauses []string
+	var whereDims []string // Dimension de chaque filtre, utilisée par les facettes
 	var args []interface{}
 	var countArgs []interface{}
 	argIndex := 1
 
-	// Filtre de recherche textuelle (recherche dans titre et description)
+	// Filtre de recherche plein texte (titre, description et valeurs de form_data)
+	// Configuration french_unaccent : "voitures" trouve "voiture", "vehicule" trouve "véhicule"
 	if searchQuery != "" {
-		searchPattern := "%" + strings.ToLower(searchQuery) + "%"
 		whereClauses = append(whereClauses,
-			fmt.Sprintf("(LOWER(a.title) LIKE $%d OR LOWER(a.description) LIKE $%d)", argIndex, argIndex))
-		args = append(args, searchPattern)
-		countArgs = append(countArgs, searchPattern)
+			fmt.Sprintf("a.search_vector @@ websearch_to_tsquery('french_unaccent', $%d)", argIndex))
+		whereDims = append(whereDims, "q")
+		args = append(args, searchQuery)
+		countArgs = append(countArgs, searchQuery)
 		argIndex++
 	}
 
 	// Filtre par catégorie
 	if subCategoryID != nil {
 		whereClauses = append(whereClauses, fmt.Sprintf("a.sub_category_id = $%d", argIndex))
+		whereDims = append(whereDims, "category")
 		args = append(args, *subCategoryID)
 		countArgs = append(countArgs, *subCategoryID)
 		argIndex++
 	} else if categoryID != nil {
 		whereClauses = append(whereClauses, fmt.Sprintf("sc.category_id = $%d", argIndex))
+		whereDims = append(whereDims, "category")
 		args = append(args, *categoryID)
 		countArgs = append(countArgs, *categoryID)
 		argIndex++
@@ -2321,6 +2637,7 @@ func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 	if city != "" {
 		whereClauses = append(whereClauses,
 			fmt.Sprintf(`REPLACE(REPLACE(LOWER(a.city), '-', ''), ' ', '') = REPLACE(REPLACE(LOWER($%d), '-', ''), ' ', '')`, argIndex))
+		whereDims = append(whereDims, "city")
 		args = append(args, city)
 		countArgs = append(countArgs, city)
 		argIndex++
@@ -2329,12 +2646,14 @@ func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 	// Filtres de prix
 	if minPrice != nil {
 		whereClauses = append(whereClauses, fmt.Sprintf("a.price >= $%d", argIndex))
+		whereDims = append(whereDims, "price")
 		args = append(args, *minPrice)
 		countArgs = append(countArgs, *minPrice)
 		argIndex++
 	}
 	if maxPrice != nil {
 		whereClauses = append(whereClauses, fmt.Sprintf("a.price <= $%d", argIndex))
+		whereDims = append(whereDims, "price")
 		args = append(args, *maxPrice)
 		countArgs = append(countArgs, *maxPrice)
 		argIndex++
@@ -2343,17 +2662,84 @@ func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 	// Filtre de disponibilité de livraison
 	if isDeliveryAvailable != nil {
 		whereClauses = append(whereClauses, fmt.Sprintf("a.is_delivery_available = $%d", argIndex))
+		whereDims = append(whereDims, "delivery")
 		args = append(args, *isDeliveryAvailable)
 		countArgs = append(countArgs, *isDeliveryAvailable)
 		argIndex++
 	}
 
+	// Filtre de rayon autour de la position de l'utilisateur
+	if geo != nil && geo.RadiusKm != nil {
+		clause, params := geo.radiusClause(argIndex)
+		whereClauses = append(whereClauses, clause)
+		whereDims = append(whereDims, "geo")
+		args = append(args, params...)
+		countArgs = append(countArgs, params...)
+		argIndex += len(params)
+	}
+
+	// Filtres sur les attributs de form_data (attr.marque=Toyota, attr.annee_min=2015, ...)
+	for _, filter := range attributeFilters {
+		clause, params := filter.clause(argIndex)
+		whereClauses = append(whereClauses, clause)
+		whereDims = append(whereDims, "attr")
+		args = append(args, params...)
+		countArgs = append(countArgs, params...)
+		argIndex += len(params)
+	}
+
 	// Construire la clause WHERE
 	whereClause := ""
 	if len(whereClauses) > 0 {
 		whereClause = " AND " + strings.Join(whereClauses, " AND ")
 	}
 
+	// Distance calculée uniquement pour la requête principale (paramètres absents du comptage)
+	distanceColumn := "NULL::float8"
+	distanceExpr := ""
+	if geo != nil {
+		distanceExpr = distanceSQL(argIndex, argIndex+1)
+		distanceColumn = "ROUND(" + distanceExpr + "::numeric, 2)::float8"
+		args = append(args, geo.Lat, geo.Lng)
+		argIndex += 2
+	}
+
+	// Pagination par curseur (keyset) : activée par le paramètre "cursor" (vide pour la première page)
+	rankExpr := ""
+	if searchQuery != "" {
+		rankExpr = "ts_rank(a.search_vector, websearch_to_tsquery('french_unaccent', $1), 1)::float8"
+	}
+	keysetColumns := adKeysetColumns(sortBy, rankExpr, distanceExpr)
+	cursorMode, cursor, err := parseCursorParam(r, sortBy, keysetColumns)
+	if err != nil {
+		http.Error(w, "Curseur invalide", http.StatusBadRequest)
+		return
+	}
+	cursorColumn := "NULL::text[]"
+	if cursorMode {
+		cursorColumn = keysetSelectColumn(keysetColumns)
+	}
+
+	baseQuery := `
+		SELECT
+			a.id, a.title, a.description, a.price, a.images, a.form_data,
+			a.city, a.phone_number, a.is_phone_visible, a.is_delivery_available,
+			a.latitude, a.longitude, a.created_at,
+			u.id, u.first_name, u.last_name, u.shop_name, u.account_type, u.avatar_url,
+			sc.name AS sub_category_name, c.name AS category_name,
+			` + highlightColumns + `,
+			` + distanceColumn + ` AS distance_km,
+			` + cursorColumn + ` AS cursor_key
+		FROM ads a
+		JOIN users u ON a.user_id = u.id
+		JOIN sub_categories sc ON a.sub_category_id = sc.id
+		JOIN categories c ON sc.category_id = c.id
+		WHERE a.is_validated = TRUE 
+		AND a.is_deactivated = FALSE 
+		AND a.is_rejected = FALSE
+		AND a.is_sold = FALSE
+		AND a.is_expired = FALSE`
+
 	// Ajouter la clause ORDER BY
 	var orderBy string
 	switch sortBy {
@@ -2363,19 +2749,12 @@ func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 		orderBy = "ORDER BY a.price ASC, a.created_at DESC"
 	case "price_desc":
 		orderBy = "ORDER BY a.price DESC, a.created_at DESC"
+	case "distance":
+		orderBy = "ORDER BY distance_km ASC NULLS LAST, a.created_at DESC"
 	case "relevance":
-		// Pour la pertinence, on peut améliorer avec un score de recherche
-		// Ici, simple ordre par pertinence basique (correspondance dans le titre prioritaire)
+		// Score ts_rank pondéré (titre > description > form_data), normalisé par la longueur du document
 		if searchQuery != "" {
-			orderBy = `ORDER BY 
-				CASE 
-					WHEN LOWER(a.title) LIKE $` + strconv.Itoa(argIndex) + ` THEN 1
-					WHEN LOWER(a.description) LIKE $` + strconv.Itoa(argIndex) + ` THEN 2
-					ELSE 3
-				END,
-				a.created_at DESC`
-			args = append(args, "%"+strings.ToLower(searchQuery)+"%")
-			argIndex++
+			orderBy = `ORDER BY ts_rank(a.search_vector, websearch_to_tsquery('french_unaccent', $1), 1) DESC, a.created_at DESC`
 		} else {
 			orderBy = "ORDER BY a.created_at DESC"
 		}
@@ -2386,12 +2765,26 @@ func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Requêtes complètes
-	query := baseQuery + whereClause + " " + orderBy + fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+	var query string
+	if cursorMode {
+		// Mode curseur : on reprend après la dernière annonce vue et on lit une annonce de plus
+		// pour savoir s'il reste des résultats (pas de COUNT, pas de doublons ni de trous)
+		keysetClause := ""
+		if cursor != nil {
+			clause, params := keysetCondition(keysetColumns, cursor, argIndex)
+			keysetClause = " AND " + clause
+			args = append(args, params...)
+			argIndex += len(params)
+		}
+		query = baseQuery + whereClause + keysetClause + " " + keysetOrderBy(keysetColumns) + fmt.Sprintf(" LIMIT $%d", argIndex)
+		args = append(args, limit+1)
+	} else {
+		query = baseQuery + whereClause + " " + orderBy + fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
+		// Ajouter LIMIT et OFFSET aux arguments
+		args = append(args, limit, offset)
+	}
 	countQuery := baseCountQuery + whereClause
 
-	// Ajouter LIMIT et OFFSET aux arguments
-	args = append(args, limit, offset)
-
 	log.Printf("Exécution de la requête de recherche: %s", query)
 	log.Printf("Avec les arguments: %v", args)
 
@@ -2405,6 +2798,7 @@ func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	var ads []models.Ad
+	var cursorKeys [][]string
 
 	for rows.Next() {
 		var ad models.Ad
@@ -2413,6 +2807,9 @@ func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 		var latitude, longitude sql.NullFloat64
 		var firstName, lastName, accountType string
 		var subCategoryName, categoryName string
+		var titleHighlight, descriptionHighlight sql.NullString
+		var distanceKm sql.NullFloat64
+		var cursorKey pq.StringArray
 
 		err := rows.Scan(
 			&ad.ID, &ad.Title, &ad.Description, &ad.Price, &images, &formDataStr,
@@ -2420,6 +2817,8 @@ func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 			&latitude, &longitude, &ad.CreatedAt,
 			&ad.User.ID, &firstName, &lastName, &shopName, &accountType, &avatarURL,
 			&subCategoryName, &categoryName,
+			&titleHighlight, &descriptionHighlight,
+			&distanceKm, &cursorKey,
 		)
 		if err != nil {
 			log.Printf("Erreur lors du scan d'une annonce: %v", err)
@@ -2428,6 +2827,7 @@ func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 
 		// Assigner les valeurs scannées
 		ad.Images = []string(images)
+		ad.ImageVariants = services.AdImageVariants(ad.Images)
 		if formDataStr.Valid {
 			json.Unmarshal([]byte(formDataStr.String), &ad.FormData)
 		}
@@ -2437,6 +2837,15 @@ func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 		if longitude.Valid {
 			ad.Longitude = longitude
 		}
+		if distanceKm.Valid {
+			ad.DistanceKm = &distanceKm.Float64
+		}
+		if titleHighlight.Valid || descriptionHighlight.Valid {
+			ad.Highlights = &models.AdHighlights{
+				Title:       renderHighlight(titleHighlight.String),
+				Description: renderHighlight(descriptionHighlight.String),
+			}
+		}
 
 		ad.SubCategoryName = subCategoryName
 		ad.CategoryName = categoryName
@@ -2454,6 +2863,7 @@ func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		ads = append(ads, ad)
+		cursorKeys = append(cursorKeys, []string(cursorKey))
 	}
 
 	if err = rows.Err(); err != nil {
@@ -2462,43 +2872,73 @@ func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 5. Compter le nombre total d'annonces pour la pagination
-	var totalAds int
-	err = config.DB.QueryRow(countQuery, countArgs...).Scan(&totalAds)
+	// 5. Compter le nombre total d'annonces pour la pagination (mode page uniquement)
+	var pagination interface{}
+	totalAds := 0
+	if cursorMode {
+		cursorPagination := CursorPagination{Limit: limit}
+		if len(ads) > limit {
+			ads = ads[:limit]
+			cursorPagination.HasMore = true
+			cursorPagination.NextCursor = nextAdCursor(sortBy, cursorKeys[limit-1], ads[limit-1].ID)
+		}
+		pagination = cursorPagination
+	} else {
+		err = config.DB.QueryRow(countQuery, countArgs...).Scan(&totalAds)
+		if err != nil {
+			log.Printf("Erreur lors du comptage des annonces: %v", err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+			return
+		}
+		pagination = PagePagination{
+			CurrentPage: page,
+			TotalPages:  (totalAds + limit - 1) / limit,
+			TotalAds:    totalAds,
+			Limit:       limit,
+		}
+	}
+
+	// 6. Calculer les facettes (nombre de résultats par filtre possible)
+	facets, err := computeSearchFacets(`
+		FROM ads a
+		JOIN sub_categories sc ON a.sub_category_id = sc.id
+		JOIN categories c ON sc.category_id = c.id
+		WHERE a.is_validated = TRUE 
+		AND a.is_deactivated = FALSE 
+		AND a.is_rejected = FALSE
+		AND a.is_sold = FALSE
+		AND a.is_expired = FALSE`, whereClauses, whereDims, countArgs, wantedFacets)
 	if err != nil {
-		log.Printf("Erreur lors du comptage des annonces: %v", err)
-		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
-		return
+		// Ne pas faire échouer la recherche pour les facettes
+		log.Printf("Erreur lors du calcul des facettes: %v", err)
+		facets = nil
 	}
 
-	// 6. Préparer la réponse finale
+	// 7. Préparer la réponse finale
 	response := struct {
-		Ads        []models.Ad `json:"ads"`
-		Pagination struct {
-			CurrentPage int `json:"current_page"`
-			TotalPages  int `json:"total_pages"`
-			TotalAds    int `json:"total_ads"`
-			Limit       int `json:"limit"`
-		} `json:"pagination"`
-		Search struct {
-			Query               string   `json:"query,omitempty"`
-			CategoryID          *int     `json:"category_id,omitempty"`
-			SubCategoryID       *int     `json:"sub_category_id,omitempty"`
-			City                string   `json:"city,omitempty"`
-			MinPrice            *float64 `json:"min_price,omitempty"`
-			MaxPrice            *float64 `json:"max_price,omitempty"`
-			IsDeliveryAvailable *bool    `json:"is_delivery_available,omitempty"`
-			SortBy              string   `json:"sort_by"`
+		Ads        []models.Ad   `json:"ads"`
+		Pagination interface{}   `json:"pagination"`
+		Facets     *SearchFacets `json:"facets,omitempty"`
+		Search     struct {
+			Query               string            `json:"query,omitempty"`
+			CategoryID          *int              `json:"category_id,omitempty"`
+			SubCategoryID       *int              `json:"sub_category_id,omitempty"`
+			City                string            `json:"city,omitempty"`
+			MinPrice            *float64          `json:"min_price,omitempty"`
+			MaxPrice            *float64          `json:"max_price,omitempty"`
+			IsDeliveryAvailable *bool             `json:"is_delivery_available,omitempty"`
+			Lat                 *float64          `json:"lat,omitempty"`
+			Lng                 *float64          `json:"lng,omitempty"`
+			RadiusKm            *float64          `json:"radius_km,omitempty"`
+			Attributes          []AttributeFilter `json:"attributes,omitempty"`
+			SortBy              string            `json:"sort_by"`
 		} `json:"search"`
 	}{
-		Ads: ads,
+		Ads:        ads,
+		Pagination: pagination,
+		Facets:     facets,
 	}
 
-	response.Pagination.CurrentPage = page
-	response.Pagination.TotalAds = totalAds
-	response.Pagination.Limit = limit
-	response.Pagination.TotalPages = (totalAds + limit - 1) / limit
-
 	// Ajouter les informations de recherche à la réponse
 	response.Search.Query = searchQuery
 	response.Search.CategoryID = categoryID
@@ -2507,6 +2947,12 @@ func SearchAdsHandler(w http.ResponseWriter, r *http.Request) {
 	response.Search.MinPrice = minPrice
 	response.Search.MaxPrice = maxPrice
 	response.Search.IsDeliveryAvailable = isDeliveryAvailable
+	if geo != nil {
+		response.Search.Lat = &geo.Lat
+		response.Search.Lng = &geo.Lng
+		response.Search.RadiusKm = geo.RadiusKm
+	}
+	response.Search.Attributes = attributeFilters
 	response.Search.SortBy = sortBy
 
 	w.Header().Set("Content-Type", "application/json")
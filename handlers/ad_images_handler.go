@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"kivendi-backend/config"
+	"kivendi-backend/models"
+	"kivendi-backend/services"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// adImagesError est une erreur de modification des images renvoyée telle quelle au client
+type adImagesError struct {
+	status  int
+	message string
+}
+
+func (e *adImagesError) Error() string {
+	return e.message
+}
+
+// errAdImagesForbidden signale une annonce qui n'appartient pas à l'utilisateur connecté
+var errAdImagesForbidden = &adImagesError{http.StatusForbidden, "Vous n'êtes pas autorisé à modifier cette annonce"}
+
+// AdImagesResponse est la réponse des endpoints de gestion des images d'une annonce
+type AdImagesResponse struct {
+	Message       string                 `json:"message"`
+	Images        []string               `json:"images"`
+	ImageVariants []models.ImageVariants `json:"image_variants"`
+	ImagesCount   int                    `json:"images_count"`
+	IsValidated   bool                   `json:"is_validated"`
+}
+
+// AdImageRequest désigne une image existante de l'annonce (couverture)
+type AdImageRequest struct {
+	Image string `json:"image"`
+}
+
+// AdImagesOrderRequest est le nouvel ordre des images : les mêmes URLs que l'annonce, réordonnées
+type AdImagesOrderRequest struct {
+	Images []string `json:"images"`
+}
+
+// updateAdImages remplace la liste des images d'une annonce du vendeur connecté avec les mêmes règles qu'une
+// modification complète (EditAdHandler) : révision initiale conservée, nombre d'images borné, retour en
+// modération sauf validation automatique et historique des révisions.
+// mutate reçoit les images actuelles, l'annonce étant verrouillée, et renvoie la nouvelle liste.
+func updateAdImages(ctx context.Context, adID, userID int, mutate func(current []string) ([]string, error)) ([]string, bool, error) {
+	tx, err := config.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	// FOR NO KEY UPDATE : les insertions dans ad_revisions (clé étrangère vers ads) restent possibles
+	var ownerID int
+	var title string
+	var current pq.StringArray
+	err = tx.QueryRowContext(ctx,
+		"SELECT user_id, title, COALESCE(images, '{}') FROM ads WHERE id = $1 FOR NO KEY UPDATE", adID,
+	).Scan(&ownerID, &title, &current)
+	if err != nil {
+		return nil, false, err
+	}
+	if ownerID != userID {
+		return nil, false, errAdImagesForbidden
+	}
+
+	images, err := mutate([]string(current))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(images) == 0 {
+		return nil, false, &adImagesError{http.StatusBadRequest, "Au moins une image est requise"}
+	}
+	adSettings := services.GetAdSettings()
+	if adSettings.MaxImagesPerAd > 0 && len(images) > adSettings.MaxImagesPerAd {
+		return nil, false, &adImagesError{http.StatusBadRequest, fmt.Sprintf("Vous ne pouvez pas ajouter plus de %d images", adSettings.MaxImagesPerAd)}
+	}
+	if adSettings.BlockDuplicateAds && editMayCreateRepost(title, title, []string(current), images) {
+		// Les nouvelles images ne doivent pas faire de l'annonce une copie d'une autre annonce du vendeur
+		existingAdID, found, err := findExactRepost(ctx, userID, title, images, adID)
+		if err != nil {
+			return nil, false, err
+		}
+		if found {
+			log.Printf("Modification des images refusée: l'annonce %d deviendrait identique à l'annonce %d", adID, existingAdID)
+			return nil, false, &adImagesError{http.StatusConflict, "Vous avez déjà publié cette annonce. Modifiez ou renouvelez l'annonce existante plutôt que de la republier."}
+		}
+	}
+
+	// Conserver la version actuelle (vue par les modérateurs) avant de l'écraser
+	if err := ensureAdBaselineRevision(ctx, adID); err != nil {
+		return nil, false, err
+	}
+
+	// Une annonce masquée par des signalements reste en modération, même avec la validation automatique
+	var isValidated bool
+	err = tx.QueryRowContext(ctx, `
+		UPDATE ads
+		SET images = $2, updated_at = NOW(), is_validated = ($3 AND reports_hidden_at IS NULL),
+			is_deactivated = FALSE, is_rejected = FALSE
+		WHERE id = $1
+		RETURNING is_validated
+	`, adID, pq.Array(images), adSettings.AutoValidateAds).Scan(&isValidated)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+
+	// Historique des modifications pour la revue des modérateurs
+	if err := recordAdRevision(ctx, adID, models.AdRevisionEditorUser, userID); err != nil {
+		log.Printf("Erreur lors de l'enregistrement de la révision de l'annonce %d: %v", adID, err)
+	}
+
+	// Validation automatique : mêmes notifications que la validation par un modérateur
+	if isValidated {
+		services.NotifyAdValidated(ctx, userID, adID, title)
+		go dispatchPriceDropAlerts(context.Background(), adID)
+	}
+	return images, isValidated, nil
+}
+
+// writeAdImagesError renvoie l'erreur d'une modification des images avec le code HTTP adapté
+func writeAdImagesError(w http.ResponseWriter, adID int, err error) {
+	var imagesErr *adImagesError
+	switch {
+	case errors.As(err, &imagesErr):
+		http.Error(w, imagesErr.message, imagesErr.status)
+	case err == sql.ErrNoRows:
+		http.Error(w, "Annonce non trouvée", http.StatusNotFound)
+	default:
+		log.Printf("Erreur lors de la modification des images de l'annonce %d: %v", adID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+	}
+}
+
+// writeAdImages renvoie la liste des images mise à jour
+func writeAdImages(w http.ResponseWriter, message string, images []string, isValidated bool) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AdImagesResponse{
+		Message:       message,
+		Images:        images,
+		ImageVariants: services.AdImageVariants(images),
+		ImagesCount:   len(images),
+		IsValidated:   isValidated,
+	})
+}
+
+// parseAdImagesRequest lit l'utilisateur connecté et l'ID de l'annonce
+func parseAdImagesRequest(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+	adID, err := strconv.Atoi(mux.Vars(r)["adID"])
+	if err != nil {
+		http.Error(w, "ID d'annonce invalide", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return userID, adID, true
+}
+
+// AddAdImagesHandler ajoute des images (multipart, champ "images") à la fin de la liste des images d'une annonce
+func AddAdImagesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, adID, ok := parseAdImagesRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// Limiter la taille de la requête pour éviter les attaques DoS
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<20) // 10 MB
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		log.Printf("Erreur lors de l'analyse du formulaire multipart : %v", err)
+		http.Error(w, "La requête est trop grande", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	files := r.MultipartForm.File["images"]
+	if len(files) == 0 {
+		http.Error(w, "Au moins une image est requise", http.StatusBadRequest)
+		return
+	}
+
+	// Vérifier le propriétaire et le nombre maximal d'images avant tout upload
+	var ownerID, currentCount int
+	err := config.DB.QueryRowContext(r.Context(),
+		"SELECT user_id, COALESCE(array_length(images, 1), 0) FROM ads WHERE id = $1", adID,
+	).Scan(&ownerID, &currentCount)
+	if err != nil {
+		writeAdImagesError(w, adID, err)
+		return
+	}
+	if ownerID != userID {
+		writeAdImagesError(w, adID, errAdImagesForbidden)
+		return
+	}
+	adSettings := services.GetAdSettings()
+	if adSettings.MaxImagesPerAd > 0 && currentCount+len(files) > adSettings.MaxImagesPerAd {
+		http.Error(w, fmt.Sprintf("Vous ne pouvez pas ajouter plus de %d images", adSettings.MaxImagesPerAd), http.StatusBadRequest)
+		return
+	}
+
+	uploadedImageURLs, err := mediaService.UploadAdMultipartImages(files)
+	if err != nil {
+		log.Printf("Erreur lors de l'upload des images de l'annonce %d: %v", adID, err)
+		http.Error(w, "Erreur lors de l'upload des images", http.StatusInternalServerError)
+		return
+	}
+
+	images, isValidated, err := updateAdImages(r.Context(), adID, userID, func(current []string) ([]string, error) {
+		return append(current, uploadedImageURLs...), nil
+	})
+	if err != nil {
+		if deleteErr := mediaService.DeleteImages(uploadedImageURLs); deleteErr != nil {
+			log.Printf("Erreur lors de la suppression des images: %v", deleteErr)
+		}
+		writeAdImagesError(w, adID, err)
+		return
+	}
+
+	log.Printf("%d images ajoutées à l'annonce %d par l'utilisateur %d", len(uploadedImageURLs), adID, userID)
+	writeAdImages(w, "Images ajoutées avec succès", images, isValidated)
+}
+
+// DeleteAdImageHandler retire une image de l'annonce (paramètre "image" : son URL) et la supprime du stockage
+func DeleteAdImageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, adID, ok := parseAdImagesRequest(w, r)
+	if !ok {
+		return
+	}
+	image := r.URL.Query().Get("image")
+	if image == "" {
+		http.Error(w, "L'URL de l'image à supprimer est requise", http.StatusBadRequest)
+		return
+	}
+
+	images, isValidated, err := updateAdImages(r.Context(), adID, userID, func(current []string) ([]string, error) {
+		remaining := make([]string, 0, len(current))
+		for _, img := range current {
+			if img != image {
+				remaining = append(remaining, img)
+			}
+		}
+		if len(remaining) == len(current) {
+			return nil, &adImagesError{http.StatusNotFound, "Image non trouvée dans cette annonce"}
+		}
+		if len(remaining) == 0 {
+			return nil, &adImagesError{http.StatusBadRequest, "Impossible de supprimer la dernière image de l'annonce"}
+		}
+		return remaining, nil
+	})
+	if err != nil {
+		writeAdImagesError(w, adID, err)
+		return
+	}
+
+	// Les images d'une version validée restent disponibles pour la comparaison par les modérateurs
+	if toDelete := imagesNotInValidatedRevisions(r.Context(), adID, []string{image}); len(toDelete) > 0 {
+		if err := mediaService.DeleteImages(toDelete); err != nil {
+			log.Printf("Erreur lors de la suppression de l'image de l'annonce %d: %v", adID, err)
+		}
+	}
+
+	log.Printf("Image retirée de l'annonce %d par l'utilisateur %d", adID, userID)
+	writeAdImages(w, "Image supprimée avec succès", images, isValidated)
+}
+
+// ReorderAdImagesHandler change l'ordre des images ; la première image devient la couverture
+func ReorderAdImagesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, adID, ok := parseAdImagesRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req AdImagesOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Données de requête invalides", http.StatusBadRequest)
+		return
+	}
+
+	images, isValidated, err := updateAdImages(r.Context(), adID, userID, func(current []string) ([]string, error) {
+		// Le nouvel ordre doit contenir exactement les images actuelles
+		remaining := make(map[string]int, len(current))
+		for _, img := range current {
+			remaining[img]++
+		}
+		for _, img := range req.Images {
+			if remaining[img] == 0 {
+				return nil, &adImagesError{http.StatusBadRequest, "Le nouvel ordre doit contenir exactement les images actuelles de l'annonce"}
+			}
+			remaining[img]--
+		}
+		if len(req.Images) != len(current) {
+			return nil, &adImagesError{http.StatusBadRequest, "Le nouvel ordre doit contenir exactement les images actuelles de l'annonce"}
+		}
+		return req.Images, nil
+	})
+	if err != nil {
+		writeAdImagesError(w, adID, err)
+		return
+	}
+
+	log.Printf("Images de l'annonce %d réordonnées par l'utilisateur %d", adID, userID)
+	writeAdImages(w, "Ordre des images mis à jour", images, isValidated)
+}
+
+// SetAdCoverImageHandler place une image existante en première position (image de couverture)
+func SetAdCoverImageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, adID, ok := parseAdImagesRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req AdImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Image == "" {
+		http.Error(w, "L'URL de l'image de couverture est requise", http.StatusBadRequest)
+		return
+	}
+
+	images, isValidated, err := updateAdImages(r.Context(), adID, userID, func(current []string) ([]string, error) {
+		reordered := make([]string, 0, len(current))
+		reordered = append(reordered, req.Image)
+		found := false
+		for _, img := range current {
+			if img == req.Image && !found {
+				found = true
+				continue
+			}
+			reordered = append(reordered, img)
+		}
+		if !found {
+			return nil, &adImagesError{http.StatusNotFound, "Image non trouvée dans cette annonce"}
+		}
+		return reordered, nil
+	})
+	if err != nil {
+		writeAdImagesError(w, adID, err)
+		return
+	}
+
+	log.Printf("Image de couverture de l'annonce %d changée par l'utilisateur %d", adID, userID)
+	writeAdImages(w, "Image de couverture mise à jour", images, isValidated)
+}
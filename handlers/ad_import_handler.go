@@ -0,0 +1,1068 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"kivendi-backend/config"
+	"kivendi-backend/models"
+	"kivendi-backend/services"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+const (
+	maxAdImportFileSize    = 5 << 20  // Fichier CSV / JSON
+	maxAdImportArchiveSize = 50 << 20 // Archive zip d'images
+	maxAdImportImageSize   = 10 << 20 // Image téléchargée depuis une URL
+	maxAdImportRows        = 500
+	maxAdImportSKULength   = 100
+
+	// Le worker d'un import signale son activité (heartbeat_at) à intervalle régulier ; un import
+	// "processing" sans signe de vie depuis adImportStaleAfter (redémarrage du serveur) est repris
+	adImportHeartbeatInterval = 30 * time.Second
+	adImportStaleAfter        = 5 * time.Minute
+)
+
+// Résultat du traitement d'une ligne d'import
+const (
+	adImportRowCreated   = "created"
+	adImportRowUpdated   = "updated"
+	adImportRowUnchanged = "unchanged"
+)
+
+// adImportHTTPClient télécharge les images référencées par URL. Les adresses privées ou locales sont refusées.
+var adImportHTTPClient = &http.Client{
+	Timeout: 20 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, c syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+					ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+					return fmt.Errorf("adresse non autorisée: %s", host)
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+}
+
+const adImportJobColumns = `
+	j.id, j.status, COALESCE(j.file_name, ''), j.file_format, j.archive IS NOT NULL,
+	j.total_rows, j.processed_rows, j.created_count, j.updated_count, j.unchanged_count, j.failed_count,
+	j.row_errors, j.error_message, j.created_at, j.started_at, j.finished_at`
+
+// scanAdImportJob lit une ligne produite par adImportJobColumns
+func scanAdImportJob(scanner interface{ Scan(...interface{}) error }) (models.AdImportJob, error) {
+	var j models.AdImportJob
+	var rowErrors []byte
+	var errorMessage sql.NullString
+	var startedAt, finishedAt sql.NullTime
+
+	err := scanner.Scan(
+		&j.ID, &j.Status, &j.FileName, &j.FileFormat, &j.HasArchive,
+		&j.TotalRows, &j.ProcessedRows, &j.CreatedCount, &j.UpdatedCount, &j.UnchangedCount, &j.FailedCount,
+		&rowErrors, &errorMessage, &j.CreatedAt, &startedAt, &finishedAt,
+	)
+	if err != nil {
+		return j, err
+	}
+
+	j.RowErrors = []models.AdImportRowError{}
+	if len(rowErrors) > 0 {
+		if err := json.Unmarshal(rowErrors, &j.RowErrors); err != nil {
+			return j, err
+		}
+	}
+	if errorMessage.Valid {
+		j.ErrorMessage = &errorMessage.String
+	}
+	if startedAt.Valid {
+		j.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		j.FinishedAt = &finishedAt.Time
+	}
+	return j, nil
+}
+
+// ============================================================================
+// LECTURE DES FICHIERS D'IMPORT
+// ============================================================================
+
+// parseAdImportFile lit un fichier CSV ou JSON d'annonces. Les erreurs de structure (fichier illisible,
+// form_data invalide) rejettent le fichier ; les valeurs des champs sont validées ligne par ligne au traitement.
+//
+// CSV : une ligne d'en-tête (séparateur "," ou ";") avec les colonnes sku, title, description, price,
+// sub_category_id, city, phone_number, is_phone_visible, is_delivery_available, latitude, longitude,
+// images (séparées par "|"), form_data (objet JSON) et une colonne "attr.<clé>" par attribut.
+// JSON : un tableau d'annonces (ou un objet {"ads": [...]}) avec les mêmes noms de champs.
+func parseAdImportFile(format string, data []byte) ([]models.AdImportRow, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var records []map[string]interface{}
+	var lines []int
+
+	switch format {
+	case "csv":
+		reader := csv.NewReader(bytes.NewReader(data))
+		firstLine := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			firstLine = data[:i]
+		}
+		if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+			reader.Comma = ';'
+		}
+
+		header, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("en-tête CSV illisible: %v", err)
+		}
+		for i := range header {
+			header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+		}
+
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("CSV invalide: %v", err)
+			}
+			line, _ := reader.FieldPos(0)
+
+			values := make(map[string]interface{}, len(header))
+			empty := true
+			for i, col := range header {
+				if i < len(record) && strings.TrimSpace(record[i]) != "" {
+					values[col] = record[i]
+					empty = false
+				}
+			}
+			if empty {
+				continue
+			}
+			records = append(records, values)
+			lines = append(lines, line)
+		}
+
+	case "json":
+		var list []map[string]interface{}
+		if err := json.Unmarshal(data, &list); err != nil {
+			var wrapped struct {
+				Ads []map[string]interface{} `json:"ads"`
+			}
+			if errWrapped := json.Unmarshal(data, &wrapped); errWrapped != nil || wrapped.Ads == nil {
+				return nil, fmt.Errorf("JSON invalide: un tableau d'annonces est attendu")
+			}
+			list = wrapped.Ads
+		}
+		for i, values := range list {
+			records = append(records, values)
+			lines = append(lines, i+1)
+		}
+
+	default:
+		return nil, fmt.Errorf("format de fichier non supporté: %s", format)
+	}
+
+	rows := make([]models.AdImportRow, 0, len(records))
+	for i, values := range records {
+		row, err := adImportRowFromValues(lines[i], values)
+		if err != nil {
+			return nil, fmt.Errorf("ligne %d : %v", lines[i], err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// adImportRowFromValues construit une ligne d'import à partir des valeurs lues (colonnes CSV ou champs JSON)
+func adImportRowFromValues(line int, values map[string]interface{}) (models.AdImportRow, error) {
+	row := models.AdImportRow{
+		Line:                line,
+		SKU:                 adImportString(values["sku"]),
+		Title:               adImportString(values["title"]),
+		Description:         adImportString(values["description"]),
+		Price:               adImportString(values["price"]),
+		SubCategoryID:       adImportString(values["sub_category_id"]),
+		City:                adImportString(values["city"]),
+		PhoneNumber:         adImportString(values["phone_number"]),
+		IsPhoneVisible:      adImportString(values["is_phone_visible"]),
+		IsDeliveryAvailable: adImportString(values["is_delivery_available"]),
+		Latitude:            adImportString(values["latitude"]),
+		Longitude:           adImportString(values["longitude"]),
+		Images:              []string{},
+		FormData:            map[string]interface{}{},
+	}
+
+	switch images := values["images"].(type) {
+	case string:
+		for _, img := range strings.Split(images, "|") {
+			if img = strings.TrimSpace(img); img != "" {
+				row.Images = append(row.Images, img)
+			}
+		}
+	case []interface{}:
+		for _, img := range images {
+			if s := adImportString(img); s != "" {
+				row.Images = append(row.Images, s)
+			}
+		}
+	case nil:
+	default:
+		return row, errors.New("images doit être une liste d'URLs ou de noms de fichiers")
+	}
+
+	switch formData := values["form_data"].(type) {
+	case map[string]interface{}:
+		for key, value := range formData {
+			row.FormData[key] = value
+		}
+	case string:
+		if strings.TrimSpace(formData) != "" {
+			if err := json.Unmarshal([]byte(formData), &row.FormData); err != nil {
+				return row, errors.New("form_data n'est pas un objet JSON valide")
+			}
+		}
+	case nil:
+	default:
+		return row, errors.New("form_data doit être un objet JSON")
+	}
+
+	for key, value := range values {
+		if attrKey := strings.TrimPrefix(key, "attr."); attrKey != key && attrKey != "" {
+			row.FormData[attrKey] = value
+		}
+	}
+	return row, nil
+}
+
+// adImportString convertit une valeur scalaire lue dans le fichier en texte
+func adImportString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return strings.TrimSpace(val)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	}
+	return ""
+}
+
+// adImportFileFormat déduit le format du fichier de son extension (ou du champ "format")
+func adImportFileFormat(fileName, declared string) string {
+	format := strings.ToLower(strings.TrimSpace(declared))
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+	}
+	if format == "csv" || format == "json" {
+		return format
+	}
+	return ""
+}
+
+// ============================================================================
+// ENDPOINTS
+// ============================================================================
+
+// CreateAdImportHandler reçoit un fichier d'annonces (CSV ou JSON) et, facultativement, une archive zip
+// d'images, puis met l'import en file d'attente. Réservé aux comptes professionnels.
+// Champs multipart : file (obligatoire), images (zip, facultatif), format (csv|json, facultatif).
+func CreateAdImportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+
+	var accountType string
+	err := config.DB.QueryRowContext(r.Context(), "SELECT account_type FROM users WHERE id = $1", userID).Scan(&accountType)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Utilisateur non trouvé", http.StatusNotFound)
+			return
+		}
+		log.Printf("Erreur lors de la récupération du type de compte de l'utilisateur %d: %v", userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if accountType != "Professionnel" {
+		http.Error(w, "L'import d'annonces est réservé aux comptes professionnels", http.StatusForbidden)
+		return
+	}
+
+	// Un seul import en cours par vendeur
+	var activeImports int
+	err = config.DB.QueryRowContext(r.Context(),
+		"SELECT COUNT(*) FROM ad_import_jobs WHERE user_id = $1 AND status IN ('pending', 'processing')", userID).Scan(&activeImports)
+	if err != nil {
+		log.Printf("Erreur lors de la vérification des imports en cours de l'utilisateur %d: %v", userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if activeImports > 0 {
+		http.Error(w, "Un import est déjà en cours, veuillez attendre sa fin", http.StatusConflict)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAdImportFileSize+maxAdImportArchiveSize+(1<<20))
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		log.Printf("Erreur lors de l'analyse du formulaire d'import: %v", err)
+		http.Error(w, "La requête est trop grande", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	file, fileHeader, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Le fichier d'annonces (file) est requis", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	format := adImportFileFormat(fileHeader.Filename, r.FormValue("format"))
+	if format == "" {
+		http.Error(w, "Format de fichier non supporté (CSV ou JSON attendu)", http.StatusBadRequest)
+		return
+	}
+	if fileHeader.Size > maxAdImportFileSize {
+		http.Error(w, fmt.Sprintf("Le fichier d'annonces ne doit pas dépasser %d Mo", maxAdImportFileSize>>20), http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		log.Printf("Erreur lors de la lecture du fichier d'import: %v", err)
+		http.Error(w, "Fichier d'annonces illisible", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := parseAdImportFile(format, data)
+	if err != nil {
+		http.Error(w, "Fichier d'annonces invalide : "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(rows) == 0 {
+		http.Error(w, "Le fichier ne contient aucune annonce", http.StatusBadRequest)
+		return
+	}
+	if len(rows) > maxAdImportRows {
+		http.Error(w, fmt.Sprintf("Un import ne peut pas dépasser %d annonces", maxAdImportRows), http.StatusBadRequest)
+		return
+	}
+
+	// Archive zip d'images (facultative)
+	var archive []byte
+	if archiveFile, archiveHeader, err := r.FormFile("images"); err == nil {
+		defer archiveFile.Close()
+		if archiveHeader.Size > maxAdImportArchiveSize {
+			http.Error(w, fmt.Sprintf("L'archive d'images ne doit pas dépasser %d Mo", maxAdImportArchiveSize>>20), http.StatusBadRequest)
+			return
+		}
+		archive, err = io.ReadAll(archiveFile)
+		if err == nil {
+			_, err = zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		}
+		if err != nil {
+			http.Error(w, "L'archive d'images doit être un fichier zip valide", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rowsJSON, _ := json.Marshal(rows)
+	var importID int
+	err = config.DB.QueryRowContext(r.Context(), `
+		INSERT INTO ad_import_jobs (user_id, file_name, file_format, rows, archive, total_rows)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, userID, fileHeader.Filename, format, string(rowsJSON), archive, len(rows)).Scan(&importID)
+	if err != nil {
+		log.Printf("Erreur lors de l'enregistrement de l'import de l'utilisateur %d: %v", userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Import d'annonces %d créé par l'utilisateur %d (%d lignes)", importID, userID, len(rows))
+
+	job, err := scanAdImportJob(config.DB.QueryRowContext(r.Context(),
+		"SELECT "+adImportJobColumns+" FROM ad_import_jobs j WHERE j.id = $1", importID))
+	if err != nil {
+		log.Printf("Erreur lors de la récupération de l'import %d: %v", importID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	// Traitement asynchrone ; le job périodique reprend les imports en attente en cas d'échec
+	go ProcessPendingAdImports()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// GetAdImportsHandler renvoie les derniers imports de l'utilisateur connecté
+func GetAdImportsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := config.DB.QueryContext(r.Context(),
+		"SELECT "+adImportJobColumns+" FROM ad_import_jobs j WHERE j.user_id = $1 ORDER BY j.created_at DESC LIMIT 50", userID)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération des imports de l'utilisateur %d: %v", userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	jobs := []models.AdImportJob{}
+	for rows.Next() {
+		job, err := scanAdImportJob(rows)
+		if err != nil {
+			log.Printf("Erreur lors du scan d'un import: %v", err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+			return
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Erreur après l'itération des imports: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// GetAdImportHandler renvoie l'avancement d'un import de l'utilisateur connecté et ses erreurs par ligne
+func GetAdImportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+	importID, err := strconv.Atoi(mux.Vars(r)["importID"])
+	if err != nil {
+		http.Error(w, "ID d'import invalide", http.StatusBadRequest)
+		return
+	}
+
+	job, err := scanAdImportJob(config.DB.QueryRowContext(r.Context(),
+		"SELECT "+adImportJobColumns+" FROM ad_import_jobs j WHERE j.id = $1 AND j.user_id = $2", importID, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Import non trouvé", http.StatusNotFound)
+			return
+		}
+		log.Printf("Erreur lors de la récupération de l'import %d: %v", importID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// ============================================================================
+// TRAITEMENT ASYNCHRONE
+// ============================================================================
+
+// adImportSubCategory met en cache ce qu'il faut savoir d'une sous-catégorie pendant un import
+type adImportSubCategory struct {
+	exists        bool
+	multiEnumKeys map[string]bool
+}
+
+// adImportRun regroupe l'état partagé par les lignes d'un import
+type adImportRun struct {
+	userID        int
+	settings      services.AdSettings
+	archiveFiles  map[string]*zip.File
+	subCategories map[int]*adImportSubCategory
+}
+
+// adImportValues sont les valeurs d'une ligne après conversion et validation
+type adImportValues struct {
+	title, description  string
+	price               float64
+	subCategoryID       int
+	formDataJSON        string
+	city, phoneNumber   string
+	isPhoneVisible      bool
+	isDeliveryAvailable bool
+	latitude, longitude *float64
+}
+
+// ProcessPendingAdImports traite les imports en attente, un à la fois, jusqu'à ce que la file soit vide.
+// Plusieurs appels concurrents sont sans risque : chaque import est réservé avec FOR UPDATE SKIP LOCKED.
+func ProcessPendingAdImports() {
+	for {
+		processed, err := processNextAdImport(context.Background())
+		if err != nil {
+			log.Printf("Erreur lors du traitement des imports d'annonces: %v", err)
+			return
+		}
+		if !processed {
+			return
+		}
+	}
+}
+
+// processNextAdImport réserve et traite le plus ancien import en attente. Renvoie false si la file est vide.
+func processNextAdImport(ctx context.Context) (bool, error) {
+	var importID, userID int
+	var rowsJSON, archive []byte
+	err := config.DB.QueryRowContext(ctx, `
+		UPDATE ad_import_jobs SET
+			status = 'processing', started_at = NOW(), heartbeat_at = NOW(), processed_rows = 0, created_count = 0,
+			updated_count = 0, unchanged_count = 0, failed_count = 0, row_errors = '[]', error_message = NULL
+		WHERE id = (
+			SELECT id FROM ad_import_jobs
+			WHERE status = 'pending'
+			OR (status = 'processing' AND COALESCE(heartbeat_at, started_at) < NOW() - make_interval(secs => $1))
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, rows, archive
+	`, adImportStaleAfter.Seconds()).Scan(&importID, &userID, &rowsJSON, &archive)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Traitement de l'import d'annonces %d de l'utilisateur %d", importID, userID)
+
+	stopHeartbeat := startAdImportHeartbeat(importID)
+	defer stopHeartbeat()
+
+	var rows []models.AdImportRow
+	if err := json.Unmarshal(rowsJSON, &rows); err != nil {
+		failAdImport(ctx, importID, "Fichier d'import illisible")
+		return true, nil
+	}
+
+	run := &adImportRun{
+		userID:        userID,
+		settings:      services.GetAdSettings(),
+		archiveFiles:  map[string]*zip.File{},
+		subCategories: map[int]*adImportSubCategory{},
+	}
+
+	if len(archive) > 0 {
+		zipReader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		if err != nil {
+			failAdImport(ctx, importID, "L'archive d'images est illisible")
+			return true, nil
+		}
+		for _, f := range zipReader.File {
+			name := path.Base(f.Name)
+			if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") || strings.HasPrefix(name, ".") {
+				continue
+			}
+			run.archiveFiles[strings.ToLower(name)] = f
+		}
+	}
+
+	var created, updated, unchanged int
+	rowErrors := []models.AdImportRowError{}
+	skuLines := make(map[string]int)
+
+	for i, row := range rows {
+		var fieldErrors map[string]string
+		if firstLine, duplicate := skuLines[strings.ToLower(row.SKU)]; duplicate && row.SKU != "" {
+			fieldErrors = map[string]string{"sku": fmt.Sprintf("SKU déjà utilisé à la ligne %d du fichier", firstLine)}
+		} else {
+			skuLines[strings.ToLower(row.SKU)] = row.Line
+			var outcome string
+			outcome, fieldErrors, err = importAdRow(ctx, run, row)
+			if err != nil {
+				log.Printf("Erreur lors de l'import de la ligne %d (import %d): %v", row.Line, importID, err)
+				fieldErrors = map[string]string{"ligne": "Erreur interne lors de l'import de cette ligne"}
+			}
+			switch outcome {
+			case adImportRowCreated:
+				created++
+			case adImportRowUpdated:
+				updated++
+			case adImportRowUnchanged:
+				unchanged++
+			}
+		}
+		if len(fieldErrors) > 0 {
+			rowErrors = append(rowErrors, models.AdImportRowError{Line: row.Line, SKU: row.SKU, Errors: fieldErrors})
+		}
+
+		// Avancement visible par l'endpoint de statut
+		if (i+1)%10 == 0 && i+1 < len(rows) {
+			rowErrorsJSON, _ := json.Marshal(rowErrors)
+			_, err = config.DB.ExecContext(ctx, `
+				UPDATE ad_import_jobs SET processed_rows = $2, created_count = $3, updated_count = $4,
+					unchanged_count = $5, failed_count = $6, row_errors = $7
+				WHERE id = $1
+			`, importID, i+1, created, updated, unchanged, len(rowErrors), string(rowErrorsJSON))
+			if err != nil {
+				log.Printf("Erreur lors de la mise à jour de l'avancement de l'import %d: %v", importID, err)
+			}
+		}
+	}
+
+	rowErrorsJSON, _ := json.Marshal(rowErrors)
+	_, err = config.DB.ExecContext(ctx, `
+		UPDATE ad_import_jobs SET status = 'completed', processed_rows = $2, created_count = $3, updated_count = $4,
+			unchanged_count = $5, failed_count = $6, row_errors = $7, archive = NULL, finished_at = NOW()
+		WHERE id = $1
+	`, importID, len(rows), created, updated, unchanged, len(rowErrors), string(rowErrorsJSON))
+	if err != nil {
+		return true, err
+	}
+	log.Printf("Import d'annonces %d terminé: %d créées, %d mises à jour, %d inchangées, %d en erreur",
+		importID, created, updated, unchanged, len(rowErrors))
+
+	message := fmt.Sprintf("%d annonce(s) créée(s), %d mise(s) à jour, %d inchangée(s).", created, updated, unchanged)
+	if len(rowErrors) > 0 {
+		message += fmt.Sprintf(" %d ligne(s) en erreur.", len(rowErrors))
+	}
+	go services.CreateNotification(userID, "ad_import_completed", "Votre import d'annonces est terminé", message,
+		map[string]interface{}{"importId": importID})
+
+	return true, nil
+}
+
+// startAdImportHeartbeat met à jour heartbeat_at pendant le traitement d'un import, pour qu'un import
+// lent mais vivant ne soit pas repris par un autre worker. La fonction renvoyée arrête les mises à jour.
+func startAdImportHeartbeat(importID int) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(adImportHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_, err := config.DB.Exec(
+					"UPDATE ad_import_jobs SET heartbeat_at = NOW() WHERE id = $1 AND status = 'processing'", importID)
+				if err != nil {
+					log.Printf("Erreur lors du signal d'activité de l'import %d: %v", importID, err)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// failAdImport marque un import en échec global
+func failAdImport(ctx context.Context, importID int, message string) {
+	_, err := config.DB.ExecContext(ctx, `
+		UPDATE ad_import_jobs SET status = 'failed', error_message = $2, archive = NULL, finished_at = NOW()
+		WHERE id = $1
+	`, importID, message)
+	if err != nil {
+		log.Printf("Erreur lors du passage en échec de l'import %d: %v", importID, err)
+	}
+	log.Printf("Import d'annonces %d en échec: %s", importID, message)
+}
+
+// subCategory renvoie (avec cache) l'existence de la sous-catégorie et ses attributs à choix multiples
+func (run *adImportRun) subCategory(subCategoryID int) (*adImportSubCategory, error) {
+	if sc, ok := run.subCategories[subCategoryID]; ok {
+		return sc, nil
+	}
+
+	sc := &adImportSubCategory{multiEnumKeys: map[string]bool{}}
+	err := config.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM sub_categories WHERE id = $1)", subCategoryID).Scan(&sc.exists)
+	if err != nil {
+		return nil, err
+	}
+	if sc.exists {
+		attributes, err := loadSubCategoryAttributes(subCategoryID)
+		if err != nil {
+			return nil, err
+		}
+		for _, attr := range attributes {
+			if attr.FieldType == models.AttributeTypeMultiEnum {
+				sc.multiEnumKeys[attr.Key] = true
+			}
+		}
+	}
+	run.subCategories[subCategoryID] = sc
+	return sc, nil
+}
+
+// validateAdImportRow convertit et valide les champs d'une ligne (sans les images).
+// isNew indique une création : les attributs obligatoires absents ne sont refusés que dans ce cas.
+func (run *adImportRun) validateAdImportRow(row models.AdImportRow, isNew bool) (adImportValues, map[string]string, error) {
+	var v adImportValues
+	fieldErrors := make(map[string]string)
+
+	if row.SKU == "" {
+		fieldErrors["sku"] = "Le SKU est obligatoire"
+	} else if len([]rune(row.SKU)) > maxAdImportSKULength {
+		fieldErrors["sku"] = fmt.Sprintf("Le SKU ne doit pas dépasser %d caractères", maxAdImportSKULength)
+	}
+
+	v.title = row.Title
+	if v.title == "" {
+		fieldErrors["title"] = "Le titre est obligatoire"
+	}
+	v.description = row.Description
+	if v.description == "" {
+		fieldErrors["description"] = "La description est obligatoire"
+	}
+
+	if row.Price == "" {
+		fieldErrors["price"] = "Le prix est obligatoire"
+	} else {
+		cleaned := strings.ReplaceAll(strings.ReplaceAll(row.Price, " ", ""), ",", ".")
+		price, err := strconv.ParseFloat(cleaned, 64)
+		if err != nil || math.IsNaN(price) || math.IsInf(price, 0) || price < 0 {
+			fieldErrors["price"] = "Le prix n'est pas un nombre valide"
+		}
+		v.price = math.Round(price*100) / 100
+	}
+
+	v.city = row.City
+	v.phoneNumber = row.PhoneNumber
+
+	var err error
+	if v.isPhoneVisible, err = parseAdImportBool(row.IsPhoneVisible); err != nil {
+		fieldErrors["is_phone_visible"] = "La visibilité du téléphone n'est pas une valeur booléenne valide"
+	}
+	if v.isDeliveryAvailable, err = parseAdImportBool(row.IsDeliveryAvailable); err != nil {
+		fieldErrors["is_delivery_available"] = "La disponibilité de la livraison n'est pas une valeur booléenne valide"
+	}
+	if v.latitude, err = parseAdImportCoordinate(row.Latitude, 90); err != nil {
+		fieldErrors["latitude"] = "La latitude n'est pas valide"
+	}
+	if v.longitude, err = parseAdImportCoordinate(row.Longitude, 180); err != nil {
+		fieldErrors["longitude"] = "La longitude n'est pas valide"
+	}
+
+	if run.settings.MaxImagesPerAd > 0 && len(row.Images) > run.settings.MaxImagesPerAd {
+		fieldErrors["images"] = fmt.Sprintf("Vous ne pouvez pas ajouter plus de %d images", run.settings.MaxImagesPerAd)
+	}
+
+	// Sous-catégorie et attributs
+	subCategoryID, err := strconv.Atoi(row.SubCategoryID)
+	if err != nil {
+		fieldErrors["sub_category_id"] = "L'ID de sous-catégorie n'est pas un nombre valide"
+		return v, fieldErrors, nil
+	}
+	v.subCategoryID = subCategoryID
+
+	sc, err := run.subCategory(subCategoryID)
+	if err != nil {
+		return v, nil, err
+	}
+	if !sc.exists {
+		fieldErrors["sub_category_id"] = "Sous-catégorie inconnue"
+		return v, fieldErrors, nil
+	}
+
+	formData := make(map[string]interface{}, len(row.FormData))
+	for key, value := range row.FormData {
+		// Dans un CSV, les choix multiples sont séparés par "|"
+		if s, isString := value.(string); isString && sc.multiEnumKeys[key] {
+			items := []interface{}{}
+			for _, item := range strings.Split(s, "|") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			value = items
+		}
+		formData[key] = value
+	}
+
+	attrErrors, err := validateAdFormData(subCategoryID, formData, isNew)
+	if err != nil {
+		return v, nil, err
+	}
+	for key, msg := range attrErrors {
+		fieldErrors["form_data."+key] = msg
+	}
+	formDataJSON, _ := json.Marshal(formData)
+	v.formDataJSON = string(formDataJSON)
+
+	return v, fieldErrors, nil
+}
+
+// parseAdImportBool lit un booléen facultatif (vide = false ; accepte aussi oui/non)
+func parseAdImportBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return false, nil
+	case "oui":
+		return true, nil
+	case "non":
+		return false, nil
+	}
+	return strconv.ParseBool(s)
+}
+
+// parseAdImportCoordinate lit une coordonnée facultative bornée par ±limit
+func parseAdImportCoordinate(s string, limit float64) (*float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", "."), 64)
+	if err != nil || math.IsNaN(f) || f < -limit || f > limit {
+		return nil, errors.New("coordonnée invalide")
+	}
+	return &f, nil
+}
+
+// adImportImageSourceKeys identifie les sources d'images d'une ligne : l'URL, ou le nom et l'empreinte
+// du fichier de l'archive. Une ligne réimportée avec les mêmes sources garde ses images actuelles.
+func (run *adImportRun) adImportImageSourceKeys(images []string) ([]string, map[string]string) {
+	keys := make([]string, 0, len(images))
+	fieldErrors := make(map[string]string)
+	for _, img := range images {
+		if strings.HasPrefix(img, "http://") || strings.HasPrefix(img, "https://") {
+			keys = append(keys, img)
+			continue
+		}
+		f, ok := run.archiveFiles[strings.ToLower(path.Base(img))]
+		if !ok {
+			fieldErrors["images"] = fmt.Sprintf("Image « %s » introuvable dans l'archive", img)
+			continue
+		}
+		keys = append(keys, fmt.Sprintf("zip:%s:%08x", strings.ToLower(path.Base(img)), f.CRC32))
+	}
+	return keys, fieldErrors
+}
+
+// fetchAdImportImage lit une image depuis l'archive ou la télécharge depuis son URL
+func (run *adImportRun) fetchAdImportImage(ctx context.Context, source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		f, ok := run.archiveFiles[strings.ToLower(path.Base(source))]
+		if !ok {
+			return nil, errors.New("introuvable dans l'archive")
+		}
+		if f.UncompressedSize64 > maxAdImportImageSize {
+			return nil, errors.New("fichier trop volumineux")
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(io.LimitReader(rc, maxAdImportImageSize))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, errors.New("URL invalide")
+	}
+	resp, err := adImportHTTPClient.Do(req)
+	if err != nil {
+		return nil, errors.New("téléchargement impossible")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("téléchargement impossible (HTTP %d)", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAdImportImageSize+1))
+	if err != nil {
+		return nil, errors.New("téléchargement interrompu")
+	}
+	if len(data) > maxAdImportImageSize {
+		return nil, errors.New("fichier trop volumineux")
+	}
+	return data, nil
+}
+
+// uploadAdImportImages envoie les images d'une ligne vers S3. En cas d'échec, les images déjà envoyées sont supprimées.
+func (run *adImportRun) uploadAdImportImages(ctx context.Context, images []string) ([]string, string) {
+	uploaded := make([]string, 0, len(images))
+	for _, source := range images {
+		data, err := run.fetchAdImportImage(ctx, source)
+		var imageURL string
+		if err == nil {
+			imageURL, err = mediaService.UploadAdImageData(data)
+		}
+		if err != nil {
+			if len(uploaded) > 0 {
+				if deleteErr := mediaService.DeleteImages(uploaded); deleteErr != nil {
+					log.Printf("Erreur lors de la suppression des images importées: %v", deleteErr)
+				}
+			}
+			return nil, fmt.Sprintf("Image « %s » : %v", source, err)
+		}
+		uploaded = append(uploaded, imageURL)
+	}
+	return uploaded, ""
+}
+
+// importAdRow crée l'annonce d'une ligne, ou met à jour l'annonce du vendeur portant le même SKU.
+// Une mise à jour suit les mêmes règles qu'une modification par le vendeur (révision, historique
+// des prix, nouvelle modération) ; une ligne identique à l'annonce existante est ignorée.
+func importAdRow(ctx context.Context, run *adImportRun, row models.AdImportRow) (string, map[string]string, error) {
+	var adID int
+	var currentTitle string
+	var currentPrice float64
+	var currentImages, currentSources pq.StringArray
+	err := config.DB.QueryRowContext(ctx, `
+		SELECT id, title, price, COALESCE(images, '{}'), COALESCE(import_image_sources, '{}')
+		FROM ads WHERE user_id = $1 AND sku = $2
+	`, run.userID, row.SKU).Scan(&adID, &currentTitle, &currentPrice, &currentImages, &currentSources)
+	exists := err == nil
+	if err != nil && err != sql.ErrNoRows {
+		return "", nil, err
+	}
+
+	values, fieldErrors, err := run.validateAdImportRow(row, !exists)
+	if err != nil {
+		return "", nil, err
+	}
+	sourceKeys, imageErrors := run.adImportImageSourceKeys(row.Images)
+	for key, msg := range imageErrors {
+		fieldErrors[key] = msg
+	}
+
+	if !exists && len(row.Images) == 0 {
+		fieldErrors["images"] = "Au moins une image est requise"
+	}
+	if len(fieldErrors) > 0 {
+		return "", fieldErrors, nil
+	}
+
+	// Images : conservées si la ligne n'en fournit pas ou si leurs sources n'ont pas changé
+	images := []string(currentImages)
+	var newImages []string
+	if len(row.Images) > 0 && !(exists && strings.Join(sourceKeys, "\n") == strings.Join(currentSources, "\n")) {
+		var msg string
+		newImages, msg = run.uploadAdImportImages(ctx, row.Images)
+		if msg != "" {
+			return "", map[string]string{"images": msg}, nil
+		}
+		images = newImages
+	} else {
+		sourceKeys = []string(currentSources)
+	}
+
+	// Supprime de S3 les images envoyées pour cette ligne si l'écriture en base échoue
+	discardNewImages := func() {
+		if len(newImages) > 0 {
+			if deleteErr := mediaService.DeleteImages(newImages); deleteErr != nil {
+				log.Printf("Erreur lors de la suppression des images importées: %v", deleteErr)
+			}
+		}
+	}
+
+	// Republication à l'identique d'une annonce du vendeur (si app_settings.block_duplicate_ads),
+	// y compris par la mise à jour d'une annonce existante (adID, exclue de la recherche)
+	if run.settings.BlockDuplicateAds && (!exists || editMayCreateRepost(currentTitle, values.title, currentImages, images)) {
+		existingAdID, found, err := findExactRepost(ctx, run.userID, values.title, images, adID)
+		if err != nil {
+			discardNewImages()
+			return "", nil, err
+		}
+		if found {
+			discardNewImages()
+			return "", map[string]string{
+				"ligne": fmt.Sprintf("Annonce identique à votre annonce %d déjà publiée : modifiez-la ou renouvelez-la plutôt que de la republier", existingAdID),
+			}, nil
+		}
+	}
+
+	if !exists {
+		err = config.DB.QueryRowContext(ctx, `
+			INSERT INTO ads (title, description, price, sub_category_id, images, form_data, is_validated, is_deactivated, is_rejected,
+				latitude, longitude, city, phone_number, is_phone_visible, is_delivery_available, user_id, sku, import_image_sources, title_fingerprint, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, FALSE, FALSE, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, `+services.AdExpiresAtSQL+`)
+			RETURNING id
+		`, values.title, values.description, values.price, values.subCategoryID, pq.Array(images), values.formDataJSON,
+			run.settings.AutoValidateAds, values.latitude, values.longitude, values.city, values.phoneNumber,
+			values.isPhoneVisible, values.isDeliveryAvailable, run.userID, row.SKU, pq.Array(sourceKeys),
+			services.TitleFingerprint(values.title)).Scan(&adID)
+		if err != nil {
+			discardNewImages()
+			return "", nil, err
+		}
+		return adImportRowCreated, nil, nil
+	}
+
+	// Conserver la version actuelle (vue par les modérateurs) avant de l'écraser
+	if err := ensureAdBaselineRevision(ctx, adID); err != nil {
+		discardNewImages()
+		return "", nil, err
+	}
+
+	// Une annonce masquée par des signalements reste en modération, même avec la validation automatique
+	var isValidated bool
+	err = config.DB.QueryRowContext(ctx, `
+		UPDATE ads SET
+			title = $2, description = $3, price = $4, sub_category_id = $5, images = $6, form_data = $7,
+			latitude = $8, longitude = $9, city = $10, phone_number = $11, is_phone_visible = $12,
+			is_delivery_available = $13, import_image_sources = $14, title_fingerprint = $16,
+			updated_at = NOW(), is_validated = ($15 AND reports_hidden_at IS NULL), is_deactivated = FALSE, is_rejected = FALSE
+		WHERE id = $1 AND (
+			title IS DISTINCT FROM $2 OR description IS DISTINCT FROM $3 OR price IS DISTINCT FROM $4::numeric
+			OR sub_category_id IS DISTINCT FROM $5 OR images IS DISTINCT FROM $6 OR form_data IS DISTINCT FROM $7::jsonb
+			OR latitude IS DISTINCT FROM $8 OR longitude IS DISTINCT FROM $9 OR COALESCE(city, '') IS DISTINCT FROM $10
+			OR COALESCE(phone_number, '') IS DISTINCT FROM $11 OR COALESCE(is_phone_visible, FALSE) IS DISTINCT FROM $12
+			OR COALESCE(is_delivery_available, FALSE) IS DISTINCT FROM $13
+		)
+		RETURNING is_validated
+	`, adID, values.title, values.description, values.price, values.subCategoryID, pq.Array(images), values.formDataJSON,
+		values.latitude, values.longitude, values.city, values.phoneNumber, values.isPhoneVisible,
+		values.isDeliveryAvailable, pq.Array(sourceKeys), run.settings.AutoValidateAds, services.TitleFingerprint(values.title)).Scan(&isValidated)
+	if err == sql.ErrNoRows {
+		return adImportRowUnchanged, nil, nil
+	}
+	if err != nil {
+		discardNewImages()
+		return "", nil, err
+	}
+
+	// Les images remplacées sont supprimées, sauf celles d'une version validée
+	if len(newImages) > 0 {
+		removed := imagesNotInValidatedRevisions(ctx, adID, []string(currentImages))
+		if len(removed) > 0 {
+			if err := mediaService.DeleteImages(removed); err != nil {
+				log.Printf("Erreur lors de la suppression des anciennes images de l'annonce %d: %v", adID, err)
+			}
+		}
+	}
+
+	if err := recordAdRevision(ctx, adID, models.AdRevisionEditorUser, run.userID); err != nil {
+		log.Printf("Erreur lors de l'enregistrement de la révision de l'annonce %d: %v", adID, err)
+	}
+	if err := recordAdPriceChange(ctx, adID, currentPrice, values.price); err != nil {
+		log.Printf("Erreur lors de l'enregistrement du prix de l'annonce %d: %v", adID, err)
+	}
+	if isValidated {
+		go dispatchPriceDropAlerts(context.Background(), adID)
+	}
+	return adImportRowUpdated, nil, nil
+}
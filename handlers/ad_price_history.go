@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	"kivendi-backend/config"
+	"kivendi-backend/models"
+	"kivendi-backend/services"
+)
+
+// adVisibleSQL est la condition de visibilité publique d'une annonce (alias a)
+const adVisibleSQL = `a.is_validated = TRUE AND a.is_deactivated = FALSE AND a.is_rejected = FALSE
+	AND COALESCE(a.is_sold, FALSE) = FALSE AND a.is_expired = FALSE`
+
+// isPriceDrop indique si la baisse de oldPrice à newPrice atteint le seuil app_settings.price_drop_alert_percent
+func isPriceDrop(oldPrice, newPrice float64, thresholdPercent int) bool {
+	if thresholdPercent <= 0 || oldPrice <= 0 || newPrice >= oldPrice {
+		return false
+	}
+	return (oldPrice-newPrice)/oldPrice*100 >= float64(thresholdPercent)
+}
+
+// recordAdPriceChange enregistre un changement de prix dans ad_price_history.
+// Le premier changement d'une annonce enregistre aussi son prix d'origine (date de création).
+// Une baisse suffisante est marquée pour alerter les favoris dès que l'annonce est visible.
+func recordAdPriceChange(ctx context.Context, adID int, oldPrice, newPrice float64) error {
+	if oldPrice == newPrice {
+		return nil
+	}
+
+	_, err := config.DB.ExecContext(ctx, `
+		INSERT INTO ad_price_history (ad_id, price, changed_at)
+		SELECT a.id, $2, a.created_at FROM ads a
+		WHERE a.id = $1 AND NOT EXISTS (SELECT 1 FROM ad_price_history h WHERE h.ad_id = a.id)
+	`, adID, oldPrice)
+	if err != nil {
+		return err
+	}
+
+	pendingAlert := isPriceDrop(oldPrice, newPrice, services.GetAdSettings().PriceDropAlertPercent)
+	_, err = config.DB.ExecContext(ctx, `
+		INSERT INTO ad_price_history (ad_id, price, previous_price, drop_alert_pending)
+		VALUES ($1, $2, $3, $4)
+	`, adID, newPrice, oldPrice, pendingAlert)
+	return err
+}
+
+// loadAdPriceHistory renvoie l'historique des prix d'une annonce, du plus ancien au plus récent
+func loadAdPriceHistory(ctx context.Context, adID int) ([]models.AdPricePoint, error) {
+	rows, err := config.DB.QueryContext(ctx,
+		"SELECT price, changed_at FROM ad_price_history WHERE ad_id = $1 ORDER BY changed_at, id", adID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []models.AdPricePoint
+	for rows.Next() {
+		var point models.AdPricePoint
+		if err := rows.Scan(&point.Price, &point.ChangedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, point)
+	}
+	return history, rows.Err()
+}
+
+// dispatchPriceDropAlerts envoie les alertes de baisse de prix en attente pour une annonce visible.
+// Une annonce modifiée repasse en modération : l'alerte part à sa validation, avec le prix alors en vigueur.
+func dispatchPriceDropAlerts(ctx context.Context, adID int) {
+	var referencePrice sql.NullFloat64
+	err := config.DB.QueryRowContext(ctx, `
+		WITH sent AS (
+			UPDATE ad_price_history h
+			SET drop_alert_pending = FALSE, alert_sent_at = NOW()
+			FROM ads a
+			WHERE h.ad_id = $1 AND h.drop_alert_pending = TRUE AND a.id = h.ad_id AND `+adVisibleSQL+`
+			RETURNING h.previous_price
+		)
+		SELECT MAX(previous_price) FROM sent
+	`, adID).Scan(&referencePrice)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération des alertes de prix de l'annonce %d: %v", adID, err)
+		return
+	}
+	if !referencePrice.Valid {
+		return // Aucune alerte en attente, ou annonce non visible
+	}
+
+	var sellerID int
+	var adTitle string
+	var currentPrice float64
+	err = config.DB.QueryRowContext(ctx, "SELECT user_id, title, price FROM ads WHERE id = $1", adID).Scan(&sellerID, &adTitle, &currentPrice)
+	if err != nil {
+		log.Printf("Erreur lors de la lecture de l'annonce %d pour l'alerte de prix: %v", adID, err)
+		return
+	}
+
+	// Le prix a pu remonter entre-temps
+	if !isPriceDrop(referencePrice.Float64, currentPrice, services.GetAdSettings().PriceDropAlertPercent) {
+		return
+	}
+
+	notifyFavoritersOfPriceDrop(ctx, adID, sellerID, adTitle, referencePrice.Float64, currentPrice)
+}
+
+// notifyFavoritersOfPriceDrop prévient les utilisateurs ayant l'annonce en favori,
+// sauf s'ils ont désactivé les notifications ou les notifications de favoris (notification_preferences).
+func notifyFavoritersOfPriceDrop(ctx context.Context, adID, sellerID int, adTitle string, oldPrice, newPrice float64) {
+	rows, err := config.DB.QueryContext(ctx, `
+		SELECT f.user_id
+		FROM favorites f
+		LEFT JOIN notification_preferences np ON np.user_id = f.user_id
+		WHERE f.ad_id = $1 AND f.user_id <> $2
+		AND COALESCE(np.notifications_enabled, TRUE) = TRUE
+		AND COALESCE(np.favorite_notifications, TRUE) = TRUE
+	`, adID, sellerID)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération des favoris de l'annonce %d: %v", adID, err)
+		return
+	}
+	defer rows.Close()
+
+	title := "Baisse de prix sur un de vos favoris"
+	message := fmt.Sprintf("« %s » passe de %.0f FCFA à %.0f FCFA.", adTitle, oldPrice, newPrice)
+	count := 0
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			log.Printf("Erreur lors du scan d'un favori: %v", err)
+			continue
+		}
+
+		go services.CreateNotification(userID, "price_drop", title, message, map[string]interface{}{
+			"adId":     adID,
+			"oldPrice": oldPrice,
+			"newPrice": newPrice,
+		})
+		if services.PushSvc != nil {
+			services.PushSvc.SendPriceDropPush(ctx, userID, adTitle, adID, oldPrice, newPrice)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Erreur après l'itération des favoris de l'annonce %d: %v", adID, err)
+	}
+
+	log.Printf("Alerte de baisse de prix de l'annonce %d envoyée à %d utilisateur(s)", adID, count)
+}
@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"kivendi-backend/config"
+	"kivendi-backend/models"
+	"kivendi-backend/services"
+
+	"github.com/gorilla/mux"
+)
+
+// adReportMaxCommentLength borne le commentaire facultatif d'un signalement
+const adReportMaxCommentLength = 1000
+
+// activeAdReportCount compte les utilisateurs distincts ayant signalé l'annonce $1, hors signalements rejetés
+const activeAdReportCount = `(
+	SELECT COUNT(DISTINCT reporter_id) FROM ad_reports
+	WHERE ad_id = $1 AND status <> '` + models.AdReportStatusDismissed + `'
+)`
+
+// UpdateAdReportRequest est le corps de la mise à jour d'un signalement d'annonce. AdAction ("reject" ou
+// "deactivate") est requis pour résoudre un signalement tant que l'annonce est masquée par les signalements.
+type UpdateAdReportRequest struct {
+	Status       *string `json:"status"`
+	AdminNotes   *string `json:"admin_notes"`
+	AdAction     *string `json:"ad_action"`
+	ActionReason string  `json:"action_reason"` // Raison du rejet communiquée au vendeur
+}
+
+// ReportAdRequest est le corps d'un signalement d'annonce
+type ReportAdRequest struct {
+	Reason  string `json:"reason"`
+	Comment string `json:"comment"`
+}
+
+// GetAdReportReasonsHandler renvoie la liste des motifs de signalement d'une annonce (accès public)
+func GetAdReportReasonsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.AdReportReasons)
+}
+
+// ReportAdHandler enregistre le signalement d'une annonce par l'utilisateur connecté (un seul par annonce).
+// Lorsque le nombre de signalements distincts atteint app_settings.ad_report_hide_threshold, l'annonce
+// est masquée (retirée des annonces validées) jusqu'à la décision d'un modérateur.
+func ReportAdHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+
+	adID, err := strconv.Atoi(mux.Vars(r)["adID"])
+	if err != nil {
+		http.Error(w, "ID d'annonce invalide", http.StatusBadRequest)
+		return
+	}
+
+	var req ReportAdRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corps de requête invalide", http.StatusBadRequest)
+		return
+	}
+	if !models.IsValidAdReportReason(req.Reason) {
+		http.Error(w, "Motif de signalement invalide", http.StatusBadRequest)
+		return
+	}
+	comment := strings.TrimSpace(req.Comment)
+	if utf8.RuneCountInString(comment) > adReportMaxCommentLength {
+		http.Error(w, fmt.Sprintf("Le commentaire ne doit pas dépasser %d caractères", adReportMaxCommentLength), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := config.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Erreur lors du démarrage de la transaction de signalement: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Le verrou sérialise les signalements d'une même annonce pour le décompte du masquage
+	var ownerID int
+	var adTitle string
+	err = tx.QueryRowContext(r.Context(),
+		"SELECT user_id, title FROM ads WHERE id = $1 FOR NO KEY UPDATE", adID,
+	).Scan(&ownerID, &adTitle)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Annonce non trouvée", http.StatusNotFound)
+			return
+		}
+		log.Printf("Erreur lors de la vérification de l'annonce %d: %v", adID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if ownerID == userID {
+		http.Error(w, "Vous ne pouvez pas signaler votre propre annonce", http.StatusBadRequest)
+		return
+	}
+
+	var reportID int
+	err = tx.QueryRowContext(r.Context(), `
+		INSERT INTO ad_reports (ad_id, reporter_id, reason, comment)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		ON CONFLICT (ad_id, reporter_id) DO NOTHING
+		RETURNING id
+	`, adID, userID, req.Reason, comment).Scan(&reportID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Vous avez déjà signalé cette annonce", http.StatusConflict)
+			return
+		}
+		log.Printf("Erreur lors du signalement de l'annonce %d: %v", adID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	// Masquage automatique, une seule fois tant que les signalements n'ont pas été rejetés
+	hidden := false
+	if threshold := services.GetAdSettings().AdReportHideThreshold; threshold > 0 {
+		result, err := tx.ExecContext(r.Context(), `
+			UPDATE ads SET is_validated = FALSE, reports_hidden_at = NOW(), updated_at = NOW()
+			WHERE id = $1 AND is_validated = TRUE AND reports_hidden_at IS NULL
+			AND `+activeAdReportCount+` >= $2
+		`, adID, threshold)
+		if err != nil {
+			log.Printf("Erreur lors du masquage de l'annonce signalée %d: %v", adID, err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+			return
+		}
+		n, _ := result.RowsAffected()
+		hidden = n > 0
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Erreur lors de la validation du signalement de l'annonce %d: %v", adID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Utilisateur %d a signalé l'annonce %d pour: %s", userID, adID, req.Reason)
+	if hidden {
+		log.Printf("Annonce %d masquée automatiquement après plusieurs signalements", adID)
+		go services.CreateNotification(ownerID, "ad_hidden_by_reports", "Votre annonce est en cours de vérification",
+			fmt.Sprintf("Votre annonce « %s » a été signalée par plusieurs utilisateurs. Elle est masquée le temps qu'un modérateur la vérifie.", adTitle),
+			map[string]interface{}{"adId": adID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Annonce signalée avec succès", "report_id": reportID})
+}
+
+// GetAdReportsHandler récupère les signalements d'annonces, filtrables par statut et par annonce.
+// Les signalements en attente viennent en premier, les annonces les plus signalées d'abord.
+func GetAdReportsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	// L'authentification est déjà gérée par le middleware adminRoutes
+
+	query := `
+		SELECT
+			r.id, r.ad_id, r.reporter_id, r.reason, r.comment, r.status, r.admin_notes, r.reviewed_by,
+			r.created_at, r.updated_at,
+			a.title, a.user_id, (owner.first_name || ' ' || owner.last_name), a.reports_hidden_at,
+			(SELECT COUNT(DISTINCT o.reporter_id) FROM ad_reports o WHERE o.ad_id = r.ad_id AND o.status <> $1) AS ad_report_count,
+			(reporter.first_name || ' ' || reporter.last_name), reporter.email
+		FROM ad_reports r
+		JOIN ads a ON a.id = r.ad_id
+		JOIN users owner ON owner.id = a.user_id
+		JOIN users reporter ON reporter.id = r.reporter_id
+		WHERE 1 = 1`
+	args := []interface{}{models.AdReportStatusDismissed}
+
+	if status := r.URL.Query().Get("status"); status != "" {
+		args = append(args, status)
+		query += fmt.Sprintf(" AND r.status = $%d", len(args))
+	}
+	if adIDStr := r.URL.Query().Get("ad_id"); adIDStr != "" {
+		adID, err := strconv.Atoi(adIDStr)
+		if err != nil {
+			httpError(w, "ID d'annonce invalide", http.StatusBadRequest, err)
+			return
+		}
+		args = append(args, adID)
+		query += fmt.Sprintf(" AND r.ad_id = $%d", len(args))
+	}
+	query += " ORDER BY CASE r.status WHEN 'pending' THEN 1 ELSE 2 END, ad_report_count DESC, r.created_at DESC LIMIT 500"
+
+	rows, err := config.DB.Query(query, args...)
+	if err != nil {
+		httpError(w, "Erreur lors de la récupération des signalements d'annonces", http.StatusInternalServerError, err)
+		return
+	}
+	defer rows.Close()
+
+	reports := []models.AdReport{}
+	for rows.Next() {
+		var report models.AdReport
+		var comment, adminNotes sql.NullString
+		var reviewedBy sql.NullInt64
+		var hiddenAt sql.NullTime
+
+		err := rows.Scan(
+			&report.ID, &report.AdID, &report.ReporterID, &report.Reason, &comment, &report.Status,
+			&adminNotes, &reviewedBy, &report.CreatedAt, &report.UpdatedAt,
+			&report.AdTitle, &report.AdOwnerID, &report.AdOwnerName, &hiddenAt, &report.AdReportCount,
+			&report.ReporterName, &report.ReporterEmail,
+		)
+		if err != nil {
+			httpError(w, "Erreur lors de la lecture des signalements d'annonces", http.StatusInternalServerError, err)
+			return
+		}
+		if comment.Valid {
+			report.Comment = &comment.String
+		}
+		if adminNotes.Valid {
+			report.AdminNotes = &adminNotes.String
+		}
+		if reviewedBy.Valid {
+			adminID := int(reviewedBy.Int64)
+			report.ReviewedBy = &adminID
+		}
+		if hiddenAt.Valid {
+			report.AdHiddenAt = &hiddenAt.Time
+		}
+		reports = append(reports, report)
+	}
+
+	if err = rows.Err(); err != nil {
+		httpError(w, "Erreur lors de l'itération sur les signalements d'annonces", http.StatusInternalServerError, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(reports)
+}
+
+// UpdateAdReportHandler met à jour le statut et les notes d'un signalement d'annonce (PATCH).
+// Une annonce masquée automatiquement est rétablie lorsque les signalements rejetés la font repasser
+// sous le seuil de masquage. Résoudre un signalement d'une annonce encore masquée exige une décision
+// explicite sur l'annonce (ad_action : rejet ou désactivation).
+func UpdateAdReportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	requestingAdminID, _, err := getRequestingAdmin(r)
+	if err != nil {
+		httpError(w, "Accès non autorisé", http.StatusUnauthorized, err)
+		return
+	}
+
+	reportID, err := strconv.Atoi(mux.Vars(r)["reportID"])
+	if err != nil {
+		httpError(w, "ID de signalement invalide", http.StatusBadRequest, err)
+		return
+	}
+
+	var req UpdateAdReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		httpError(w, "Corps de requête invalide", http.StatusBadRequest, err)
+		return
+	}
+	adAction := ""
+	if req.AdAction != nil {
+		adAction = strings.ToLower(*req.AdAction)
+		if adAction != models.AdReportActionReject && adAction != models.AdReportActionDeactivate {
+			httpError(w, "Action invalide. Doit être 'reject' ou 'deactivate'.", http.StatusBadRequest, nil)
+			return
+		}
+	}
+
+	tx, err := config.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		httpError(w, "Erreur interne du serveur", http.StatusInternalServerError, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var adID int
+	var currentStatus string
+	var currentNotes sql.NullString
+	var adHidden bool
+	err = tx.QueryRowContext(r.Context(), `
+		SELECT r.ad_id, r.status, r.admin_notes,
+			a.reports_hidden_at IS NOT NULL AND COALESCE(a.is_rejected, FALSE) = FALSE AND COALESCE(a.is_deactivated, FALSE) = FALSE
+		FROM ad_reports r
+		JOIN ads a ON a.id = r.ad_id
+		WHERE r.id = $1
+		FOR UPDATE OF r
+	`, reportID).Scan(&adID, &currentStatus, &currentNotes, &adHidden)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			httpError(w, "Signalement non trouvé", http.StatusNotFound, err)
+		} else {
+			httpError(w, "Erreur lors de la récupération du signalement", http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	if req.Status != nil {
+		status := strings.ToLower(*req.Status)
+		if status != models.AdReportStatusResolved && status != models.AdReportStatusDismissed && status != models.AdReportStatusPending {
+			httpError(w, "Statut invalide. Doit être 'pending', 'resolved' ou 'dismissed'.", http.StatusBadRequest, nil)
+			return
+		}
+		currentStatus = status
+	}
+	if adAction != "" && currentStatus != models.AdReportStatusResolved {
+		httpError(w, "Une action sur l'annonce n'est possible qu'en résolvant le signalement", http.StatusBadRequest, nil)
+		return
+	}
+	if adAction == "" && currentStatus == models.AdReportStatusResolved && adHidden {
+		httpError(w, "L'annonce est masquée par les signalements : précisez l'action à appliquer (ad_action 'reject' ou 'deactivate')", http.StatusBadRequest, nil)
+		return
+	}
+	if req.AdminNotes != nil {
+		if *req.AdminNotes == "" {
+			currentNotes = sql.NullString{Valid: false}
+		} else {
+			currentNotes = sql.NullString{String: *req.AdminNotes, Valid: true}
+		}
+	}
+
+	_, err = tx.ExecContext(r.Context(), `
+		UPDATE ad_reports
+		SET status = $1, admin_notes = $2, reviewed_by = $3, updated_at = NOW()
+		WHERE id = $4
+	`, currentStatus, currentNotes, requestingAdminID, reportID)
+	if err != nil {
+		httpError(w, "Erreur lors de la mise à jour du signalement", http.StatusInternalServerError, err)
+		return
+	}
+
+	// Rétablissement d'une annonce masquée par des signalements désormais rejetés (hors annonce
+	// rejetée ou désactivée entre-temps par la modération)
+	restored := false
+	var ownerID int
+	var adTitle string
+	if currentStatus == models.AdReportStatusDismissed {
+		threshold := services.GetAdSettings().AdReportHideThreshold
+		err = tx.QueryRowContext(r.Context(), `
+			UPDATE ads SET is_validated = TRUE, reports_hidden_at = NULL, updated_at = NOW()
+			WHERE id = $1 AND reports_hidden_at IS NOT NULL AND is_validated = FALSE
+			AND COALESCE(is_rejected, FALSE) = FALSE AND COALESCE(is_deactivated, FALSE) = FALSE
+			AND ($2::integer <= 0 OR `+activeAdReportCount+` < $2)
+			RETURNING user_id, title
+		`, adID, threshold).Scan(&ownerID, &adTitle)
+		if err != nil && err != sql.ErrNoRows {
+			httpError(w, "Erreur lors du rétablissement de l'annonce", http.StatusInternalServerError, err)
+			return
+		}
+		restored = err == nil
+	}
+
+	// Décision du modérateur sur l'annonce d'un signalement fondé
+	if adAction != "" {
+		update := "is_validated = FALSE, is_rejected = TRUE, is_deactivated = FALSE, reports_hidden_at = NULL"
+		if adAction == models.AdReportActionDeactivate {
+			update = "is_deactivated = TRUE, is_validated = FALSE, is_rejected = FALSE"
+		}
+		err = tx.QueryRowContext(r.Context(),
+			"UPDATE ads SET "+update+", updated_at = NOW() WHERE id = $1 RETURNING user_id, title", adID,
+		).Scan(&ownerID, &adTitle)
+		if err != nil {
+			httpError(w, "Erreur lors de la mise à jour de l'annonce signalée", http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		httpError(w, "Erreur lors de la mise à jour du signalement", http.StatusInternalServerError, err)
+		return
+	}
+
+	log.Printf("Admin %d a mis à jour le signalement d'annonce %d (Statut: %s)", requestingAdminID, reportID, currentStatus)
+	switch adAction {
+	case models.AdReportActionReject:
+		reason := strings.TrimSpace(req.ActionReason)
+		if reason == "" {
+			reason = "annonce signalée par des utilisateurs"
+		}
+		log.Printf("Annonce %d rejetée suite au signalement %d", adID, reportID)
+		go services.CreateNotification(ownerID, "ad_rejected", "Votre annonce a été rejetée",
+			fmt.Sprintf("Malheureusement, votre annonce « %s » n'a pas pu être validée. Raison : %s", adTitle, reason),
+			map[string]interface{}{"adId": adID})
+		if services.PushSvc != nil {
+			services.PushSvc.SendAdRejectedPush(r.Context(), ownerID, adTitle, adID, reason)
+		}
+	case models.AdReportActionDeactivate:
+		log.Printf("Annonce %d désactivée suite au signalement %d", adID, reportID)
+		go services.CreateNotification(ownerID, "ad_deactivated", "Votre annonce a été désactivée",
+			fmt.Sprintf("Votre annonce « %s » a été désactivée par un administrateur. Elle n'est plus visible sur la plateforme.", adTitle),
+			map[string]interface{}{"adId": adID})
+		if services.PushSvc != nil {
+			services.PushSvc.SendAdDeactivatedPush(r.Context(), ownerID, adTitle, adID)
+		}
+	}
+	if restored {
+		log.Printf("Annonce %d rétablie après le rejet de ses signalements", adID)
+		go services.CreateNotification(ownerID, "ad_restored", "Votre annonce est de nouveau visible",
+			fmt.Sprintf("Après vérification, votre annonce « %s » est de nouveau visible sur la plateforme.", adTitle),
+			map[string]interface{}{"adId": adID})
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":     "Signalement mis à jour avec succès",
+		"ad_restored": restored,
+		"ad_action":   adAction,
+	})
+}
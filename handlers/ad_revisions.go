@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"kivendi-backend/config"
+	"kivendi-backend/models"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// adRevisionContentColumns liste les colonnes de ads recopiées dans chaque révision
+const adRevisionContentColumns = "title, description, price, images, form_data, city, phone_number, is_phone_visible"
+
+const adRevisionColumns = `
+	r.id, r.ad_id, r.revision_number, r.editor_type, r.editor_id,
+	COALESCE(r.title, ''), COALESCE(r.description, ''), COALESCE(r.price, 0), COALESCE(r.images, '{}'), r.form_data,
+	COALESCE(r.city, ''), COALESCE(r.phone_number, ''), COALESCE(r.is_phone_visible, FALSE),
+	r.is_validated_version, r.validated_at, r.created_at`
+
+// editedSinceValidationSQL indique si l'annonce a été modifiée après sa dernière version validée
+const editedSinceValidationSQL = `EXISTS (
+	SELECT 1 FROM ad_revisions r
+	WHERE r.ad_id = a.id
+	AND r.id > (SELECT MAX(v.id) FROM ad_revisions v WHERE v.ad_id = a.id AND v.is_validated_version = TRUE)
+)`
+
+// scanAdRevision lit une ligne produite par adRevisionColumns
+func scanAdRevision(scanner interface{ Scan(...interface{}) error }) (models.AdRevision, error) {
+	var rev models.AdRevision
+	var editorID sql.NullInt64
+	var formData []byte
+	var validatedAt sql.NullTime
+
+	err := scanner.Scan(
+		&rev.ID, &rev.AdID, &rev.RevisionNumber, &rev.EditorType, &editorID,
+		&rev.Title, &rev.Description, &rev.Price, pq.Array(&rev.Images), &formData,
+		&rev.City, &rev.PhoneNumber, &rev.IsPhoneVisible,
+		&rev.IsValidatedVersion, &validatedAt, &rev.CreatedAt,
+	)
+	if err != nil {
+		return rev, err
+	}
+
+	if editorID.Valid {
+		v := int(editorID.Int64)
+		rev.EditorID = &v
+	}
+	if validatedAt.Valid {
+		rev.ValidatedAt = &validatedAt.Time
+	}
+	if len(formData) > 0 {
+		if err := json.Unmarshal(formData, &rev.FormData); err != nil {
+			log.Printf("Erreur lors du décodage du form_data de la révision %d: %v", rev.ID, err)
+		}
+	}
+	if rev.Images == nil {
+		rev.Images = []string{}
+	}
+	return rev, nil
+}
+
+// ensureAdBaselineRevision enregistre l'état actuel de l'annonce comme révision initiale si elle n'a
+// encore aucun historique. À appeler avant la mise à jour : c'est la version vue par les modérateurs.
+func ensureAdBaselineRevision(ctx context.Context, adID int) error {
+	_, err := config.DB.ExecContext(ctx, `
+		INSERT INTO ad_revisions (ad_id, revision_number, editor_type, `+adRevisionContentColumns+`, is_validated_version, validated_at, created_at)
+		SELECT a.id, 1, $2, `+adRevisionContentColumns+`, COALESCE(a.is_validated, FALSE), CASE WHEN a.is_validated THEN a.updated_at END, a.updated_at
+		FROM ads a
+		WHERE a.id = $1 AND NOT EXISTS (SELECT 1 FROM ad_revisions r WHERE r.ad_id = a.id)
+		ON CONFLICT (ad_id, revision_number) DO NOTHING
+	`, adID, models.AdRevisionEditorInitial)
+	return err
+}
+
+// recordAdRevision enregistre le contenu de l'annonce après une modification.
+// La révision est considérée comme validée si l'annonce l'est restée (modification admin ou validation automatique).
+func recordAdRevision(ctx context.Context, adID int, editorType string, editorID int) error {
+	_, err := config.DB.ExecContext(ctx, `
+		INSERT INTO ad_revisions (ad_id, revision_number, editor_type, editor_id, `+adRevisionContentColumns+`, is_validated_version, validated_at)
+		SELECT a.id, COALESCE((SELECT MAX(r.revision_number) FROM ad_revisions r WHERE r.ad_id = a.id), 0) + 1, $2, $3,
+			`+adRevisionContentColumns+`, COALESCE(a.is_validated, FALSE), CASE WHEN a.is_validated THEN NOW() END
+		FROM ads a
+		WHERE a.id = $1
+	`, adID, editorType, editorID)
+	return err
+}
+
+// markAdRevisionValidated marque la dernière révision de l'annonce comme version validée
+func markAdRevisionValidated(ctx context.Context, adID int) error {
+	_, err := config.DB.ExecContext(ctx, `
+		UPDATE ad_revisions SET is_validated_version = TRUE, validated_at = NOW()
+		WHERE id = (SELECT MAX(id) FROM ad_revisions WHERE ad_id = $1)
+	`, adID)
+	return err
+}
+
+// imagesNotInValidatedRevisions filtre les images encore référencées par une version validée de l'annonce :
+// elles sont conservées dans le stockage pour que les modérateurs puissent comparer les photos.
+func imagesNotInValidatedRevisions(ctx context.Context, adID int, images []string) []string {
+	if len(images) == 0 {
+		return images
+	}
+
+	var kept []string
+	err := config.DB.QueryRowContext(ctx, `
+		SELECT COALESCE(array_agg(DISTINCT img), '{}')
+		FROM ad_revisions r, unnest(r.images) AS img
+		WHERE r.ad_id = $1 AND r.is_validated_version = TRUE AND img = ANY($2)
+	`, adID, pq.Array(images)).Scan(pq.Array(&kept))
+	if err != nil {
+		log.Printf("Erreur lors de la vérification des images des révisions de l'annonce %d: %v", adID, err)
+		return nil // En cas de doute, ne rien supprimer
+	}
+
+	keptSet := make(map[string]bool, len(kept))
+	for _, img := range kept {
+		keptSet[img] = true
+	}
+	var toDelete []string
+	for _, img := range images {
+		if !keptSet[img] {
+			toDelete = append(toDelete, img)
+		}
+	}
+	return toDelete
+}
+
+// loadCurrentAdAsRevision renvoie le contenu actuel de l'annonce sous forme de révision (id 0)
+func loadCurrentAdAsRevision(ctx context.Context, adID int) (models.AdRevision, error) {
+	return scanAdRevision(config.DB.QueryRowContext(ctx, `
+		SELECT 0, a.id, 0, '', NULL::INTEGER,
+			COALESCE(a.title, ''), COALESCE(a.description, ''), COALESCE(a.price, 0), COALESCE(a.images, '{}'), a.form_data,
+			COALESCE(a.city, ''), COALESCE(a.phone_number, ''), COALESCE(a.is_phone_visible, FALSE),
+			COALESCE(a.is_validated, FALSE), NULL::TIMESTAMPTZ, a.updated_at
+		FROM ads a WHERE a.id = $1
+	`, adID))
+}
+
+// diffAdRevisions compare deux versions champ par champ
+func diffAdRevisions(from, to models.AdRevision) models.AdRevisionDiff {
+	diff := models.AdRevisionDiff{
+		AdID:    to.AdID,
+		From:    &from,
+		To:      &to,
+		Changes: []models.AdRevisionFieldChange{},
+		Images:  models.AdRevisionImagesDiff{Added: []string{}, Removed: []string{}},
+	}
+
+	addChange := func(field string, before, after interface{}) {
+		diff.Changes = append(diff.Changes, models.AdRevisionFieldChange{Field: field, Before: before, After: after})
+	}
+	if from.Title != to.Title {
+		addChange("title", from.Title, to.Title)
+	}
+	if from.Description != to.Description {
+		addChange("description", from.Description, to.Description)
+	}
+	if from.Price != to.Price {
+		addChange("price", from.Price, to.Price)
+	}
+	if from.City != to.City {
+		addChange("city", from.City, to.City)
+	}
+	if from.PhoneNumber != to.PhoneNumber {
+		addChange("phone_number", from.PhoneNumber, to.PhoneNumber)
+	}
+	if from.IsPhoneVisible != to.IsPhoneVisible {
+		addChange("is_phone_visible", from.IsPhoneVisible, to.IsPhoneVisible)
+	}
+
+	// form_data : comparaison attribut par attribut
+	keys := make(map[string]bool)
+	for k := range from.FormData {
+		keys[k] = true
+	}
+	for k := range to.FormData {
+		keys[k] = true
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for k := range keys {
+		sortedKeys = append(sortedKeys, k)
+	}
+	sort.Strings(sortedKeys)
+	for _, k := range sortedKeys {
+		before, after := from.FormData[k], to.FormData[k]
+		if !reflect.DeepEqual(before, after) {
+			addChange("form_data."+k, before, after)
+		}
+	}
+
+	// Images : ajouts, suppressions et changement d'ordre (dont la photo principale)
+	fromSet := make(map[string]bool, len(from.Images))
+	for _, img := range from.Images {
+		fromSet[img] = true
+	}
+	toSet := make(map[string]bool, len(to.Images))
+	for _, img := range to.Images {
+		toSet[img] = true
+		if !fromSet[img] {
+			diff.Images.Added = append(diff.Images.Added, img)
+		}
+	}
+	for _, img := range from.Images {
+		if !toSet[img] {
+			diff.Images.Removed = append(diff.Images.Removed, img)
+		}
+	}
+	var fromKept, toKept []string
+	for _, img := range from.Images {
+		if toSet[img] {
+			fromKept = append(fromKept, img)
+		}
+	}
+	for _, img := range to.Images {
+		if fromSet[img] {
+			toKept = append(toKept, img)
+		}
+	}
+	diff.Images.Reordered = !reflect.DeepEqual(fromKept, toKept)
+	if len(diff.Images.Added) > 0 || len(diff.Images.Removed) > 0 || diff.Images.Reordered {
+		addChange("images", from.Images, to.Images)
+	}
+
+	diff.Changed = len(diff.Changes) > 0
+	return diff
+}
+
+// GetAdRevisionsHandler liste (admin) l'historique des versions d'une annonce, de la plus récente à la plus ancienne
+func GetAdRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	adID, err := strconv.Atoi(mux.Vars(r)["adID"])
+	if err != nil {
+		http.Error(w, "ID d'annonce invalide", http.StatusBadRequest)
+		return
+	}
+
+	var exists bool
+	if err := config.DB.QueryRowContext(r.Context(), "SELECT EXISTS(SELECT 1 FROM ads WHERE id = $1)", adID).Scan(&exists); err != nil {
+		log.Printf("Erreur lors de la vérification de l'annonce %d: %v", adID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "Annonce non trouvée", http.StatusNotFound)
+		return
+	}
+
+	rows, err := config.DB.QueryContext(r.Context(),
+		"SELECT "+adRevisionColumns+" FROM ad_revisions r WHERE r.ad_id = $1 ORDER BY r.revision_number DESC", adID)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération des révisions de l'annonce %d: %v", adID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	revisions := []models.AdRevision{}
+	var lastValidatedID *int
+	for rows.Next() {
+		rev, err := scanAdRevision(rows)
+		if err != nil {
+			log.Printf("Erreur lors du scan d'une révision: %v", err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+			return
+		}
+		if rev.IsValidatedVersion && lastValidatedID == nil {
+			id := rev.ID
+			lastValidatedID = &id
+		}
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Erreur après l'itération des révisions: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ad_id":                      adID,
+		"revisions":                  revisions,
+		"last_validated_revision_id": lastValidatedID,
+		"edited_since_validation":    lastValidatedID != nil && len(revisions) > 0 && revisions[0].ID != *lastValidatedID,
+	})
+}
+
+// GetAdRevisionDiffHandler renvoie (admin) la comparaison champ par champ entre deux versions d'une annonce.
+// Par défaut : dernière version validée (from) contre le contenu actuel de l'annonce (to).
+// Les paramètres from et to acceptent un ID de révision.
+func GetAdRevisionDiffHandler(w http.ResponseWriter, r *http.Request) {
+	adID, err := strconv.Atoi(mux.Vars(r)["adID"])
+	if err != nil {
+		http.Error(w, "ID d'annonce invalide", http.StatusBadRequest)
+		return
+	}
+
+	loadRevision := func(param string) (*models.AdRevision, int, string) {
+		raw := r.URL.Query().Get(param)
+		if raw == "" {
+			return nil, 0, ""
+		}
+		revisionID, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Sprintf("Paramètre %s invalide", param)
+		}
+		rev, err := scanAdRevision(config.DB.QueryRowContext(r.Context(),
+			"SELECT "+adRevisionColumns+" FROM ad_revisions r WHERE r.id = $1 AND r.ad_id = $2", revisionID, adID))
+		if err == sql.ErrNoRows {
+			return nil, http.StatusNotFound, "Révision non trouvée"
+		}
+		if err != nil {
+			log.Printf("Erreur lors de la récupération de la révision %d: %v", revisionID, err)
+			return nil, http.StatusInternalServerError, "Erreur interne du serveur"
+		}
+		return &rev, 0, ""
+	}
+
+	from, status, msg := loadRevision("from")
+	if status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+	to, status, msg := loadRevision("to")
+	if status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	if to == nil {
+		current, err := loadCurrentAdAsRevision(r.Context(), adID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Annonce non trouvée", http.StatusNotFound)
+				return
+			}
+			log.Printf("Erreur lors de la récupération de l'annonce %d: %v", adID, err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+			return
+		}
+		to = &current
+	}
+
+	if from == nil {
+		rev, err := scanAdRevision(config.DB.QueryRowContext(r.Context(), `
+			SELECT `+adRevisionColumns+` FROM ad_revisions r
+			WHERE r.ad_id = $1 AND r.is_validated_version = TRUE
+			ORDER BY r.id DESC LIMIT 1
+		`, adID))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Aucune version validée pour cette annonce", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Erreur lors de la récupération de la dernière version validée de l'annonce %d: %v", adID, err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+			return
+		}
+		from = &rev
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(diffAdRevisions(*from, *to))
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"kivendi-backend/config"
+	"kivendi-backend/middleware"
+	"kivendi-backend/services"
+
+	"github.com/gorilla/mux"
+)
+
+// adViewerKey identifie le visiteur pour le dédoublonnage : utilisateur connecté, sinon adresse IP et
+// User-Agent. L'identifiant d'appareil (X-Device-ID) n'est pas utilisé : choisi par le client, il
+// pourrait changer à chaque requête et contourner le dédoublonnage.
+func adViewerKey(r *http.Request, userID int, authenticated bool) string {
+	if authenticated {
+		return services.AdViewerKey("user", strconv.Itoa(userID))
+	}
+	return services.AdViewerKey("ip-ua", middleware.GetClientIP(r)+"|"+r.UserAgent())
+}
+
+// RecordAdViewHandler enregistre la vue d'une annonce visible (404 sinon). Un même visiteur n'est compté qu'une fois par
+// fenêtre de dédoublonnage et les vues du vendeur sont ignorées. Les vues sont écrites par lots puis
+// agrégées par jour (ad_view_daily) ; views_count est mis à jour lors de l'agrégation.
+// Pour l'utilisateur connecté, une vue comptée incrémente aussi view_count dans son historique
+// (alimenté par GetAdDetailsHandler, voir recordUserAdView).
+func RecordAdViewHandler(w http.ResponseWriter, r *http.Request) {
+	adID, err := strconv.Atoi(mux.Vars(r)["adID"])
+	if err != nil {
+		http.Error(w, "ID d'annonce invalide", http.StatusBadRequest)
+		return
+	}
+
+	// Seules les annonces visibles publiquement comptent (ni rejetées, désactivées, expirées, vendues
+	// ou masquées par des signalements)
+	var ownerID int
+	err = config.DB.QueryRowContext(r.Context(),
+		"SELECT a.user_id FROM ads a WHERE a.id = $1 AND "+adVisibleSQL, adID).Scan(&ownerID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Annonce non trouvée", http.StatusNotFound)
+			return
+		}
+		log.Printf("Erreur lors de la vérification de l'annonce %d: %v", adID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	userID, authenticated := optionalUserID(r)
+	counted := false
+	if !authenticated || userID != ownerID {
+		counted = services.RecordAdView(adID, adViewerKey(r, userID, authenticated))
+	}
+	if authenticated && userID != ownerID {
+		// Historique de consultation et fil personnalisé de l'utilisateur connecté
+		go recordUserAdView(userID, adID, counted)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Vue enregistrée",
+		"counted": counted,
+	})
+}
+
+// RecordPhoneRevealHandler enregistre l'affichage du numéro de téléphone d'une annonce
+// (une fois par visiteur et par jour, hors vendeur), pour les statistiques du vendeur.
+func RecordPhoneRevealHandler(w http.ResponseWriter, r *http.Request) {
+	adID, err := strconv.Atoi(mux.Vars(r)["adID"])
+	if err != nil {
+		http.Error(w, "ID d'annonce invalide", http.StatusBadRequest)
+		return
+	}
+
+	var ownerID int
+	var isPhoneVisible bool
+	err = config.DB.QueryRowContext(r.Context(),
+		"SELECT user_id, COALESCE(is_phone_visible, FALSE) FROM ads WHERE id = $1", adID).Scan(&ownerID, &isPhoneVisible)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Annonce non trouvée", http.StatusNotFound)
+			return
+		}
+		log.Printf("Erreur lors de la vérification de l'annonce %d: %v", adID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if !isPhoneVisible {
+		http.Error(w, "Le numéro de téléphone de cette annonce n'est pas visible", http.StatusBadRequest)
+		return
+	}
+
+	userID, authenticated := optionalUserID(r)
+	if !authenticated || userID != ownerID {
+		_, err = config.DB.ExecContext(r.Context(), `
+			INSERT INTO ad_phone_reveals (ad_id, viewer_key) VALUES ($1, $2)
+			ON CONFLICT (ad_id, viewer_key, revealed_on) DO NOTHING
+		`, adID, adViewerKey(r, userID, authenticated))
+		if err != nil {
+			log.Printf("Erreur lors de l'enregistrement de l'affichage du téléphone de l'annonce %d: %v", adID, err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Affichage du numéro enregistré"})
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"kivendi-backend/config"
 	"kivendi-backend/models"
+	"kivendi-backend/services"
 	"log"
 	"net/http"
 	"strings"
@@ -215,6 +216,8 @@ func GetAppSettingsForAdminHandler(w http.ResponseWriter, r *http.Request) {
 			meta_title, meta_description, meta_keywords,
 			default_language, currency, timezone,
 			auto_validate_ads, require_phone_verification, max_images_per_ad, max_ad_duration_days,
+			COALESCE(ad_expiry_reminder_days, 3), COALESCE(price_drop_alert_percent, 5),
+			COALESCE(block_duplicate_ads, false), COALESCE(ad_report_hide_threshold, 3),
 			smtp_host, smtp_port, smtp_username, smtp_password, smtp_from_email, smtp_from_name,
 			kkiapay_public_key, kkiapay_private_key, kkiapay_secret, payment_enabled,
 			created_at, updated_at, updated_by
@@ -249,7 +252,8 @@ func GetAppSettingsForAdminHandler(w http.ResponseWriter, r *http.Request) {
 		&metaTitle, &metaDescription, &metaKeywords,
 		&settings.DefaultLanguage, &settings.Currency, &timezone,
 		&settings.AutoValidateAds, &settings.RequirePhoneVerification,
-		&settings.MaxImagesPerAd, &settings.MaxAdDurationDays,
+		&settings.MaxImagesPerAd, &settings.MaxAdDurationDays, &settings.AdExpiryReminderDays, &settings.PriceDropAlertPercent,
+		&settings.BlockDuplicateAds, &settings.AdReportHideThreshold,
 		&smtpHost, &smtpPort, &smtpUsername,
 		&smtpPassword, &smtpFromEmail, &smtpFromName,
 		&kkiapayPublicKey, &kkiapayPrivateKey, &kkiapaySecret, &settings.PaymentEnabled,
@@ -518,6 +522,18 @@ func UpdateAppSettingsHandler(w http.ResponseWriter, r *http.Request) {
 	if req.MaxAdDurationDays != nil {
 		addField("max_ad_duration_days", *req.MaxAdDurationDays)
 	}
+	if req.AdExpiryReminderDays != nil {
+		addField("ad_expiry_reminder_days", *req.AdExpiryReminderDays)
+	}
+	if req.PriceDropAlertPercent != nil {
+		addField("price_drop_alert_percent", *req.PriceDropAlertPercent)
+	}
+	if req.BlockDuplicateAds != nil {
+		addField("block_duplicate_ads", *req.BlockDuplicateAds)
+	}
+	if req.AdReportHideThreshold != nil {
+		addField("ad_report_hide_threshold", *req.AdReportHideThreshold)
+	}
 
 	// Email
 	if req.SMTPHost != nil {
@@ -572,6 +588,9 @@ func UpdateAppSettingsHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Paramètres de l'application mis à jour par l'admin %d", requestingAdminID)
 
+	// Les paramètres d'annonces (validation automatique, images, durée) sont relus au prochain accès
+	services.InvalidateAdSettings()
+
 	response := map[string]string{
 		"message": "Paramètres mis à jour avec succès",
 	}
@@ -716,6 +716,27 @@ func ValidateToken(next http.Handler) http.Handler {
 	})
 }
 
+// optionalUserID renvoie l'ID de l'utilisateur si la requête porte un jeton valide,
+// pour les routes publiques dont le comportement dépend de l'utilisateur connecté.
+func optionalUserID(r *http.Request) (int, bool) {
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" || parts[1] == "" {
+		return 0, false
+	}
+
+	token, err := jwt.ParseWithClaims(parts[1], &claims{}, func(token *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	})
+	if err != nil || !token.Valid {
+		return 0, false
+	}
+	c, ok := token.Claims.(*claims)
+	if !ok {
+		return 0, false
+	}
+	return c.ID, true
+}
+
 // UpdateProfileHandler gère la modification du profil utilisateur
 func UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Début de la mise à jour du profil")
@@ -819,15 +840,8 @@ func UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Gestion de l'avatar
 	if updateData.AvatarBase64 != nil && *updateData.AvatarBase64 != "" {
-		// Upload vers S3
-		awsService, err := services.NewAWSService()
-		if err != nil {
-			log.Printf("Erreur AWS Service: %v", err)
-			http.Error(w, "Erreur lors de l'initialisation du service de stockage", http.StatusInternalServerError)
-			return
-		}
-
-		newAvatarURL, err := awsService.UploadAvatar(*updateData.AvatarBase64)
+		// Upload vers le stockage
+		newAvatarURL, err := mediaService.UploadAvatar(*updateData.AvatarBase64)
 		if err != nil {
 			log.Printf("Erreur upload avatar: %v", err)
 			http.Error(w, "Erreur lors du téléchargement de l'avatar", http.StatusInternalServerError)
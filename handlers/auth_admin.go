@@ -13,7 +13,6 @@ import (
 	"golang.org/x/crypto/bcrypt"
 
 	"kivendi-backend/config"
-	"kivendi-backend/services"
 )
 
 // AdminCredentials pour la requête de connexion admin
@@ -595,14 +594,6 @@ func UpdateAdminAvatarHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Initialiser le service AWS
-	awsService, err := services.NewAWSService()
-	if err != nil {
-		log.Printf("Erreur lors de l'initialisation du service AWS: %v", err)
-		http.Error(w, "Erreur de configuration du service de stockage", http.StatusInternalServerError)
-		return
-	}
-
 	// Récupérer l'ancien avatar pour le supprimer (si existe)
 	var oldAvatarURL sql.NullString
 	err = config.DB.QueryRow(`
@@ -617,7 +608,7 @@ func UpdateAdminAvatarHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Uploader le nouvel avatar
-	avatarURL, err := awsService.UploadAvatar(req.AvatarBase64)
+	avatarURL, err := mediaService.UploadAvatar(req.AvatarBase64)
 	if err != nil {
 		log.Printf("Erreur lors de l'upload de l'avatar: %v", err)
 		http.Error(w, "Erreur lors de l'upload de l'avatar", http.StatusInternalServerError)
@@ -641,7 +632,7 @@ func UpdateAdminAvatarHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Supprimer l'ancien avatar de S3 (si existe)
 	if oldAvatarURL.Valid && oldAvatarURL.String != "" {
-		err = awsService.DeleteImages([]string{oldAvatarURL.String})
+		err = mediaService.DeleteImages([]string{oldAvatarURL.String})
 		if err != nil {
 			log.Printf("Erreur lors de la suppression de l'ancien avatar: %v", err)
 			// On continue même si la suppression échoue
@@ -700,14 +691,8 @@ func DeleteAdminAvatarHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Supprimer l'image de S3 (si existe)
 	if avatarURL.Valid && avatarURL.String != "" {
-		awsService, err := services.NewAWSService()
-		if err != nil {
-			log.Printf("Erreur lors de l'initialisation du service AWS: %v", err)
-		} else {
-			err = awsService.DeleteImages([]string{avatarURL.String})
-			if err != nil {
-				log.Printf("Erreur lors de la suppression de l'avatar de S3: %v", err)
-			}
+		if err := mediaService.DeleteImages([]string{avatarURL.String}); err != nil {
+			log.Printf("Erreur lors de la suppression de l'avatar de S3: %v", err)
 		}
 	}
 
@@ -14,6 +14,7 @@ import (
 
 	"kivendi-backend/config"
 	"kivendi-backend/models"
+	"kivendi-backend/services"
 )
 
 // GetBoostOffersHandler récupère toutes les offres de boost disponibles
@@ -578,6 +579,14 @@ func GetBoostedAdsHandler(w http.ResponseWriter, r *http.Request) {
 
 	offset := (page - 1) * limit
 
+	// Pagination par curseur (keyset) : activée par le paramètre "cursor" (vide pour la première page)
+	keysetColumns := []keysetColumn{{"bo.position_priority", true, keysetNumber}, {"a.created_at", true, keysetTime}, {"a.id", true, keysetID}}
+	cursorMode, cursor, err := parseCursorParam(r, "boosted", keysetColumns)
+	if err != nil {
+		http.Error(w, "Curseur invalide", http.StatusBadRequest)
+		return
+	}
+
 	query := `
 		SELECT 
 			a.id, a.title, a.description, a.price, a.images, a.city, 
@@ -596,14 +605,26 @@ func GetBoostedAdsHandler(w http.ResponseWriter, r *http.Request) {
 		AND a.is_deactivated = FALSE 
 		AND a.is_rejected = FALSE
 		AND a.is_sold = FALSE
+		AND a.is_expired = FALSE
 		AND a.is_boosted = TRUE
 		AND ab.is_active = TRUE
-		AND ab.end_date > NOW()
-		ORDER BY bo.position_priority DESC, a.created_at DESC
-		LIMIT $1 OFFSET $2
-	`
+		AND ab.end_date > NOW()`
+
+	var args []interface{}
+	if cursorMode {
+		if cursor != nil {
+			clause, params := keysetCondition(keysetColumns, cursor, 1)
+			query += " AND " + clause
+			args = append(args, params...)
+		}
+		query += " " + keysetOrderBy(keysetColumns) + fmt.Sprintf(" LIMIT $%d", len(args)+1)
+		args = append(args, limit+1)
+	} else {
+		query += " ORDER BY bo.position_priority DESC, a.created_at DESC LIMIT $1 OFFSET $2"
+		args = append(args, limit, offset)
+	}
 
-	rows, err := config.DB.Query(query, limit, offset)
+	rows, err := config.DB.Query(query, args...)
 	if err != nil {
 		log.Printf("Erreur lors de la récupération des annonces boostées: %v", err)
 		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
@@ -612,6 +633,7 @@ func GetBoostedAdsHandler(w http.ResponseWriter, r *http.Request) {
 	defer rows.Close()
 
 	var ads []models.Ad
+	var priorities []int
 
 	for rows.Next() {
 		var ad models.Ad
@@ -637,6 +659,7 @@ func GetBoostedAdsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		ad.Images = []string(images)
+		ad.ImageVariants = services.AdImageVariants(ad.Images)
 		if latitude.Valid {
 			ad.Latitude = latitude
 		}
@@ -659,6 +682,7 @@ func GetBoostedAdsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		ads = append(ads, ad)
+		priorities = append(priorities, priority)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -667,6 +691,26 @@ func GetBoostedAdsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if cursorMode {
+		pagination := CursorPagination{Limit: limit}
+		if len(ads) > limit {
+			ads = ads[:limit]
+			last := ads[limit-1]
+			pagination.HasMore = true
+			pagination.NextCursor = nextAdCursor("boosted",
+				[]string{strconv.Itoa(priorities[limit-1]), last.CreatedAt.Format(time.RFC3339Nano)}, last.ID)
+		}
+		response := struct {
+			Ads        []models.Ad      `json:"ads"`
+			Pagination CursorPagination `json:"pagination"`
+		}{Ads: ads, Pagination: pagination}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		log.Printf("Récupération réussie de %d annonces boostées (mode curseur).", len(ads))
+		return
+	}
+
 	var totalAds int
 	countQuery := `
 		SELECT COUNT(*)
@@ -676,6 +720,7 @@ func GetBoostedAdsHandler(w http.ResponseWriter, r *http.Request) {
 		AND a.is_deactivated = FALSE 
 		AND a.is_rejected = FALSE
 		AND a.is_sold = FALSE
+		AND a.is_expired = FALSE
 		AND a.is_boosted = TRUE
 		AND ab.is_active = TRUE
 		AND ab.end_date > NOW()
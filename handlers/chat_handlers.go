@@ -22,15 +22,13 @@ import (
 // Définition de la clé de contexte pour l'ID utilisateur
 var wsManager = localwebsocket.NewManager()
 var notificationManager = localwebsocket.NewNotificationManager()
-var awsService *services.AWSService
 
-func InitAWSService() {
-	var err error
-	awsService, err = services.NewAWSService()
-	if err != nil {
-		log.Fatalf("Erreur d'initialisation du service AWS: %v", err)
-	}
-	log.Println("Service AWS initialisé avec succès.")
+// mediaService gère les fichiers uploadés (images d'annonces, avatars, images du chat)
+var mediaService *services.MediaService
+
+// SetMediaService injecte le service de fichiers construit au démarrage sur le backend de stockage configuré
+func SetMediaService(service *services.MediaService) {
+	mediaService = service
 }
 
 // InitPushService initialise le service de push et l'affecte au singleton exporté du package services
@@ -50,6 +48,12 @@ func GetUserIDFromContext(r *http.Request) (int, bool) {
 	return userID, ok
 }
 
+// NotifyUser envoie un message sur le WebSocket de notifications (/ws/notifications) d'un utilisateur.
+// Utilisé par les jobs qui n'ont pas accès au gestionnaire de notifications.
+func NotifyUser(userID int, message []byte) {
+	notificationManager.Notify(userID, message)
+}
+
 // GetOrCreateConversation gère la création ou la récupération d'une conversation.
 // GetOrCreateConversation - CORRECTION: Empêcher la création de conversations si blocage global
 func GetOrCreateConversation(w http.ResponseWriter, r *http.Request) {
@@ -523,10 +527,10 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 			}
 
 			// Traitement spécifique pour les images
-			if incomingMessage.Type == "image" && awsService != nil {
+			if incomingMessage.Type == "image" {
 				log.Printf("Traitement de %d images", len(incomingMessage.Images))
 
-				imageURLs, err := awsService.UploadBase64Images(incomingMessage.Images)
+				imageURLs, err := mediaService.UploadBase64Images(incomingMessage.Images)
 				if err != nil {
 					log.Printf("Erreur lors de l'upload des images: %v", err)
 					continue
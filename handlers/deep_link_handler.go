@@ -1,42 +1,274 @@
 package handlers
 
 import (
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"html/template"
+	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"kivendi-backend/config"
+	"kivendi-backend/services"
 
 	"github.com/gorilla/mux"
+	"github.com/lib/pq"
 )
 
-// DeepLinkHandler gère les redirections pour les deep links
+// shareAdPathPrefix est le chemin des liens de partage d'annonces, déclaré dans les fichiers d'association
+const shareAdPathPrefix = "/api/v1/share/ad/"
+
+// shareDescriptionLength borne la description reprise dans l'aperçu des liens partagés
+const shareDescriptionLength = 200
+
+// deepLinkPage est la page des liens de partage : aperçu Open Graph de l'annonce, puis ouverture de
+// l'application (ou des stores / du site web si elle n'est pas installée)
+var deepLinkPage = template.Must(template.New("deep_link").Parse(deepLinkPageHTML))
+
+// deepLinkPageData alimente deepLinkPage
+type deepLinkPageData struct {
+	Found           bool // Annonce visible (en vente ou vendue)
+	Sold            bool
+	Title           string
+	PageTitle       string
+	OGTitle         string
+	Description     string
+	ImageURL        string
+	PriceAmount     string
+	PriceLabel      string
+	City            string
+	Heading         string
+	Message         string
+	ShareURL        string
+	AppDeepLink     string
+	WebFallbackURL  string
+	AndroidPackage  string
+	AndroidStoreURL string
+	IOSStoreURL     string
+	IOSAppStoreID   string
+}
+
+// DeepLinkHandler sert la page de partage d'une annonce. Les robots des réseaux sociaux (WhatsApp,
+// Facebook...) y lisent le titre, la photo, le prix et la description ; les visiteurs sont redirigés vers
+// l'application. Une annonce vendue reste présentée comme telle ; une annonce supprimée ou retirée
+// donne une page générique (404) qui renvoie vers l'accueil.
 func DeepLinkHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	adID := vars["adID"]
+	links := config.AppLinks
+	adIDStr := mux.Vars(r)["adID"]
+
+	data := deepLinkPageData{
+		PageTitle:       "Annonce indisponible - Kivendi",
+		OGTitle:         "Annonce indisponible",
+		Description:     "Cette annonce n'est plus disponible. Découvrez d'autres annonces sur Kivendi.",
+		Heading:         "Annonce indisponible",
+		Message:         "Cette annonce a été supprimée ou n'est plus en ligne",
+		ShareURL:        links.APIPublicURL + shareAdPathPrefix + url.PathEscape(adIDStr),
+		AppDeepLink:     links.AppScheme + "://",
+		WebFallbackURL:  links.WebBaseURL,
+		AndroidPackage:  links.AndroidPackage,
+		AndroidStoreURL: links.AndroidStoreURL,
+		IOSStoreURL:     links.IOSStoreURL,
+		IOSAppStoreID:   links.IOSAppStoreID,
+	}
+	status := http.StatusNotFound
+
+	if adID, err := strconv.Atoi(adIDStr); err == nil {
+		var title, description string
+		var price float64
+		var images pq.StringArray
+		var city sql.NullString
+		var isSold, isValidated, isExpired, isDeactivated, isRejected, isHiddenByReports bool
+		err = config.DB.QueryRowContext(r.Context(), `
+			SELECT title, COALESCE(description, ''), price, images, city,
+				COALESCE(is_sold, FALSE), COALESCE(is_validated, FALSE),
+				COALESCE(is_expired, FALSE), COALESCE(is_deactivated, FALSE),
+				COALESCE(is_rejected, FALSE), reports_hidden_at IS NOT NULL
+			FROM ads WHERE id = $1
+		`, adID).Scan(&title, &description, &price, &images, &city, &isSold, &isValidated, &isExpired, &isDeactivated,
+			&isRejected, &isHiddenByReports)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("Erreur lors de la lecture de l'annonce partagée %d: %v", adID, err)
+		}
 
-	// URLs des stores
-	androidStoreURL := "https://play.google.com/store/apps/details?id=bj.kivendie.app"
-	iosStoreURL := "https://apps.apple.com/app/idVOTRE_APP_ID"
+		// Une annonce vendue reste partageable ; sinon seules les annonces en ligne sont présentées.
+		// Une annonce rejetée ou masquée par des signalements ne l'est jamais, même vendue.
+		visible := err == nil && !isDeactivated && !isRejected && !isHiddenByReports &&
+			(isSold || (isValidated && !isExpired))
+		if visible {
+			status = http.StatusOK
+			data.Found = true
+			data.Sold = isSold
+			data.Title = title
+			data.City = strings.TrimSpace(city.String)
+			data.PriceAmount = strconv.FormatFloat(math.Round(price), 'f', 0, 64)
+			data.PriceLabel = formatSharePrice(price)
+			data.AppDeepLink = fmt.Sprintf("%s://ad/%d", links.AppScheme, adID)
+			data.WebFallbackURL = fmt.Sprintf("%s/annonces/%d", links.WebBaseURL, adID)
+			if len(images) > 0 {
+				// Variante JPEG : le WebP n'est pas lu par tous les aperçus de liens
+				data.ImageURL = services.ImageVariantsFor(images[0]).Medium
+			}
 
-	// Deep link de votre application
-	appDeepLink := fmt.Sprintf("kivendi://ad/%s", adID)
+			summary := data.PriceLabel
+			if data.City != "" {
+				summary += " · " + data.City
+			}
+			if isSold {
+				data.PageTitle = title + " (vendu) - Kivendi"
+				data.OGTitle = "Vendu : " + title
+				data.Description = summary + " — Cet article a été vendu. Découvrez des annonces similaires sur Kivendi."
+				data.Heading = "Cet article a été vendu"
+				data.Message = "Découvrez des annonces similaires dans l'application"
+			} else {
+				data.PageTitle = title + " - Kivendi"
+				data.OGTitle = title + " - " + data.PriceLabel
+				data.Description = summary
+				if excerpt := shareExcerpt(description); excerpt != "" {
+					data.Description += " — " + excerpt
+				}
+				data.Heading = "Ouverture de Kivendi..."
+				data.Message = "Vous allez être redirigé vers l'application"
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(status)
+	if err := deepLinkPage.Execute(w, data); err != nil {
+		log.Printf("Erreur lors du rendu de la page de partage de l'annonce %s: %v", adIDStr, err)
+	}
+}
+
+// formatSharePrice affiche un prix en FCFA avec séparateur de milliers (ex. "15 000 FCFA")
+func formatSharePrice(price float64) string {
+	digits := strconv.FormatInt(int64(math.Round(math.Abs(price))), 10)
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteString("\u00a0")
+		}
+		b.WriteRune(d)
+	}
+	return b.String() + "\u00a0FCFA"
+}
+
+// shareExcerpt renvoie le début de la description, sur une ligne, coupé sur un mot
+func shareExcerpt(description string) string {
+	excerpt := strings.Join(strings.Fields(description), " ")
+	if utf8.RuneCountInString(excerpt) <= shareDescriptionLength {
+		return excerpt
+	}
+	runes := []rune(excerpt)[:shareDescriptionLength]
+	cut := string(runes)
+	if i := strings.LastIndex(cut, " "); i > shareDescriptionLength/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
 
-	// URL de fallback pour desktop
-	webFallbackURL := fmt.Sprintf("https://kivendi.com/annonces/%s", adID)
+// AppleAppSiteAssociationHandler sert /.well-known/apple-app-site-association : les liens de partage
+// s'ouvrent directement dans l'application iOS (liens universels). Nécessite IOS_APP_ID.
+func AppleAppSiteAssociationHandler(w http.ResponseWriter, r *http.Request) {
+	appID := config.AppLinks.IOSAppID
+	if appID == "" {
+		http.NotFound(w, r)
+		return
+	}
 
-	// Page HTML avec redirection intelligente
-	htmlContent := fmt.Sprintf(`
+	sharePath := shareAdPathPrefix + "*"
+	association := map[string]interface{}{
+		"applinks": map[string]interface{}{
+			"apps": []string{},
+			"details": []map[string]interface{}{{
+				// appID/paths pour iOS 12 et antérieurs, appIDs/components ensuite
+				"appID":      appID,
+				"paths":      []string{sharePath},
+				"appIDs":     []string{appID},
+				"components": []map[string]string{{"/": sharePath, "comment": "Annonces partagées"}},
+			}},
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(association)
+}
+
+// AssetLinksHandler sert /.well-known/assetlinks.json : vérification des App Links Android pour ouvrir
+// les liens de partage dans l'application. Nécessite ANDROID_CERT_FINGERPRINTS.
+func AssetLinksHandler(w http.ResponseWriter, r *http.Request) {
+	links := config.AppLinks
+	if len(links.AndroidFingerprints) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	statements := []map[string]interface{}{{
+		"relation": []string{"delegate_permission/common.handle_all_urls"},
+		"target": map[string]interface{}{
+			"namespace":                "android_app",
+			"package_name":             links.AndroidPackage,
+			"sha256_cert_fingerprints": links.AndroidFingerprints,
+		},
+	}}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	json.NewEncoder(w).Encode(statements)
+}
+
+// deepLinkPageHTML est le gabarit de deepLinkPage
+const deepLinkPageHTML = `
 <!DOCTYPE html>
 <html lang="fr">
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Redirection vers Kivendi</title>
-    <meta name="description" content="Découvrez cette annonce sur Kivendi">
+    <title>{{.PageTitle}}</title>
+    <meta name="description" content="{{.Description}}">
+    <link rel="canonical" href="{{.ShareURL}}">
     
     <!-- Open Graph pour le partage sur les réseaux sociaux -->
-    <meta property="og:title" content="Annonce sur Kivendi">
-    <meta property="og:description" content="Cliquez pour voir cette annonce">
+    <meta property="og:site_name" content="Kivendi">
+    <meta property="og:locale" content="fr_FR">
+    <meta property="og:title" content="{{.OGTitle}}">
+    <meta property="og:description" content="{{.Description}}">
+    <meta property="og:url" content="{{.ShareURL}}">
+    {{- if .Found}}
+    <meta property="og:type" content="product">
+    <meta property="product:price:amount" content="{{.PriceAmount}}">
+    <meta property="product:price:currency" content="XOF">
+    <meta property="product:availability" content="{{if .Sold}}out of stock{{else}}in stock{{end}}">
+    {{- else}}
     <meta property="og:type" content="website">
+    {{- end}}
+    {{- if .ImageURL}}
+    <meta property="og:image" content="{{.ImageURL}}">
+    <meta property="og:image:alt" content="{{.Title}}">
+    <meta name="twitter:card" content="summary_large_image">
+    <meta name="twitter:image" content="{{.ImageURL}}">
+    {{- else}}
+    <meta name="twitter:card" content="summary">
+    {{- end}}
+    <meta name="twitter:title" content="{{.OGTitle}}">
+    <meta name="twitter:description" content="{{.Description}}">
     
+    <!-- App Links : ouverture directe de l'application depuis Facebook et Messenger -->
+    <meta property="al:android:package" content="{{.AndroidPackage}}">
+    <meta property="al:android:url" content="{{.AppDeepLink}}">
+    <meta property="al:android:app_name" content="Kivendi">
+    {{- if .IOSAppStoreID}}
+    <meta property="al:ios:app_store_id" content="{{.IOSAppStoreID}}">
+    <meta property="al:ios:url" content="{{.AppDeepLink}}">
+    <meta property="al:ios:app_name" content="Kivendi">
+    {{- end}}
+    <meta property="al:web:url" content="{{.WebFallbackURL}}">
     
     <!-- Lucide Icons -->
     <script src="https://unpkg.com/lucide@latest"></script>
@@ -67,7 +299,7 @@ func DeepLinkHandler(w http.ResponseWriter, r *http.Request) {
             justify-content: center;
             align-items: center;
             min-height: 100vh;
-            background: linear-gradient(135deg, var(--kivendi-green) 0%%, #005F6B 100%%);
+            background: linear-gradient(135deg, var(--kivendi-green) 0%, #005F6B 100%);
             color: var(--kivendi-white);
             text-align: center;
             padding: 20px;
@@ -78,7 +310,7 @@ func DeepLinkHandler(w http.ResponseWriter, r *http.Request) {
         /* Mode sombre adaptatif */
         @media (prefers-color-scheme: dark) {
             body {
-                background: linear-gradient(135deg, var(--kivendi-green-dark) 0%%, #008C7A 100%%);
+                background: linear-gradient(135deg, var(--kivendi-green-dark) 0%, #008C7A 100%);
             }
         }
         
@@ -86,8 +318,8 @@ func DeepLinkHandler(w http.ResponseWriter, r *http.Request) {
         body::before {
             content: '';
             position: absolute;
-            width: 200%%;
-            height: 200%%;
+            width: 200%;
+            height: 200%;
             background: radial-gradient(circle, rgba(255,255,255,0.08) 1px, transparent 1px);
             background-size: 40px 40px;
             animation: moveBackground 30s linear infinite;
@@ -95,13 +327,13 @@ func DeepLinkHandler(w http.ResponseWriter, r *http.Request) {
         }
         
         @keyframes moveBackground {
-            0%% { transform: translate(0, 0); }
-            100%% { transform: translate(40px, 40px); }
+            0% { transform: translate(0, 0); }
+            100% { transform: translate(40px, 40px); }
         }
         
         .container {
             max-width: 480px;
-            width: 100%%;
+            width: 100%;
             position: relative;
             z-index: 1;
         }
@@ -122,8 +354,8 @@ func DeepLinkHandler(w http.ResponseWriter, r *http.Request) {
         }
         
         @keyframes float {
-            0%%, 100%% { transform: translateY(0px); }
-            50%% { transform: translateY(-12px); }
+            0%, 100% { transform: translateY(0px); }
+            50% { transform: translateY(-12px); }
         }
         
         .logo-container svg {
@@ -158,7 +390,7 @@ func DeepLinkHandler(w http.ResponseWriter, r *http.Request) {
             height: 64px;
             margin: 0 auto;
             border: 4px solid rgba(255, 255, 255, 0.15);
-            border-radius: 50%%;
+            border-radius: 50%;
             border-top-color: var(--kivendi-white);
             animation: spin 0.9s ease-in-out infinite;
         }
@@ -204,15 +436,15 @@ func DeepLinkHandler(w http.ResponseWriter, r *http.Request) {
             content: '';
             position: absolute;
             top: 0;
-            left: -100%%;
-            width: 100%%;
-            height: 100%%;
+            left: -100%;
+            width: 100%;
+            height: 100%;
             background: linear-gradient(90deg, transparent, rgba(255,255,255,0.4), transparent);
             transition: left 0.5s;
         }
         
         .store-btn:hover::before {
-            left: 100%%;
+            left: 100%;
         }
         
         .store-btn:hover {
@@ -354,7 +586,7 @@ func DeepLinkHandler(w http.ResponseWriter, r *http.Request) {
             }
             
             .container {
-                max-width: 100%%;
+                max-width: 100%;
             }
             
             .logo-container {
@@ -548,16 +780,91 @@ func DeepLinkHandler(w http.ResponseWriter, r *http.Request) {
                 margin-bottom: 8px;
             }
         }
+        
+        /* Aperçu de l'annonce partagée */
+        .ad-card {
+            background: rgba(255, 255, 255, 0.12);
+            backdrop-filter: blur(12px);
+            border: 1px solid rgba(255, 255, 255, 0.18);
+            border-radius: 24px;
+            overflow: hidden;
+            margin: 0 auto 32px;
+            box-shadow: 0 10px 40px rgba(0, 0, 0, 0.15);
+        }
+        
+        .ad-image {
+            display: block;
+            width: 100%;
+            max-height: 280px;
+            object-fit: cover;
+        }
+        
+        .ad-info {
+            padding: 18px 22px 22px;
+        }
+        
+        .ad-badge {
+            display: inline-block;
+            padding: 4px 12px;
+            margin-bottom: 10px;
+            border-radius: 999px;
+            background: var(--kivendi-white);
+            color: var(--kivendi-green);
+            font-size: 13px;
+            font-weight: 700;
+            text-transform: uppercase;
+        }
+        
+        .ad-title {
+            font-size: 20px;
+            font-weight: 700;
+            line-height: 1.3;
+            margin-bottom: 8px;
+        }
+        
+        .ad-price {
+            font-size: 22px;
+            font-weight: 800;
+        }
+        
+        .ad-sold .ad-price {
+            opacity: 0.7;
+            text-decoration: line-through;
+        }
+        
+        .ad-city {
+            margin-top: 6px;
+            font-size: 15px;
+            opacity: 0.9;
+        }
     </style>
 </head>
 <body>
     <div class="container">
+        {{- if .Found}}
+        <div class="ad-card{{if .Sold}} ad-sold{{end}}">
+            {{- if .ImageURL}}
+            <img src="{{.ImageURL}}" alt="{{.Title}}" class="ad-image">
+            {{- end}}
+            <div class="ad-info">
+                {{- if .Sold}}
+                <span class="ad-badge">Vendu</span>
+                {{- end}}
+                <div class="ad-title">{{.Title}}</div>
+                <div class="ad-price">{{.PriceLabel}}</div>
+                {{- if .City}}
+                <div class="ad-city">{{.City}}</div>
+                {{- end}}
+            </div>
+        </div>
+        {{- else}}
         <div class="logo-container">
             <i data-lucide="shopping-bag"></i>
         </div>
+        {{- end}}
         
-        <h1 id="mainTitle">Ouverture de Kivendi...</h1>
-        <p id="mainText">Vous allez être redirigé vers l'application</p>
+        <h1 id="mainTitle">{{.Heading}}</h1>
+        <p id="mainText">{{.Message}}</p>
         
         <div class="spinner-container" id="spinnerContainer">
             <div class="spinner"></div>
@@ -565,15 +872,15 @@ func DeepLinkHandler(w http.ResponseWriter, r *http.Request) {
         
         <div class="store-buttons" id="storeButtons">
             <p>L'application n'est pas installée ?</p>
-            <a href="%s" class="store-btn" id="androidBtn" style="display:none;">
+            <a href="{{.AndroidStoreURL}}" class="store-btn" id="androidBtn" style="display:none;">
                 <i data-lucide="smartphone"></i>
                 <span>Télécharger sur Google Play</span>
             </a>
-            <a href="%s" class="store-btn" id="iosBtn" style="display:none;">
+            <a href="{{.IOSStoreURL}}" class="store-btn" id="iosBtn" style="display:none;">
                 <i data-lucide="apple"></i>
                 <span>Télécharger sur App Store</span>
             </a>
-            <a href="%s" class="store-btn web-btn" id="webBtn" style="display:none;">
+            <a href="{{.WebFallbackURL}}" class="store-btn web-btn" id="webBtn" style="display:none;">
                 <i data-lucide="globe"></i>
                 <span>Voir sur le site web</span>
             </a>
@@ -599,18 +906,18 @@ func DeepLinkHandler(w http.ResponseWriter, r *http.Request) {
                     <span>Géolocalisation des annonces</span>
                 </div>
             </div>
-            <a href="%s" class="store-btn web-btn">
+            <a href="{{.WebFallbackURL}}" class="store-btn web-btn">
                 <i data-lucide="external-link"></i>
-                <span>Voir l'annonce sur le site web</span>
+                <span>{{if .Found}}Voir l'annonce sur le site web{{else}}Voir les annonces sur le site web{{end}}</span>
             </a>
         </div>
     </div>
 
     <script>
-        const appDeepLink = '%s';
-        const androidStoreURL = '%s';
-        const iosStoreURL = '%s';
-        const webFallbackURL = '%s';
+        const appDeepLink = {{.AppDeepLink}};
+        const androidStoreURL = {{.AndroidStoreURL}};
+        const iosStoreURL = {{.IOSStoreURL}};
+        const webFallbackURL = {{.WebFallbackURL}};
         
         let appOpened = false;
         let redirectTimer;
@@ -655,7 +962,7 @@ func DeepLinkHandler(w http.ResponseWriter, r *http.Request) {
 
             if (isAndroid) {
                 document.getElementById('androidBtn').style.display = 'inline-flex';
-            } else if (isIOS) {
+            } else if (isIOS && iosStoreURL) {
                 document.getElementById('iosBtn').style.display = 'inline-flex';
             }
             
@@ -710,9 +1017,4 @@ func DeepLinkHandler(w http.ResponseWriter, r *http.Request) {
     </script>
 </body>
 </html>
-`, androidStoreURL, iosStoreURL, webFallbackURL, webFallbackURL, appDeepLink, androidStoreURL, iosStoreURL, webFallbackURL)
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(htmlContent))
-}
+`
@@ -9,6 +9,7 @@ import (
 
 	"kivendi-backend/config"
 	"kivendi-backend/models"
+	"kivendi-backend/services"
 
 	"github.com/gorilla/mux"
 	"github.com/lib/pq"
@@ -133,6 +134,7 @@ func GetFavoritesHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		ad.Images = []string(images)
+		ad.ImageVariants = services.AdImageVariants(ad.Images)
 
 		if formDataStr.Valid {
 			err = json.Unmarshal([]byte(formDataStr.String), &ad.FormData)
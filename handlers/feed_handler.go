@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"kivendi-backend/config"
+	"kivendi-backend/models"
+	"kivendi-backend/services"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// feedMaxLimit borne la taille d'une page du fil
+	feedMaxLimit = 50
+	// feedMaxSubCategories et feedMaxCities sont les centres d'intérêt retenus dans le profil de l'utilisateur
+	feedMaxSubCategories = 10
+	feedMaxCities        = 3
+	// feedRecentQueries est le nombre de recherches récentes reprises pour la pertinence textuelle
+	feedRecentQueries = 5
+	// feedBoostedFirstSlot et feedBoostedInterval placent les annonces boostées dans une page (3e position, puis une sur 5)
+	feedBoostedFirstSlot = 2
+	feedBoostedInterval  = 5
+	// feedMaxBoosted limite le nombre d'annonces boostées classées pour le fil
+	feedMaxBoosted = 100
+	// feedSearchHistoryLimit est le nombre de recherches conservées par utilisateur
+	feedSearchHistoryLimit = 50
+)
+
+// feedWeights pondère les critères du score d'une annonce dans le fil (total 1)
+type feedWeights struct {
+	subCategory float64
+	city        float64
+	text        float64
+	freshness   float64
+	popularity  float64
+}
+
+var (
+	// feedPersonalizedWeights s'appliquent lorsque l'utilisateur a un historique
+	feedPersonalizedWeights = feedWeights{subCategory: 0.35, city: 0.15, text: 0.15, freshness: 0.20, popularity: 0.15}
+	// feedTrendingWeights s'appliquent aux nouveaux utilisateurs : annonces récentes et tendance
+	feedTrendingWeights = feedWeights{freshness: 0.35, popularity: 0.65}
+)
+
+// feedProfile regroupe les centres d'intérêt d'un utilisateur, pondérés entre 0 et 1
+type feedProfile struct {
+	subCategoryIDs     []int64
+	subCategoryWeights []float64
+	cities             []string
+	cityWeights        []float64
+	textQuery          string
+}
+
+// personalized indique si le profil contient au moins un signal
+func (p feedProfile) personalized() bool {
+	return len(p.subCategoryIDs) > 0 || len(p.cities) > 0 || p.textQuery != ""
+}
+
+// FeedResponse est une page du fil d'accueil
+type FeedResponse struct {
+	Ads          []models.Ad `json:"ads"`
+	Page         int         `json:"page"`
+	Limit        int         `json:"limit"`
+	Personalized bool        `json:"personalized"`
+}
+
+// feedInterestCTEs expose le profil ($2 à $8) et les annonces tendance comme tables pour le score.
+// Les paramètres $1 à $13 sont communs aux requêtes du fil (voir feedQueryArgs).
+const feedInterestCTEs = `
+	sub_interest AS (
+		SELECT * FROM unnest($2::int[], $3::float8[]) AS t(sub_category_id, weight)
+	), city_interest AS (
+		SELECT * FROM unnest($4::text[], $5::float8[]) AS t(city, weight)
+	), trending AS (
+		SELECT * FROM unnest($6::bigint[], $7::float8[]) AS t(ad_id, popularity)
+	), text_query AS (
+		SELECT CASE WHEN $8::text = '' THEN NULL ELSE websearch_to_tsquery('french_unaccent', $8::text) END AS q
+	)`
+
+// feedSelect lit les colonnes d'une annonce du fil et son score ; les annonces déjà vues comptent moins
+const feedSelect = `
+	SELECT
+		a.id, a.title, a.description, a.price, a.images, a.form_data,
+		a.city, a.phone_number, a.is_phone_visible, a.latitude, a.longitude,
+		u.first_name, u.last_name, u.shop_name, u.account_type, u.avatar_url,
+		a.is_delivery_available, a.created_at,
+		(
+			$9::float8 * COALESCE(si.weight, 0)
+			+ $10::float8 * COALESCE(ci.weight, 0)
+			+ $11::float8 * CASE WHEN COALESCE(a.search_vector @@ tq.q, FALSE) THEN 1 ELSE 0 END
+			+ $12::float8 * EXP(-EXTRACT(EPOCH FROM NOW() - a.created_at) / 86400 / 14)
+			+ $13::float8 * COALESCE(t.popularity, 0)
+		) * CASE WHEN v.ad_id IS NULL THEN 1 ELSE 0.6 END AS feed_score`
+
+// feedJoins rattache à une annonce son vendeur, ses correspondances avec le profil et la consultation par l'utilisateur
+const feedJoins = `
+	JOIN users u ON a.user_id = u.id
+	CROSS JOIN text_query tq
+	LEFT JOIN sub_interest si ON si.sub_category_id = a.sub_category_id
+	LEFT JOIN city_interest ci ON ci.city = LOWER(TRIM(a.city))
+	LEFT JOIN trending t ON t.ad_id = a.id
+	LEFT JOIN user_ad_views v ON v.user_id = $1 AND v.ad_id = a.id
+	WHERE a.is_validated = TRUE AND a.is_expired = FALSE
+	AND COALESCE(a.is_deactivated, FALSE) = FALSE AND COALESCE(a.is_sold, FALSE) = FALSE
+	AND a.user_id <> $1`
+
+// feedActiveBoost est vrai pour une annonce dont le boost payé est en cours
+const feedActiveBoost = `EXISTS (
+		SELECT 1 FROM ad_boosts ab
+		WHERE ab.ad_id = a.id AND ab.is_active = TRUE AND ab.payment_status = 'completed'
+		AND ab.end_date > CURRENT_TIMESTAMP
+	)`
+
+// feedQueryArgs renvoie les paramètres $1 à $13 communs aux requêtes du fil
+func feedQueryArgs(userID int, profile feedProfile, trending services.TrendingAds, weights feedWeights) []interface{} {
+	return []interface{}{
+		userID,
+		pq.Array(profile.subCategoryIDs), pq.Array(profile.subCategoryWeights),
+		pq.Array(profile.cities), pq.Array(profile.cityWeights),
+		pq.Array(trending.AdIDs), pq.Array(trending.Scores),
+		profile.textQuery,
+		weights.subCategory, weights.city, weights.text, weights.freshness, weights.popularity,
+	}
+}
+
+// loadFeedProfile calcule les centres d'intérêt de l'utilisateur à partir de ses favoris, des annonces consultées,
+// des conversations engagées comme acheteur, de ses recherches récentes et des villes de ses propres annonces.
+// Chaque signal perd de son poids avec le temps (décroissance exponentielle sur 30 jours).
+func loadFeedProfile(r *http.Request, userID int) (feedProfile, error) {
+	profile := feedProfile{
+		subCategoryIDs: []int64{}, subCategoryWeights: []float64{},
+		cities: []string{}, cityWeights: []float64{},
+	}
+
+	rows, err := config.DB.QueryContext(r.Context(), `
+		WITH signals AS (
+			SELECT a.sub_category_id, a.city,
+				3.0 * EXP(-EXTRACT(EPOCH FROM NOW() - f.created_at) / 86400 / 30) AS weight
+			FROM favorites f JOIN ads a ON a.id = f.ad_id
+			WHERE f.user_id = $1
+			UNION ALL
+			SELECT a.sub_category_id, a.city,
+				LEAST(v.view_count, 5) * EXP(-EXTRACT(EPOCH FROM NOW() - v.last_viewed_at) / 86400 / 30)
+			FROM user_ad_views v JOIN ads a ON a.id = v.ad_id
+			WHERE v.user_id = $1 AND v.last_viewed_at > NOW() - INTERVAL '90 days'
+			UNION ALL
+			SELECT a.sub_category_id, a.city,
+				4.0 * EXP(-EXTRACT(EPOCH FROM NOW() - c.updated_at) / 86400 / 30)
+			FROM conversations c JOIN ads a ON a.id = c.ad_id
+			WHERE c.buyer_id = $1
+			UNION ALL
+			SELECT h.sub_category_id, h.city,
+				2.0 * EXP(-EXTRACT(EPOCH FROM NOW() - h.searched_at) / 86400 / 30)
+			FROM user_search_history h
+			WHERE h.user_id = $1 AND (h.sub_category_id IS NOT NULL OR h.category_id IS NULL)
+			UNION ALL
+			-- Une recherche limitée à une catégorie est répartie entre ses sous-catégories
+			SELECT sc.id, h.city,
+				2.0 * EXP(-EXTRACT(EPOCH FROM NOW() - h.searched_at) / 86400 / 30) / COUNT(*) OVER (PARTITION BY h.id)
+			FROM user_search_history h JOIN sub_categories sc ON sc.category_id = h.category_id
+			WHERE h.user_id = $1 AND h.sub_category_id IS NULL
+			UNION ALL
+			SELECT NULL::integer, a.city, 1.0
+			FROM ads a
+			WHERE a.user_id = $1
+		)
+		(
+			SELECT 'sub_category', sub_category_id::text, SUM(weight)::float8
+			FROM signals WHERE sub_category_id IS NOT NULL
+			GROUP BY sub_category_id ORDER BY 3 DESC LIMIT $2
+		)
+		UNION ALL
+		(
+			SELECT 'city', LOWER(TRIM(city)), SUM(weight)::float8
+			FROM signals WHERE TRIM(COALESCE(city, '')) <> ''
+			GROUP BY LOWER(TRIM(city)) ORDER BY 3 DESC LIMIT $3
+		)
+	`, userID, feedMaxSubCategories, feedMaxCities)
+	if err != nil {
+		return profile, err
+	}
+	defer rows.Close()
+
+	var maxSubCategory, maxCity float64
+	for rows.Next() {
+		var kind, key string
+		var weight float64
+		if err := rows.Scan(&kind, &key, &weight); err != nil {
+			return profile, err
+		}
+		if weight <= 0 {
+			continue
+		}
+		switch kind {
+		case "sub_category":
+			id, err := strconv.ParseInt(key, 10, 64)
+			if err != nil {
+				continue
+			}
+			profile.subCategoryIDs = append(profile.subCategoryIDs, id)
+			profile.subCategoryWeights = append(profile.subCategoryWeights, weight)
+			if weight > maxSubCategory {
+				maxSubCategory = weight
+			}
+		case "city":
+			profile.cities = append(profile.cities, key)
+			profile.cityWeights = append(profile.cityWeights, weight)
+			if weight > maxCity {
+				maxCity = weight
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return profile, err
+	}
+
+	// Normalisation : le centre d'intérêt principal vaut 1
+	for i := range profile.subCategoryWeights {
+		profile.subCategoryWeights[i] /= maxSubCategory
+	}
+	for i := range profile.cityWeights {
+		profile.cityWeights[i] /= maxCity
+	}
+
+	queryRows, err := config.DB.QueryContext(r.Context(), `
+		SELECT query FROM user_search_history
+		WHERE user_id = $1 AND query <> ''
+		GROUP BY query
+		ORDER BY MAX(searched_at) DESC
+		LIMIT $2
+	`, userID, feedRecentQueries)
+	if err != nil {
+		return profile, err
+	}
+	defer queryRows.Close()
+
+	var queries []string
+	for queryRows.Next() {
+		var query string
+		if err := queryRows.Scan(&query); err != nil {
+			return profile, err
+		}
+		queries = append(queries, query)
+	}
+	profile.textQuery = strings.Join(queries, " or ")
+	return profile, queryRows.Err()
+}
+
+// scanAdListRow lit les colonnes d'annonce de feedSelect (jusqu'à a.created_at), suivies des colonnes extra
+func scanAdListRow(scanner interface{ Scan(...interface{}) error }, extra ...interface{}) (models.Ad, error) {
+	var ad models.Ad
+	var images pq.StringArray
+	var formDataStr sql.NullString
+	var firstName, lastName, accountType string
+	var shopName, avatarURL sql.NullString
+
+	dest := []interface{}{
+		&ad.ID, &ad.Title, &ad.Description, &ad.Price, &images, &formDataStr,
+		&ad.City, &ad.PhoneNumber, &ad.IsPhoneVisible, &ad.Latitude, &ad.Longitude,
+		&firstName, &lastName, &shopName, &accountType, &avatarURL,
+		&ad.IsDeliveryAvailable, &ad.CreatedAt,
+	}
+	if err := scanner.Scan(append(dest, extra...)...); err != nil {
+		return ad, err
+	}
+
+	ad.Images = []string(images)
+	ad.ImageVariants = services.AdImageVariants(ad.Images)
+	if formDataStr.Valid {
+		if err := json.Unmarshal([]byte(formDataStr.String), &ad.FormData); err != nil {
+			ad.FormData = nil
+		}
+	}
+
+	// Logique pour déterminer le nom d'affichage
+	if accountType == "Professionnel" {
+		ad.User.IsProAccount = true
+		ad.User.ShopName = shopName
+		if shopName.Valid {
+			ad.User.DisplayName = shopName.String
+		}
+	} else {
+		ad.User.FirstName = firstName
+		ad.User.LastName = lastName
+		ad.User.DisplayName = firstName + " " + lastName
+	}
+	ad.User.AvatarURL = avatarURL
+	return ad, nil
+}
+
+// queryFeedAds exécute une requête du fil et lit les annonces
+func queryFeedAds(r *http.Request, query string, args ...interface{}) ([]models.Ad, error) {
+	rows, err := config.DB.QueryContext(r.Context(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ads := []models.Ad{}
+	for rows.Next() {
+		var score float64
+		ad, err := scanAdListRow(rows, &score)
+		if err != nil {
+			return nil, err
+		}
+		ads = append(ads, ad)
+	}
+	return ads, rows.Err()
+}
+
+// feedBoostedSlots renvoie le nombre d'emplacements réservés aux annonces boostées dans une page
+func feedBoostedSlots(limit int) int {
+	if limit <= feedBoostedFirstSlot {
+		return 0
+	}
+	return (limit-feedBoostedFirstSlot-1)/feedBoostedInterval + 1
+}
+
+// blendFeedAds insère les annonces boostées aux emplacements réservés ; si les annonces organiques
+// manquent, les boostées restantes sont placées à la suite.
+func blendFeedAds(organic, boosted []models.Ad, limit int) []models.Ad {
+	ads := make([]models.Ad, 0, len(organic)+len(boosted))
+	for i := 0; i < limit && (len(organic) > 0 || len(boosted) > 0); i++ {
+		isSlot := i >= feedBoostedFirstSlot && (i-feedBoostedFirstSlot)%feedBoostedInterval == 0
+		if len(boosted) > 0 && (isSlot || len(organic) == 0) {
+			ads = append(ads, boosted[0])
+			boosted = boosted[1:]
+			continue
+		}
+		if len(organic) > 0 {
+			ads = append(ads, organic[0])
+			organic = organic[1:]
+		}
+	}
+	return ads
+}
+
+// GetFeedHandler renvoie le fil d'accueil de l'utilisateur connecté. Les annonces validées sont classées selon
+// ses centres d'intérêt (sous-catégories, villes, recherches récentes), leur fraîcheur et leur popularité ;
+// sans historique, le fil se compose des annonces tendance et récentes. Les annonces boostées sont
+// intercalées à intervalles réguliers. Les annonces du vendeur, ses favoris et celles pour lesquelles
+// il a déjà contacté le vendeur sont exclues. Pagination par page/limit (10 par défaut).
+func GetFeedHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 10
+	}
+	if limit > feedMaxLimit {
+		limit = feedMaxLimit
+	}
+
+	profile, err := loadFeedProfile(r, userID)
+	if err != nil {
+		log.Printf("Erreur lors du calcul du profil du fil de l'utilisateur %d: %v", userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	weights := feedTrendingWeights
+	if profile.personalized() {
+		weights = feedPersonalizedWeights
+	}
+	args := feedQueryArgs(userID, profile, services.GetTrendingAds(), weights)
+
+	// Annonces boostées, classées une fois pour toutes les pages : chaque page consomme ses emplacements
+	boostedQuery := "WITH " + feedInterestCTEs + feedSelect + `
+		FROM ads a` + feedJoins + `
+		AND ` + feedActiveBoost + `
+		ORDER BY feed_score DESC, a.id DESC
+		LIMIT $14`
+	boostedAds, err := queryFeedAds(r, boostedQuery, append(args, feedMaxBoosted)...)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération des annonces boostées du fil: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	slots := feedBoostedSlots(limit)
+	boostedBefore := (page - 1) * slots
+	if boostedBefore > len(boostedAds) {
+		boostedBefore = len(boostedAds)
+	}
+	boostedEnd := boostedBefore + slots
+	if boostedEnd > len(boostedAds) {
+		boostedEnd = len(boostedAds)
+	}
+	pageBoosted := boostedAds[boostedBefore:boostedEnd]
+	for i := range pageBoosted {
+		pageBoosted[i].IsBoosted = true
+	}
+
+	// Annonces organiques : candidates issues des centres d'intérêt, des tendances et des annonces récentes,
+	// chaque source étant bornée pour que le classement reste rapide
+	organicQuery := "WITH " + feedInterestCTEs + `, candidates AS (
+			(
+				SELECT a.id::bigint AS id FROM ads a JOIN sub_interest si ON si.sub_category_id = a.sub_category_id
+				WHERE a.is_validated = TRUE AND a.created_at > NOW() - INTERVAL '60 days'
+				ORDER BY a.created_at DESC LIMIT 500
+			)
+			UNION
+			(
+				SELECT a.id FROM ads a JOIN city_interest ci ON ci.city = LOWER(TRIM(a.city))
+				WHERE a.is_validated = TRUE AND a.created_at > NOW() - INTERVAL '30 days'
+				ORDER BY a.created_at DESC LIMIT 500
+			)
+			UNION
+			SELECT ad_id FROM trending
+			UNION
+			(
+				SELECT a.id FROM ads a CROSS JOIN text_query tq
+				WHERE a.is_validated = TRUE AND a.search_vector @@ tq.q
+				ORDER BY a.created_at DESC LIMIT 300
+			)
+			UNION
+			(
+				SELECT a.id FROM ads a
+				WHERE a.is_validated = TRUE
+				ORDER BY a.created_at DESC LIMIT 200
+			)
+		)` + feedSelect + `
+		FROM candidates c
+		JOIN ads a ON a.id = c.id` + feedJoins + `
+		AND NOT ` + feedActiveBoost + `
+		AND NOT EXISTS (SELECT 1 FROM favorites f WHERE f.user_id = $1 AND f.ad_id = a.id)
+		AND NOT EXISTS (SELECT 1 FROM conversations cv WHERE cv.buyer_id = $1 AND cv.ad_id = a.id)
+		ORDER BY feed_score DESC, a.created_at DESC, a.id DESC
+		LIMIT $14 OFFSET $15`
+	organicOffset := (page-1)*limit - boostedBefore
+	organicAds, err := queryFeedAds(r, organicQuery, append(args, limit-len(pageBoosted), organicOffset)...)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération du fil de l'utilisateur %d: %v", userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FeedResponse{
+		Ads:          blendFeedAds(organicAds, pageBoosted, limit),
+		Page:         page,
+		Limit:        limit,
+		Personalized: profile.personalized(),
+	})
+}
+
+// recordUserSearch mémorise une recherche d'un utilisateur connecté (fil personnalisé) et ne conserve
+// que ses feedSearchHistoryLimit dernières recherches
+func recordUserSearch(userID int, query string, categoryID, subCategoryID *int, city string) {
+	_, err := config.DB.Exec(`
+		INSERT INTO user_search_history (user_id, query, category_id, sub_category_id, city)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+	`, userID, strings.TrimSpace(query), categoryID, subCategoryID, strings.TrimSpace(city))
+	if err != nil {
+		log.Printf("Erreur lors de l'enregistrement de la recherche de l'utilisateur %d: %v", userID, err)
+		return
+	}
+
+	_, err = config.DB.Exec(`
+		DELETE FROM user_search_history
+		WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM user_search_history WHERE user_id = $1 ORDER BY searched_at DESC, id DESC LIMIT $2
+		)
+	`, userID, feedSearchHistoryLimit)
+	if err != nil {
+		log.Printf("Erreur lors de la purge des recherches de l'utilisateur %d: %v", userID, err)
+	}
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"kivendi-backend/config"
+	"kivendi-backend/models"
+	"kivendi-backend/services"
+
+	"github.com/gorilla/mux"
+)
+
+// mediaGCRunColumns sont les colonnes lues pour un rapport de nettoyage (sans le détail des orphelins)
+const mediaGCRunColumns = `
+	r.id, r.status, r.dry_run, r.triggered_by, r.grace_period_hours,
+	r.scanned_count, r.scanned_bytes, r.referenced_count, r.orphan_count, r.orphan_bytes,
+	r.deleted_count, r.failed_count, r.error_message, r.started_at, r.finished_at`
+
+// scanMediaGCRun lit une ligne produite par mediaGCRunColumns, suivie de r.orphans si withOrphans
+func scanMediaGCRun(scanner interface{ Scan(...interface{}) error }, withOrphans bool) (models.MediaGCRun, error) {
+	var run models.MediaGCRun
+	var triggeredBy sql.NullInt64
+	var errorMessage sql.NullString
+	var finishedAt sql.NullTime
+	var orphans []byte
+
+	dest := []interface{}{
+		&run.ID, &run.Status, &run.DryRun, &triggeredBy, &run.GracePeriodHours,
+		&run.ScannedCount, &run.ScannedBytes, &run.ReferencedCount, &run.OrphanCount, &run.OrphanBytes,
+		&run.DeletedCount, &run.FailedCount, &errorMessage, &run.StartedAt, &finishedAt,
+	}
+	if withOrphans {
+		dest = append(dest, &orphans)
+	}
+	if err := scanner.Scan(dest...); err != nil {
+		return run, err
+	}
+
+	if triggeredBy.Valid {
+		adminID := int(triggeredBy.Int64)
+		run.TriggeredBy = &adminID
+	}
+	if errorMessage.Valid {
+		run.ErrorMessage = &errorMessage.String
+	}
+	if finishedAt.Valid {
+		run.FinishedAt = &finishedAt.Time
+	}
+	if withOrphans {
+		run.Orphans = []models.MediaGCOrphan{}
+		if len(orphans) > 0 {
+			if err := json.Unmarshal(orphans, &run.Orphans); err != nil {
+				return run, err
+			}
+		}
+	}
+	return run, nil
+}
+
+// RunScheduledMediaGC est exécuté par le job planifié avec la configuration MEDIA_GC_DRY_RUN / MEDIA_GC_GRACE_HOURS
+func RunScheduledMediaGC() {
+	dryRun, graceHours := services.MediaGCConfigFromEnv()
+	runID, err := services.StartMediaGCRun(context.Background(), dryRun, graceHours, nil)
+	if err != nil {
+		if errors.Is(err, services.ErrMediaGCAlreadyRunning) {
+			log.Println("Nettoyage des fichiers orphelins ignoré: un passage est déjà en cours")
+			return
+		}
+		log.Printf("Erreur lors du démarrage du nettoyage des fichiers orphelins: %v", err)
+		return
+	}
+	mediaService.RunMediaGC(context.Background(), runID)
+}
+
+// StartMediaGCRunRequest paramètre un passage lancé par un admin. Sans corps, le passage est une simulation
+// avec le délai de grâce configuré pour le job planifié.
+type StartMediaGCRunRequest struct {
+	DryRun           *bool `json:"dry_run"`
+	GracePeriodHours *int  `json:"grace_period_hours"`
+}
+
+// StartMediaGCRunHandler lance un passage du nettoyage des fichiers orphelins (admin uniquement)
+func StartMediaGCRunHandler(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := r.Context().Value(adminIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID admin non trouvé", http.StatusUnauthorized)
+		return
+	}
+
+	var req StartMediaGCRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Corps de la requête invalide", http.StatusBadRequest)
+		return
+	}
+
+	_, graceHours := services.MediaGCConfigFromEnv()
+	dryRun := true
+	if req.DryRun != nil {
+		dryRun = *req.DryRun
+	}
+	if req.GracePeriodHours != nil {
+		if *req.GracePeriodHours < services.MinMediaGCGraceHours {
+			http.Error(w, "Le délai de grâce doit être d'au moins "+strconv.Itoa(services.MinMediaGCGraceHours)+" heure", http.StatusBadRequest)
+			return
+		}
+		graceHours = *req.GracePeriodHours
+	}
+
+	runID, err := services.StartMediaGCRun(r.Context(), dryRun, graceHours, &adminID)
+	if err != nil {
+		if errors.Is(err, services.ErrMediaGCAlreadyRunning) {
+			http.Error(w, "Un nettoyage des fichiers est déjà en cours", http.StatusConflict)
+			return
+		}
+		log.Printf("Erreur lors du démarrage du nettoyage des fichiers par l'admin %d: %v", adminID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Nettoyage des fichiers %d lancé par l'admin %d (simulation: %t, délai de grâce: %dh)", runID, adminID, dryRun, graceHours)
+
+	run, err := scanMediaGCRun(config.DB.QueryRowContext(r.Context(),
+		"SELECT "+mediaGCRunColumns+" FROM media_gc_runs r WHERE r.id = $1", runID), false)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération du nettoyage %d: %v", runID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	// Le parcours du stockage peut être long : il se poursuit après la réponse
+	go mediaService.RunMediaGC(context.Background(), runID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(run)
+}
+
+// GetMediaGCRunsHandler renvoie les derniers rapports du nettoyage des fichiers orphelins
+func GetMediaGCRunsHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := config.DB.QueryContext(r.Context(),
+		"SELECT "+mediaGCRunColumns+" FROM media_gc_runs r ORDER BY r.started_at DESC LIMIT 50")
+	if err != nil {
+		log.Printf("Erreur lors de la récupération des rapports de nettoyage: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	runs := []models.MediaGCRun{}
+	for rows.Next() {
+		run, err := scanMediaGCRun(rows, false)
+		if err != nil {
+			log.Printf("Erreur lors du scan d'un rapport de nettoyage: %v", err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+			return
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Erreur après l'itération des rapports de nettoyage: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+// GetMediaGCRunHandler renvoie un rapport de nettoyage avec le détail des fichiers orphelins
+func GetMediaGCRunHandler(w http.ResponseWriter, r *http.Request) {
+	runID, err := strconv.Atoi(mux.Vars(r)["runID"])
+	if err != nil {
+		http.Error(w, "ID de rapport invalide", http.StatusBadRequest)
+		return
+	}
+
+	run, err := scanMediaGCRun(config.DB.QueryRowContext(r.Context(),
+		"SELECT "+mediaGCRunColumns+", r.orphans FROM media_gc_runs r WHERE r.id = $1", runID), true)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Rapport non trouvé", http.StatusNotFound)
+			return
+		}
+		log.Printf("Erreur lors de la récupération du rapport de nettoyage %d: %v", runID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// ServeMediaHandler sert les fichiers uploadés lorsque le stockage local est utilisé (STORAGE_BACKEND=local).
+// Avec S3, les fichiers sont servis directement par le bucket et cette route répond 404.
+func ServeMediaHandler(w http.ResponseWriter, r *http.Request) {
+	if mediaService == nil {
+		http.NotFound(w, r)
+		return
+	}
+	fileServer := mediaService.FileServer()
+	if fileServer == nil {
+		http.NotFound(w, r)
+		return
+	}
+	fileServer.ServeHTTP(w, r)
+}
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"kivendi-backend/config"
+	"kivendi-backend/models"
+
+	"github.com/gorilla/mux"
+)
+
+// maxSavedSearchesPerUser limite le nombre de recherches sauvegardées par utilisateur
+const maxSavedSearchesPerUser = 20
+
+// SavedSearchRequest représente le corps de la requête de création d'une recherche sauvegardée
+type SavedSearchRequest struct {
+	Name                string   `json:"name"`
+	Query               string   `json:"q"`
+	City                string   `json:"city"`
+	CategoryID          *int     `json:"category_id"`
+	SubCategoryID       *int     `json:"sub_category_id"`
+	MinPrice            *float64 `json:"min_price"`
+	MaxPrice            *float64 `json:"max_price"`
+	IsDeliveryAvailable *bool    `json:"is_delivery_available"`
+	Lat                 *float64 `json:"lat"`
+	Lng                 *float64 `json:"lng"`
+	RadiusKm            *float64 `json:"radius_km"`
+	DeliveryMode        string   `json:"delivery_mode"`
+}
+
+// SavedSearchUpdateRequest représente les champs modifiables d'une recherche sauvegardée
+type SavedSearchUpdateRequest struct {
+	Name          *string `json:"name"`
+	DeliveryMode  *string `json:"delivery_mode"`
+	AlertsEnabled *bool   `json:"alerts_enabled"`
+}
+
+const savedSearchColumns = `
+	ss.id, ss.user_id, ss.name, COALESCE(ss.query, ''), COALESCE(ss.city, ''),
+	ss.category_id, ss.sub_category_id, ss.min_price, ss.max_price, ss.is_delivery_available,
+	ss.latitude, ss.longitude, ss.radius_km,
+	ss.delivery_mode, ss.alerts_enabled, ss.last_notified_at, ss.created_at, ss.updated_at,
+	(SELECT COUNT(*) FROM saved_search_matches m WHERE m.saved_search_id = ss.id AND m.notified_at IS NULL)`
+
+// scanSavedSearch lit une ligne produite par savedSearchColumns
+func scanSavedSearch(scanner interface{ Scan(...interface{}) error }) (models.SavedSearch, error) {
+	var s models.SavedSearch
+	var categoryID, subCategoryID sql.NullInt64
+	var minPrice, maxPrice, lat, lng, radius sql.NullFloat64
+	var isDeliveryAvailable sql.NullBool
+	var lastNotifiedAt sql.NullTime
+
+	err := scanner.Scan(
+		&s.ID, &s.UserID, &s.Name, &s.Query, &s.City,
+		&categoryID, &subCategoryID, &minPrice, &maxPrice, &isDeliveryAvailable,
+		&lat, &lng, &radius,
+		&s.DeliveryMode, &s.AlertsEnabled, &lastNotifiedAt, &s.CreatedAt, &s.UpdatedAt,
+		&s.PendingMatches,
+	)
+	if err != nil {
+		return s, err
+	}
+
+	if categoryID.Valid {
+		v := int(categoryID.Int64)
+		s.CategoryID = &v
+	}
+	if subCategoryID.Valid {
+		v := int(subCategoryID.Int64)
+		s.SubCategoryID = &v
+	}
+	if minPrice.Valid {
+		s.MinPrice = &minPrice.Float64
+	}
+	if maxPrice.Valid {
+		s.MaxPrice = &maxPrice.Float64
+	}
+	if isDeliveryAvailable.Valid {
+		s.IsDeliveryAvailable = &isDeliveryAvailable.Bool
+	}
+	if lat.Valid && lng.Valid {
+		s.Lat = &lat.Float64
+		s.Lng = &lng.Float64
+	}
+	if radius.Valid {
+		s.RadiusKm = &radius.Float64
+	}
+	if lastNotifiedAt.Valid {
+		s.LastNotifiedAt = &lastNotifiedAt.Time
+	}
+	return s, nil
+}
+
+// isValidDeliveryMode vérifie le mode de réception des alertes
+func isValidDeliveryMode(mode string) bool {
+	return mode == models.SavedSearchDeliveryInstant || mode == models.SavedSearchDeliveryDaily
+}
+
+// CreateSavedSearchHandler enregistre les critères d'une recherche pour l'utilisateur connecté
+func CreateSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+
+	var req SavedSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corps de requête invalide", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.Query = strings.TrimSpace(req.Query)
+	req.City = strings.TrimSpace(req.City)
+	if req.Name == "" {
+		req.Name = req.Query
+	}
+	if req.Name == "" {
+		http.Error(w, "Le nom de la recherche est requis", http.StatusBadRequest)
+		return
+	}
+	if len(req.Name) > 100 {
+		http.Error(w, "Le nom de la recherche ne doit pas dépasser 100 caractères", http.StatusBadRequest)
+		return
+	}
+
+	if req.DeliveryMode == "" {
+		req.DeliveryMode = models.SavedSearchDeliveryInstant
+	}
+	if !isValidDeliveryMode(req.DeliveryMode) {
+		http.Error(w, "Mode de réception invalide (instant ou daily)", http.StatusBadRequest)
+		return
+	}
+
+	if req.MinPrice != nil && req.MaxPrice != nil && *req.MinPrice > *req.MaxPrice {
+		http.Error(w, "Le prix minimum doit être inférieur au prix maximum", http.StatusBadRequest)
+		return
+	}
+	if (req.Lat == nil) != (req.Lng == nil) {
+		http.Error(w, "lat et lng doivent être fournis ensemble", http.StatusBadRequest)
+		return
+	}
+	if req.RadiusKm != nil && (req.Lat == nil || *req.RadiusKm <= 0) {
+		http.Error(w, "radius_km nécessite une position (lat, lng) et doit être positif", http.StatusBadRequest)
+		return
+	}
+
+	hasCriteria := req.Query != "" || req.City != "" || req.CategoryID != nil || req.SubCategoryID != nil ||
+		req.MinPrice != nil || req.MaxPrice != nil || req.IsDeliveryAvailable != nil || req.RadiusKm != nil
+	if !hasCriteria {
+		http.Error(w, "Au moins un critère de recherche est requis", http.StatusBadRequest)
+		return
+	}
+
+	var count int
+	err := config.DB.QueryRowContext(r.Context(),
+		"SELECT COUNT(*) FROM saved_searches WHERE user_id = $1", userID).Scan(&count)
+	if err != nil {
+		log.Printf("Erreur lors du comptage des recherches sauvegardées: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if count >= maxSavedSearchesPerUser {
+		http.Error(w, "Nombre maximum de recherches sauvegardées atteint", http.StatusConflict)
+		return
+	}
+
+	var savedSearchID int
+	err = config.DB.QueryRowContext(r.Context(), `
+		INSERT INTO saved_searches (
+			user_id, name, query, city, category_id, sub_category_id,
+			min_price, max_price, is_delivery_available,
+			latitude, longitude, radius_km, delivery_mode
+		)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id`,
+		userID, req.Name, req.Query, req.City, req.CategoryID, req.SubCategoryID,
+		req.MinPrice, req.MaxPrice, req.IsDeliveryAvailable,
+		req.Lat, req.Lng, req.RadiusKm, req.DeliveryMode,
+	).Scan(&savedSearchID)
+	if err != nil {
+		log.Printf("Erreur lors de l'enregistrement de la recherche: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	savedSearch, err := scanSavedSearch(config.DB.QueryRowContext(r.Context(),
+		"SELECT "+savedSearchColumns+" FROM saved_searches ss WHERE ss.id = $1", savedSearchID))
+	if err != nil {
+		log.Printf("Erreur lors de la relecture de la recherche %d: %v", savedSearchID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Recherche sauvegardée %d créée pour l'utilisateur %d.", savedSearchID, userID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(savedSearch)
+}
+
+// GetSavedSearchesHandler liste les recherches sauvegardées de l'utilisateur connecté
+func GetSavedSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := config.DB.QueryContext(r.Context(),
+		"SELECT "+savedSearchColumns+" FROM saved_searches ss WHERE ss.user_id = $1 ORDER BY ss.created_at DESC",
+		userID)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération des recherches sauvegardées: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	savedSearches := []models.SavedSearch{}
+	for rows.Next() {
+		savedSearch, err := scanSavedSearch(rows)
+		if err != nil {
+			log.Printf("Erreur lors du scan d'une recherche sauvegardée: %v", err)
+			continue
+		}
+		savedSearches = append(savedSearches, savedSearch)
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Printf("Erreur après l'itération des recherches sauvegardées: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(savedSearches)
+}
+
+// UpdateSavedSearchHandler renomme une recherche sauvegardée ou modifie ses alertes
+func UpdateSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+
+	savedSearchID, err := strconv.Atoi(mux.Vars(r)["savedSearchID"])
+	if err != nil {
+		http.Error(w, "ID de recherche invalide", http.StatusBadRequest)
+		return
+	}
+
+	var req SavedSearchUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Corps de requête invalide", http.StatusBadRequest)
+		return
+	}
+
+	var setClauses []string
+	var args []interface{}
+	argIndex := 1
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > 100 {
+			http.Error(w, "Le nom de la recherche doit contenir entre 1 et 100 caractères", http.StatusBadRequest)
+			return
+		}
+		setClauses = append(setClauses, fmt.Sprintf("name = $%d", argIndex))
+		args = append(args, name)
+		argIndex++
+	}
+	if req.DeliveryMode != nil {
+		if !isValidDeliveryMode(*req.DeliveryMode) {
+			http.Error(w, "Mode de réception invalide (instant ou daily)", http.StatusBadRequest)
+			return
+		}
+		setClauses = append(setClauses, fmt.Sprintf("delivery_mode = $%d", argIndex))
+		args = append(args, *req.DeliveryMode)
+		argIndex++
+	}
+	if req.AlertsEnabled != nil {
+		setClauses = append(setClauses, fmt.Sprintf("alerts_enabled = $%d", argIndex))
+		args = append(args, *req.AlertsEnabled)
+		argIndex++
+	}
+
+	if len(setClauses) == 0 {
+		http.Error(w, "Aucun champ à mettre à jour", http.StatusBadRequest)
+		return
+	}
+	setClauses = append(setClauses, fmt.Sprintf("updated_at = $%d", argIndex))
+	args = append(args, time.Now())
+	argIndex++
+
+	query := fmt.Sprintf("UPDATE saved_searches SET %s WHERE id = $%d AND user_id = $%d",
+		strings.Join(setClauses, ", "), argIndex, argIndex+1)
+	args = append(args, savedSearchID, userID)
+
+	result, err := config.DB.ExecContext(r.Context(), query, args...)
+	if err != nil {
+		log.Printf("Erreur lors de la mise à jour de la recherche %d: %v", savedSearchID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		http.Error(w, "Recherche sauvegardée non trouvée", http.StatusNotFound)
+		return
+	}
+
+	savedSearch, err := scanSavedSearch(config.DB.QueryRowContext(r.Context(),
+		"SELECT "+savedSearchColumns+" FROM saved_searches ss WHERE ss.id = $1", savedSearchID))
+	if err != nil {
+		log.Printf("Erreur lors de la relecture de la recherche %d: %v", savedSearchID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(savedSearch)
+}
+
+// DeleteSavedSearchHandler supprime une recherche sauvegardée de l'utilisateur connecté
+func DeleteSavedSearchHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+
+	savedSearchID, err := strconv.Atoi(mux.Vars(r)["savedSearchID"])
+	if err != nil {
+		http.Error(w, "ID de recherche invalide", http.StatusBadRequest)
+		return
+	}
+
+	result, err := config.DB.ExecContext(r.Context(),
+		"DELETE FROM saved_searches WHERE id = $1 AND user_id = $2", savedSearchID, userID)
+	if err != nil {
+		log.Printf("Erreur lors de la suppression de la recherche %d: %v", savedSearchID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		http.Error(w, "Recherche sauvegardée non trouvée", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("Recherche sauvegardée %d supprimée par l'utilisateur %d.", savedSearchID, userID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Recherche sauvegardée supprimée"})
+}
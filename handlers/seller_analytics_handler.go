@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kivendi-backend/config"
+	"kivendi-backend/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	analyticsDateLayout       = "2006-01-02"
+	defaultAnalyticsRangeDays = 30
+	maxAnalyticsRangeDays     = 366
+)
+
+// sellerAdDaysSQL produit une ligne par annonce et par jour en ligne dans la période [$2, $3]
+// (jusqu'à la vente), avec le vendeur et l'indicateur de boost payé ou offert ce jour-là. L'appelant ajoute le WHERE.
+const sellerAdDaysSQL = `
+	SELECT a.id AS ad_id, a.user_id AS seller_id, d::date AS day,
+		EXISTS (
+			SELECT 1 FROM ad_boosts b
+			WHERE b.ad_id = a.id AND b.payment_status IN ('completed', 'admin_granted')
+			AND d::date BETWEEN b.start_date::date AND b.end_date::date
+		) AS boosted
+	FROM ads a
+	LEFT JOIN sold_ads s ON s.ad_id = a.id
+	CROSS JOIN LATERAL generate_series(
+		GREATEST($2::date, a.created_at::date),
+		LEAST($3::date, COALESCE(s.sold_at::date, $3::date), CURRENT_DATE),
+		INTERVAL '1 day'
+	) AS d`
+
+// parseAnalyticsRange lit les paramètres from et to (AAAA-MM-JJ, inclus). Par défaut : les 30 derniers jours.
+func parseAnalyticsRange(r *http.Request) (from, to time.Time, errMsg string) {
+	to, _ = time.Parse(analyticsDateLayout, time.Now().Format(analyticsDateLayout))
+	if raw := r.URL.Query().Get("to"); raw != "" {
+		t, err := time.Parse(analyticsDateLayout, raw)
+		if err != nil {
+			return from, to, "Paramètre to invalide (format AAAA-MM-JJ)"
+		}
+		to = t
+	}
+	from = to.AddDate(0, 0, -(defaultAnalyticsRangeDays - 1))
+	if raw := r.URL.Query().Get("from"); raw != "" {
+		t, err := time.Parse(analyticsDateLayout, raw)
+		if err != nil {
+			return from, to, "Paramètre from invalide (format AAAA-MM-JJ)"
+		}
+		from = t
+	}
+
+	if from.After(to) {
+		return from, to, "La date de début doit précéder la date de fin"
+	}
+	if to.Sub(from) > time.Duration(maxAnalyticsRangeDays)*24*time.Hour {
+		return from, to, fmt.Sprintf("La période ne peut pas dépasser %d jours", maxAnalyticsRangeDays)
+	}
+	return from, to, ""
+}
+
+// loadSellerAdAnalytics renvoie les indicateurs par annonce du vendeur sur la période (une seule annonce si adID est fourni)
+func loadSellerAdAnalytics(ctx context.Context, userID int, from, to time.Time, adID *int) ([]models.SellerAdAnalytics, error) {
+	rows, err := config.DB.QueryContext(ctx, `
+		SELECT a.id, a.title, a.created_at, COALESCE(a.is_sold, FALSE), s.sold_at,
+			COALESCE((SELECT SUM(v.views) FROM ad_view_daily v WHERE v.ad_id = a.id AND v.day BETWEEN $2::date AND $3::date), 0),
+			(SELECT COUNT(*) FROM favorites f WHERE f.ad_id = a.id AND f.created_at::date BETWEEN $2::date AND $3::date),
+			(SELECT COUNT(*) FROM conversations c WHERE c.ad_id = a.id AND c.created_at::date BETWEEN $2::date AND $3::date),
+			(SELECT COUNT(*) FROM messages m JOIN conversations c ON c.id = m.conversation_id
+				WHERE c.ad_id = a.id AND m.type = 'offer' AND m.sender_id <> a.user_id
+				AND m.created_at::date BETWEEN $2::date AND $3::date),
+			(SELECT COUNT(*) FROM ad_phone_reveals p WHERE p.ad_id = a.id AND p.revealed_on BETWEEN $2::date AND $3::date)
+		FROM ads a
+		LEFT JOIN sold_ads s ON s.ad_id = a.id
+		WHERE a.user_id = $1 AND a.created_at::date <= $3::date AND ($4::int IS NULL OR a.id = $4)
+		ORDER BY a.created_at DESC
+	`, userID, from.Format(analyticsDateLayout), to.Format(analyticsDateLayout), adID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Fin de période exclusive pour situer la date de vente
+	periodEnd := to.AddDate(0, 0, 1)
+
+	ads := []models.SellerAdAnalytics{}
+	for rows.Next() {
+		var ad models.SellerAdAnalytics
+		var soldAt sql.NullTime
+		if err := rows.Scan(
+			&ad.AdID, &ad.Title, &ad.CreatedAt, &ad.IsSold, &soldAt,
+			&ad.Views, &ad.FavoritesAdded, &ad.ConversationsStarted, &ad.OffersReceived, &ad.PhoneReveals,
+		); err != nil {
+			return nil, err
+		}
+		if soldAt.Valid {
+			ad.SoldAt = &soldAt.Time
+			if !soldAt.Time.Before(from) && soldAt.Time.Before(periodEnd) {
+				days := soldAt.Time.Sub(ad.CreatedAt).Hours() / 24
+				ad.TimeToSaleDays = &days
+			}
+		}
+		ads = append(ads, ad)
+	}
+	return ads, rows.Err()
+}
+
+// GetSellerAnalyticsHandler renvoie les statistiques du vendeur connecté sur une période :
+// indicateurs par annonce, totaux et comparaison des périodes boostées et non boostées.
+func GetSellerAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+
+	from, to, msg := parseAnalyticsRange(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	ads, err := loadSellerAdAnalytics(r.Context(), userID, from, to, nil)
+	if err != nil {
+		log.Printf("Erreur lors du calcul des statistiques du vendeur %d: %v", userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.SellerAnalytics{
+		From: from.Format(analyticsDateLayout),
+		To:   to.Format(analyticsDateLayout),
+		Ads:  ads,
+	}
+
+	var totalTimeToSale float64
+	for _, ad := range ads {
+		response.Totals.Add(ad.AdPerformanceMetrics)
+		if ad.TimeToSaleDays != nil {
+			response.Totals.SoldCount++
+			totalTimeToSale += *ad.TimeToSaleDays
+		}
+	}
+	response.Totals.AdsCount = len(ads)
+	if response.Totals.SoldCount > 0 {
+		avg := totalTimeToSale / float64(response.Totals.SoldCount)
+		response.Totals.AverageTimeToSaleDays = &avg
+	}
+
+	// Comparaison boost / sans boost sur les jours-annonces de la période
+	rows, err := config.DB.QueryContext(r.Context(), `
+		WITH days AS (`+sellerAdDaysSQL+` WHERE a.user_id = $1)
+		SELECT days.boosted, COUNT(*),
+			COALESCE(SUM(v.views), 0),
+			COALESCE(SUM((SELECT COUNT(*) FROM favorites f WHERE f.ad_id = days.ad_id AND f.created_at::date = days.day)), 0),
+			COALESCE(SUM((SELECT COUNT(*) FROM conversations c WHERE c.ad_id = days.ad_id AND c.created_at::date = days.day)), 0),
+			COALESCE(SUM((SELECT COUNT(*) FROM messages m JOIN conversations c ON c.id = m.conversation_id
+				WHERE c.ad_id = days.ad_id AND m.type = 'offer' AND m.sender_id <> days.seller_id
+				AND m.created_at::date = days.day)), 0),
+			COALESCE(SUM((SELECT COUNT(*) FROM ad_phone_reveals p WHERE p.ad_id = days.ad_id AND p.revealed_on = days.day)), 0)
+		FROM days
+		LEFT JOIN ad_view_daily v ON v.ad_id = days.ad_id AND v.day = days.day
+		GROUP BY days.boosted
+	`, userID, from.Format(analyticsDateLayout), to.Format(analyticsDateLayout))
+	if err != nil {
+		log.Printf("Erreur lors de la comparaison des périodes boostées du vendeur %d: %v", userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var boosted bool
+		var stats models.BoostPeriodStats
+		if err := rows.Scan(&boosted, &stats.Days, &stats.Views, &stats.FavoritesAdded, &stats.ConversationsStarted, &stats.OffersReceived, &stats.PhoneReveals); err != nil {
+			log.Printf("Erreur lors du scan de la comparaison des boosts: %v", err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+			return
+		}
+		if boosted {
+			response.BoostComparison.Boosted = stats
+		} else {
+			response.BoostComparison.NotBoosted = stats
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Erreur après l'itération de la comparaison des boosts: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	response.BoostComparison.ComputeUplift()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetSellerAdAnalyticsHandler renvoie les statistiques d'une annonce du vendeur connecté,
+// avec la série quotidienne et la comparaison des jours boostés et non boostés.
+func GetSellerAdAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+
+	adID, err := strconv.Atoi(mux.Vars(r)["adID"])
+	if err != nil {
+		http.Error(w, "ID d'annonce invalide", http.StatusBadRequest)
+		return
+	}
+
+	from, to, msg := parseAnalyticsRange(r)
+	if msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	ads, err := loadSellerAdAnalytics(r.Context(), userID, from, to, &adID)
+	if err != nil {
+		log.Printf("Erreur lors du calcul des statistiques de l'annonce %d: %v", adID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if len(ads) == 0 {
+		// Annonce inexistante, d'un autre vendeur ou créée après la période
+		http.Error(w, "Annonce non trouvée", http.StatusNotFound)
+		return
+	}
+
+	rows, err := config.DB.QueryContext(r.Context(), `
+		WITH days AS (`+sellerAdDaysSQL+` WHERE a.id = $1)
+		SELECT to_char(days.day, 'YYYY-MM-DD'), days.boosted,
+			COALESCE(v.views, 0),
+			(SELECT COUNT(*) FROM favorites f WHERE f.ad_id = days.ad_id AND f.created_at::date = days.day),
+			(SELECT COUNT(*) FROM conversations c WHERE c.ad_id = days.ad_id AND c.created_at::date = days.day),
+			(SELECT COUNT(*) FROM messages m JOIN conversations c ON c.id = m.conversation_id
+				WHERE c.ad_id = days.ad_id AND m.type = 'offer' AND m.sender_id <> days.seller_id
+				AND m.created_at::date = days.day),
+			(SELECT COUNT(*) FROM ad_phone_reveals p WHERE p.ad_id = days.ad_id AND p.revealed_on = days.day)
+		FROM days
+		LEFT JOIN ad_view_daily v ON v.ad_id = days.ad_id AND v.day = days.day
+		ORDER BY days.day
+	`, adID, from.Format(analyticsDateLayout), to.Format(analyticsDateLayout))
+	if err != nil {
+		log.Printf("Erreur lors du calcul de la série quotidienne de l'annonce %d: %v", adID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	response := models.SellerAdAnalyticsDetail{
+		From:  from.Format(analyticsDateLayout),
+		To:    to.Format(analyticsDateLayout),
+		Ad:    ads[0],
+		Daily: []models.AdDailyMetrics{},
+	}
+	for rows.Next() {
+		var day models.AdDailyMetrics
+		if err := rows.Scan(
+			&day.Day, &day.IsBoosted,
+			&day.Views, &day.FavoritesAdded, &day.ConversationsStarted, &day.OffersReceived, &day.PhoneReveals,
+		); err != nil {
+			log.Printf("Erreur lors du scan de la série quotidienne: %v", err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+			return
+		}
+		response.Daily = append(response.Daily, day)
+
+		period := &response.BoostComparison.NotBoosted
+		if day.IsBoosted {
+			period = &response.BoostComparison.Boosted
+		}
+		period.Days++
+		period.Views += day.Views
+		period.FavoritesAdded += day.FavoritesAdded
+		period.ConversationsStarted += day.ConversationsStarted
+		period.OffersReceived += day.OffersReceived
+		period.PhoneReveals += day.PhoneReveals
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Erreur après l'itération de la série quotidienne: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	response.BoostComparison.ComputeUplift()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -225,6 +225,44 @@ func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// userSettingViewHistory active l'historique des annonces consultées (voir view_history_handler.go)
+const userSettingViewHistory = "view_history_enabled"
+
+// defaultUserSettings renvoie les paramètres d'un utilisateur qui ne les a jamais modifiés
+func defaultUserSettings() map[string]interface{} {
+	return map[string]interface{}{
+		"notifications_enabled": true,
+		"email_notifications":   true,
+		"push_notifications":    true,
+		userSettingViewHistory:  true,
+	}
+}
+
+// loadUserSettings renvoie les paramètres enregistrés de l'utilisateur, complétés par les valeurs par défaut
+func loadUserSettings(ctx context.Context, userID int) (map[string]interface{}, error) {
+	settings := defaultUserSettings()
+
+	var raw []byte
+	err := config.DB.QueryRowContext(ctx, `
+		SELECT settings FROM user_settings WHERE user_id = $1
+	`, userID).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stored map[string]interface{}
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return nil, err
+	}
+	for key, value := range stored {
+		settings[key] = value
+	}
+	return settings, nil
+}
+
 // GetUserSettingsHandler récupère les paramètres de l'utilisateur
 func GetUserSettingsHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(userIDContextKey).(int)
@@ -233,20 +271,8 @@ func GetUserSettingsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Utiliser userID pour récupérer les settings depuis la DB
-	var settings map[string]interface{}
-	err := config.DB.QueryRow(`
-		SELECT settings FROM user_settings WHERE user_id = $1
-	`, userID).Scan(&settings)
-
-	if err == sql.ErrNoRows {
-		// Retourner des paramètres par défaut
-		settings = map[string]interface{}{
-			"notifications_enabled": true,
-			"email_notifications":   true,
-			"push_notifications":    true,
-		}
-	} else if err != nil {
+	settings, err := loadUserSettings(r.Context(), userID)
+	if err != nil {
 		log.Printf("Erreur lors de la récupération des paramètres: %v", err)
 		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
 		return
@@ -256,7 +282,8 @@ func GetUserSettingsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(settings)
 }
 
-// UpdateUserSettingsHandler met à jour les paramètres de l'utilisateur
+// UpdateUserSettingsHandler met à jour les paramètres de l'utilisateur. Seules les clés envoyées sont
+// modifiées ; les paramètres connus doivent être des booléens. Désactiver view_history_enabled vide l'historique.
 func UpdateUserSettingsHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(userIDContextKey).(int)
 	if !ok {
@@ -269,13 +296,65 @@ func UpdateUserSettingsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Corps de requête invalide", http.StatusBadRequest)
 		return
 	}
+	for key := range defaultUserSettings() {
+		if value, present := settings[key]; present {
+			if _, isBool := value.(bool); !isBool {
+				http.Error(w, fmt.Sprintf("Le paramètre %s doit être un booléen", key), http.StatusBadRequest)
+				return
+			}
+		}
+	}
 
-	// Ici, vous pouvez sauvegarder les paramètres dans une table settings
-	// Pour l'instant, on retourne juste un succès
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		http.Error(w, "Corps de requête invalide", http.StatusBadRequest)
+		return
+	}
+	tx, err := config.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		log.Printf("Erreur lors du démarrage de la transaction des paramètres: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(r.Context(), `
+		INSERT INTO user_settings (user_id, settings) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET settings = user_settings.settings || EXCLUDED.settings, updated_at = NOW()
+	`, userID, string(settingsJSON))
+	if err != nil {
+		log.Printf("Erreur lors de la mise à jour des paramètres de l'utilisateur %d: %v", userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	// Désactiver l'historique efface les consultations déjà enregistrées (historique et fil personnalisé)
+	if enabled, present := settings[userSettingViewHistory].(bool); present && !enabled {
+		if _, err := tx.ExecContext(r.Context(), "DELETE FROM user_ad_views WHERE user_id = $1", userID); err != nil {
+			log.Printf("Erreur lors de la suppression de l'historique de l'utilisateur %d: %v", userID, err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Erreur lors de la validation des paramètres de l'utilisateur %d: %v", userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
 	log.Printf("Paramètres mis à jour pour l'utilisateur %d: %+v", userID, settings)
 
+	updated, err := loadUserSettings(r.Context(), userID)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération des paramètres: %v", err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Paramètres mis à jour avec succès",
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Paramètres mis à jour avec succès",
+		"settings": updated,
 	})
 }
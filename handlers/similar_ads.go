@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"kivendi-backend/models"
+	"kivendi-backend/services"
+)
+
+const (
+	// similarAdsLimit est le nombre d'annonces similaires renvoyées
+	similarAdsLimit = 5
+	// similarAdsCandidatePool est le nombre d'annonces récentes de la sous-catégorie évaluées
+	similarAdsCandidatePool = 200
+	// similarAdsMaxDistanceKm au-delà duquel la proximité géographique ne compte plus
+	similarAdsMaxDistanceKm = 100.0
+	// similarAdsBoostMinScore est le score minimal d'une annonce boostée pour être proposée
+	similarAdsBoostMinScore = 0.45
+	// similarAdsMaxBoosted limite le nombre d'annonces boostées dans la liste
+	similarAdsMaxBoosted = 1
+	// similarAdsSellerPenalty réduit le score de chaque nouvelle annonce d'un vendeur déjà proposé
+	similarAdsSellerPenalty = 0.6
+)
+
+// Poids des critères du score de similarité (total 1)
+const (
+	similarAdsTitleWeight     = 0.30
+	similarAdsAttributeWeight = 0.25
+	similarAdsPriceWeight     = 0.25
+	similarAdsLocationWeight  = 0.20
+)
+
+// similarAdsKeyAttributes comptent double dans la comparaison des attributs (form_data)
+var similarAdsKeyAttributes = map[string]bool{
+	"marque": true, "brand": true, "modele": true, "modèle": true, "model": true,
+}
+
+// similarAdProfile regroupe ce qui sert à comparer deux annonces
+type similarAdProfile struct {
+	userID     int
+	price      float64
+	city       string
+	latitude   *float64
+	longitude  *float64
+	formData   map[string]interface{}
+	titleWords map[string]bool
+}
+
+// similarAdCandidate est une annonce candidate et son score
+type similarAdCandidate struct {
+	ad        models.Ad
+	profile   similarAdProfile
+	isBoosted bool
+	score     float64
+}
+
+// newSimilarAdProfile prépare le profil de comparaison d'une annonce
+func newSimilarAdProfile(userID int, title string, price float64, city string, lat, lng *float64, formData map[string]interface{}) similarAdProfile {
+	words := make(map[string]bool)
+	for _, word := range strings.Fields(services.TitleFingerprint(title)) {
+		words[word] = true
+	}
+	return similarAdProfile{
+		userID:     userID,
+		price:      price,
+		city:       strings.ToLower(strings.TrimSpace(city)),
+		latitude:   lat,
+		longitude:  lng,
+		formData:   formData,
+		titleWords: words,
+	}
+}
+
+// similarityScore combine la proximité de prix, la localisation, les attributs communs et la
+// ressemblance des titres. Renvoie un score entre 0 et 1.
+func similarityScore(source, candidate similarAdProfile) float64 {
+	return similarAdsTitleWeight*titleSimilarity(source.titleWords, candidate.titleWords) +
+		similarAdsAttributeWeight*attributeSimilarity(source.formData, candidate.formData) +
+		similarAdsPriceWeight*priceCloseness(source.price, candidate.price) +
+		similarAdsLocationWeight*locationCloseness(source, candidate)
+}
+
+// titleSimilarity est l'indice de Jaccard des mots normalisés des deux titres
+func titleSimilarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// attributeSimilarity est la part (pondérée) des attributs renseignés de l'annonce d'origine que la
+// candidate partage ; la marque et le modèle comptent double.
+func attributeSimilarity(source, candidate map[string]interface{}) float64 {
+	var total, shared float64
+	for key, value := range source {
+		sourceValue := attributeValue(value)
+		if sourceValue == "" {
+			continue
+		}
+		weight := 1.0
+		if similarAdsKeyAttributes[strings.ToLower(key)] {
+			weight = 2.0
+		}
+		total += weight
+		if attributeValue(candidate[key]) == sourceValue {
+			shared += weight
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return shared / total
+}
+
+// attributeValue normalise une valeur de form_data pour la comparaison (listes triées pour les choix multiples)
+func attributeValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.ToLower(strings.TrimSpace(v))
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			if s := attributeValue(item); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		sort.Strings(parts)
+		return strings.Join(parts, "|")
+	default:
+		return strings.ToLower(fmt.Sprint(v))
+	}
+}
+
+// priceCloseness vaut 1 pour un prix identique et décroît avec l'écart relatif
+func priceCloseness(a, b float64) float64 {
+	highest := math.Max(a, b)
+	if highest <= 0 {
+		return 1
+	}
+	return 1 - math.Min(math.Abs(a-b)/highest, 1)
+}
+
+// locationCloseness vaut 1 dans la même ville, sinon décroît avec la distance jusqu'à similarAdsMaxDistanceKm
+func locationCloseness(a, b similarAdProfile) float64 {
+	if a.city != "" && a.city == b.city {
+		return 1
+	}
+	if a.latitude == nil || a.longitude == nil || b.latitude == nil || b.longitude == nil {
+		return 0
+	}
+	distance := haversineKm(*a.latitude, *a.longitude, *b.latitude, *b.longitude)
+	return math.Max(0, 1-distance/similarAdsMaxDistanceKm)
+}
+
+// haversineKm calcule la distance en kilomètres entre deux positions
+func haversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	toRad := math.Pi / 180
+	dLat := (lat2 - lat1) * toRad
+	dLng := (lng2 - lng1) * toRad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRad)*math.Cos(lat2*toRad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// rankSimilarAds classe les candidates par score en diversifiant les vendeurs : chaque annonce d'un vendeur
+// déjà retenu voit son score réduit. Les annonces boostées ne sont proposées que si elles sont pertinentes.
+func rankSimilarAds(source similarAdProfile, candidates []similarAdCandidate, limit int) []models.Ad {
+	pool := make([]similarAdCandidate, 0, len(candidates))
+	for _, c := range candidates {
+		c.score = similarityScore(source, c.profile)
+		if c.isBoosted && c.score < similarAdsBoostMinScore {
+			continue
+		}
+		pool = append(pool, c)
+	}
+
+	result := []models.Ad{}
+	sellerCount := make(map[int]int)
+	boosted := 0
+	for len(result) < limit && len(pool) > 0 {
+		best, bestScore := -1, -1.0
+		for i, c := range pool {
+			if c.isBoosted && boosted >= similarAdsMaxBoosted {
+				continue
+			}
+			score := c.score * math.Pow(similarAdsSellerPenalty, float64(sellerCount[c.profile.userID]))
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		chosen := pool[best]
+		pool = append(pool[:best], pool[best+1:]...)
+		sellerCount[chosen.profile.userID]++
+		if chosen.isBoosted {
+			boosted++
+		}
+		score := math.Round(bestScore*1000) / 1000
+		chosen.ad.SimilarityScore = &score
+		result = append(result, chosen.ad)
+	}
+	return result
+}
+
+// decodeFormData lit les attributs JSONB d'une annonce ; des attributs illisibles sont ignorés
+func decodeFormData(raw []byte) map[string]interface{} {
+	formData := map[string]interface{}{}
+	if len(raw) > 0 {
+		_ = json.Unmarshal(raw, &formData)
+	}
+	return formData
+}
+
+// nullFloatPtr convertit une coordonnée nullable en pointeur (nil si absente)
+func nullFloatPtr(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"kivendi-backend/config"
 	"kivendi-backend/models"
-	"kivendi-backend/services"
 	"log"
 	"net/http"
 	"strconv"
@@ -343,7 +342,7 @@ func GetUserDetailsForAdminHandler(w http.ResponseWriter, r *http.Request) {
 	config.DB.QueryRow("SELECT COUNT(*) FROM ads WHERE user_id = $1 AND is_rejected = TRUE", userID).Scan(&adsStats.RejectedAds)
 	config.DB.QueryRow("SELECT COUNT(*) FROM ads WHERE user_id = $1 AND is_deactivated = TRUE", userID).Scan(&adsStats.DeactivatedAds)
 	config.DB.QueryRow("SELECT COUNT(*) FROM ads WHERE user_id = $1 AND is_sold = TRUE", userID).Scan(&adsStats.SoldAds)
-	config.DB.QueryRow("SELECT COUNT(*) FROM ads WHERE user_id = $1 AND is_validated = TRUE AND is_sold = FALSE AND is_deactivated = FALSE", userID).Scan(&adsStats.ActiveAds)
+	config.DB.QueryRow("SELECT COUNT(*) FROM ads WHERE user_id = $1 AND is_validated = TRUE AND is_sold = FALSE AND is_deactivated = FALSE AND is_expired = FALSE", userID).Scan(&adsStats.ActiveAds)
 
 	// Statistiques des boosts
 	var boostStats struct {
@@ -536,14 +535,8 @@ func DeleteUserForAdminHandler(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Utilisateur %d supprimé de la BDD. Lancement du nettoyage S3...", userID)
 
 	go func() {
-		awsService, err := services.NewAWSService()
-		if err != nil {
-			log.Printf("CRITIQUE: Impossible d'initier le service AWS pour suppression images utilisateur %d: %v", userID, err)
-			return
-		}
-
 		if avatarURL.Valid && avatarURL.String != "" {
-			if err := awsService.DeleteImages([]string{avatarURL.String}); err != nil {
+			if err := mediaService.DeleteImages([]string{avatarURL.String}); err != nil {
 				log.Printf("ERREUR S3: Echec suppression avatar %s pour utilisateur %d: %v", avatarURL.String, userID, err)
 			} else {
 				log.Printf("Avatar S3 pour utilisateur %d supprimé.", userID)
@@ -551,7 +544,7 @@ func DeleteUserForAdminHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if len(allAdImages) > 0 {
-			if err := awsService.DeleteImages(allAdImages); err != nil {
+			if err := mediaService.DeleteImages(allAdImages); err != nil {
 				log.Printf("ERREUR S3: Echec suppression %d images d'annonces pour utilisateur %d: %v", len(allAdImages), userID, err)
 			} else {
 				log.Printf("%d images d'annonces S3 pour utilisateur %d supprimées.", len(allAdImages), userID)
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"kivendi-backend/config"
+	"kivendi-backend/models"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// viewHistoryLimit est le nombre d'annonces conservées dans l'historique d'un utilisateur
+	viewHistoryLimit = 200
+	// viewHistoryMaxPageSize borne la taille d'une page de l'historique
+	viewHistoryMaxPageSize = 50
+)
+
+// ViewHistoryResponse est une page de l'historique des annonces consultées
+type ViewHistoryResponse struct {
+	Ads            []models.Ad `json:"ads"`
+	Page           int         `json:"page"`
+	Limit          int         `json:"limit"`
+	HistoryEnabled bool        `json:"history_enabled"`
+}
+
+// recordUserAdView mémorise la consultation d'une annonce par un utilisateur connecté (une ligne par annonce,
+// alimentant l'historique et le fil personnalisé). counted indique si la vue a été comptée (hors fenêtre de
+// dédoublonnage) : seules ces vues incrémentent view_count, utilisé par le fil personnalisé. Rien n'est
+// enregistré si l'utilisateur a désactivé l'historique ; seules ses viewHistoryLimit dernières annonces sont conservées.
+func recordUserAdView(userID, adID int, counted bool) {
+	var inserted bool
+	err := config.DB.QueryRow(`
+		INSERT INTO user_ad_views (user_id, ad_id)
+		SELECT $1, $2
+		WHERE NOT EXISTS (
+			SELECT 1 FROM user_settings
+			WHERE user_id = $1 AND settings->>'`+userSettingViewHistory+`' = 'false'
+		)
+		ON CONFLICT (user_id, ad_id) DO UPDATE
+		SET view_count = user_ad_views.view_count + CASE WHEN $3 THEN 1 ELSE 0 END, last_viewed_at = NOW()
+		RETURNING (xmax = 0)
+	`, userID, adID, counted).Scan(&inserted)
+	if err != nil {
+		// Aucune ligne : l'historique est désactivé
+		if err != sql.ErrNoRows {
+			log.Printf("Erreur lors de l'enregistrement de la consultation de l'annonce %d par l'utilisateur %d: %v", adID, userID, err)
+		}
+		return
+	}
+	if !inserted {
+		return
+	}
+
+	// Une nouvelle annonce dans l'historique : les plus anciennes au-delà de la limite sont retirées
+	_, err = config.DB.Exec(`
+		DELETE FROM user_ad_views
+		WHERE user_id = $1 AND ad_id NOT IN (
+			SELECT ad_id FROM user_ad_views WHERE user_id = $1 ORDER BY last_viewed_at DESC LIMIT $2
+		)
+	`, userID, viewHistoryLimit)
+	if err != nil {
+		log.Printf("Erreur lors de la purge de l'historique de l'utilisateur %d: %v", userID, err)
+	}
+}
+
+// GetViewHistoryHandler renvoie les annonces consultées par l'utilisateur connecté, de la plus récente à la
+// plus ancienne. Seules les annonces encore visibles sont renvoyées (ni vendues, ni expirées, ni désactivées,
+// rejetées ou masquées par des signalements ; les annonces supprimées disparaissent de l'historique).
+// Pagination par page/limit (20 par défaut).
+func GetViewHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 20
+	}
+	if limit > viewHistoryMaxPageSize {
+		limit = viewHistoryMaxPageSize
+	}
+
+	settings, err := loadUserSettings(r.Context(), userID)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération des paramètres de l'utilisateur %d: %v", userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	enabled, _ := settings[userSettingViewHistory].(bool)
+
+	rows, err := config.DB.QueryContext(r.Context(), `
+		SELECT
+			a.id, a.title, a.description, a.price, a.images, a.form_data,
+			a.city, a.phone_number, a.is_phone_visible, a.latitude, a.longitude,
+			u.first_name, u.last_name, u.shop_name, u.account_type, u.avatar_url,
+			a.is_delivery_available, a.created_at, v.last_viewed_at
+		FROM user_ad_views v
+		JOIN ads a ON a.id = v.ad_id
+		JOIN users u ON a.user_id = u.id
+		WHERE v.user_id = $1 AND `+adVisibleSQL+`
+		ORDER BY v.last_viewed_at DESC, a.id DESC
+		LIMIT $2 OFFSET $3
+	`, userID, limit, (page-1)*limit)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération de l'historique de l'utilisateur %d: %v", userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	ads := []models.Ad{}
+	for rows.Next() {
+		var viewedAt time.Time
+		ad, err := scanAdListRow(rows, &viewedAt)
+		if err != nil {
+			log.Printf("Erreur lors de la lecture de l'historique de l'utilisateur %d: %v", userID, err)
+			http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+			return
+		}
+		ad.ViewedAt = &viewedAt
+		ads = append(ads, ad)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Erreur après l'itération de l'historique de l'utilisateur %d: %v", userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ViewHistoryResponse{Ads: ads, Page: page, Limit: limit, HistoryEnabled: enabled})
+}
+
+// RemoveViewHistoryEntryHandler retire une annonce de l'historique de l'utilisateur connecté
+func RemoveViewHistoryEntryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+
+	adID, err := strconv.Atoi(mux.Vars(r)["adID"])
+	if err != nil {
+		http.Error(w, "ID d'annonce invalide", http.StatusBadRequest)
+		return
+	}
+
+	result, err := config.DB.ExecContext(r.Context(),
+		"DELETE FROM user_ad_views WHERE user_id = $1 AND ad_id = $2", userID, adID)
+	if err != nil {
+		log.Printf("Erreur lors du retrait de l'annonce %d de l'historique de l'utilisateur %d: %v", adID, userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		http.Error(w, "L'annonce n'est pas dans l'historique", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Annonce retirée de l'historique"})
+}
+
+// ClearViewHistoryHandler vide l'historique des annonces consultées de l'utilisateur connecté
+func ClearViewHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(userIDContextKey).(int)
+	if !ok {
+		http.Error(w, "ID utilisateur manquant", http.StatusUnauthorized)
+		return
+	}
+
+	result, err := config.DB.ExecContext(r.Context(), "DELETE FROM user_ad_views WHERE user_id = $1", userID)
+	if err != nil {
+		log.Printf("Erreur lors de la suppression de l'historique de l'utilisateur %d: %v", userID, err)
+		http.Error(w, "Erreur interne du serveur", http.StatusInternalServerError)
+		return
+	}
+	removed, _ := result.RowsAffected()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Historique supprimé",
+		"removed": removed,
+	})
+}
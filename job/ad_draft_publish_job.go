@@ -0,0 +1,116 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"kivendi-backend/config"
+	"kivendi-backend/services"
+)
+
+// PublishScheduledDrafts publie les brouillons dont la date de publication programmée (publish_at) est atteinte.
+// validate est handlers.ValidateScheduledAdDraft : chaque brouillon est revérifié avec les règles et les paramètres
+// en vigueur, comme une publication immédiate ; un brouillon refusé voit sa programmation annulée.
+// Les annonces créées suivent app_settings.auto_validate_ads, comme celles publiées depuis l'application.
+func PublishScheduledDrafts(validate func(ctx context.Context, draftID int) (string, error)) {
+	rows, err := config.DB.Query(`SELECT id FROM ad_drafts WHERE publish_at IS NOT NULL AND publish_at <= NOW() ORDER BY publish_at`)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération des brouillons à publier: %v", err)
+		return
+	}
+
+	var draftIDs []int
+	for rows.Next() {
+		var draftID int
+		if err := rows.Scan(&draftID); err != nil {
+			log.Printf("Erreur lors du scan d'un brouillon à publier: %v", err)
+			continue
+		}
+		draftIDs = append(draftIDs, draftID)
+	}
+	rows.Close()
+
+	if len(draftIDs) == 0 {
+		return
+	}
+
+	log.Printf("Publication de %d brouillons programmés...", len(draftIDs))
+	ctx := context.Background()
+	for _, draftID := range draftIDs {
+		reason, err := validate(ctx, draftID)
+		if errors.Is(err, services.ErrDraftNotPublishable) {
+			// Brouillon supprimé entre-temps
+			continue
+		}
+		if err != nil {
+			log.Printf("Erreur lors de la vérification du brouillon %d: %v", draftID, err)
+			continue
+		}
+		if reason != "" {
+			cancelDraftSchedule(draftID, reason)
+			continue
+		}
+
+		published, err := services.PublishAdDraft(ctx, draftID, true)
+		if errors.Is(err, services.ErrDraftNotPublishable) {
+			// Brouillon supprimé, ou programmation annulée ou repoussée depuis la sélection
+			continue
+		}
+		if err != nil {
+			log.Printf("Erreur lors de la publication du brouillon %d: %v", draftID, err)
+			continue
+		}
+
+		log.Printf("Brouillon %d publié. ID de l'annonce: %d", draftID, published.AdID)
+		if published.IsValidated {
+			services.NotifyAdValidated(ctx, published.UserID, published.AdID, published.Title)
+			continue
+		}
+		message := fmt.Sprintf("Votre annonce « %s » a été publiée et est en attente de validation.", published.Title)
+		go services.CreateNotification(published.UserID, "ad_draft_published", "Votre annonce programmée a été publiée", message, map[string]interface{}{
+			"adId": published.AdID,
+		})
+	}
+}
+
+// cancelDraftSchedule retire la date de publication d'un brouillon qui ne peut pas être publié et prévient son
+// auteur ; reason complète « n'a pas pu être publié car ... »
+func cancelDraftSchedule(draftID int, reason string) {
+	var userID int
+	var title string
+	err := config.DB.QueryRow(`
+		UPDATE ad_drafts SET publish_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND publish_at IS NOT NULL AND publish_at <= NOW()
+		RETURNING user_id, COALESCE(title, '')
+	`, draftID).Scan(&userID, &title)
+	if err != nil {
+		// Brouillon supprimé, ou programmation annulée ou repoussée entre-temps : rien à faire
+		return
+	}
+
+	log.Printf("Publication programmée du brouillon %d annulée : %s", draftID, reason)
+	message := fmt.Sprintf("Votre brouillon « %s » n'a pas pu être publié car %s. Modifiez-le puis publiez-le à nouveau.", title, reason)
+	go services.CreateNotification(userID, "ad_draft_publish_failed", "Publication programmée annulée", message, map[string]interface{}{
+		"draftId": draftID,
+	})
+}
+
+// StartAdDraftPublishJob démarre le job de publication des brouillons programmés.
+// validate est handlers.ValidateScheduledAdDraft (voir PublishScheduledDrafts).
+func StartAdDraftPublishJob(validate func(ctx context.Context, draftID int) (string, error)) {
+	// Exécuter immédiatement au démarrage
+	PublishScheduledDrafts(validate)
+
+	// Puis exécuter toutes les minutes
+	ticker := time.NewTicker(1 * time.Minute)
+	go func() {
+		for range ticker.C {
+			PublishScheduledDrafts(validate)
+		}
+	}()
+
+	log.Println("Job de publication des brouillons programmés démarré (exécution toutes les minutes)")
+}
@@ -0,0 +1,160 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"kivendi-backend/config"
+	"kivendi-backend/services"
+)
+
+// ProcessAdExpiry applique la durée de publication des annonces (app_settings.max_ad_duration_days) :
+// date d'expiration des annonces qui n'en ont pas, rappels N jours avant et passage à l'état expiré.
+func ProcessAdExpiry() {
+	log.Println("Début du traitement de l'expiration des annonces...")
+
+	settings := services.GetAdSettings()
+	durationDays, reminderDays := settings.MaxAdDurationDays, settings.AdExpiryReminderDays
+	if durationDays <= 0 {
+		log.Println("Expiration des annonces désactivée (max_ad_duration_days = 0)")
+		return
+	}
+
+	// 1. Fixer une date d'expiration aux annonces qui n'en ont pas (annonces antérieures à l'expiration).
+	// Les annonces déjà trop anciennes reçoivent un délai de grâce pour que le rappel puisse être envoyé.
+	result, err := config.DB.Exec(`
+		UPDATE ads
+		SET expires_at = GREATEST(created_at + make_interval(days => $1), NOW() + make_interval(days => $2 + 1))
+		WHERE expires_at IS NULL AND is_expired = FALSE AND is_sold = FALSE
+	`, durationDays, reminderDays)
+	if err != nil {
+		log.Printf("Erreur lors de l'initialisation des dates d'expiration: %v", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("%d annonces ont reçu une date d'expiration", n)
+	}
+
+	// 2. Rappels avant expiration (une seule fois par période de publication)
+	if reminderDays > 0 {
+		sendExpiryReminders(reminderDays)
+	}
+
+	// 3. Passage à l'état expiré : l'annonce disparaît des flux publics
+	expireAds()
+
+	log.Println("Traitement de l'expiration des annonces terminé")
+}
+
+// sendExpiryReminders prévient les vendeurs dont l'annonce visible expire dans moins de reminderDays jours
+func sendExpiryReminders(reminderDays int) {
+	rows, err := config.DB.Query(`
+		UPDATE ads
+		SET expiry_reminder_sent_at = NOW()
+		WHERE is_expired = FALSE AND is_sold = FALSE
+		AND is_validated = TRUE AND is_deactivated = FALSE AND is_rejected = FALSE
+		AND expiry_reminder_sent_at IS NULL
+		AND expires_at > NOW() AND expires_at <= NOW() + make_interval(days => $1)
+		RETURNING id, user_id, title, expires_at
+	`, reminderDays)
+	if err != nil {
+		log.Printf("Erreur lors de la sélection des annonces à rappeler: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var adID, userID int
+		var adTitle string
+		var expiresAt time.Time
+		if err := rows.Scan(&adID, &userID, &adTitle, &expiresAt); err != nil {
+			log.Printf("Erreur lors du scan d'une annonce à rappeler: %v", err)
+			continue
+		}
+
+		daysLeft := int(math.Ceil(time.Until(expiresAt).Hours() / 24))
+		if daysLeft < 1 {
+			daysLeft = 1
+		}
+
+		message := fmt.Sprintf("Votre annonce « %s » expire dans %d jour(s). Renouvelez-la pour qu'elle reste visible.", adTitle, daysLeft)
+		go services.CreateNotification(userID, "ad_expiring_soon", "Votre annonce expire bientôt", message, map[string]interface{}{
+			"adId":      adID,
+			"expiresAt": expiresAt,
+		})
+		if services.PushSvc != nil {
+			services.PushSvc.SendAdExpiringSoonPush(context.Background(), userID, adTitle, adID, daysLeft)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Erreur après l'itération des annonces à rappeler: %v", err)
+	}
+
+	log.Printf("%d rappels d'expiration envoyés", count)
+}
+
+// expireAds passe à l'état expiré les annonces dont la date d'expiration est dépassée et prévient les vendeurs
+func expireAds() {
+	rows, err := config.DB.Query(`
+		UPDATE ads
+		SET is_expired = TRUE, expired_at = NOW(), updated_at = NOW()
+		WHERE is_expired = FALSE AND is_sold = FALSE
+		AND expires_at <= NOW()
+		RETURNING id, user_id, title, (is_validated AND NOT is_deactivated AND NOT is_rejected)
+	`)
+	if err != nil {
+		log.Printf("Erreur lors de l'expiration des annonces: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var adID, userID int
+		var adTitle string
+		var wasVisible bool
+		if err := rows.Scan(&adID, &userID, &adTitle, &wasVisible); err != nil {
+			log.Printf("Erreur lors du scan d'une annonce expirée: %v", err)
+			continue
+		}
+		count++
+
+		// Seules les annonces qui étaient visibles font l'objet d'une notification
+		if !wasVisible {
+			continue
+		}
+		message := fmt.Sprintf("Votre annonce « %s » n'est plus visible. Renouvelez-la depuis « Mes annonces ».", adTitle)
+		go services.CreateNotification(userID, "ad_expired", "Votre annonce a expiré", message, map[string]interface{}{
+			"adId": adID,
+		})
+		if services.PushSvc != nil {
+			services.PushSvc.SendAdExpiredPush(context.Background(), userID, adTitle, adID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Erreur après l'itération des annonces expirées: %v", err)
+	}
+
+	log.Printf("%d annonces expirées", count)
+}
+
+// StartAdExpiryJob démarre le job périodique d'expiration des annonces
+func StartAdExpiryJob() {
+	// Exécuter immédiatement au démarrage
+	ProcessAdExpiry()
+
+	// Puis exécuter toutes les heures
+	ticker := time.NewTicker(1 * time.Hour)
+	go func() {
+		for range ticker.C {
+			ProcessAdExpiry()
+		}
+	}()
+
+	log.Println("Job d'expiration des annonces démarré (exécution toutes les heures)")
+}
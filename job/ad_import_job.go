@@ -0,0 +1,24 @@
+package jobs
+
+import (
+	"log"
+	"time"
+)
+
+// StartAdImportJob démarre la reprise périodique des imports d'annonces en attente.
+// Les imports sont lancés dès leur création ; ce job reprend ceux interrompus (redémarrage, erreur).
+// process est handlers.ProcessPendingAdImports (le traitement réutilise la validation des annonces).
+func StartAdImportJob(process func()) {
+	// Exécuter immédiatement au démarrage
+	go process()
+
+	// Puis exécuter toutes les 5 minutes
+	ticker := time.NewTicker(5 * time.Minute)
+	go func() {
+		for range ticker.C {
+			process()
+		}
+	}()
+
+	log.Println("Job des imports d'annonces démarré (exécution toutes les 5 minutes)")
+}
@@ -0,0 +1,64 @@
+package jobs
+
+import (
+	"log"
+	"time"
+
+	"kivendi-backend/config"
+	"kivendi-backend/services"
+)
+
+// RollupAdViews agrège les vues enregistrées dans ad_view_events en compteurs quotidiens (ad_view_daily)
+// et reporte le total dans ads.views_count, conservé comme total dérivé pour les réponses existantes.
+func RollupAdViews() {
+	var rolledUp int
+	err := config.DB.QueryRow(`
+		WITH batch AS (
+			UPDATE ad_view_events SET rolled_up = TRUE
+			WHERE rolled_up = FALSE
+			RETURNING ad_id, viewed_at
+		), daily AS (
+			INSERT INTO ad_view_daily (ad_id, day, views)
+			SELECT ad_id, viewed_at::date, COUNT(*) FROM batch GROUP BY ad_id, viewed_at::date
+			ON CONFLICT (ad_id, day) DO UPDATE SET views = ad_view_daily.views + EXCLUDED.views
+		), totals AS (
+			UPDATE ads a SET views_count = COALESCE(a.views_count, 0) + t.views
+			FROM (SELECT ad_id, COUNT(*) AS views FROM batch GROUP BY ad_id) t
+			WHERE a.id = t.ad_id
+		)
+		SELECT COUNT(*) FROM batch
+	`).Scan(&rolledUp)
+	if err != nil {
+		log.Printf("Erreur lors de l'agrégation des vues d'annonces: %v", err)
+		return
+	}
+
+	// Les événements agrégés ne servent plus qu'au dédoublonnage : on les garde le temps de la fenêtre
+	_, err = config.DB.Exec(`
+		DELETE FROM ad_view_events
+		WHERE rolled_up = TRUE AND viewed_at < NOW() - make_interval(secs => $1)
+	`, services.AdViewDedupWindow.Seconds())
+	if err != nil {
+		log.Printf("Erreur lors de la purge des vues d'annonces agrégées: %v", err)
+	}
+
+	if rolledUp > 0 {
+		log.Printf("%d vues d'annonces agrégées", rolledUp)
+	}
+}
+
+// StartAdViewRollupJob démarre l'agrégation périodique des vues d'annonces
+func StartAdViewRollupJob() {
+	// Exécuter immédiatement au démarrage
+	RollupAdViews()
+
+	// Puis exécuter toutes les 5 minutes
+	ticker := time.NewTicker(5 * time.Minute)
+	go func() {
+		for range ticker.C {
+			RollupAdViews()
+		}
+	}()
+
+	log.Println("Job d'agrégation des vues d'annonces démarré (exécution toutes les 5 minutes)")
+}
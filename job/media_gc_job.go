@@ -0,0 +1,20 @@
+package jobs
+
+import (
+	"log"
+	"time"
+)
+
+// StartMediaGCJob démarre le nettoyage quotidien des fichiers orphelins du stockage.
+// run est handlers.RunScheduledMediaGC (le service de fichiers est injecté dans le package handlers).
+// Pas d'exécution au démarrage : un redéploiement ne doit pas relancer un parcours complet du stockage.
+func StartMediaGCJob(run func()) {
+	ticker := time.NewTicker(24 * time.Hour)
+	go func() {
+		for range ticker.C {
+			run()
+		}
+	}()
+
+	log.Println("Job de nettoyage des fichiers orphelins démarré (exécution toutes les 24 heures)")
+}
@@ -0,0 +1,297 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"kivendi-backend/config"
+	"kivendi-backend/models"
+	"kivendi-backend/services"
+
+	"github.com/lib/pq"
+)
+
+// NotifyFunc envoie un message sur le WebSocket de notifications d'un utilisateur
+type NotifyFunc func(userID int, message []byte)
+
+// maxMatchesPerRun limite le nombre de nouvelles annonces enregistrées par recherche et par passage
+const maxMatchesPerRun = 50
+
+// savedSearchCriteria regroupe les critères d'une recherche sauvegardée chargés par le job
+type savedSearchCriteria struct {
+	ID                  int
+	UserID              int
+	Name                string
+	Query               sql.NullString
+	City                sql.NullString
+	CategoryID          sql.NullInt64
+	SubCategoryID       sql.NullInt64
+	MinPrice            sql.NullFloat64
+	MaxPrice            sql.NullFloat64
+	IsDeliveryAvailable sql.NullBool
+	Latitude            sql.NullFloat64
+	Longitude           sql.NullFloat64
+	RadiusKm            sql.NullFloat64
+	DeliveryMode        string
+	LastNotifiedAt      sql.NullTime
+	CreatedAt           time.Time
+}
+
+// matchedAd représente une annonce en attente d'alerte
+type matchedAd struct {
+	ID    int
+	Title string
+}
+
+// ProcessSavedSearchAlerts recherche les nouvelles annonces validées pour chaque recherche sauvegardée
+// et alerte les propriétaires (immédiatement ou via le récapitulatif quotidien).
+func ProcessSavedSearchAlerts(notify NotifyFunc) {
+	log.Println("Début du traitement des alertes de recherches sauvegardées...")
+
+	rows, err := config.DB.Query(`
+		SELECT id, user_id, name, query, city, category_id, sub_category_id,
+			min_price, max_price, is_delivery_available, latitude, longitude, radius_km,
+			delivery_mode, last_notified_at, created_at
+		FROM saved_searches
+		WHERE alerts_enabled = TRUE
+	`)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération des recherches sauvegardées: %v", err)
+		return
+	}
+
+	var searches []savedSearchCriteria
+	for rows.Next() {
+		var s savedSearchCriteria
+		err := rows.Scan(
+			&s.ID, &s.UserID, &s.Name, &s.Query, &s.City, &s.CategoryID, &s.SubCategoryID,
+			&s.MinPrice, &s.MaxPrice, &s.IsDeliveryAvailable, &s.Latitude, &s.Longitude, &s.RadiusKm,
+			&s.DeliveryMode, &s.LastNotifiedAt, &s.CreatedAt,
+		)
+		if err != nil {
+			log.Printf("Erreur lors du scan d'une recherche sauvegardée: %v", err)
+			continue
+		}
+		searches = append(searches, s)
+	}
+	rows.Close()
+
+	alertsSent := 0
+	for _, s := range searches {
+		if err := recordNewMatches(s); err != nil {
+			log.Printf("Erreur lors de la recherche de nouvelles annonces pour la recherche %d: %v", s.ID, err)
+			continue
+		}
+
+		// Récapitulatif quotidien : au plus une alerte toutes les 24 heures
+		if s.DeliveryMode == models.SavedSearchDeliveryDaily && s.LastNotifiedAt.Valid &&
+			time.Since(s.LastNotifiedAt.Time) < 24*time.Hour {
+			continue
+		}
+
+		pending, err := pendingMatches(s.ID)
+		if err != nil {
+			log.Printf("Erreur lors de la récupération des annonces en attente pour la recherche %d: %v", s.ID, err)
+			continue
+		}
+		if len(pending) == 0 {
+			continue
+		}
+
+		if err := sendSavedSearchAlert(s, pending, notify); err != nil {
+			log.Printf("Erreur lors de l'envoi de l'alerte pour la recherche %d: %v", s.ID, err)
+			continue
+		}
+		alertsSent++
+	}
+
+	log.Printf("Traitement des recherches sauvegardées terminé: %d recherches, %d alertes envoyées", len(searches), alertsSent)
+}
+
+// recordNewMatches enregistre les annonces validées (ou revalidées) depuis la création de la recherche
+// qui correspondent à ses critères et n'ont pas encore été signalées. La fenêtre porte sur validated_at :
+// une annonce déposée avant la recherche mais validée après par la modération est bien signalée.
+func recordNewMatches(s savedSearchCriteria) error {
+	whereClauses := []string{
+		"a.is_validated = TRUE",
+		"a.is_deactivated = FALSE",
+		"a.is_rejected = FALSE",
+		"a.is_sold = FALSE",
+		"a.is_expired = FALSE",
+		"a.validated_at > $2",
+		"a.user_id <> $3",
+		"NOT EXISTS (SELECT 1 FROM saved_search_matches m WHERE m.saved_search_id = $1 AND m.ad_id = a.id)",
+	}
+	args := []interface{}{s.ID, s.CreatedAt, s.UserID}
+	argIndex := 4
+
+	if s.Query.Valid && s.Query.String != "" {
+		whereClauses = append(whereClauses,
+			fmt.Sprintf("a.search_vector @@ websearch_to_tsquery('french_unaccent', $%d)", argIndex))
+		args = append(args, s.Query.String)
+		argIndex++
+	}
+	if s.SubCategoryID.Valid {
+		whereClauses = append(whereClauses, fmt.Sprintf("a.sub_category_id = $%d", argIndex))
+		args = append(args, s.SubCategoryID.Int64)
+		argIndex++
+	} else if s.CategoryID.Valid {
+		whereClauses = append(whereClauses, fmt.Sprintf("sc.category_id = $%d", argIndex))
+		args = append(args, s.CategoryID.Int64)
+		argIndex++
+	}
+	if s.City.Valid && s.City.String != "" {
+		whereClauses = append(whereClauses,
+			fmt.Sprintf(`REPLACE(REPLACE(LOWER(a.city), '-', ''), ' ', '') = REPLACE(REPLACE(LOWER($%d), '-', ''), ' ', '')`, argIndex))
+		args = append(args, s.City.String)
+		argIndex++
+	}
+	if s.MinPrice.Valid {
+		whereClauses = append(whereClauses, fmt.Sprintf("a.price >= $%d", argIndex))
+		args = append(args, s.MinPrice.Float64)
+		argIndex++
+	}
+	if s.MaxPrice.Valid {
+		whereClauses = append(whereClauses, fmt.Sprintf("a.price <= $%d", argIndex))
+		args = append(args, s.MaxPrice.Float64)
+		argIndex++
+	}
+	if s.IsDeliveryAvailable.Valid {
+		whereClauses = append(whereClauses, fmt.Sprintf("a.is_delivery_available = $%d", argIndex))
+		args = append(args, s.IsDeliveryAvailable.Bool)
+		argIndex++
+	}
+	if s.RadiusKm.Valid && s.Latitude.Valid && s.Longitude.Valid {
+		whereClauses = append(whereClauses, fmt.Sprintf(`(6371 * acos(LEAST(1.0, GREATEST(-1.0,
+			cos(radians($%d)) * cos(radians(a.latitude)) * cos(radians(a.longitude) - radians($%d)) +
+			sin(radians($%d)) * sin(radians(a.latitude)))))) <= $%d`, argIndex, argIndex+1, argIndex, argIndex+2))
+		args = append(args, s.Latitude.Float64, s.Longitude.Float64, s.RadiusKm.Float64)
+		argIndex += 3
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO saved_search_matches (saved_search_id, ad_id)
+		SELECT $1, a.id
+		FROM ads a
+		JOIN sub_categories sc ON a.sub_category_id = sc.id
+		WHERE %s
+		ORDER BY a.validated_at ASC
+		LIMIT %d
+		ON CONFLICT DO NOTHING
+	`, strings.Join(whereClauses, " AND "), maxMatchesPerRun)
+
+	_, err := config.DB.Exec(query, args...)
+	return err
+}
+
+// pendingMatches renvoie les annonces trouvées mais pas encore signalées, toujours visibles
+func pendingMatches(savedSearchID int) ([]matchedAd, error) {
+	rows, err := config.DB.Query(`
+		SELECT a.id, a.title
+		FROM saved_search_matches m
+		JOIN ads a ON m.ad_id = a.id
+		WHERE m.saved_search_id = $1
+		AND m.notified_at IS NULL
+		AND a.is_validated = TRUE AND a.is_deactivated = FALSE AND a.is_rejected = FALSE AND a.is_sold = FALSE AND a.is_expired = FALSE
+		ORDER BY a.created_at DESC
+	`, savedSearchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ads []matchedAd
+	for rows.Next() {
+		var ad matchedAd
+		if err := rows.Scan(&ad.ID, &ad.Title); err != nil {
+			return nil, err
+		}
+		ads = append(ads, ad)
+	}
+	return ads, rows.Err()
+}
+
+// sendSavedSearchAlert notifie le propriétaire (table notifications, push FCM et WebSocket)
+// puis marque les annonces comme signalées.
+func sendSavedSearchAlert(s savedSearchCriteria, ads []matchedAd, notify NotifyFunc) error {
+	adIDs := make([]int, len(ads))
+	for i, ad := range ads {
+		adIDs[i] = ad.ID
+	}
+
+	notifType := "saved_search_alert"
+	title := fmt.Sprintf("Nouvelles annonces pour « %s »", s.Name)
+	message := fmt.Sprintf("%d nouvelles annonces correspondent à votre recherche.", len(ads))
+	if s.DeliveryMode == models.SavedSearchDeliveryDaily {
+		notifType = "saved_search_digest"
+		message = fmt.Sprintf("Votre récapitulatif du jour : %d nouvelles annonces correspondent à votre recherche.", len(ads))
+	}
+	if len(ads) == 1 {
+		title = fmt.Sprintf("Nouvelle annonce pour « %s »", s.Name)
+		message = ads[0].Title
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE saved_search_matches SET notified_at = NOW()
+		WHERE saved_search_id = $1 AND ad_id = ANY($2)
+	`, s.ID, pq.Array(adIDs))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE saved_searches SET last_notified_at = NOW() WHERE id = $1`, s.ID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	services.CreateNotification(s.UserID, notifType, title, message, map[string]interface{}{
+		"savedSearchId": s.ID,
+		"adId":          adIDs[0],
+		"adIds":         adIDs,
+	})
+
+	if services.PushSvc != nil {
+		services.PushSvc.SendSavedSearchAlertPush(context.Background(), s.UserID, s.ID, s.Name, len(ads), ads[0].ID, ads[0].Title)
+	}
+
+	if notify != nil {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"type":            notifType,
+			"saved_search_id": s.ID,
+			"ad_ids":          adIDs,
+		})
+		notify(s.UserID, payload)
+	}
+
+	log.Printf("Alerte '%s' envoyée à l'utilisateur %d pour la recherche %d (%d annonces)", notifType, s.UserID, s.ID, len(ads))
+	return nil
+}
+
+// StartSavedSearchAlertJob démarre le job périodique des alertes de recherches sauvegardées
+func StartSavedSearchAlertJob(notify NotifyFunc) {
+	// Exécuter immédiatement au démarrage
+	ProcessSavedSearchAlerts(notify)
+
+	// Puis exécuter toutes les 15 minutes
+	ticker := time.NewTicker(15 * time.Minute)
+	go func() {
+		for range ticker.C {
+			ProcessSavedSearchAlerts(notify)
+		}
+	}()
+
+	log.Println("Job des alertes de recherches sauvegardées démarré (exécution toutes les 15 minutes)")
+}
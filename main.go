@@ -6,6 +6,9 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	//"github.com/joho/godotenv"
 	"github.com/rs/cors" // NOUVEAU : Importer la bibliothèque CORS
@@ -24,8 +27,12 @@ func main() {
 		//log.Fatal("Erreur lors du chargement du fichier .env")
 	//}
 
-	// Initialisez le service AWS
-	//handlers.InitAWSService()
+	// Initialise le stockage des fichiers uploadés (S3 ou disque local selon STORAGE_BACKEND)
+	storage, err := services.NewStorageFromEnv()
+	if err != nil {
+		log.Fatalf("Échec de l'initialisation du stockage des fichiers: %v", err)
+	}
+	handlers.SetMediaService(services.NewMediaService(storage))
 
 	// ✅ CORRECTION DE L'INITIALISATION DU SERVICE PUSH
 	// Appel correct à la fonction dans le package 'services'
@@ -35,6 +42,8 @@ func main() {
 
 	config.InitKKiaPay()
 	log.Println("KKiaPay initialisé")
+	// Liens de partage des annonces (stores, site web, liens universels)
+	config.InitAppLinks()
 	// Définit la clé JWT dans le package handlers
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
@@ -62,6 +71,21 @@ func main() {
 
 	// Démarrer le job de nettoyage des boosts expirés
 	jobs.StartBoostCleanupJob()
+	// Démarrer le job des alertes de recherches sauvegardées (notifications WebSocket via handlers.NotifyUser)
+	jobs.StartSavedSearchAlertJob(handlers.NotifyUser)
+	// Démarrer le job d'expiration des annonces (app_settings.max_ad_duration_days)
+	jobs.StartAdExpiryJob()
+	// Démarrer le job de publication des brouillons programmés (ad_drafts.publish_at)
+	jobs.StartAdDraftPublishJob(handlers.ValidateScheduledAdDraft)
+	// Démarrer l'écriture par lots des vues d'annonces et leur agrégation quotidienne
+	services.StartAdViewFlusher()
+	jobs.StartAdViewRollupJob()
+	// Démarrer la reprise des imports d'annonces en attente (comptes professionnels)
+	jobs.StartAdImportJob(handlers.ProcessPendingAdImports)
+	// Démarrer le nettoyage quotidien des fichiers orphelins du stockage
+	jobs.StartMediaGCJob(handlers.RunScheduledMediaGC)
+	// Calculer l'empreinte des titres des annonces existantes (détection des doublons)
+	go services.BackfillAdTitleFingerprints()
 	// Configure le routeur
 	router := routes.SetupRoutes()
 
@@ -84,5 +108,24 @@ func main() {
 
 	fmt.Printf("Serveur démarré sur le port %s...\n", port)
 	// MODIFIÉ : Utiliser le handler avec CORS au lieu du routeur seul
-	log.Fatal(http.ListenAndServe(":"+port, handler))
+	server := &http.Server{Addr: ":" + port, Handler: handler}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// Arrêt propre (SIGINT / SIGTERM) : terminer les requêtes en cours puis écrire les vues en tampon
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	log.Println("Arrêt du serveur...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Erreur lors de l'arrêt du serveur: %v", err)
+	}
+	services.FlushAdViews()
+	log.Println("Serveur arrêté")
 }
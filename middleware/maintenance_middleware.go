@@ -88,7 +88,7 @@ func CheckMaintenanceMode(next http.Handler) http.Handler {
 		}
 
 		// 2. Vérifier l'IP de l'utilisateur
-		clientIP := getClientIP(r)
+		clientIP := GetClientIP(r)
 		for _, allowedIP := range maintenance.AllowedIPAddresses {
 			if clientIP == allowedIP {
 				next.ServeHTTP(w, r)
@@ -110,8 +110,8 @@ func CheckMaintenanceMode(next http.Handler) http.Handler {
 	})
 }
 
-// getClientIP récupère l'adresse IP du client
-func getClientIP(r *http.Request) string {
+// GetClientIP récupère l'adresse IP du client (en-têtes de proxy, sinon RemoteAddr)
+func GetClientIP(r *http.Request) string {
 	// Vérifier les headers de proxy
 	ip := r.Header.Get("X-Real-IP")
 	if ip != "" {
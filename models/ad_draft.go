@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// Statuts d'un brouillon d'annonce
+const (
+	AdDraftStatusDraft     = "draft"     // En cours de rédaction
+	AdDraftStatusScheduled = "scheduled" // Publication programmée à publish_at
+)
+
+// AdDraft représente une annonce en cours de rédaction. Tous les champs sont facultatifs
+// tant que le brouillon n'est pas publié ; MissingFields liste ceux qui manquent pour la publication.
+type AdDraft struct {
+	ID                  int                    `json:"id"`
+	UserID              int                    `json:"user_id"`
+	Title               string                 `json:"title"`
+	Description         string                 `json:"description"`
+	Price               *float64               `json:"price"`
+	SubCategoryID       *int                   `json:"sub_category_id"`
+	Images              []string               `json:"images"`
+	FormData            map[string]interface{} `json:"form_data"`
+	City                string                 `json:"city"`
+	PhoneNumber         string                 `json:"phone_number"`
+	IsPhoneVisible      bool                   `json:"is_phone_visible"`
+	IsDeliveryAvailable bool                   `json:"is_delivery_available"`
+	Latitude            *float64               `json:"latitude"`
+	Longitude           *float64               `json:"longitude"`
+	PublishAt           *time.Time             `json:"publish_at,omitempty"`
+	Status              string                 `json:"status"`
+	MissingFields       []string               `json:"missing_fields"`
+	CreatedAt           time.Time              `json:"created_at"`
+	UpdatedAt           time.Time              `json:"updated_at"`
+}
+
+// ComputeMissingFields renvoie les champs obligatoires encore absents pour publier le brouillon
+func (d *AdDraft) ComputeMissingFields() []string {
+	missing := []string{}
+	if d.Title == "" {
+		missing = append(missing, "title")
+	}
+	if d.Description == "" {
+		missing = append(missing, "description")
+	}
+	if d.Price == nil {
+		missing = append(missing, "price")
+	}
+	if d.SubCategoryID == nil {
+		missing = append(missing, "sub_category_id")
+	}
+	if len(d.Images) == 0 {
+		missing = append(missing, "images")
+	}
+	return missing
+}
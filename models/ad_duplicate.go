@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Raisons pour lesquelles une annonce est signalée comme doublon probable
+const (
+	AdDuplicateReasonTitle = "title" // Même titre normalisé
+	AdDuplicateReasonImage = "image" // Image visuellement identique (empreinte perceptuelle proche)
+)
+
+// AdImageMatch associe une image de l'annonce examinée à une image similaire d'une autre annonce
+type AdImageMatch struct {
+	Image        string `json:"image"`
+	MatchedImage string `json:"matched_image"`
+	Distance     int    `json:"distance"` // 0 = empreintes identiques
+}
+
+// AdDuplicateCandidate est une annonce ressemblant à l'annonce examinée (vue de modération)
+type AdDuplicateCandidate struct {
+	AdID           int            `json:"ad_id"`
+	Title          string         `json:"title"`
+	UserID         int            `json:"user_id"`
+	SellerName     string         `json:"seller_name"`
+	SameSeller     bool           `json:"same_seller"`
+	IsValidated    bool           `json:"is_validated"`
+	IsSold         bool           `json:"is_sold"`
+	CreatedAt      time.Time      `json:"created_at"`
+	Reasons        []string       `json:"reasons"`
+	MatchingImages []AdImageMatch `json:"matching_images,omitempty"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// Statuts d'un import d'annonces en masse
+const (
+	AdImportStatusPending    = "pending"    // En attente de traitement
+	AdImportStatusProcessing = "processing" // En cours de traitement
+	AdImportStatusCompleted  = "completed"  // Terminé (certaines lignes peuvent être en erreur)
+	AdImportStatusFailed     = "failed"     // Échec global (fichier d'images illisible, etc.)
+)
+
+// AdImportRow est une ligne d'un fichier d'import (CSV ou JSON), conservée telle que reçue.
+// Les valeurs sont converties et validées lors du traitement pour produire des erreurs par ligne.
+type AdImportRow struct {
+	Line                int                    `json:"line"`
+	SKU                 string                 `json:"sku"`
+	Title               string                 `json:"title"`
+	Description         string                 `json:"description"`
+	Price               string                 `json:"price"`
+	SubCategoryID       string                 `json:"sub_category_id"`
+	City                string                 `json:"city"`
+	PhoneNumber         string                 `json:"phone_number"`
+	IsPhoneVisible      string                 `json:"is_phone_visible"`
+	IsDeliveryAvailable string                 `json:"is_delivery_available"`
+	Latitude            string                 `json:"latitude"`
+	Longitude           string                 `json:"longitude"`
+	Images              []string               `json:"images"` // URLs http(s) ou noms de fichiers de l'archive zip
+	FormData            map[string]interface{} `json:"form_data"`
+}
+
+// AdImportRowError liste les erreurs d'une ligne, par champ
+type AdImportRowError struct {
+	Line   int               `json:"line"`
+	SKU    string            `json:"sku,omitempty"`
+	Errors map[string]string `json:"errors"`
+}
+
+// AdImportJob représente un import d'annonces et son avancement
+type AdImportJob struct {
+	ID             int                `json:"id"`
+	Status         string             `json:"status"`
+	FileName       string             `json:"file_name"`
+	FileFormat     string             `json:"file_format"`
+	HasArchive     bool               `json:"has_archive"`
+	TotalRows      int                `json:"total_rows"`
+	ProcessedRows  int                `json:"processed_rows"`
+	CreatedCount   int                `json:"created_count"`
+	UpdatedCount   int                `json:"updated_count"`
+	UnchangedCount int                `json:"unchanged_count"`
+	FailedCount    int                `json:"failed_count"`
+	RowErrors      []AdImportRowError `json:"row_errors"`
+	ErrorMessage   *string            `json:"error_message,omitempty"`
+	CreatedAt      time.Time          `json:"created_at"`
+	StartedAt      *time.Time         `json:"started_at,omitempty"`
+	FinishedAt     *time.Time         `json:"finished_at,omitempty"`
+}
@@ -0,0 +1,74 @@
+package models
+
+import "time"
+
+// Motifs de signalement d'une annonce
+const (
+	AdReportReasonScam          = "scam"            // Arnaque ou annonce frauduleuse
+	AdReportReasonProhibited    = "prohibited_item" // Article interdit à la vente
+	AdReportReasonWrongCategory = "wrong_category"  // Mauvaise catégorie
+	AdReportReasonDuplicate     = "duplicate"       // Annonce publiée en double
+	AdReportReasonOffensive     = "offensive"       // Contenu choquant ou injurieux
+)
+
+// Statuts d'un signalement d'annonce (les mêmes que pour les signalements d'utilisateurs)
+const (
+	AdReportStatusPending   = "pending"   // En attente de modération
+	AdReportStatusResolved  = "resolved"  // Signalement fondé
+	AdReportStatusDismissed = "dismissed" // Signalement rejeté : ne compte plus pour le masquage automatique
+)
+
+// Actions sur l'annonce lors de la résolution d'un signalement (obligatoire tant que l'annonce est masquée
+// par les signalements : un signalement fondé ne doit pas la laisser dans la file de validation ordinaire)
+const (
+	AdReportActionReject     = "reject"     // Rejet de l'annonce (le vendeur peut la corriger et la resoumettre)
+	AdReportActionDeactivate = "deactivate" // Désactivation de l'annonce
+)
+
+// AdReportReason est un motif de signalement proposé aux utilisateurs
+type AdReportReason struct {
+	Code  string `json:"code"`
+	Label string `json:"label"`
+}
+
+// AdReportReasons est la liste fixe des motifs, dans l'ordre d'affichage
+var AdReportReasons = []AdReportReason{
+	{Code: AdReportReasonScam, Label: "Arnaque ou fraude"},
+	{Code: AdReportReasonProhibited, Label: "Article interdit"},
+	{Code: AdReportReasonWrongCategory, Label: "Mauvaise catégorie"},
+	{Code: AdReportReasonDuplicate, Label: "Annonce en double"},
+	{Code: AdReportReasonOffensive, Label: "Contenu choquant"},
+}
+
+// IsValidAdReportReason indique si code fait partie des motifs de signalement
+func IsValidAdReportReason(code string) bool {
+	for _, reason := range AdReportReasons {
+		if reason.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// AdReport est un signalement d'annonce vu par les administrateurs
+type AdReport struct {
+	ID         int       `json:"id"`
+	AdID       int       `json:"ad_id"`
+	ReporterID int       `json:"reporter_id"`
+	Reason     string    `json:"reason"`
+	Comment    *string   `json:"comment"`
+	Status     string    `json:"status"`
+	AdminNotes *string   `json:"admin_notes"`
+	ReviewedBy *int      `json:"reviewed_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// Infos jointes
+	AdTitle       string     `json:"ad_title"`
+	AdOwnerID     int        `json:"ad_owner_id"`
+	AdOwnerName   string     `json:"ad_owner_name"`
+	AdHiddenAt    *time.Time `json:"ad_hidden_at,omitempty"` // Masquage automatique de l'annonce par les signalements
+	AdReportCount int        `json:"ad_report_count"`        // Signalements distincts non rejetés de l'annonce
+	ReporterName  string     `json:"reporter_name"`
+	ReporterEmail string     `json:"reporter_email"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// Origine d'une révision d'annonce
+const (
+	AdRevisionEditorInitial = "initial" // État de l'annonce avant la première modification enregistrée
+	AdRevisionEditorUser    = "user"    // Modification par le vendeur
+	AdRevisionEditorAdmin   = "admin"   // Modification par un modérateur ou un admin
+)
+
+// AdRevision est un instantané complet du contenu d'une annonce après une modification
+type AdRevision struct {
+	ID                 int                    `json:"id"`
+	AdID               int                    `json:"ad_id"`
+	RevisionNumber     int                    `json:"revision_number"`
+	EditorType         string                 `json:"editor_type"`
+	EditorID           *int                   `json:"editor_id,omitempty"`
+	Title              string                 `json:"title"`
+	Description        string                 `json:"description"`
+	Price              float64                `json:"price"`
+	Images             []string               `json:"images"`
+	FormData           map[string]interface{} `json:"form_data"`
+	City               string                 `json:"city"`
+	PhoneNumber        string                 `json:"phone_number"`
+	IsPhoneVisible     bool                   `json:"is_phone_visible"`
+	IsValidatedVersion bool                   `json:"is_validated_version"`
+	ValidatedAt        *time.Time             `json:"validated_at,omitempty"`
+	CreatedAt          time.Time              `json:"created_at"`
+}
+
+// AdRevisionFieldChange décrit la modification d'un champ entre deux versions d'une annonce.
+// Les attributs de form_data apparaissent sous la forme "form_data.<clé>".
+type AdRevisionFieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AdRevisionImagesDiff décrit l'évolution des images entre deux versions
+type AdRevisionImagesDiff struct {
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Reordered bool     `json:"reordered"`
+}
+
+// AdRevisionDiff compare une version de référence (par défaut la dernière version validée) à une version plus récente
+type AdRevisionDiff struct {
+	AdID    int                     `json:"ad_id"`
+	From    *AdRevision             `json:"from"`
+	To      *AdRevision             `json:"to"`
+	Changed bool                    `json:"changed"`
+	Changes []AdRevisionFieldChange `json:"changes"`
+	Images  AdRevisionImagesDiff    `json:"images"`
+}
@@ -57,6 +57,10 @@ type AppSettings struct {
 	RequirePhoneVerification bool `json:"require_phone_verification"`
 	MaxImagesPerAd           int  `json:"max_images_per_ad"`
 	MaxAdDurationDays        int  `json:"max_ad_duration_days"`
+	AdExpiryReminderDays     int  `json:"ad_expiry_reminder_days"`  // Rappel envoyé N jours avant l'expiration
+	PriceDropAlertPercent    int  `json:"price_drop_alert_percent"` // Baisse minimale (%) pour alerter les utilisateurs ayant l'annonce en favori
+	BlockDuplicateAds        bool `json:"block_duplicate_ads"`      // Refuser la republication à l'identique d'une annonce du même vendeur
+	AdReportHideThreshold    int  `json:"ad_report_hide_threshold"` // Nombre de signalements distincts masquant une annonce (0 : jamais)
 
 	// Email (sensible - ne pas exposer en JSON)
 	SMTPHost      string `json:"-"`
@@ -202,6 +206,10 @@ type UpdateAppSettingsRequest struct {
 	RequirePhoneVerification *bool   `json:"require_phone_verification,omitempty"`
 	MaxImagesPerAd           *int    `json:"max_images_per_ad,omitempty"`
 	MaxAdDurationDays        *int    `json:"max_ad_duration_days,omitempty"`
+	AdExpiryReminderDays     *int    `json:"ad_expiry_reminder_days,omitempty"`
+	PriceDropAlertPercent    *int    `json:"price_drop_alert_percent,omitempty"`
+	BlockDuplicateAds        *bool   `json:"block_duplicate_ads,omitempty"`
+	AdReportHideThreshold    *int    `json:"ad_report_hide_threshold,omitempty"`
 
 	// Email (admin uniquement)
 	SMTPHost      *string `json:"smtp_host,omitempty"`
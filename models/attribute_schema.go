@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Types de champs possibles pour un attribut de sous-catégorie
+const (
+	AttributeTypeText      = "text"       // Texte libre (min/max = longueur)
+	AttributeTypeNumber    = "number"     // Nombre décimal (min/max = bornes)
+	AttributeTypeInteger   = "integer"    // Nombre entier (min/max = bornes)
+	AttributeTypeBoolean   = "boolean"    // Oui / Non
+	AttributeTypeEnum      = "enum"       // Une valeur parmi enum_values
+	AttributeTypeMultiEnum = "multi_enum" // Plusieurs valeurs parmi enum_values
+)
+
+// SubCategoryAttribute décrit un attribut typé de ads.form_data pour une sous-catégorie
+// (ex: "marque", "kilometrage", "surface").
+type SubCategoryAttribute struct {
+	ID            int       `json:"id"`
+	SubCategoryID int       `json:"sub_category_id"`
+	Key           string    `json:"key"`
+	Label         string    `json:"label"`
+	FieldType     string    `json:"field_type"`
+	IsRequired    bool      `json:"is_required"`
+	EnumValues    []string  `json:"enum_values"`
+	Unit          *string   `json:"unit,omitempty"`
+	MinValue      *float64  `json:"min_value,omitempty"`
+	MaxValue      *float64  `json:"max_value,omitempty"`
+	DisplayOrder  int       `json:"display_order"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
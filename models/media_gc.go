@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Statuts d'un passage du nettoyage des fichiers orphelins
+const (
+	MediaGCStatusRunning   = "running"   // En cours
+	MediaGCStatusCompleted = "completed" // Terminé
+	MediaGCStatusFailed    = "failed"    // Interrompu par une erreur (stockage ou base indisponible)
+)
+
+// MediaGCOrphan est un fichier du stockage qui n'est plus référencé en base
+type MediaGCOrphan struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	Deleted      bool      `json:"deleted"`
+}
+
+// MediaGCRun est le rapport d'un passage du nettoyage des fichiers orphelins.
+// En mode simulation (dry_run), les orphelins sont listés mais jamais supprimés.
+type MediaGCRun struct {
+	ID               int             `json:"id"`
+	Status           string          `json:"status"`
+	DryRun           bool            `json:"dry_run"`
+	TriggeredBy      *int            `json:"triggered_by,omitempty"` // Admin ayant lancé le passage (absent pour le job planifié)
+	GracePeriodHours int             `json:"grace_period_hours"`
+	ScannedCount     int             `json:"scanned_count"`
+	ScannedBytes     int64           `json:"scanned_bytes"`
+	ReferencedCount  int             `json:"referenced_count"`
+	OrphanCount      int             `json:"orphan_count"`
+	OrphanBytes      int64           `json:"orphan_bytes"`
+	DeletedCount     int             `json:"deleted_count"`
+	FailedCount      int             `json:"failed_count"`
+	Orphans          []MediaGCOrphan `json:"orphans,omitempty"`
+	ErrorMessage     *string         `json:"error_message,omitempty"`
+	StartedAt        time.Time       `json:"started_at"`
+	FinishedAt       *time.Time      `json:"finished_at,omitempty"`
+}
@@ -51,6 +51,8 @@ type Ad struct {
 	IsDeactivated   bool     `json:"is_deactivated"`
 	IsRejected      bool     `json:"is_rejected"`
 	Images          []string `json:"images"`
+	// Variantes (miniature, moyenne, pleine taille en JPEG et WebP) de chaque image, dans le même ordre
+	ImageVariants []ImageVariants `json:"image_variants,omitempty"`
 	//FormData      []byte   `json:"form_data"`
 	FormData            map[string]interface{} `json:"form_data"`
 	City                string                 `json:"city"`
@@ -69,6 +71,35 @@ type Ad struct {
 	IsBoosted      bool       `json:"is_boosted"`
 	BoostExpiresAt *time.Time `json:"boost_expires_at,omitempty"`
 
+	// Expiration (app_settings.max_ad_duration_days) et statut affiché au vendeur
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	IsExpired bool       `json:"is_expired"`
+	Status    string     `json:"status,omitempty"`
+
+	// Modifiée depuis sa dernière version validée (panel admin, voir ad_revisions)
+	EditedSinceValidation bool `json:"edited_since_validation,omitempty"`
+
+	// Masquée automatiquement par les signalements, en attente d'une décision de modération (panel admin)
+	ReportsHiddenAt *time.Time `json:"reports_hidden_at,omitempty"`
+
+	// Doublons probables, du même vendeur ou d'autres comptes (détail d'une annonce dans le panel admin)
+	DuplicateCandidates []AdDuplicateCandidate `json:"duplicate_candidates,omitempty"`
+
+	// Historique des prix, du plus ancien au plus récent (détail d'une annonce)
+	PriceHistory []AdPricePoint `json:"price_history,omitempty"`
+
+	// Distance (km) depuis la position de l'utilisateur, renseignée si lat/lng sont fournis
+	DistanceKm *float64 `json:"distance_km,omitempty"`
+
+	// Score de similarité avec l'annonce consultée (0 à 1), renseigné par les annonces similaires
+	SimilarityScore *float64 `json:"similarity_score,omitempty"`
+
+	// Date de la dernière consultation, renseignée par l'historique des annonces consultées
+	ViewedAt *time.Time `json:"viewed_at,omitempty"`
+
+	// Extraits surlignés renvoyés par la recherche plein texte
+	Highlights *AdHighlights `json:"highlights,omitempty"`
+
 	// Informations de l'utilisateur
 	User struct {
 		ID           int            `json:"id"`
@@ -81,6 +112,56 @@ type Ad struct {
 	} `json:"user"`
 }
 
+// ImageVariants regroupe les URLs des tailles produites pour une image uploadée
+type ImageVariants struct {
+	Thumbnail     string `json:"thumbnail"`
+	ThumbnailWebP string `json:"thumbnail_webp"`
+	Medium        string `json:"medium"`
+	MediumWebP    string `json:"medium_webp"`
+	Full          string `json:"full"`
+	FullWebP      string `json:"full_webp"`
+}
+
+// AdPricePoint est un prix pratiqué par une annonce à partir d'une date donnée
+type AdPricePoint struct {
+	Price     float64   `json:"price"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// AdHighlights contient les extraits d'une annonce où les termes recherchés
+// sont entourés de balises <mark></mark> ; le reste du texte est échappé (HTML)
+type AdHighlights struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// Statuts d'une annonce tels qu'affichés au vendeur (champ Ad.Status)
+const (
+	AdStatusPending     = "pending"     // En attente de validation
+	AdStatusActive      = "active"      // Validée et visible
+	AdStatusRejected    = "rejected"    // Rejetée par la modération
+	AdStatusDeactivated = "deactivated" // Désactivée par la modération
+	AdStatusSold        = "sold"        // Marquée comme vendue
+	AdStatusExpired     = "expired"     // Durée de publication dépassée
+)
+
+// ComputeStatus renvoie le statut de l'annonce à partir de ses indicateurs
+func (a *Ad) ComputeStatus() string {
+	switch {
+	case a.IsSold:
+		return AdStatusSold
+	case a.IsExpired:
+		return AdStatusExpired
+	case a.IsRejected:
+		return AdStatusRejected
+	case a.IsDeactivated:
+		return AdStatusDeactivated
+	case !a.IsValidated:
+		return AdStatusPending
+	}
+	return AdStatusActive
+}
+
 // BoostOffer représente une offre de boost disponible à l'achat
 type BoostOffer struct {
 	ID               int                    `json:"id"`
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Modes de réception des alertes d'une recherche sauvegardée
+const (
+	SavedSearchDeliveryInstant = "instant" // Alerte dès qu'une nouvelle annonce correspond
+	SavedSearchDeliveryDaily   = "daily"   // Récapitulatif quotidien
+)
+
+// SavedSearch représente une recherche sauvegardée par un utilisateur.
+// Les critères reprennent les paramètres de SearchAdsHandler.
+type SavedSearch struct {
+	ID                  int        `json:"id"`
+	UserID              int        `json:"user_id"`
+	Name                string     `json:"name"`
+	Query               string     `json:"q,omitempty"`
+	City                string     `json:"city,omitempty"`
+	CategoryID          *int       `json:"category_id,omitempty"`
+	SubCategoryID       *int       `json:"sub_category_id,omitempty"`
+	MinPrice            *float64   `json:"min_price,omitempty"`
+	MaxPrice            *float64   `json:"max_price,omitempty"`
+	IsDeliveryAvailable *bool      `json:"is_delivery_available,omitempty"`
+	Lat                 *float64   `json:"lat,omitempty"`
+	Lng                 *float64   `json:"lng,omitempty"`
+	RadiusKm            *float64   `json:"radius_km,omitempty"`
+	DeliveryMode        string     `json:"delivery_mode"`
+	AlertsEnabled       bool       `json:"alerts_enabled"`
+	PendingMatches      int        `json:"pending_matches"`
+	LastNotifiedAt      *time.Time `json:"last_notified_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
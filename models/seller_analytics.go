@@ -0,0 +1,112 @@
+package models
+
+import "time"
+
+// AdPerformanceMetrics regroupe les indicateurs d'une annonce (ou d'un ensemble d'annonces) sur une période
+type AdPerformanceMetrics struct {
+	Views                int `json:"views"`
+	FavoritesAdded       int `json:"favorites_added"`
+	ConversationsStarted int `json:"conversations_started"`
+	OffersReceived       int `json:"offers_received"`
+	PhoneReveals         int `json:"phone_reveals"`
+}
+
+// Add cumule les indicateurs de other
+func (m *AdPerformanceMetrics) Add(other AdPerformanceMetrics) {
+	m.Views += other.Views
+	m.FavoritesAdded += other.FavoritesAdded
+	m.ConversationsStarted += other.ConversationsStarted
+	m.OffersReceived += other.OffersReceived
+	m.PhoneReveals += other.PhoneReveals
+}
+
+// SellerAdAnalytics représente les statistiques d'une annonce du vendeur sur la période
+type SellerAdAnalytics struct {
+	AdID      int        `json:"ad_id"`
+	Title     string     `json:"title"`
+	CreatedAt time.Time  `json:"created_at"`
+	IsSold    bool       `json:"is_sold"`
+	SoldAt    *time.Time `json:"sold_at,omitempty"`
+	// Délai de vente en jours (annonces vendues pendant la période)
+	TimeToSaleDays *float64 `json:"time_to_sale_days,omitempty"`
+	AdPerformanceMetrics
+}
+
+// SellerAnalyticsTotals cumule les statistiques de toutes les annonces du vendeur sur la période
+type SellerAnalyticsTotals struct {
+	AdPerformanceMetrics
+	AdsCount              int      `json:"ads_count"`
+	SoldCount             int      `json:"sold_count"`
+	AverageTimeToSaleDays *float64 `json:"average_time_to_sale_days,omitempty"`
+}
+
+// BoostPeriodStats regroupe les indicateurs sur les jours boostés ou non boostés.
+// Days compte des jours-annonces : une annonce en ligne pendant 3 jours compte pour 3.
+type BoostPeriodStats struct {
+	Days                       int     `json:"days"`
+	Views                      int     `json:"views"`
+	FavoritesAdded             int     `json:"favorites_added"`
+	ConversationsStarted       int     `json:"conversations_started"`
+	OffersReceived             int     `json:"offers_received"`
+	PhoneReveals               int     `json:"phone_reveals"`
+	ViewsPerDay                float64 `json:"views_per_day"`
+	FavoritesPerDay            float64 `json:"favorites_per_day"`
+	ConversationsStartedPerDay float64 `json:"conversations_started_per_day"`
+	OffersPerDay               float64 `json:"offers_per_day"`
+	PhoneRevealsPerDay         float64 `json:"phone_reveals_per_day"`
+}
+
+// ComputeAverages calcule les moyennes journalières
+func (s *BoostPeriodStats) ComputeAverages() {
+	if s.Days == 0 {
+		return
+	}
+	s.ViewsPerDay = float64(s.Views) / float64(s.Days)
+	s.FavoritesPerDay = float64(s.FavoritesAdded) / float64(s.Days)
+	s.ConversationsStartedPerDay = float64(s.ConversationsStarted) / float64(s.Days)
+	s.OffersPerDay = float64(s.OffersReceived) / float64(s.Days)
+	s.PhoneRevealsPerDay = float64(s.PhoneReveals) / float64(s.Days)
+}
+
+// BoostComparison compare les périodes boostées (ad_boosts) et non boostées.
+// ViewsUplift est le rapport des vues par jour boosté / non boosté, s'il est calculable.
+type BoostComparison struct {
+	Boosted     BoostPeriodStats `json:"boosted"`
+	NotBoosted  BoostPeriodStats `json:"not_boosted"`
+	ViewsUplift *float64         `json:"views_uplift,omitempty"`
+}
+
+// ComputeUplift calcule les moyennes et le rapport des vues par jour
+func (c *BoostComparison) ComputeUplift() {
+	c.Boosted.ComputeAverages()
+	c.NotBoosted.ComputeAverages()
+	if c.Boosted.Days > 0 && c.NotBoosted.ViewsPerDay > 0 {
+		uplift := c.Boosted.ViewsPerDay / c.NotBoosted.ViewsPerDay
+		c.ViewsUplift = &uplift
+	}
+}
+
+// AdDailyMetrics représente les indicateurs d'une annonce pour un jour donné
+type AdDailyMetrics struct {
+	Day       string `json:"day"` // AAAA-MM-JJ
+	IsBoosted bool   `json:"is_boosted"`
+	AdPerformanceMetrics
+}
+
+// SellerAnalytics est la réponse du tableau de bord vendeur
+type SellerAnalytics struct {
+	From            string                `json:"from"`
+	To              string                `json:"to"`
+	Totals          SellerAnalyticsTotals `json:"totals"`
+	Ads             []SellerAdAnalytics   `json:"ads"`
+	BoostComparison BoostComparison       `json:"boost_comparison"`
+}
+
+// SellerAdAnalyticsDetail est la réponse détaillée (série quotidienne) pour une annonce
+type SellerAdAnalyticsDetail struct {
+	From            string            `json:"from"`
+	To              string            `json:"to"`
+	Ad              SellerAdAnalytics `json:"ad"`
+	Daily           []AdDailyMetrics  `json:"daily"`
+	BoostComparison BoostComparison   `json:"boost_comparison"`
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"kivendi-backend/handlers"
+	"kivendi-backend/services"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -14,6 +15,13 @@ func SetupRoutes() *mux.Router {
 	// Création d'un sous-routeur pour la version 1 de l'API
 	apiV1 := router.PathPrefix("/api/v1").Subrouter()
 
+	// Fichiers uploadés, servis par l'API lorsque le stockage local est utilisé
+	router.PathPrefix(services.LocalMediaPathPrefix).HandlerFunc(handlers.ServeMediaHandler).Methods("GET", "HEAD")
+
+	// Fichiers d'association des liens de partage (liens universels iOS, App Links Android)
+	router.HandleFunc("/.well-known/apple-app-site-association", handlers.AppleAppSiteAssociationHandler).Methods("GET")
+	router.HandleFunc("/.well-known/assetlinks.json", handlers.AssetLinksHandler).Methods("GET")
+
 	apiV1.HandleFunc("/register", handlers.RegisterHandler).Methods("POST")
 	apiV1.HandleFunc("/verify", handlers.VerifyHandler).Methods("POST")
 	apiV1.HandleFunc("/resend-verification", handlers.ResendVerificationCodeHandler).Methods("POST")
@@ -73,12 +81,15 @@ func SetupRoutes() *mux.Router {
 
 	// Routes pour les catégories et les sous-catégories
 	apiV1.HandleFunc("/categories", handlers.GetCategoriesWithSubCategories).Methods("GET")
+	apiV1.HandleFunc("/sub-categories/{subCategoryID:[0-9]+}/attributes", handlers.GetSubCategoryAttributesHandler).Methods("GET")
 	apiV1.HandleFunc("/ads/e/{adID}", handlers.GetAdDetailsHandler).Methods("GET")
 	apiV1.HandleFunc("/ads/cities", handlers.GetAvailableCitiesHandler).Methods("GET")
 	// Nouvelle route pour récupérer toutes les annonces (pour un tableau de bord admin par exemple)
 	apiV1.HandleFunc("/ads/all", handlers.GetAllAdsHandler).Methods("GET")
-	// Route pour incrémenter le nombre de vues d'une annonce
-	apiV1.HandleFunc("/ads/{adID}/views", handlers.IncrementAdViewsHandler).Methods("POST")
+	// Route pour enregistrer une vue d'annonce (dédoublonnée par utilisateur, appareil ou IP)
+	apiV1.HandleFunc("/ads/{adID}/views", handlers.RecordAdViewHandler).Methods("POST")
+	// Route pour enregistrer l'affichage du numéro de téléphone (statistiques vendeur)
+	apiV1.HandleFunc("/ads/{adID}/phone-reveal", handlers.RecordPhoneRevealHandler).Methods("POST")
 
 	// NOUVELLE ROUTE: Récupérer les annonces par catégorie
 	apiV1.HandleFunc("/ads/category/{categoryID}", handlers.GetAdsByCategoryHandler).Methods("GET")
@@ -86,6 +97,21 @@ func SetupRoutes() *mux.Router {
 	// Nouvelle route pour récupérer les annonces de l'utilisateur connecté
 	apiV1.Handle("/ads/me", handlers.ValidateToken(http.HandlerFunc(handlers.GetUserAdsHandler))).Methods("GET")
 
+	// Brouillons d'annonces de l'utilisateur connecté (publication immédiate ou programmée)
+	apiV1.Handle("/ads/drafts", handlers.ValidateToken(http.HandlerFunc(handlers.GetUserAdDraftsHandler))).Methods("GET")
+	apiV1.Handle("/ads/drafts", handlers.ValidateToken(http.HandlerFunc(handlers.CreateAdDraftHandler))).Methods("POST")
+	apiV1.Handle("/ads/drafts/{draftID:[0-9]+}", handlers.ValidateToken(http.HandlerFunc(handlers.GetUserAdDraftHandler))).Methods("GET")
+	apiV1.Handle("/ads/drafts/{draftID:[0-9]+}", handlers.ValidateToken(http.HandlerFunc(handlers.UpdateAdDraftHandler))).Methods("PUT")
+	apiV1.Handle("/ads/drafts/{draftID:[0-9]+}", handlers.ValidateToken(http.HandlerFunc(handlers.DeleteAdDraftHandler))).Methods("DELETE")
+	apiV1.Handle("/ads/drafts/{draftID:[0-9]+}/images", handlers.ValidateToken(http.HandlerFunc(handlers.UploadAdDraftImagesHandler))).Methods("POST")
+	apiV1.Handle("/ads/drafts/{draftID:[0-9]+}/publish", handlers.ValidateToken(http.HandlerFunc(handlers.PublishAdDraftHandler))).Methods("POST")
+	apiV1.Handle("/ads/drafts/{draftID:[0-9]+}/publish", handlers.ValidateToken(http.HandlerFunc(handlers.CancelAdDraftScheduleHandler))).Methods("DELETE")
+
+	// Import d'annonces en masse (CSV / JSON, comptes professionnels) et suivi des imports
+	apiV1.Handle("/ads/imports", handlers.ValidateToken(http.HandlerFunc(handlers.CreateAdImportHandler))).Methods("POST")
+	apiV1.Handle("/ads/imports", handlers.ValidateToken(http.HandlerFunc(handlers.GetAdImportsHandler))).Methods("GET")
+	apiV1.Handle("/ads/imports/{importID:[0-9]+}", handlers.ValidateToken(http.HandlerFunc(handlers.GetAdImportHandler))).Methods("GET")
+
 	// Route pour marquer une annonce comme vendue, protégée par le middleware JWT
 	apiV1.Handle("/ads/{adID}/mark-sold", handlers.ValidateToken(http.HandlerFunc(handlers.MarkAdAsSoldHandler))).Methods("POST")
 
@@ -95,15 +121,32 @@ func SetupRoutes() *mux.Router {
 	// Route pour récupérer toutes les annonces vendues de l'utilisateur, protégée par le middleware JWT
 	apiV1.Handle("/ads/sold", handlers.ValidateToken(http.HandlerFunc(handlers.GetSoldAdsHandler))).Methods("GET")
 
+	// Statistiques du vendeur connecté (période from/to), globales et par annonce
+	apiV1.Handle("/analytics/ads", handlers.ValidateToken(http.HandlerFunc(handlers.GetSellerAnalyticsHandler))).Methods("GET")
+	apiV1.Handle("/analytics/ads/{adID:[0-9]+}", handlers.ValidateToken(http.HandlerFunc(handlers.GetSellerAdAnalyticsHandler))).Methods("GET")
+
+	// Route pour renouveler une annonce expirée (ou sur le point d'expirer)
+	apiV1.Handle("/ads/{adID}/renew", handlers.ValidateToken(http.HandlerFunc(handlers.RenewAdHandler))).Methods("POST")
+
 	// Route pour supprimer une annonce (protégée par le middleware JWT)
 	apiV1.Handle("/ads/{adID}", handlers.ValidateToken(http.HandlerFunc(handlers.DeleteAdHandler))).Methods("DELETE")
 
 	// Route pour modifier une annonce (protégée par le middleware JWT)
 	apiV1.Handle("/ads/{adID}", handlers.ValidateToken(http.HandlerFunc(handlers.EditAdHandler))).Methods("PUT")
 
+	// Gestion image par image (ajout, suppression, ordre, couverture), avec les règles d'une modification
+	apiV1.Handle("/ads/{adID:[0-9]+}/images", handlers.ValidateToken(http.HandlerFunc(handlers.AddAdImagesHandler))).Methods("POST")
+	apiV1.Handle("/ads/{adID:[0-9]+}/images", handlers.ValidateToken(http.HandlerFunc(handlers.DeleteAdImageHandler))).Methods("DELETE")
+	apiV1.Handle("/ads/{adID:[0-9]+}/images/order", handlers.ValidateToken(http.HandlerFunc(handlers.ReorderAdImagesHandler))).Methods("PUT")
+	apiV1.Handle("/ads/{adID:[0-9]+}/images/cover", handlers.ValidateToken(http.HandlerFunc(handlers.SetAdCoverImageHandler))).Methods("PUT")
+
 	// Nouvelle route pour les annonces similaires
 	apiV1.HandleFunc("/ads/e/{adID}/similar", handlers.GetSimilarAdsHandler).Methods("GET")
 
+	// Signalement d'une annonce depuis sa page (motifs fixes, un signalement par utilisateur et par annonce)
+	apiV1.HandleFunc("/ads/report-reasons", handlers.GetAdReportReasonsHandler).Methods("GET")
+	apiV1.Handle("/ads/{adID:[0-9]+}/report", handlers.ValidateToken(http.HandlerFunc(handlers.ReportAdHandler))).Methods("POST")
+
 	// Route pour récupérer le profil d'un vendeur et ses articles validés (accès public)
 	apiV1.HandleFunc("/sellers/{userID}", handlers.GetSellerProfileHandler).Methods("GET")
 
@@ -112,6 +155,13 @@ func SetupRoutes() *mux.Router {
 
 	// Nouvelle route pour récupérer les annonces validées (accès public)
 	apiV1.HandleFunc("/ads/validated", handlers.GetValidatedAdsHandler).Methods("GET")
+	// Fil d'accueil personnalisé de l'utilisateur connecté
+	apiV1.Handle("/feed", handlers.ValidateToken(http.HandlerFunc(handlers.GetFeedHandler))).Methods("GET")
+
+	// Historique des annonces consultées par l'utilisateur connecté (désactivable dans ses paramètres)
+	apiV1.Handle("/history/ads", handlers.ValidateToken(http.HandlerFunc(handlers.GetViewHistoryHandler))).Methods("GET")
+	apiV1.Handle("/history/ads", handlers.ValidateToken(http.HandlerFunc(handlers.ClearViewHistoryHandler))).Methods("DELETE")
+	apiV1.Handle("/history/ads/{adID:[0-9]+}", handlers.ValidateToken(http.HandlerFunc(handlers.RemoveViewHistoryEntryHandler))).Methods("DELETE")
 	// Route pour la recherche d'annonces (accès public)
 	apiV1.HandleFunc("/ads/search", handlers.SearchAdsHandler).Methods("GET")
 
@@ -125,6 +175,12 @@ func SetupRoutes() *mux.Router {
 	apiV1.Handle("/favorites/{adID}", handlers.ValidateToken(http.HandlerFunc(handlers.RemoveFavoriteHandler))).Methods("DELETE")
 	apiV1.Handle("/favorites", handlers.ValidateToken(http.HandlerFunc(handlers.GetFavoritesHandler))).Methods("GET")
 
+	// 👇 ROUTES POUR LES RECHERCHES SAUVEGARDÉES 👇
+	apiV1.Handle("/saved-searches", handlers.ValidateToken(http.HandlerFunc(handlers.CreateSavedSearchHandler))).Methods("POST")
+	apiV1.Handle("/saved-searches", handlers.ValidateToken(http.HandlerFunc(handlers.GetSavedSearchesHandler))).Methods("GET")
+	apiV1.Handle("/saved-searches/{savedSearchID:[0-9]+}", handlers.ValidateToken(http.HandlerFunc(handlers.UpdateSavedSearchHandler))).Methods("PUT")
+	apiV1.Handle("/saved-searches/{savedSearchID:[0-9]+}", handlers.ValidateToken(http.HandlerFunc(handlers.DeleteSavedSearchHandler))).Methods("DELETE")
+
 	// Route protégée par le middleware JWT
 	apiV1.Handle("/profile", handlers.ValidateToken(http.HandlerFunc(handlers.ProfileHandler))).Methods("GET")
 
@@ -239,6 +295,10 @@ func SetupRoutes() *mux.Router {
 	adminRoutes.HandleFunc("/ads/{adID}/reject", handlers.RejectAdHandler).Methods("POST")
 	adminRoutes.HandleFunc("/ads/{adID}/deactivate", handlers.DeactivateAdHandler).Methods("POST")
 
+	// Historique des modifications et comparaison avec la dernière version validée
+	adminRoutes.HandleFunc("/ads/{adID}/revisions", handlers.GetAdRevisionsHandler).Methods("GET")
+	adminRoutes.HandleFunc("/ads/{adID}/revisions/diff", handlers.GetAdRevisionDiffHandler).Methods("GET")
+
 	// 👇 NOUVELLE ROUTE DE MODIFICATION ADMIN 👇
 	adminRoutes.HandleFunc("/ads/{adID}", handlers.EditAdForAdminHandler).Methods("PUT")
 
@@ -269,6 +329,12 @@ func SetupRoutes() *mux.Router {
 	adminRoutes.HandleFunc("/sub-categories/{subCategoryID}", handlers.UpdateSubCategoryHandler).Methods("PUT")
 	adminRoutes.HandleFunc("/sub-categories/{subCategoryID}", handlers.DeleteSubCategoryHandler).Methods("DELETE")
 
+	// SCHÉMAS D'ATTRIBUTS DES SOUS-CATÉGORIES (validation de form_data)
+	adminRoutes.HandleFunc("/sub-categories/{subCategoryID:[0-9]+}/attributes", handlers.GetSubCategoryAttributesHandler).Methods("GET")
+	adminRoutes.HandleFunc("/sub-categories/{subCategoryID:[0-9]+}/attributes", handlers.CreateSubCategoryAttributeHandler).Methods("POST")
+	adminRoutes.HandleFunc("/sub-categories/{subCategoryID:[0-9]+}/attributes/{attributeID:[0-9]+}", handlers.UpdateSubCategoryAttributeHandler).Methods("PUT")
+	adminRoutes.HandleFunc("/sub-categories/{subCategoryID:[0-9]+}/attributes/{attributeID:[0-9]+}", handlers.DeleteSubCategoryAttributeHandler).Methods("DELETE")
+
 	// 👇 =================================================================
 	// 👇 NOUVELLES ROUTES POUR LA GESTION DU STAFF (Table 'admins')
 	// 👇 (AJOUTÉES ICI)
@@ -286,6 +352,8 @@ func SetupRoutes() *mux.Router {
 	// Récupérer tous les signalements (filtrables par ?status=pending)
 	adminRoutes.HandleFunc("/reports", handlers.GetReportsHandler).Methods("GET")
 	adminRoutes.HandleFunc("/reports/{reportID:[0-9]+}", handlers.UpdateReportHandler).Methods("PATCH")
+	adminRoutes.HandleFunc("/ad-reports", handlers.GetAdReportsHandler).Methods("GET")
+	adminRoutes.HandleFunc("/ad-reports/{reportID:[0-9]+}", handlers.UpdateAdReportHandler).Methods("PATCH")
 
 	// 👇 =================================================================
 	// 👇 NOUVELLES ROUTES POUR LA GESTION DES TICKETS DE SUPPORT (ADMIN)
@@ -358,5 +426,14 @@ func SetupRoutes() *mux.Router {
 	adminRoutes.HandleFunc("/maintenance", handlers.GetMaintenanceModeForAdminHandler).Methods("GET")
 	adminRoutes.HandleFunc("/maintenance", handlers.UpdateMaintenanceModeHandler).Methods("PUT")
 
+	// ==============================================================
+	// ROUTES ADMIN - NETTOYAGE DES FICHIERS ORPHELINS
+	// ==============================================================
+
+	adminRoutes.HandleFunc("/media/gc/runs", handlers.GetMediaGCRunsHandler).Methods("GET")
+	adminRoutes.HandleFunc("/media/gc/runs/{runID:[0-9]+}", handlers.GetMediaGCRunHandler).Methods("GET")
+	// Lancer un passage (suppression possible) : rôle admin requis
+	adminRoutes.Handle("/media/gc/runs", handlers.RequireAdminRole(http.HandlerFunc(handlers.StartMediaGCRunHandler))).Methods("POST")
+
 	return router
 }
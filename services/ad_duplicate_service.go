@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"image"
+	"log"
+	"math/bits"
+	"sort"
+	"strings"
+	"unicode"
+
+	"kivendi-backend/config"
+
+	"github.com/lib/pq"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ImageHashDuplicateDistance est la distance de Hamming maximale entre deux empreintes perceptuelles
+// pour considérer deux images comme visuellement identiques (recadrage léger, recompression, redimensionnement).
+const ImageHashDuplicateDistance = 6
+
+// ImageHashBandCount est le nombre de tranches de 8 bits indexées de chaque empreinte. Deux empreintes
+// à distance <= ImageHashDuplicateDistance (< 8) ont forcément au moins une tranche identique : la
+// recherche des doublons ne compare que les empreintes partageant une tranche (index GIN).
+const ImageHashBandCount = 8
+
+// titleFingerprintStopWords sont ignorés dans l'empreinte des titres (articles et formules d'annonce)
+var titleFingerprintStopWords = map[string]bool{
+	"a": true, "au": true, "aux": true, "de": true, "des": true, "du": true, "d": true, "en": true,
+	"et": true, "l": true, "la": true, "le": true, "les": true, "un": true, "une": true, "pour": true,
+	"avec": true, "sur": true, "vend": true, "vends": true, "vendre": true, "vente": true,
+	"urgent": true, "neuf": true, "neuve": true, "occasion": true, "tres": true, "bon": true, "etat": true,
+}
+
+// ComputeImagePerceptualHash calcule l'empreinte perceptuelle (dHash 64 bits) d'une image déjà décodée
+// (la miniature produite par processUploadedImage) : l'image est réduite en niveaux de gris sur une
+// grille 9x8 et chaque bit compare deux cases voisines.
+func ComputeImagePerceptualHash(img image.Image) uint64 {
+	const cols, rows = 9, 8
+	bounds := img.Bounds()
+	var grid [rows][cols]float64
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			grid[y][x] = averageLuminance(img, image.Rect(
+				bounds.Min.X+x*bounds.Dx()/cols, bounds.Min.Y+y*bounds.Dy()/rows,
+				bounds.Min.X+(x+1)*bounds.Dx()/cols, bounds.Min.Y+(y+1)*bounds.Dy()/rows,
+			))
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols-1; x++ {
+			hash <<= 1
+			if grid[y][x] > grid[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// ImageHashBands découpe une empreinte en ImageHashBandCount tranches, codées tranche*256 + valeur
+// pour qu'une même valeur à deux positions différentes ne se confonde pas
+func ImageHashBands(hash uint64) []int64 {
+	bands := make([]int64, ImageHashBandCount)
+	for i := range bands {
+		bands[i] = int64(i)*256 + int64((hash>>(8*i))&0xFF)
+	}
+	return bands
+}
+
+// averageLuminance renvoie la luminance moyenne d'une zone, échantillonnée sur au plus 8x8 points
+func averageLuminance(img image.Image, area image.Rectangle) float64 {
+	if area.Empty() {
+		return 0
+	}
+	stepX := max(area.Dx()/8, 1)
+	stepY := max(area.Dy()/8, 1)
+
+	var sum float64
+	var count int
+	for y := area.Min.Y; y < area.Max.Y; y += stepY {
+		for x := area.Min.X; x < area.Max.X; x += stepX {
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			count++
+		}
+	}
+	return sum / float64(count)
+}
+
+// ImageHashDistance renvoie la distance de Hamming entre deux empreintes perceptuelles
+func ImageHashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// RecordAdImageHash calcule et enregistre l'empreinte perceptuelle d'une image d'annonce uploadée
+func RecordAdImageHash(imageURL string, img image.Image) {
+	hash := ComputeImagePerceptualHash(img)
+	_, err := config.DB.Exec(`
+		INSERT INTO ad_image_hashes (image_url, phash, bands) VALUES ($1, $2, $3)
+		ON CONFLICT (image_url) DO UPDATE SET phash = EXCLUDED.phash, bands = EXCLUDED.bands
+	`, imageURL, int64(hash), pq.Array(ImageHashBands(hash)))
+	if err != nil {
+		log.Printf("Erreur lors de l'enregistrement de l'empreinte de l'image %s: %v", imageURL, err)
+	}
+}
+
+// TitleFingerprint normalise un titre d'annonce pour comparer les annonces : minuscules, sans accents
+// ni ponctuation, sans mots vides, mots uniques triés. "Vends iPhone 12 Pro, très bon état !" et
+// "iphone 12 pro" donnent la même empreinte. Renvoie une chaîne vide si le titre ne contient aucun mot utile.
+func TitleFingerprint(title string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(title)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// Accent séparé par la décomposition NFD
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+
+	seen := make(map[string]bool)
+	words := []string{}
+	for _, word := range strings.Fields(b.String()) {
+		if titleFingerprintStopWords[word] || seen[word] {
+			continue
+		}
+		seen[word] = true
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+// SetAdTitleFingerprint enregistre l'empreinte du titre d'une annonce
+func SetAdTitleFingerprint(ctx context.Context, adID int, title string) error {
+	_, err := config.DB.ExecContext(ctx, "UPDATE ads SET title_fingerprint = $2 WHERE id = $1", adID, TitleFingerprint(title))
+	return err
+}
+
+// BackfillAdTitleFingerprints calcule l'empreinte des titres des annonces créées avant la détection des doublons
+func BackfillAdTitleFingerprints() {
+	total := 0
+	for {
+		rows, err := config.DB.Query("SELECT id, title FROM ads WHERE title_fingerprint IS NULL ORDER BY id LIMIT 500")
+		if err != nil {
+			log.Printf("Erreur lors de la récupération des annonces sans empreinte de titre: %v", err)
+			return
+		}
+
+		type adTitle struct {
+			id    int
+			title string
+		}
+		var batch []adTitle
+		for rows.Next() {
+			var a adTitle
+			if err := rows.Scan(&a.id, &a.title); err != nil {
+				rows.Close()
+				log.Printf("Erreur lors du scan d'une annonce sans empreinte de titre: %v", err)
+				return
+			}
+			batch = append(batch, a)
+		}
+		rows.Close()
+
+		if len(batch) == 0 {
+			break
+		}
+		for _, a := range batch {
+			if err := SetAdTitleFingerprint(context.Background(), a.id, a.title); err != nil {
+				log.Printf("Erreur lors de l'enregistrement de l'empreinte du titre de l'annonce %d: %v", a.id, err)
+				return
+			}
+		}
+		total += len(batch)
+	}
+
+	if total > 0 {
+		log.Printf("Empreinte de titre calculée pour %d annonces existantes", total)
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"kivendi-backend/config"
+)
+
+// AdExpiresAtSQL calcule la date d'expiration d'une annonce publiée maintenant, d'après
+// app_settings.max_ad_duration_days (NULL = pas d'expiration si la durée vaut 0). Une durée non renseignée
+// vaut DefaultMaxAdDurationDays, comme pour le job d'expiration (GetAdSettings).
+var AdExpiresAtSQL = fmt.Sprintf(`(
+	SELECT CASE WHEN days > 0 THEN NOW() + make_interval(days => days) END
+	FROM (SELECT COALESCE((SELECT max_ad_duration_days FROM app_settings ORDER BY id DESC LIMIT 1), %d) AS days) s
+)`, DefaultMaxAdDurationDays)
+
+// ErrDraftNotPublishable est renvoyée lorsque le brouillon n'existe pas ou qu'il est incomplet
+// (ou, pour une publication programmée, que sa programmation a été annulée ou repoussée)
+var ErrDraftNotPublishable = errors.New("brouillon introuvable ou incomplet")
+
+// PublishedDraft décrit l'annonce créée à partir d'un brouillon
+type PublishedDraft struct {
+	AdID        int
+	UserID      int
+	Title       string
+	IsValidated bool
+}
+
+// PublishAdDraft transforme un brouillon complet en annonce (en attente de modération, ou validée
+// directement si auto_validate_ads est activé) puis supprime le brouillon, en une seule requête.
+// Pour une publication programmée (scheduled), la date de publication est revérifiée dans la même
+// requête : un brouillon dont la programmation a été annulée ou repoussée entre-temps n'est pas publié.
+func PublishAdDraft(ctx context.Context, draftID int, scheduled bool) (*PublishedDraft, error) {
+	settings := GetAdSettings()
+
+	published := PublishedDraft{IsValidated: settings.AutoValidateAds}
+	err := config.DB.QueryRowContext(ctx, `
+		WITH d AS (
+			DELETE FROM ad_drafts
+			WHERE id = $1
+			AND COALESCE(TRIM(title), '') <> '' AND COALESCE(TRIM(description), '') <> ''
+			AND price IS NOT NULL AND sub_category_id IS NOT NULL
+			AND COALESCE(cardinality(images), 0) > 0
+			AND (NOT $3 OR (publish_at IS NOT NULL AND publish_at <= NOW()))
+			RETURNING *
+		)
+		INSERT INTO ads (title, description, price, sub_category_id, images, form_data, is_validated, is_deactivated, is_rejected, latitude, longitude, city, phone_number, is_phone_visible, is_delivery_available, user_id, expires_at)
+		SELECT title, description, price, sub_category_id, images, COALESCE(form_data, '{}'::jsonb), $2, FALSE, FALSE, latitude, longitude, city, phone_number, is_phone_visible, is_delivery_available, user_id, `+AdExpiresAtSQL+`
+		FROM d
+		RETURNING id, user_id, title
+	`, draftID, settings.AutoValidateAds, scheduled).Scan(&published.AdID, &published.UserID, &published.Title)
+	if err == sql.ErrNoRows {
+		return nil, ErrDraftNotPublishable
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Empreinte du titre pour la détection des doublons
+	if err := SetAdTitleFingerprint(ctx, published.AdID, published.Title); err != nil {
+		log.Printf("Erreur lors de l'enregistrement de l'empreinte du titre de l'annonce %d: %v", published.AdID, err)
+	}
+
+	return &published, nil
+}
+
+// NotifyAdValidated prévient le vendeur que son annonce est validée (notification in-app et push).
+func NotifyAdValidated(ctx context.Context, userID int, adID int, adTitle string) {
+	// Envoyer la notification (in-app)
+	notificationTitle := "Votre annonce a été approuvée !"
+	notificationMessage := fmt.Sprintf("Bonne nouvelle ! Votre annonce « %s » a été validée et est maintenant visible par tous.", adTitle)
+	go CreateNotification(userID, "ad_validated", notificationTitle, notificationMessage, map[string]interface{}{"adId": adID})
+
+	// Envoyer la notification (push)
+	if PushSvc != nil {
+		PushSvc.SendAdValidatedPush(ctx, userID, adTitle, adID)
+	}
+}
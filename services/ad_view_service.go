@@ -0,0 +1,134 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"kivendi-backend/config"
+
+	"github.com/lib/pq"
+)
+
+// AdViewDedupWindow est la période pendant laquelle un même visiteur ne compte qu'une vue par annonce
+const AdViewDedupWindow = 30 * time.Minute
+
+const (
+	adViewFlushInterval  = 10 * time.Second // Fréquence d'écriture du tampon en base
+	adViewFlushThreshold = 500              // Écriture anticipée au-delà de ce nombre de vues en attente
+)
+
+// adViewEvent est une vue en attente d'écriture dans ad_view_events
+type adViewEvent struct {
+	adID      int
+	viewerKey string
+	viewedAt  time.Time
+}
+
+var (
+	adViewMu       sync.Mutex
+	adViewBuffer   []adViewEvent
+	adViewLastSeen = make(map[string]time.Time) // "adID|viewerKey" -> dernière vue comptée (dédoublonnage local)
+	adViewFlushCh  = make(chan struct{}, 1)
+)
+
+// AdViewerKey construit l'identifiant anonymisé d'un visiteur (utilisateur, ou IP et User-Agent)
+func AdViewerKey(kind, value string) string {
+	sum := sha256.Sum256([]byte(kind + ":" + value))
+	return hex.EncodeToString(sum[:16])
+}
+
+// RecordAdView met en tampon une vue d'annonce. Renvoie false si le visiteur a déjà été compté
+// dans la fenêtre de dédoublonnage. Les vues sont écrites par lots par StartAdViewFlusher.
+func RecordAdView(adID int, viewerKey string) bool {
+	now := time.Now()
+	key := strconv.Itoa(adID) + "|" + viewerKey
+
+	adViewMu.Lock()
+	if last, ok := adViewLastSeen[key]; ok && now.Sub(last) < AdViewDedupWindow {
+		adViewMu.Unlock()
+		return false
+	}
+	adViewLastSeen[key] = now
+	adViewBuffer = append(adViewBuffer, adViewEvent{adID: adID, viewerKey: viewerKey, viewedAt: now})
+	full := len(adViewBuffer) >= adViewFlushThreshold
+	adViewMu.Unlock()
+
+	if full {
+		select {
+		case adViewFlushCh <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+// FlushAdViews écrit les vues en attente dans ad_view_events en une seule requête.
+// Le dédoublonnage est vérifié aussi en base, pour les vues reçues par une autre instance.
+func FlushAdViews() {
+	adViewMu.Lock()
+	events := adViewBuffer
+	adViewBuffer = nil
+
+	// Purger les entrées de dédoublonnage expirées
+	now := time.Now()
+	for key, last := range adViewLastSeen {
+		if now.Sub(last) >= AdViewDedupWindow {
+			delete(adViewLastSeen, key)
+		}
+	}
+	adViewMu.Unlock()
+
+	if len(events) == 0 {
+		return
+	}
+
+	adIDs := make([]int64, len(events))
+	viewerKeys := make([]string, len(events))
+	viewedAts := make([]string, len(events))
+	for i, e := range events {
+		adIDs[i] = int64(e.adID)
+		viewerKeys[i] = e.viewerKey
+		viewedAts[i] = e.viewedAt.Format(time.RFC3339Nano)
+	}
+
+	result, err := config.DB.Exec(`
+		INSERT INTO ad_view_events (ad_id, viewer_key, viewed_at)
+		SELECT v.ad_id, v.viewer_key, v.viewed_at
+		FROM unnest($1::int[], $2::text[], $3::timestamptz[]) AS v(ad_id, viewer_key, viewed_at)
+		WHERE EXISTS (SELECT 1 FROM ads a WHERE a.id = v.ad_id)
+		AND NOT EXISTS (
+			SELECT 1 FROM ad_view_events e
+			WHERE e.ad_id = v.ad_id AND e.viewer_key = v.viewer_key
+			AND e.viewed_at > v.viewed_at - make_interval(secs => $4)
+		)
+	`, pq.Array(adIDs), pq.Array(viewerKeys), pq.Array(viewedAts), AdViewDedupWindow.Seconds())
+	if err != nil {
+		log.Printf("Erreur lors de l'écriture de %d vues d'annonces: %v", len(events), err)
+		return
+	}
+
+	if n, _ := result.RowsAffected(); n != int64(len(events)) {
+		log.Printf("%d vues d'annonces enregistrées (%d doublons ignorés)", n, int64(len(events))-n)
+	}
+}
+
+// StartAdViewFlusher démarre l'écriture périodique des vues mises en tampon. Les vues restantes
+// doivent être écrites par FlushAdViews à l'arrêt du processus.
+func StartAdViewFlusher() {
+	ticker := time.NewTicker(adViewFlushInterval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+			case <-adViewFlushCh:
+			}
+			FlushAdViews()
+		}
+	}()
+
+	log.Println("Écriture des vues d'annonces par lots démarrée")
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"kivendi-backend/config"
+)
+
+const (
+	// trendingCacheTTL est la durée pendant laquelle le classement des annonces tendance reste en cache
+	trendingCacheTTL = 10 * time.Minute
+	// trendingAdsLimit est le nombre d'annonces retenues dans le classement tendance
+	trendingAdsLimit = 300
+)
+
+// TrendingAds est le classement des annonces les plus consultées et ajoutées en favori des 7 derniers jours.
+// Scores[i] est la popularité de AdIDs[i], normalisée entre 0 et 1.
+type TrendingAds struct {
+	AdIDs  []int64
+	Scores []float64
+}
+
+var (
+	trendingMu       sync.RWMutex
+	trendingCache    *TrendingAds
+	trendingCachedAt time.Time
+)
+
+// GetTrendingAds renvoie le classement tendance depuis un cache mémoire rafraîchi toutes les 10 minutes.
+// En cas d'erreur de lecture, le dernier classement connu (ou un classement vide) est renvoyé.
+func GetTrendingAds() TrendingAds {
+	trendingMu.RLock()
+	if trendingCache != nil && time.Since(trendingCachedAt) < trendingCacheTTL {
+		trending := *trendingCache
+		trendingMu.RUnlock()
+		return trending
+	}
+	trendingMu.RUnlock()
+
+	trendingMu.Lock()
+	defer trendingMu.Unlock()
+
+	// Un autre appel a pu rafraîchir le cache entre-temps
+	if trendingCache != nil && time.Since(trendingCachedAt) < trendingCacheTTL {
+		return *trendingCache
+	}
+
+	trending, err := loadTrendingAds()
+	if err != nil {
+		log.Printf("Erreur lors du calcul des annonces tendance: %v", err)
+		if trendingCache != nil {
+			return *trendingCache
+		}
+		return TrendingAds{}
+	}
+
+	trendingCache = &trending
+	trendingCachedAt = time.Now()
+	return trending
+}
+
+// loadTrendingAds calcule le classement : vues agrégées par jour et favoris récents (un favori vaut 5 vues),
+// en échelle logarithmique pour qu'une annonce virale n'écrase pas toutes les autres.
+func loadTrendingAds() (TrendingAds, error) {
+	rows, err := config.DB.Query(`
+		WITH activity AS (
+			SELECT ad_id, SUM(views)::float8 AS points
+			FROM ad_view_daily
+			WHERE day >= CURRENT_DATE - 7
+			GROUP BY ad_id
+			UNION ALL
+			SELECT ad_id, COUNT(*)::float8 * 5
+			FROM favorites
+			WHERE created_at >= NOW() - INTERVAL '7 days'
+			GROUP BY ad_id
+		), ranked AS (
+			SELECT act.ad_id, LN(1 + SUM(act.points)) AS score
+			FROM activity act
+			JOIN ads a ON a.id = act.ad_id
+			WHERE a.is_validated = TRUE AND a.is_expired = FALSE
+			AND COALESCE(a.is_deactivated, FALSE) = FALSE AND COALESCE(a.is_sold, FALSE) = FALSE
+			GROUP BY act.ad_id
+			ORDER BY score DESC
+			LIMIT $1
+		)
+		SELECT ad_id, score / NULLIF(MAX(score) OVER (), 0) FROM ranked ORDER BY score DESC
+	`, trendingAdsLimit)
+	if err != nil {
+		return TrendingAds{}, err
+	}
+	defer rows.Close()
+
+	trending := TrendingAds{AdIDs: []int64{}, Scores: []float64{}}
+	for rows.Next() {
+		var adID int64
+		var score *float64
+		if err := rows.Scan(&adID, &score); err != nil {
+			return TrendingAds{}, err
+		}
+		trending.AdIDs = append(trending.AdIDs, adID)
+		if score != nil {
+			trending.Scores = append(trending.Scores, *score)
+		} else {
+			trending.Scores = append(trending.Scores, 0)
+		}
+	}
+	return trending, rows.Err()
+}
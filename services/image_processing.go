@@ -0,0 +1,273 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"strings"
+	"sync"
+
+	"kivendi-backend/models"
+
+	"github.com/gen2brain/webp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Tailles produites pour chaque image uploadée (côté le plus long, en pixels, sans agrandissement).
+// Les fichiers sont rangés sous des clés prévisibles : <dossier>/<uuid>/<taille>.<jpg|webp>.
+const (
+	ImageVariantThumbnail = "thumb"
+	ImageVariantMedium    = "medium"
+	ImageVariantFull      = "full"
+)
+
+var imageVariantSizes = []struct {
+	name    string
+	maxSide int
+}{
+	{ImageVariantFull, 1600},
+	{ImageVariantMedium, 800},
+	{ImageVariantThumbnail, 320},
+}
+
+// imageJPEGQuality est la qualité d'encodage des variantes JPEG
+const imageJPEGQuality = 82
+
+// imageWebPQuality est la qualité d'encodage des variantes WebP (avec perte)
+const imageWebPQuality = 75
+
+// maxImagePixels est le nombre maximal de pixels d'une image uploadée (40 MP). Vérifié sur l'en-tête
+// avant le décodage complet : une petite image déclarant des dimensions énormes épuiserait la mémoire.
+const maxImagePixels = 40_000_000
+
+// processedImageFile est un fichier produit par le traitement d'une image
+type processedImageFile struct {
+	name        string // ex. "thumb.webp"
+	contentType string
+	data        []byte
+}
+
+// processUploadedImage décode une image (JPEG, PNG, GIF, WebP), applique l'orientation EXIF et produit
+// les variantes thumb / medium / full en JPEG et en WebP. Le réencodage supprime toutes les métadonnées
+// (EXIF, GPS, profils). Pour un GIF animé, seule la première image est conservée.
+// Les variantes WebP sont encodées avec perte (libwebp compilée en WebAssembly, sans cgo).
+// La miniature décodée est aussi renvoyée, pour calculer l'empreinte perceptuelle sans redécoder l'upload.
+func processUploadedImage(data []byte) ([]processedImageFile, image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("image illisible: %v", err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		return nil, nil, fmt.Errorf("image trop grande (%dx%d pixels, maximum %d mégapixels)",
+			cfg.Width, cfg.Height, maxImagePixels/1_000_000)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("image illisible: %v", err)
+	}
+
+	// Réduire d'abord à la plus grande taille, puis orienter (moins de pixels à déplacer)
+	full := applyImageOrientation(resizeImage(src, imageVariantSizes[0].maxSide), jpegExifOrientation(data))
+
+	resized := make([]image.Image, len(imageVariantSizes))
+	resized[0] = full
+	for i := 1; i < len(imageVariantSizes); i++ {
+		resized[i] = resizeImage(full, imageVariantSizes[i].maxSide)
+	}
+
+	files := make([]processedImageFile, 2*len(imageVariantSizes))
+	errs := make([]error, len(files))
+	var wg sync.WaitGroup
+	for i, size := range imageVariantSizes {
+		img := resized[i]
+		wg.Add(2)
+		go func(slot int) {
+			defer wg.Done()
+			var buf bytes.Buffer
+			errs[slot] = jpeg.Encode(&buf, img, &jpeg.Options{Quality: imageJPEGQuality})
+			files[slot] = processedImageFile{name: size.name + ".jpg", contentType: "image/jpeg", data: buf.Bytes()}
+		}(2 * i)
+		go func(slot int) {
+			defer wg.Done()
+			var buf bytes.Buffer
+			errs[slot] = webp.Encode(&buf, img, webp.Options{Quality: imageWebPQuality})
+			files[slot] = processedImageFile{name: size.name + ".webp", contentType: "image/webp", data: buf.Bytes()}
+		}(2*i + 1)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, nil, fmt.Errorf("erreur d'encodage de l'image: %v", err)
+		}
+	}
+	return files, resized[len(resized)-1], nil
+}
+
+// resizeImage réduit l'image pour que son plus grand côté ne dépasse pas maxSide.
+// Le résultat est toujours une image RGBA opaque (fond blanc pour la transparence, JPEG oblige).
+func resizeImage(src image.Image, maxSide int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > maxSide || h > maxSide {
+		if w >= h {
+			h = max(h*maxSide/w, 1)
+			w = maxSide
+		} else {
+			w = max(w*maxSide/h, 1)
+			h = maxSide
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+	return dst
+}
+
+// applyImageOrientation redresse une image selon la valeur EXIF Orientation (1 à 8)
+func applyImageOrientation(src image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Miroir horizontal
+				dx, dy = w-1-x, y
+			case 3: // Rotation 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // Miroir vertical
+				dx, dy = x, h-1-y
+			case 5: // Transposition
+				dx, dy = y, x
+			case 6: // Rotation 90° horaire
+				dx, dy = h-1-y, x
+			case 7: // Transposition inverse
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotation 90° anti-horaire
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, src.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// jpegExifOrientation lit la balise EXIF Orientation (0x0112) d'un JPEG. Renvoie 1 si elle est absente.
+func jpegExifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 1
+		}
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 { // Début des données image : plus de métadonnées
+			return 1
+		}
+		segmentLen := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		if segmentLen < 2 || pos+2+segmentLen > len(data) {
+			return 1
+		}
+		segment := data[pos+4 : pos+2+segmentLen]
+		if marker == 0xE1 && len(segment) > 14 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		pos += 2 + segmentLen
+	}
+	return 1
+}
+
+// tiffOrientation lit la balise Orientation dans le premier IFD d'un en-tête TIFF (bloc EXIF)
+func tiffOrientation(tiff []byte) int {
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8 : entry+10]))
+		}
+	}
+	return 1
+}
+
+// ImageVariantsFor renvoie les URLs des variantes d'une image. Pour une image antérieure au traitement
+// (un seul fichier d'origine), toutes les variantes pointent vers l'image d'origine.
+func ImageVariantsFor(imageURL string) models.ImageVariants {
+	base, ok := strings.CutSuffix(imageURL, "/"+ImageVariantFull+".jpg")
+	if !ok {
+		return models.ImageVariants{
+			Thumbnail: imageURL, ThumbnailWebP: imageURL,
+			Medium: imageURL, MediumWebP: imageURL,
+			Full: imageURL, FullWebP: imageURL,
+		}
+	}
+	return models.ImageVariants{
+		Thumbnail:     base + "/" + ImageVariantThumbnail + ".jpg",
+		ThumbnailWebP: base + "/" + ImageVariantThumbnail + ".webp",
+		Medium:        base + "/" + ImageVariantMedium + ".jpg",
+		MediumWebP:    base + "/" + ImageVariantMedium + ".webp",
+		Full:          imageURL,
+		FullWebP:      base + "/" + ImageVariantFull + ".webp",
+	}
+}
+
+// AdImageVariants renvoie les variantes de chaque image d'une annonce, dans le même ordre
+func AdImageVariants(images []string) []models.ImageVariants {
+	variants := make([]models.ImageVariants, len(images))
+	for i, img := range images {
+		variants[i] = ImageVariantsFor(img)
+	}
+	return variants
+}
+
+// imageVariantKeys renvoie les clés S3 de toutes les variantes d'une image à partir de la clé de sa
+// variante "full.jpg" ; une clé d'image antérieure au traitement est renvoyée telle quelle.
+func imageVariantKeys(key string) []string {
+	base, ok := strings.CutSuffix(key, "/"+ImageVariantFull+".jpg")
+	if !ok {
+		return []string{key}
+	}
+	keys := make([]string, 0, 2*len(imageVariantSizes))
+	for _, size := range imageVariantSizes {
+		keys = append(keys, base+"/"+size.name+".jpg", base+"/"+size.name+".webp")
+	}
+	return keys
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"os"
+	"testing"
+)
+
+// Les fichiers testdata/sample.* sont une même image 40x30 dans chaque format accepté à l'upload.
+// Ils sont lus depuis le disque pour que le test ne dépende que des décodeurs enregistrés par le paquet.
+func TestProcessUploadedImageFormats(t *testing.T) {
+	for _, name := range []string{"sample.jpg", "sample.png", "sample.gif", "sample.webp"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile("testdata/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			files, thumbnail, err := processUploadedImage(data)
+			if err != nil {
+				t.Fatalf("processUploadedImage(%s): %v", name, err)
+			}
+			if got := thumbnail.Bounds(); got.Dx() != 40 || got.Dy() != 30 {
+				t.Errorf("miniature de %dx%d, attendu 40x30", got.Dx(), got.Dy())
+			}
+
+			if len(files) != 2*len(imageVariantSizes) {
+				t.Fatalf("%d fichiers produits, attendu %d", len(files), 2*len(imageVariantSizes))
+			}
+			for _, f := range files {
+				decoded, kind, err := image.Decode(bytes.NewReader(f.data))
+				if err != nil {
+					t.Fatalf("variante %s illisible: %v", f.name, err)
+				}
+				if "image/"+kind != f.contentType {
+					t.Errorf("variante %s au format %s, attendu %s", f.name, kind, f.contentType)
+				}
+				if got := decoded.Bounds(); got.Dx() != 40 || got.Dy() != 30 {
+					t.Errorf("variante %s de %dx%d, attendu 40x30", f.name, got.Dx(), got.Dy())
+				}
+			}
+		})
+	}
+}
+
+func TestProcessUploadedImageRejectsOversizedHeader(t *testing.T) {
+	data, err := os.ReadFile("testdata/sample.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// En-tête IHDR modifié pour déclarer 10000x10000 pixels
+	binary.BigEndian.PutUint32(data[16:20], 10000)
+	binary.BigEndian.PutUint32(data[20:24], 10000)
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+	if _, _, err := processUploadedImage(data); err == nil {
+		t.Fatal("une image de 100 mégapixels doit être refusée")
+	}
+}
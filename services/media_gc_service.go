@@ -0,0 +1,245 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"kivendi-backend/config"
+	"kivendi-backend/models"
+)
+
+// mediaGCPrefixes sont les dossiers du stockage alimentés par l'application ; le reste du stockage n'est jamais parcouru
+var mediaGCPrefixes = []string{"ads/", "avatars/", "chat-images/"}
+
+const (
+	// DefaultMediaGCGraceHours est l'âge minimal d'un fichier orphelin avant sa suppression. Les fichiers sont
+	// uploadés avant l'écriture en base (création d'annonce, import) : un fichier récent peut ne pas encore être référencé.
+	DefaultMediaGCGraceHours = 72
+	// MinMediaGCGraceHours est le délai de grâce minimal accepté
+	MinMediaGCGraceHours = 1
+
+	// mediaGCMaxReportedOrphans limite le nombre d'orphelins détaillés dans un rapport (les compteurs restent exacts)
+	mediaGCMaxReportedOrphans = 1000
+	// mediaGCStaleRun au-delà duquel un passage resté "running" est considéré comme interrompu (redémarrage)
+	mediaGCStaleRun = 6 * time.Hour
+	// mediaGCMaxLoggedUnrecognized limite le nombre d'URLs non reconnues détaillées dans les logs
+	mediaGCMaxLoggedUnrecognized = 20
+)
+
+// ErrMediaGCAlreadyRunning est renvoyée lorsqu'un passage du nettoyage est déjà en cours
+var ErrMediaGCAlreadyRunning = errors.New("un nettoyage des fichiers est déjà en cours")
+
+// MediaGCConfigFromEnv lit la configuration du job planifié : MEDIA_GC_DRY_RUN (simulation, activée par défaut)
+// et MEDIA_GC_GRACE_HOURS (délai de grâce en heures, 72 par défaut).
+func MediaGCConfigFromEnv() (dryRun bool, graceHours int) {
+	dryRun = true
+	if v := os.Getenv("MEDIA_GC_DRY_RUN"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Printf("MEDIA_GC_DRY_RUN invalide (%q), simulation conservée", v)
+		} else {
+			dryRun = parsed
+		}
+	}
+
+	graceHours = DefaultMediaGCGraceHours
+	if v := os.Getenv("MEDIA_GC_GRACE_HOURS"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < MinMediaGCGraceHours {
+			log.Printf("MEDIA_GC_GRACE_HOURS invalide (%q), délai de grâce de %d heures conservé", v, graceHours)
+		} else {
+			graceHours = parsed
+		}
+	}
+	return dryRun, graceHours
+}
+
+// StartMediaGCRun enregistre un nouveau passage du nettoyage et renvoie son ID.
+// Un seul passage peut être en cours à la fois (ErrMediaGCAlreadyRunning).
+func StartMediaGCRun(ctx context.Context, dryRun bool, graceHours int, triggeredBy *int) (int, error) {
+	// Un passage interrompu par un redémarrage ne doit pas bloquer les suivants
+	_, err := config.DB.ExecContext(ctx, `
+		UPDATE media_gc_runs SET status = $1, error_message = 'Passage interrompu', finished_at = NOW()
+		WHERE status = $2 AND started_at < NOW() - make_interval(secs => $3)
+	`, models.MediaGCStatusFailed, models.MediaGCStatusRunning, mediaGCStaleRun.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	var runID int
+	err = config.DB.QueryRowContext(ctx, `
+		INSERT INTO media_gc_runs (status, dry_run, triggered_by, grace_period_hours)
+		SELECT $1::varchar, $2::boolean, $3::integer, $4::integer
+		WHERE NOT EXISTS (SELECT 1 FROM media_gc_runs WHERE status = $1)
+		RETURNING id
+	`, models.MediaGCStatusRunning, dryRun, triggeredBy, graceHours).Scan(&runID)
+	if err == sql.ErrNoRows {
+		return 0, ErrMediaGCAlreadyRunning
+	}
+	return runID, err
+}
+
+// RunMediaGC exécute un passage enregistré par StartMediaGCRun : les URLs référencées en base sont relevées
+// d'abord, puis le stockage est parcouru ; les fichiers non référencés plus anciens que le délai de grâce sont
+// supprimés (ou seulement listés en simulation). Le rapport est enregistré dans media_gc_runs.
+func (a *MediaService) RunMediaGC(ctx context.Context, runID int) {
+	var run models.MediaGCRun
+	err := config.DB.QueryRowContext(ctx,
+		"SELECT dry_run, grace_period_hours FROM media_gc_runs WHERE id = $1", runID,
+	).Scan(&run.DryRun, &run.GracePeriodHours)
+	if err != nil {
+		log.Printf("Erreur lors de la lecture du passage de nettoyage %d: %v", runID, err)
+		return
+	}
+
+	run.Orphans = []models.MediaGCOrphan{}
+	runErr := a.collectOrphanedMedia(ctx, &run)
+
+	status := models.MediaGCStatusCompleted
+	var errorMessage *string
+	if runErr != nil {
+		log.Printf("Erreur lors du passage de nettoyage %d: %v", runID, runErr)
+		status = models.MediaGCStatusFailed
+		msg := runErr.Error()
+		errorMessage = &msg
+	}
+
+	orphansJSON, err := json.Marshal(run.Orphans)
+	if err != nil {
+		orphansJSON = []byte("[]")
+	}
+	_, err = config.DB.ExecContext(ctx, `
+		UPDATE media_gc_runs SET status = $2, scanned_count = $3, scanned_bytes = $4, referenced_count = $5,
+			orphan_count = $6, orphan_bytes = $7, deleted_count = $8, failed_count = $9, orphans = $10,
+			error_message = $11, finished_at = NOW()
+		WHERE id = $1
+	`, runID, status, run.ScannedCount, run.ScannedBytes, run.ReferencedCount,
+		run.OrphanCount, run.OrphanBytes, run.DeletedCount, run.FailedCount, string(orphansJSON), errorMessage)
+	if err != nil {
+		log.Printf("Erreur lors de l'enregistrement du rapport de nettoyage %d: %v", runID, err)
+		return
+	}
+
+	log.Printf("Nettoyage des fichiers %d terminé (simulation: %t): %d fichiers parcourus, %d orphelins (%d octets), %d supprimés, %d échecs",
+		runID, run.DryRun, run.ScannedCount, run.OrphanCount, run.OrphanBytes, run.DeletedCount, run.FailedCount)
+}
+
+// collectOrphanedMedia parcourt le stockage et remplit les compteurs du rapport
+func (a *MediaService) collectOrphanedMedia(ctx context.Context, run *models.MediaGCRun) error {
+	referenced, referencedURLs, err := a.referencedMediaKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("erreur lors du relevé des fichiers référencés: %v", err)
+	}
+	run.ReferencedCount = referencedURLs
+
+	cutoff := time.Now().Add(-time.Duration(run.GracePeriodHours) * time.Hour)
+	for _, prefix := range mediaGCPrefixes {
+		err := a.storage.List(ctx, prefix, func(obj StoredObject) error {
+			run.ScannedCount++
+			run.ScannedBytes += obj.Size
+			if referenced[obj.Key] || obj.LastModified.After(cutoff) {
+				return nil
+			}
+
+			run.OrphanCount++
+			run.OrphanBytes += obj.Size
+			orphan := models.MediaGCOrphan{Key: obj.Key, Size: obj.Size, LastModified: obj.LastModified}
+			if !run.DryRun {
+				if err := a.storage.Delete(ctx, obj.Key); err != nil {
+					log.Printf("Erreur lors de la suppression du fichier orphelin %s: %v", obj.Key, err)
+					run.FailedCount++
+				} else {
+					run.DeletedCount++
+					orphan.Deleted = true
+				}
+			}
+			if len(run.Orphans) < mediaGCMaxReportedOrphans {
+				run.Orphans = append(run.Orphans, orphan)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("erreur lors du parcours du stockage (%s): %v", prefix, err)
+		}
+	}
+	return nil
+}
+
+// referencedMediaKeys renvoie les clés de stockage de tous les fichiers référencés en base (toutes variantes
+// comprises) et le nombre d'URLs distinctes. Une URL que le backend ne reconnaît pas (ancien format d'URL du
+// bucket ou de la région...) est considérée comme référençant la clé lue dans son chemin dès qu'il contient un
+// dossier parcouru : ses fichiers ne sont jamais pris pour des orphelins. Les autres URLs (extérieures) sont ignorées.
+func (a *MediaService) referencedMediaKeys(ctx context.Context) (map[string]bool, int, error) {
+	rows, err := config.DB.QueryContext(ctx, `
+		SELECT DISTINCT url FROM (
+			SELECT unnest(images) AS url FROM ads
+			UNION ALL SELECT unnest(images) FROM ad_drafts
+			UNION ALL SELECT unnest(images) FROM ad_revisions
+			UNION ALL SELECT unnest(image_urls) FROM messages
+			UNION ALL SELECT avatar_url FROM users
+			UNION ALL SELECT avatar_url FROM admins
+			UNION ALL SELECT unnest(ARRAY[hero_image_url, mission_image_url, vision_image_url]) FROM about_pages
+			UNION ALL SELECT unnest(ARRAY[logo_url, favicon_url, logo_dark_url]) FROM app_settings
+		) refs
+		WHERE url IS NOT NULL AND url <> ''
+	`)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	keys := make(map[string]bool)
+	count, unrecognized := 0, 0
+	for rows.Next() {
+		var fileURL string
+		if err := rows.Scan(&fileURL); err != nil {
+			return nil, 0, err
+		}
+		count++
+		key, ok := a.storage.KeyFromURL(fileURL)
+		if !ok {
+			if key, ok = mediaKeyFromUnrecognizedURL(fileURL); !ok {
+				continue
+			}
+			unrecognized++
+			if unrecognized <= mediaGCMaxLoggedUnrecognized {
+				log.Printf("Nettoyage des fichiers: URL au format non reconnu, clé %s conservée: %s", key, fileURL)
+			}
+		}
+		for _, variantKey := range imageVariantKeys(key) {
+			keys[variantKey] = true
+		}
+	}
+	if unrecognized > 0 {
+		log.Printf("Nettoyage des fichiers: %d URLs au format non reconnu traitées comme référencées", unrecognized)
+	}
+	return keys, count, rows.Err()
+}
+
+// mediaKeyFromUnrecognizedURL lit la clé de stockage dans le chemin d'une URL non reconnue par le backend :
+// la clé commence au premier dossier parcouru par le nettoyage (ex. .../ads/<uuid>/full.jpg).
+func mediaKeyFromUnrecognizedURL(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+	best := -1
+	for _, prefix := range mediaGCPrefixes {
+		if i := strings.Index(u.Path, "/"+prefix); i >= 0 && (best < 0 || i < best) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return "", false
+	}
+	return u.Path[best+1:], true
+}
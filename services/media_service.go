@@ -5,54 +5,44 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"image"
 	"log"
 	"mime"
 	"mime/multipart"
-	"os"
-	"strings"
+	"net/http"
+
+	"kivendi-backend/config"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-type AWSService struct {
-	s3Client *s3.Client
-	bucket   string
+// MediaService regroupe les opérations sur les fichiers uploadés (traitement des images, upload,
+// suppression) au-dessus du backend de stockage configuré.
+type MediaService struct {
+	storage Storage
 }
 
-func NewAWSService() (*AWSService, error) {
-	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
-	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
-	region := os.Getenv("AWS_REGION")
-	bucket := os.Getenv("S3_BUCKET_NAME")
+func NewMediaService(storage Storage) *MediaService {
+	return &MediaService{storage: storage}
+}
 
-	if accessKey == "" || secretKey == "" || region == "" || bucket == "" {
-		return nil, fmt.Errorf("variables d'environnement AWS manquantes")
-	}
+// Storage renvoie le backend de stockage utilisé
+func (a *MediaService) Storage() Storage {
+	return a.storage
+}
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
-			accessKey, secretKey, "",
-		)),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("erreur de configuration AWS: %v", err)
+// FileServer renvoie le handler HTTP servant les fichiers lorsque l'API les héberge elle-même
+// (stockage local), ou nil lorsque le backend les sert directement (S3)
+func (a *MediaService) FileServer() http.Handler {
+	if local, ok := a.storage.(*LocalStorage); ok {
+		return local.FileServer()
 	}
-
-	s3Client := s3.NewFromConfig(cfg)
-
-	return &AWSService{
-		s3Client: s3Client,
-		bucket:   bucket,
-	}, nil
+	return nil
 }
 
-// UploadBase64Images gère le téléchargement de plusieurs images base64 vers S3.
-func (a *AWSService) UploadBase64Images(base64Images []string) ([]string, error) {
+// UploadBase64Images gère le téléchargement de plusieurs images base64 vers le stockage.
+func (a *MediaService) UploadBase64Images(base64Images []string) ([]string, error) {
 	// Add this log statement to see if the function received images
 	log.Printf("Received %d images to upload", len(base64Images))
 
@@ -73,13 +63,10 @@ func (a *AWSService) UploadBase64Images(base64Images []string) ([]string, error)
 			continue
 		}
 
-		// Générer un nom de fichier unique
-		fileName := fmt.Sprintf("chat-images/%s%s", uuid.New().String(), getFileExtension(contentType))
-
-		// Upload vers S3
-		imageUrl, err := a.uploadToS3(fileName, imageData, contentType)
+		// Traiter l'image (métadonnées, orientation, tailles) et uploader ses variantes
+		imageUrl, _, err := a.uploadProcessedImage("chat-images", imageData)
 		if err != nil {
-			log.Printf("Erreur lors de l'upload vers S3: %v", err)
+			log.Printf("Erreur lors de l'upload vers le stockage: %v", err)
 			continue
 		}
 
@@ -89,8 +76,8 @@ func (a *AWSService) UploadBase64Images(base64Images []string) ([]string, error)
 	return imageUrls, nil
 }
 
-// UploadAvatar gère le téléchargement d'un seul avatar base64 vers S3.
-func (a *AWSService) UploadAvatar(base64Image string) (string, error) {
+// UploadAvatar gère le téléchargement d'un seul avatar base64 vers le stockage.
+func (a *MediaService) UploadAvatar(base64Image string) (string, error) {
 	if base64Image == "" {
 		return "", fmt.Errorf("données d'image base64 vides")
 	}
@@ -109,36 +96,41 @@ func (a *AWSService) UploadAvatar(base64Image string) (string, error) {
 		return "", fmt.Errorf("type d'image non supporté")
 	}
 
-	// Générer un nom de fichier unique dans un dossier 'avatars'
-	fileName := fmt.Sprintf("avatars/%s%s", uuid.New().String(), getFileExtension(contentType))
-
-	// Upload vers S3
-	imageUrl, err := a.uploadToS3(fileName, imageData, contentType)
+	// Traiter l'image (métadonnées, orientation, tailles) et uploader ses variantes dans le dossier 'avatars'
+	imageUrl, _, err := a.uploadProcessedImage("avatars", imageData)
 	if err != nil {
-		log.Printf("Erreur lors de l'upload de l'avatar vers S3: %v", err)
-		return "", fmt.Errorf("échec de l'upload vers S3")
+		log.Printf("Erreur lors de l'upload de l'avatar vers le stockage: %v", err)
+		return "", fmt.Errorf("échec de l'upload de l'avatar")
 	}
 
 	return imageUrl, nil
 }
 
-func (a *AWSService) uploadToS3(fileName string, data []byte, contentType string) (string, error) {
-	_, err := a.s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:      aws.String(a.bucket),
-		Key:         aws.String(fileName),
-		Body:        bytes.NewReader(data),
-		ContentType: aws.String(contentType),
-	})
-
+// uploadProcessedImage traite une image (voir processUploadedImage) et uploade toutes ses variantes
+// sous <folder>/<uuid>/. Renvoie l'URL de la variante full.jpg, celle enregistrée en base, et la miniature décodée.
+func (a *MediaService) uploadProcessedImage(folder string, imageData []byte) (string, image.Image, error) {
+	files, thumbnail, err := processUploadedImage(imageData)
 	if err != nil {
-		return "", fmt.Errorf("erreur lors de l'upload S3: %v", err)
+		return "", nil, err
 	}
 
-	// Construire l'URL publique
-	imageUrl := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s",
-		a.bucket, os.Getenv("AWS_REGION"), fileName)
-
-	return imageUrl, nil
+	base := fmt.Sprintf("%s/%s", folder, uuid.New().String())
+	var fullURL string
+	var uploaded []string
+	for _, f := range files {
+		fileURL, err := a.storage.Put(context.TODO(), base+"/"+f.name, f.data, f.contentType)
+		if err != nil {
+			if len(uploaded) > 0 {
+				a.DeleteImages(uploaded)
+			}
+			return "", nil, err
+		}
+		uploaded = append(uploaded, fileURL)
+		if f.name == ImageVariantFull+".jpg" {
+			fullURL = fileURL
+		}
+	}
+	return fullURL, thumbnail, nil
 }
 
 func detectImageContentType(data []byte) string {
@@ -171,27 +163,25 @@ func detectImageContentType(data []byte) string {
 	return ""
 }
 
-// DeleteImages supprime plusieurs images de S3 en utilisant leurs URLs
-func (a *AWSService) DeleteImages(imageUrls []string) error {
-	region := os.Getenv("AWS_REGION")
-	bucketName := a.bucket
-
+// DeleteImages supprime plusieurs images du stockage en utilisant leurs URLs
+func (a *MediaService) DeleteImages(imageUrls []string) error {
 	for _, imageUrl := range imageUrls {
 		// Extraire la clé (nom du fichier) depuis l'URL
-		key := extractKeyFromUrl(imageUrl, bucketName, region)
-		if key == "" {
-			log.Printf("Impossible d'extraire la clé depuis l'URL: %s", imageUrl)
+		key, ok := a.storage.KeyFromURL(imageUrl)
+		if !ok {
+			log.Printf("Format d'URL non reconnu, impossible d'extraire la clé: %s", imageUrl)
 			continue
 		}
 
-		// Supprimer l'objet de S3
-		_, err := a.s3Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
-			Bucket: aws.String(bucketName),
-			Key:    aws.String(key),
-		})
-
-		if err != nil {
-			log.Printf("Erreur lors de la suppression de l'image %s: %v", imageUrl, err)
+		// Supprimer le fichier (et toutes les variantes d'une image traitée)
+		failed := false
+		for _, variantKey := range imageVariantKeys(key) {
+			if err := a.storage.Delete(context.TODO(), variantKey); err != nil {
+				log.Printf("Erreur lors de la suppression de l'image %s (%s): %v", imageUrl, variantKey, err)
+				failed = true
+			}
+		}
+		if failed {
 			// Continuer même si une image ne peut pas être supprimée
 			continue
 		}
@@ -199,31 +189,17 @@ func (a *AWSService) DeleteImages(imageUrls []string) error {
 		log.Printf("Image supprimée avec succès: %s", imageUrl)
 	}
 
-	return nil
-}
-
-// extractKeyFromUrl extrait la clé (nom du fichier) depuis une URL S3
-func extractKeyFromUrl(imageUrl, bucketName, region string) string {
-	// Format attendu: https://bucketname.s3.region.amazonaws.com/path/to/file.jpg
-	expectedPrefix := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/", bucketName, region)
-
-	if strings.HasPrefix(imageUrl, expectedPrefix) {
-		return strings.TrimPrefix(imageUrl, expectedPrefix)
-	}
-
-	// Format alternatif: https://s3.region.amazonaws.com/bucketname/path/to/file.jpg
-	alternativePrefix := fmt.Sprintf("https://s3.%s.amazonaws.com/%s/", region, bucketName)
-	if strings.HasPrefix(imageUrl, alternativePrefix) {
-		return strings.TrimPrefix(imageUrl, alternativePrefix)
+	// Les empreintes des images supprimées ne doivent plus participer à la détection des doublons
+	if _, err := config.DB.Exec("DELETE FROM ad_image_hashes WHERE image_url = ANY($1)", pq.Array(imageUrls)); err != nil {
+		log.Printf("Erreur lors de la suppression des empreintes d'images: %v", err)
 	}
 
-	log.Printf("Format d'URL non reconnu: %s", imageUrl)
-	return ""
+	return nil
 }
 
-// UploadAdImages gère le téléchargement de plusieurs images pour les annonces vers S3.
+// UploadAdImages gère le téléchargement de plusieurs images pour les annonces vers le stockage.
 // Les images sont stockées dans le dossier 'ads/'
-func (a *AWSService) UploadAdImages(base64Images []string) ([]string, error) {
+func (a *MediaService) UploadAdImages(base64Images []string) ([]string, error) {
 	log.Printf("Réception de %d images d'annonce à uploader", len(base64Images))
 
 	var imageUrls []string
@@ -243,18 +219,18 @@ func (a *AWSService) UploadAdImages(base64Images []string) ([]string, error) {
 			continue
 		}
 
-		// Générer un nom de fichier unique dans le dossier 'ads'
-		fileName := fmt.Sprintf("ads/%s%s", uuid.New().String(), getFileExtension(contentType))
-
-		// Upload vers S3
-		imageUrl, err := a.uploadToS3(fileName, imageData, contentType)
+		// Traiter l'image (métadonnées, orientation, tailles) et uploader ses variantes dans le dossier 'ads'
+		imageUrl, thumbnail, err := a.uploadProcessedImage("ads", imageData)
 		if err != nil {
-			log.Printf("Erreur lors de l'upload de l'image %d vers S3: %v", i+1, err)
+			log.Printf("Erreur lors de l'upload de l'image %d vers le stockage: %v", i+1, err)
 			continue
 		}
 
 		log.Printf("Image %d uploadée avec succès: %s", i+1, imageUrl)
 		imageUrls = append(imageUrls, imageUrl)
+
+		// Empreinte perceptuelle pour la détection des doublons
+		RecordAdImageHash(imageUrl, thumbnail)
 	}
 
 	if len(imageUrls) == 0 {
@@ -266,7 +242,7 @@ func (a *AWSService) UploadAdImages(base64Images []string) ([]string, error) {
 }
 
 // UploadAdMultipartImages gère le téléchargement d'images multipart pour les annonces
-func (a *AWSService) UploadAdMultipartImages(files []*multipart.FileHeader) ([]string, error) {
+func (a *MediaService) UploadAdMultipartImages(files []*multipart.FileHeader) ([]string, error) {
 	log.Printf("Réception de %d fichiers multipart à uploader", len(files))
 
 	var imageUrls []string
@@ -295,18 +271,18 @@ func (a *AWSService) UploadAdMultipartImages(files []*multipart.FileHeader) ([]s
 			continue
 		}
 
-		// Générer un nom de fichier unique dans le dossier 'ads'
-		fileName := fmt.Sprintf("ads/%s%s", uuid.New().String(), getFileExtension(contentType))
-
-		// Upload vers S3
-		imageUrl, err := a.uploadToS3(fileName, imageData, contentType)
+		// Traiter l'image (métadonnées, orientation, tailles) et uploader ses variantes dans le dossier 'ads'
+		imageUrl, thumbnail, err := a.uploadProcessedImage("ads", imageData)
 		if err != nil {
-			log.Printf("Erreur lors de l'upload du fichier %d vers S3: %v", i+1, err)
+			log.Printf("Erreur lors de l'upload du fichier %d vers le stockage: %v", i+1, err)
 			continue
 		}
 
 		log.Printf("Fichier %d uploadé avec succès: %s", i+1, imageUrl)
 		imageUrls = append(imageUrls, imageUrl)
+
+		// Empreinte perceptuelle pour la détection des doublons
+		RecordAdImageHash(imageUrl, thumbnail)
 	}
 
 	if len(imageUrls) == 0 {
@@ -317,6 +293,22 @@ func (a *AWSService) UploadAdMultipartImages(files []*multipart.FileHeader) ([]s
 	return imageUrls, nil
 }
 
+// UploadAdImageData upload une image (octets bruts) dans le dossier 'ads' après vérification de son type
+func (a *MediaService) UploadAdImageData(imageData []byte) (string, error) {
+	if detectImageContentType(imageData) == "" {
+		return "", fmt.Errorf("type d'image non supporté")
+	}
+
+	imageUrl, thumbnail, err := a.uploadProcessedImage("ads", imageData)
+	if err != nil {
+		return "", err
+	}
+
+	// Empreinte perceptuelle pour la détection des doublons
+	RecordAdImageHash(imageUrl, thumbnail)
+	return imageUrl, nil
+}
+
 func getFileExtension(contentType string) string {
 	ext, err := mime.ExtensionsByType(contentType)
 	if err != nil || len(ext) == 0 {
@@ -387,6 +387,80 @@ func (s *PushService) SendAdDeletedPush(ctx context.Context, recipientID int, ad
 	}()
 }
 
+// SendSavedSearchAlertPush envoie une notif push pour de nouvelles annonces correspondant à une recherche sauvegardée.
+// adID et adTitle décrivent la première annonce trouvée (utilisée seule si count == 1).
+func (s *PushService) SendSavedSearchAlertPush(ctx context.Context, recipientID int, savedSearchID int, searchName string, count int, adID int, adTitle string) {
+	title := fmt.Sprintf("Nouvelles annonces pour « %s »", searchName)
+	body := fmt.Sprintf("%d nouvelles annonces correspondent à votre recherche.", count)
+	if count == 1 {
+		title = fmt.Sprintf("Nouvelle annonce pour « %s »", searchName)
+		body = adTitle
+	}
+	data := map[string]string{
+		"savedSearchId": fmt.Sprintf("%d", savedSearchID),
+		"adId":          fmt.Sprintf("%d", adID),
+		"count":         fmt.Sprintf("%d", count),
+	}
+
+	go func() {
+		err := s.sendGenericPush(context.Background(), recipientID, title, body, "saved_search_alert", data)
+		if err != nil {
+			log.Printf("[Push] Erreur envoi notif 'saved_search_alert' pour user %d: %v", recipientID, err)
+		}
+	}()
+}
+
+// SendAdExpiringSoonPush envoie une notif push rappelant qu'une annonce expire bientôt.
+func (s *PushService) SendAdExpiringSoonPush(ctx context.Context, recipientID int, adTitle string, adID int, daysLeft int) {
+	title := "Votre annonce expire bientôt"
+	body := fmt.Sprintf("Votre annonce « %s » expire dans %d jour(s). Renouvelez-la pour qu'elle reste visible.", adTitle, daysLeft)
+	data := map[string]string{
+		"adId":     fmt.Sprintf("%d", adID),
+		"daysLeft": fmt.Sprintf("%d", daysLeft),
+	}
+
+	go func() {
+		err := s.sendGenericPush(context.Background(), recipientID, title, body, "ad_expiring_soon", data)
+		if err != nil {
+			log.Printf("[Push] Erreur envoi notif 'ad_expiring_soon' pour user %d: %v", recipientID, err)
+		}
+	}()
+}
+
+// SendAdExpiredPush envoie une notif push pour une annonce arrivée à expiration.
+func (s *PushService) SendAdExpiredPush(ctx context.Context, recipientID int, adTitle string, adID int) {
+	title := "Votre annonce a expiré"
+	body := fmt.Sprintf("Votre annonce « %s » n'est plus visible. Renouvelez-la depuis « Mes annonces ».", adTitle)
+	data := map[string]string{
+		"adId": fmt.Sprintf("%d", adID),
+	}
+
+	go func() {
+		err := s.sendGenericPush(context.Background(), recipientID, title, body, "ad_expired", data)
+		if err != nil {
+			log.Printf("[Push] Erreur envoi notif 'ad_expired' pour user %d: %v", recipientID, err)
+		}
+	}()
+}
+
+// SendPriceDropPush prévient un utilisateur de la baisse de prix d'une annonce qu'il a en favori.
+func (s *PushService) SendPriceDropPush(ctx context.Context, recipientID int, adTitle string, adID int, oldPrice, newPrice float64) {
+	title := "Baisse de prix sur un de vos favoris"
+	body := fmt.Sprintf("« %s » passe de %.0f FCFA à %.0f FCFA.", adTitle, oldPrice, newPrice)
+	data := map[string]string{
+		"adId":     fmt.Sprintf("%d", adID),
+		"oldPrice": fmt.Sprintf("%.0f", oldPrice),
+		"newPrice": fmt.Sprintf("%.0f", newPrice),
+	}
+
+	go func() {
+		err := s.sendGenericPush(context.Background(), recipientID, title, body, "price_drop", data)
+		if err != nil {
+			log.Printf("[Push] Erreur envoi notif 'price_drop' pour user %d: %v", recipientID, err)
+		}
+	}()
+}
+
 // ============================================================================
 
 // getDeviceTokens récupère tous les tokens actifs pour un utilisateur
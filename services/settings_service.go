@@ -0,0 +1,97 @@
+package services
+
+import (
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"kivendi-backend/config"
+)
+
+// settingsCacheTTL est la durée pendant laquelle les paramètres d'annonces restent en cache
+const settingsCacheTTL = 1 * time.Minute
+
+// DefaultMaxAdDurationDays est la durée de publication (jours) appliquée lorsque max_ad_duration_days n'est pas renseigné
+const DefaultMaxAdDurationDays = 90
+
+// AdSettings regroupe les paramètres de app_settings appliqués aux annonces (modération, durée, alertes de prix, doublons, signalements)
+type AdSettings struct {
+	AutoValidateAds       bool
+	MaxImagesPerAd        int
+	MaxAdDurationDays     int
+	AdExpiryReminderDays  int
+	PriceDropAlertPercent int
+	BlockDuplicateAds     bool
+	AdReportHideThreshold int
+}
+
+// defaultAdSettings reprend les valeurs par défaut de la table app_settings
+var defaultAdSettings = AdSettings{
+	AutoValidateAds:       false,
+	MaxImagesPerAd:        8,
+	MaxAdDurationDays:     DefaultMaxAdDurationDays,
+	AdExpiryReminderDays:  3,
+	PriceDropAlertPercent: 5,
+	BlockDuplicateAds:     false,
+	AdReportHideThreshold: 3,
+}
+
+var (
+	adSettingsMu       sync.RWMutex
+	adSettingsCache    *AdSettings
+	adSettingsCachedAt time.Time
+)
+
+// GetAdSettings renvoie les paramètres d'annonces depuis un cache mémoire rafraîchi toutes les minutes.
+// En cas d'erreur de lecture, les dernières valeurs connues (ou les valeurs par défaut) sont renvoyées.
+func GetAdSettings() AdSettings {
+	adSettingsMu.RLock()
+	if adSettingsCache != nil && time.Since(adSettingsCachedAt) < settingsCacheTTL {
+		settings := *adSettingsCache
+		adSettingsMu.RUnlock()
+		return settings
+	}
+	adSettingsMu.RUnlock()
+
+	adSettingsMu.Lock()
+	defer adSettingsMu.Unlock()
+
+	// Un autre appel a pu rafraîchir le cache entre-temps
+	if adSettingsCache != nil && time.Since(adSettingsCachedAt) < settingsCacheTTL {
+		return *adSettingsCache
+	}
+
+	settings := defaultAdSettings
+	err := config.DB.QueryRow(`
+		SELECT
+			COALESCE(auto_validate_ads, false),
+			COALESCE(max_images_per_ad, 8),
+			COALESCE(max_ad_duration_days, `+strconv.Itoa(DefaultMaxAdDurationDays)+`),
+			COALESCE(ad_expiry_reminder_days, 3),
+			COALESCE(price_drop_alert_percent, 5),
+			COALESCE(block_duplicate_ads, false),
+			COALESCE(ad_report_hide_threshold, 3)
+		FROM app_settings
+		ORDER BY id DESC
+		LIMIT 1
+	`).Scan(&settings.AutoValidateAds, &settings.MaxImagesPerAd, &settings.MaxAdDurationDays, &settings.AdExpiryReminderDays, &settings.PriceDropAlertPercent, &settings.BlockDuplicateAds, &settings.AdReportHideThreshold)
+	if err != nil {
+		log.Printf("Erreur lors de la lecture des paramètres d'annonces: %v", err)
+		if adSettingsCache != nil {
+			return *adSettingsCache
+		}
+		return defaultAdSettings
+	}
+
+	adSettingsCache = &settings
+	adSettingsCachedAt = time.Now()
+	return settings
+}
+
+// InvalidateAdSettings vide le cache des paramètres (à appeler après une modification de app_settings)
+func InvalidateAdSettings() {
+	adSettingsMu.Lock()
+	adSettingsCache = nil
+	adSettingsMu.Unlock()
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Backends de stockage disponibles (variable d'environnement STORAGE_BACKEND)
+const (
+	StorageBackendS3    = "s3"
+	StorageBackendLocal = "local"
+)
+
+// LocalMediaPathPrefix est le chemin sous lequel l'API sert les fichiers du stockage local
+const LocalMediaPathPrefix = "/media/"
+
+// StoredObject décrit un fichier présent dans le stockage
+type StoredObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// Storage abstrait le stockage des fichiers uploadés (images d'annonces, avatars, images du chat).
+// Les clés sont des chemins relatifs séparés par des "/" (ex. "ads/<uuid>/full.jpg").
+type Storage interface {
+	// Put enregistre un fichier et renvoie son URL publique
+	Put(ctx context.Context, key string, data []byte, contentType string) (string, error)
+	// Delete supprime un fichier ; supprimer un fichier absent n'est pas une erreur
+	Delete(ctx context.Context, key string) error
+	// URL renvoie l'URL publique d'une clé
+	URL(key string) string
+	// KeyFromURL retrouve la clé d'un fichier à partir de son URL publique
+	KeyFromURL(fileURL string) (string, bool)
+	// List parcourt les fichiers dont la clé commence par prefix
+	List(ctx context.Context, prefix string, fn func(StoredObject) error) error
+}
+
+// NewStorageFromEnv construit le backend de stockage choisi par STORAGE_BACKEND ("s3" par défaut, ou "local")
+func NewStorageFromEnv() (Storage, error) {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_BACKEND")))
+	switch backend {
+	case "", StorageBackendS3:
+		return NewS3Storage()
+	case StorageBackendLocal:
+		dir := os.Getenv("LOCAL_STORAGE_DIR")
+		if dir == "" {
+			dir = "./uploads"
+		}
+		baseURL := os.Getenv("LOCAL_STORAGE_BASE_URL")
+		if baseURL == "" {
+			port := os.Getenv("PORT")
+			if port == "" {
+				port = "8080"
+			}
+			baseURL = "http://localhost:" + port + strings.TrimSuffix(LocalMediaPathPrefix, "/")
+		}
+		return NewLocalStorage(dir, baseURL)
+	default:
+		return nil, fmt.Errorf("backend de stockage inconnu: %q (valeurs possibles: s3, local)", backend)
+	}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStorage stocke les fichiers sur le disque du serveur ; l'API les sert elle-même sous
+// LocalMediaPathPrefix. Prévu pour le développement local et les tests, sans compte AWS.
+type LocalStorage struct {
+	root    string
+	baseURL string
+}
+
+// NewLocalStorage crée le dossier racine si besoin. baseURL est l'URL publique correspondant à
+// LocalMediaPathPrefix (ex. "http://localhost:8080/media").
+func NewLocalStorage(root, baseURL string) (*LocalStorage, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("dossier de stockage invalide: %v", err)
+	}
+	if err := os.MkdirAll(absRoot, 0o755); err != nil {
+		return nil, fmt.Errorf("impossible de créer le dossier de stockage %s: %v", absRoot, err)
+	}
+	return &LocalStorage{root: absRoot, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// filePath convertit une clé en chemin sur le disque, sans jamais sortir du dossier racine
+func (l *LocalStorage) filePath(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" {
+		return "", fmt.Errorf("clé de stockage invalide: %q", key)
+	}
+	return filepath.Join(l.root, filepath.FromSlash(cleaned)), nil
+}
+
+func (l *LocalStorage) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+	p, err := l.filePath(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", fmt.Errorf("erreur lors de la création du dossier %s: %v", filepath.Dir(p), err)
+	}
+
+	// Écriture dans un fichier temporaire puis renommage : un fichier servi n'est jamais incomplet
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("erreur lors de l'écriture du fichier %s: %v", key, err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), p)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("erreur lors de l'écriture du fichier %s: %v", key, err)
+	}
+	return l.URL(key), nil
+}
+
+func (l *LocalStorage) Delete(ctx context.Context, key string) error {
+	p, err := l.filePath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// Supprimer les dossiers devenus vides (ex. ads/<uuid>/ une fois toutes les variantes supprimées)
+	for dir := filepath.Dir(p); dir != l.root && strings.HasPrefix(dir, l.root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (l *LocalStorage) URL(key string) string {
+	return l.baseURL + "/" + strings.TrimPrefix(key, "/")
+}
+
+func (l *LocalStorage) KeyFromURL(fileURL string) (string, bool) {
+	key, ok := strings.CutPrefix(fileURL, l.baseURL+"/")
+	if !ok || key == "" {
+		return "", false
+	}
+	return key, true
+}
+
+func (l *LocalStorage) List(ctx context.Context, prefix string, fn func(StoredObject) error) error {
+	return filepath.WalkDir(l.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(StoredObject{Key: key, Size: info.Size(), LastModified: info.ModTime()})
+	})
+}
+
+// FileServer sert les fichiers stockés (sans listage des dossiers). Les clés contenant un UUID,
+// un fichier n'est jamais modifié : il peut être mis en cache indéfiniment.
+func (l *LocalStorage) FileServer() http.Handler {
+	files := http.StripPrefix(LocalMediaPathPrefix, http.FileServer(http.Dir(l.root)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Storage stocke les fichiers dans un bucket S3 public
+type S3Storage struct {
+	s3Client *s3.Client
+	bucket   string
+	region   string
+}
+
+// NewS3Storage construit le stockage S3 à partir des variables d'environnement AWS
+func NewS3Storage() (*S3Storage, error) {
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	region := os.Getenv("AWS_REGION")
+	bucket := os.Getenv("S3_BUCKET_NAME")
+
+	if accessKey == "" || secretKey == "" || region == "" || bucket == "" {
+		return nil, fmt.Errorf("variables d'environnement AWS manquantes")
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion(region),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			accessKey, secretKey, "",
+		)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("erreur de configuration AWS: %v", err)
+	}
+
+	return &S3Storage{
+		s3Client: s3.NewFromConfig(cfg),
+		bucket:   bucket,
+		region:   region,
+	}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, data []byte, contentType string) (string, error) {
+	_, err := s.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", fmt.Errorf("erreur lors de l'upload S3: %v", err)
+	}
+	return s.URL(key), nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	_, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s *S3Storage) URL(key string) string {
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, s.region, key)
+}
+
+func (s *S3Storage) KeyFromURL(fileURL string) (string, bool) {
+	// Format attendu: https://bucketname.s3.region.amazonaws.com/path/to/file.jpg
+	expectedPrefix := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/", s.bucket, s.region)
+	if key, ok := strings.CutPrefix(fileURL, expectedPrefix); ok && key != "" {
+		return key, true
+	}
+
+	// Format alternatif: https://s3.region.amazonaws.com/bucketname/path/to/file.jpg
+	alternativePrefix := fmt.Sprintf("https://s3.%s.amazonaws.com/%s/", s.region, s.bucket)
+	if key, ok := strings.CutPrefix(fileURL, alternativePrefix); ok && key != "" {
+		return key, true
+	}
+	return "", false
+}
+
+func (s *S3Storage) List(ctx context.Context, prefix string, fn func(StoredObject) error) error {
+	paginator := s3.NewListObjectsV2Paginator(s.s3Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("erreur lors du listage S3: %v", err)
+		}
+		for _, obj := range page.Contents {
+			object := StoredObject{Key: aws.ToString(obj.Key), Size: aws.ToInt64(obj.Size)}
+			if obj.LastModified != nil {
+				object.LastModified = *obj.LastModified
+			}
+			if err := fn(object); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}